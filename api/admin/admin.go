@@ -0,0 +1,208 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"strings"
+	"time"
+
+	"k6-practice/api/handlers"
+	"k6-practice/api/metrics"
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+	"k6-practice/api/problem"
+	"k6-practice/api/security"
+	"k6-practice/api/upstream"
+)
+
+// Config は管理用エンドポイントの設定
+type Config struct {
+	// Token: Authorization: Bearer で送る管理用トークン（空の場合はすべて拒否）
+	Token string
+	// Profiler: 連続プロファイリング（nilの場合は /debug/profiles を提供しない）
+	Profiler *Profiler
+
+	// 以下は管理用API（/admin/...）の操作対象。nilの項目のエンドポイントは提供しない
+	Store       *models.UserStore
+	RateLimiter *middleware.RateLimiter
+	Readiness   *handlers.Readiness
+	Revocations *middleware.TokenRevocations
+	LoginGuard  *handlers.LoginGuard
+	// MFA, APIKeys: ストアの初期化で多要素認証の登録・APIキーも消す
+	MFA         *handlers.MFAStore
+	APIKeys     *handlers.APIKeyStore
+	Connections *ConnTracker
+	Security    *security.Monitor
+	// Upstream: 上流のサーキットブレーカーの確認とリセット
+	Upstream *upstream.Client
+	// Settings: GET /admin/config で返す実効設定（秘密の値は伏せる）
+	Settings any
+}
+
+// Handler は管理用リスナーのハンドラー（診断と管理用API。すべてトークン認証が必要）
+// net/http/pprof はimportすると DefaultServeMux に登録するが、公開側のmuxは router で別に作るため露出しない
+func Handler(cfg Config) http.Handler {
+	mux := http.NewServeMux()
+
+	// 標準のpprof（go tool pprof http://ADMIN_ADDR/debug/pprof/profile?seconds=30）
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// ランタイムの診断
+	mux.HandleFunc("GET /debug/runtime", runtimeStats)
+	mux.HandleFunc("GET /debug/goroutines", goroutines)
+
+	// 連続プロファイリングで保存したプロファイル
+	if p := cfg.Profiler; p != nil {
+		mux.HandleFunc("GET /debug/profiles", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, p.Profiles())
+		})
+		mux.HandleFunc("POST /debug/profiles", func(w http.ResponseWriter, r *http.Request) {
+			captured, err := p.Capture(r.Context(), "manual")
+			if errors.Is(err, ErrCapturing) {
+				problem.Write(w, r, problem.CodeConflict, err.Error())
+				return
+			}
+			if len(captured) == 0 {
+				problem.Write(w, r, problem.CodeInternal, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusCreated, captured)
+		})
+		mux.HandleFunc("GET /debug/profiles/{name}", func(w http.ResponseWriter, r *http.Request) {
+			f, err := p.Open(r.PathValue("name"))
+			if err != nil {
+				problem.Write(w, r, problem.CodeNotFound, "profile not found")
+				return
+			}
+			defer f.Close()
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+r.PathValue("name")+`"`)
+			io.Copy(w, f)
+		})
+	}
+
+	// 管理用API
+	(&api{
+		store:       cfg.Store,
+		rateLimiter: cfg.RateLimiter,
+		readiness:   cfg.Readiness,
+		revocations: cfg.Revocations,
+		loginGuard:  cfg.LoginGuard,
+		mfa:         cfg.MFA,
+		apiKeys:     cfg.APIKeys,
+		conns:       cfg.Connections,
+		upstream:    cfg.Upstream,
+		security:    cfg.Security,
+		settings:    cfg.Settings,
+	}).register(mux)
+
+	return requireToken(cfg.Token, mux)
+}
+
+// requireToken は Authorization: Bearer のトークンを定数時間で比較する
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			middleware.LogSecurityEvent(middleware.EventUnauthorized, r, "invalid admin token")
+			problem.Write(w, r, problem.CodeUnauthorized, "invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RuntimeStats はランタイムの状態（GET /debug/runtime）
+type RuntimeStats struct {
+	GoVersion  string      `json:"go_version"`
+	NumCPU     int         `json:"num_cpu"`
+	GOMAXPROCS int         `json:"gomaxprocs"`
+	Goroutines int         `json:"goroutines"`
+	InFlight   int64       `json:"in_flight"`
+	Memory     MemoryStats `json:"memory"`
+	GC         GCStats     `json:"gc"`
+}
+
+// MemoryStats はヒープとスタックの使用量（バイト）
+type MemoryStats struct {
+	HeapAlloc   uint64 `json:"heap_alloc"`
+	HeapInuse   uint64 `json:"heap_inuse"`
+	HeapObjects uint64 `json:"heap_objects"`
+	StackInuse  uint64 `json:"stack_inuse"`
+	Sys         uint64 `json:"sys"`
+	TotalAlloc  uint64 `json:"total_alloc"`
+}
+
+// GCStats はGCの回数と停止時間
+type GCStats struct {
+	NumGC         int64      `json:"num_gc"`
+	LastGC        *time.Time `json:"last_gc,omitempty"`
+	NextGC        uint64     `json:"next_gc"`
+	CPUFraction   float64    `json:"cpu_fraction"`
+	PauseTotalMs  float64    `json:"pause_total_ms"`
+	PauseMedianMs float64    `json:"pause_median_ms"`
+	PauseMaxMs    float64    `json:"pause_max_ms"`
+}
+
+func runtimeStats(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	// 最小・25%・50%・75%・最大
+	gc := debug.GCStats{PauseQuantiles: make([]time.Duration, 5)}
+	debug.ReadGCStats(&gc)
+
+	stats := RuntimeStats{
+		GoVersion:  runtime.Version(),
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Goroutines: runtime.NumGoroutine(),
+		InFlight:   metrics.InFlight(),
+		Memory: MemoryStats{
+			HeapAlloc:   mem.HeapAlloc,
+			HeapInuse:   mem.HeapInuse,
+			HeapObjects: mem.HeapObjects,
+			StackInuse:  mem.StackInuse,
+			Sys:         mem.Sys,
+			TotalAlloc:  mem.TotalAlloc,
+		},
+		GC: GCStats{
+			NumGC:         gc.NumGC,
+			NextGC:        mem.NextGC,
+			CPUFraction:   mem.GCCPUFraction,
+			PauseTotalMs:  milliseconds(gc.PauseTotal),
+			PauseMedianMs: milliseconds(gc.PauseQuantiles[2]),
+			PauseMaxMs:    milliseconds(gc.PauseQuantiles[4]),
+		},
+	}
+	if !gc.LastGC.IsZero() {
+		stats.GC.LastGC = &gc.LastGC
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// goroutines は全ゴルーチンのスタックをテキストで返す（panic時と同じ形式）
+func goroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rpprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
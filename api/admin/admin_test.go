@@ -0,0 +1,122 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testToken = "admin-secret"
+
+func serve(h http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_Auth(t *testing.T) {
+	tests := []struct {
+		name           string
+		configured     string
+		token          string
+		expectedStatus int
+	}{
+		{"valid token", testToken, testToken, http.StatusOK},
+		{"missing token", testToken, "", http.StatusUnauthorized},
+		{"wrong token", testToken, "guess", http.StatusUnauthorized},
+		{"no configured token rejects everything", "", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(Handler(Config{Token: tt.configured}), http.MethodGet, "/debug/runtime", tt.token)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_Diagnostics(t *testing.T) {
+	h := Handler(Config{Token: testToken})
+
+	tests := []struct {
+		name             string
+		path             string
+		expectedContains string
+	}{
+		{"pprof index", "/debug/pprof/", "goroutine"},
+		{"pprof heap", "/debug/pprof/heap?debug=1", "heap profile"},
+		{"goroutine dump", "/debug/goroutines", "goroutine "},
+		{"runtime stats", "/debug/runtime", `"gomaxprocs"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, tt.path, testToken)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q", tt.expectedContains)
+			}
+		})
+	}
+
+	t.Run("runtime stats are populated", func(t *testing.T) {
+		var stats RuntimeStats
+		json.NewDecoder(serve(h, http.MethodGet, "/debug/runtime", testToken).Body).Decode(&stats)
+		if stats.Goroutines == 0 || stats.Memory.HeapAlloc == 0 || stats.GoVersion == "" {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+}
+
+func TestHandler_Profiles(t *testing.T) {
+	p := newTestProfiler(t, ProfilerConfig{CPUDuration: 10 * time.Millisecond})
+	h := Handler(Config{Token: testToken, Profiler: p})
+
+	rec := serve(h, http.MethodPost, "/debug/profiles", testToken)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var captured []Profile
+	json.NewDecoder(rec.Body).Decode(&captured)
+	if len(captured) != 3 || captured[0].Reason != "manual" {
+		t.Fatalf("unexpected profiles %+v", captured)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{"list", "/debug/profiles", http.StatusOK},
+		{"download", "/debug/profiles/" + captured[0].Name, http.StatusOK},
+		{"unknown profile", "/debug/profiles/missing.pprof", http.StatusNotFound},
+		{"path outside the directory", "/debug/profiles/..%2F" + captured[0].Name, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, http.MethodGet, tt.path, testToken)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+
+	t.Run("not served without a profiler", func(t *testing.T) {
+		rec := serve(Handler(Config{Token: testToken}), http.MethodGet, "/debug/profiles", testToken)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,448 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"k6-practice/api/handlers"
+	"k6-practice/api/logging"
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+	"k6-practice/api/problem"
+	"k6-practice/api/security"
+	"k6-practice/api/upstream"
+)
+
+// maxBodySize は管理用APIのリクエストボディの上限
+const maxBodySize = 64 * 1024
+
+// redacted は秘密の値の代わりに返す文字列
+const redacted = "[REDACTED]"
+
+// api は管理用API（/admin/...）の依存
+type api struct {
+	store       *models.UserStore
+	rateLimiter *middleware.RateLimiter
+	readiness   *handlers.Readiness
+	revocations *middleware.TokenRevocations
+	loginGuard  *handlers.LoginGuard
+	mfa         *handlers.MFAStore
+	apiKeys     *handlers.APIKeyStore
+	conns       *ConnTracker
+	upstream    *upstream.Client
+	security    *security.Monitor
+	settings    any
+}
+
+// register は依存が設定されている管理用APIだけを登録する
+func (a *api) register(mux *http.ServeMux) {
+	if a.store != nil {
+		mux.HandleFunc("POST /admin/store/reset", a.resetStore)
+	}
+	if a.rateLimiter != nil {
+		mux.HandleFunc("GET /admin/ratelimit", a.listBuckets)
+		mux.HandleFunc("GET /admin/ratelimit/{client}", a.getBucket)
+		mux.HandleFunc("PUT /admin/ratelimit/{client}", a.setBucket)
+		mux.HandleFunc("DELETE /admin/ratelimit/{client}", a.resetBucket)
+	}
+	if a.revocations != nil {
+		mux.HandleFunc("GET /admin/tokens/revocations", a.listRevocations)
+		mux.HandleFunc("POST /admin/tokens/revoke", a.revokeToken)
+	}
+	if a.loginGuard != nil {
+		mux.HandleFunc("GET /admin/lockouts", a.listLockouts)
+		mux.HandleFunc("DELETE /admin/lockouts/{scope}/{key}", a.unlock)
+	}
+	if a.readiness != nil {
+		mux.HandleFunc("GET /admin/readiness", a.getReadiness)
+		mux.HandleFunc("PUT /admin/readiness", a.setReadiness)
+	}
+	mux.HandleFunc("GET /admin/log-level", a.getLogLevel)
+	mux.HandleFunc("PUT /admin/log-level", a.setLogLevel)
+	if a.conns != nil {
+		mux.HandleFunc("GET /admin/connections", a.listConnections)
+	}
+	if a.upstream != nil {
+		mux.HandleFunc("GET /admin/upstream", a.getUpstream)
+		mux.HandleFunc("POST /admin/upstream/reset", a.resetUpstream)
+	}
+	if a.security != nil {
+		mux.HandleFunc("GET /admin/security-events", a.listSecurityEvents)
+	}
+	if a.settings != nil {
+		mux.HandleFunc("GET /admin/config", a.getConfig)
+	}
+}
+
+// audit は管理操作をログに記録する（ログレベルに関係なく出力する）
+func audit(r *http.Request, action, details string) {
+	log.Printf("[ADMIN] action=%s remote_addr=%s details=%q", action, r.RemoteAddr, details)
+}
+
+// decode はJSONのリクエストボディを読み込む（失敗した場合はレスポンスを書いて false を返す）
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		problem.Write(w, r, problem.CodeInvalidBody, err.Error())
+		return false
+	}
+	return true
+}
+
+// StoreResetResponse はストアの初期化結果
+type StoreResetResponse struct {
+	Users   int    `json:"users"`
+	Version uint64 `json:"version"`
+}
+
+// resetStore は POST /admin/store/reset
+func (a *api) resetStore(w http.ResponseWriter, r *http.Request) {
+	a.store.Reset()
+	// 振り直したユーザーIDに以前の登録が残らないようにする
+	if a.mfa != nil {
+		a.mfa.Reset()
+	}
+	if a.apiKeys != nil {
+		a.apiKeys.Reset()
+	}
+	// 以前のユーザーIDで発行したトークン（OAuthの認可コード・リフレッシュトークンを含む）で別のユーザーとして認証できないようにする
+	if a.revocations != nil {
+		a.revocations.RevokeAll()
+	}
+	if a.loginGuard != nil {
+		a.loginGuard.Reset()
+	}
+	if a.rateLimiter != nil {
+		a.rateLimiter.ResetAll()
+	}
+	users, version, _ := a.store.Snapshot()
+	audit(r, "store.reset", "")
+	writeJSON(w, http.StatusOK, StoreResetResponse{Users: len(users), Version: version})
+}
+
+// listBuckets は GET /admin/ratelimit
+func (a *api) listBuckets(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.rateLimiter.Buckets())
+}
+
+// getBucket は GET /admin/ratelimit/{client}
+func (a *api) getBucket(w http.ResponseWriter, r *http.Request) {
+	bucket, ok := a.rateLimiter.Bucket(r.PathValue("client"))
+	if !ok {
+		problem.Write(w, r, problem.CodeNotFound, "no active rate limit window for client")
+		return
+	}
+	writeJSON(w, http.StatusOK, bucket)
+}
+
+// SetBucketRequest はクライアントのリクエスト数の変更
+type SetBucketRequest struct {
+	Count *int `json:"count"`
+}
+
+// setBucket は PUT /admin/ratelimit/{client}
+func (a *api) setBucket(w http.ResponseWriter, r *http.Request) {
+	var req SetBucketRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Count == nil || *req.Count < 0 {
+		problem.Write(w, r, problem.CodeValidationFailed, "count must be zero or greater")
+		return
+	}
+	client := r.PathValue("client")
+	bucket := a.rateLimiter.SetCount(client, *req.Count)
+	audit(r, "ratelimit.set", client)
+	writeJSON(w, http.StatusOK, bucket)
+}
+
+// resetBucket は DELETE /admin/ratelimit/{client}
+func (a *api) resetBucket(w http.ResponseWriter, r *http.Request) {
+	client := r.PathValue("client")
+	a.rateLimiter.Reset(client)
+	audit(r, "ratelimit.reset", client)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listRevocations は GET /admin/tokens/revocations
+func (a *api) listRevocations(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.revocations.Summary())
+}
+
+// RevokeRequest はトークンの失効（token と user_id のどちらか一方）
+type RevokeRequest struct {
+	// Token: このトークン（jti）だけを失効させる
+	Token string `json:"token"`
+	// UserID: このユーザーに発行済みのトークンをすべて失効させる
+	UserID int `json:"user_id"`
+}
+
+// RevokeResponse はトークンの失効結果
+type RevokeResponse struct {
+	Revoked   string     `json:"revoked"`
+	UserID    int        `json:"user_id"`
+	TokenID   string     `json:"token_id,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// IssuedBefore: この時刻以前に発行したトークンを失効（秒単位）
+	IssuedBefore *time.Time `json:"issued_before,omitempty"`
+}
+
+// revokeToken は POST /admin/tokens/revoke
+func (a *api) revokeToken(w http.ResponseWriter, r *http.Request) {
+	var req RevokeRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if (req.Token == "") == (req.UserID == 0) {
+		problem.Write(w, r, problem.CodeValidationFailed, "specify either token or user_id")
+		return
+	}
+
+	if req.UserID != 0 {
+		now := time.Now()
+		a.revocations.RevokeUser(req.UserID, now)
+		audit(r, "tokens.revoke_user", strconv.Itoa(req.UserID))
+		writeJSON(w, http.StatusOK, RevokeResponse{Revoked: "user", UserID: req.UserID, IssuedBefore: &now})
+		return
+	}
+
+	claims, err := middleware.ParseToken(req.Token)
+	if errors.Is(err, middleware.ErrTokenRevoked) {
+		problem.Write(w, r, problem.CodeConflict, "token already revoked")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, problem.CodeValidationFailed, "token is invalid or expired")
+		return
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		problem.Write(w, r, problem.CodeValidationFailed, "token has no jti or expiry; revoke by user_id instead")
+		return
+	}
+	expiresAt := claims.ExpiresAt.Time
+	a.revocations.RevokeToken(claims.ID, expiresAt)
+	audit(r, "tokens.revoke", claims.ID)
+	writeJSON(w, http.StatusOK, RevokeResponse{Revoked: "token", UserID: claims.UserID, TokenID: claims.ID, ExpiresAt: &expiresAt})
+}
+
+// listLockouts は GET /admin/lockouts（ログインの失敗を記録しているアカウントとIP）
+func (a *api) listLockouts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.loginGuard.Statuses())
+}
+
+// unlock は DELETE /admin/lockouts/{scope}/{key}（scope は account か ip）
+func (a *api) unlock(w http.ResponseWriter, r *http.Request) {
+	scope, key := r.PathValue("scope"), r.PathValue("key")
+	unlocked, err := a.loginGuard.Unlock(scope, key)
+	if errors.Is(err, handlers.ErrInvalidLockoutScope) {
+		problem.Write(w, r, problem.CodeInvalidParameter, "scope must be account or ip")
+		return
+	}
+	if !unlocked {
+		problem.Write(w, r, problem.CodeNotFound, "no failed logins recorded for "+scope)
+		return
+	}
+	audit(r, "lockout.unlock", scope+" "+key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getReadiness は GET /admin/readiness
+func (a *api) getReadiness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.readiness.Status())
+}
+
+// SetReadinessRequest は GET /ready の状態の変更
+type SetReadinessRequest struct {
+	Ready  *bool  `json:"ready"`
+	Reason string `json:"reason"`
+}
+
+// setReadiness は PUT /admin/readiness
+func (a *api) setReadiness(w http.ResponseWriter, r *http.Request) {
+	var req SetReadinessRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Ready == nil {
+		problem.Write(w, r, problem.CodeValidationFailed, "ready is required")
+		return
+	}
+	a.readiness.Set(*req.Ready, req.Reason)
+	status := a.readiness.Status()
+	audit(r, "readiness.set", status.Status)
+	writeJSON(w, http.StatusOK, status)
+}
+
+// LogLevel はログの出力レベル
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+// getLogLevel は GET /admin/log-level
+func (a *api) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, LogLevel{Level: logging.Level()})
+}
+
+// setLogLevel は PUT /admin/log-level
+func (a *api) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req LogLevel
+	if !decode(w, r, &req) {
+		return
+	}
+	if err := logging.SetLevel(req.Level); err != nil {
+		problem.Write(w, r, problem.CodeValidationFailed, err.Error())
+		return
+	}
+	audit(r, "log_level.set", logging.Level())
+	writeJSON(w, http.StatusOK, LogLevel{Level: logging.Level()})
+}
+
+// ConnectionsResponse は公開側のコネクションの一覧
+type ConnectionsResponse struct {
+	Count       int            `json:"count"`
+	ByState     map[string]int `json:"by_state"`
+	Connections []Connection   `json:"connections"`
+}
+
+// listConnections は GET /admin/connections
+func (a *api) listConnections(w http.ResponseWriter, r *http.Request) {
+	conns := a.conns.Connections()
+	byState := make(map[string]int)
+	for _, c := range conns {
+		byState[c.State]++
+	}
+	writeJSON(w, http.StatusOK, ConnectionsResponse{Count: len(conns), ByState: byState, Connections: conns})
+}
+
+// defaultEventLimit は GET /admin/security-events で limit を省略したときの件数
+const defaultEventLimit = 100
+
+// SecurityEventsResponse はセキュリティイベントの照会結果
+type SecurityEventsResponse struct {
+	// Counts: 起動後の種類ごとのイベント数（保持件数を超えて古くなったものも含む）
+	Counts map[string]int64 `json:"counts"`
+	// Rules: しきい値アラートのルール
+	Rules  []string         `json:"rules"`
+	Events []security.Event `json:"events"`
+}
+
+// listSecurityEvents は GET /admin/security-events?type=&ip=&since=&limit=
+// since は RFC 3339 の時刻か "5m" のような現在からの期間
+func (a *api) listSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := security.Query{
+		Type:  query.Get("type"),
+		IP:    query.Get("ip"),
+		Limit: defaultEventLimit,
+	}
+	if v := query.Get("since"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			q.Since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+			q.Since = t
+		} else {
+			problem.Write(w, r, problem.CodeInvalidParameter, "since must be an RFC 3339 time or a duration")
+			return
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			problem.Write(w, r, problem.CodeInvalidParameter, "limit must be zero (no limit) or greater")
+			return
+		}
+		q.Limit = limit
+	}
+
+	rules := []string{}
+	for _, rule := range a.security.Rules() {
+		rules = append(rules, rule.String())
+	}
+	writeJSON(w, http.StatusOK, SecurityEventsResponse{
+		Counts: a.security.Counts(),
+		Rules:  rules,
+		Events: a.security.Query(q),
+	})
+}
+
+// getUpstream は GET /admin/upstream（上流のサーキットブレーカーの状態）
+func (a *api) getUpstream(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.upstream.Breaker().Status())
+}
+
+// resetUpstream は POST /admin/upstream/reset（上流の復旧後、Cooldownを待たずにブレーカーを閉じる）
+func (a *api) resetUpstream(w http.ResponseWriter, r *http.Request) {
+	breaker := a.upstream.Breaker()
+	audit(r, "upstream.reset", "state="+breaker.Status().State)
+	breaker.Reset()
+	writeJSON(w, http.StatusOK, breaker.Status())
+}
+
+// getConfig は GET /admin/config（環境変数と既定値から決まった実効設定）
+func (a *api) getConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, settingsJSON(reflect.ValueOf(a.settings), ""))
+}
+
+// settingsJSON は設定をJSONに変換できる値にする
+// 期間は "1s" の形式にし、名前に Token・Secret・Password・WebhookURL を含む値は伏せる
+// （文字列だけでなく []byte の鍵や []string もまとめて伏せる）
+// 値の一部だけが秘密の設定（OAuthのクライアントなど）は Redact で伏せた値を返す
+func settingsJSON(v reflect.Value, name string) any {
+	if r, ok := v.Interface().(redactor); ok {
+		return r.Redact(redacted)
+	}
+	if (v.Kind() == reflect.String || v.Kind() == reflect.Slice) && v.Len() > 0 && secret(name) {
+		return redacted
+	}
+
+	switch x := v.Interface().(type) {
+	case time.Duration:
+		return x.String()
+	case time.Time:
+		return x
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return settingsJSON(v.Elem(), name)
+	case reflect.Struct:
+		fields := make(map[string]any)
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.IsExported() {
+				fields[f.Name] = settingsJSON(v.Field(i), f.Name)
+			}
+		}
+		return fields
+	case reflect.Slice:
+		items := make([]any, v.Len())
+		for i := range items {
+			items[i] = settingsJSON(v.Index(i), name)
+		}
+		return items
+	}
+	return v.Interface()
+}
+
+// redactor は秘密の部分を伏せた値を返す設定
+type redactor interface {
+	Redact(mask string) any
+}
+
+func secret(name string) bool {
+	for _, s := range []string{"Token", "Secret", "Password", "WebhookURL"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
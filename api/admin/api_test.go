@@ -0,0 +1,432 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"k6-practice/api/config"
+	"k6-practice/api/handlers"
+	"k6-practice/api/logging"
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+	"k6-practice/api/security"
+	"k6-practice/api/totp"
+	"k6-practice/api/upstream"
+)
+
+// serveJSON はJSONのボディ付きで管理用APIを呼ぶ
+func serveJSON(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func signToken(t *testing.T, userID int, jti string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &middleware.Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}).SignedString(middleware.JWTSecret)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+func TestAPI_StoreReset(t *testing.T) {
+	store := models.NewUserStore()
+	store.Create("Dave", "dave@example.com")
+	store.Delete(1)
+	before := store.Version()
+	mfa := handlers.NewMFAStore(handlers.MFAConfig{})
+	secret, _, _ := mfa.Enroll(4, "dave@example.com")
+	code, _ := totp.Code(secret, time.Now())
+	if _, err := mfa.Activate(4, code); err != nil {
+		t.Fatal(err)
+	}
+	apiKeys := handlers.NewAPIKeyStore(handlers.APIKeyConfig{RateLimit: 10, Window: time.Minute, MaxPerUser: 5}, store)
+	apiKeys.Create(1, "ci", nil, 0, 0)
+	revocations := middleware.NewTokenRevocations()
+	issued := &middleware.Claims{UserID: 1, Epoch: revocations.Epoch()}
+	guard := handlers.NewLoginGuard(handlers.LockoutConfig{AccountThreshold: 1, Window: time.Minute, Duration: time.Minute})
+	attempt, _ := guard.Begin("alice@example.com", "192.0.2.1")
+	attempt.Failure()
+	rl := middleware.NewRateLimiter(10, time.Minute)
+	rl.Allow("192.0.2.1")
+	h := Handler(Config{Token: testToken, Store: store, MFA: mfa, APIKeys: apiKeys,
+		Revocations: revocations, LoginGuard: guard, RateLimiter: rl})
+
+	rec := serveJSON(h, http.MethodPost, "/admin/store/reset", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var resp StoreResetResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	if resp.Users != 3 || store.Get(1) == nil || store.Get(4) != nil {
+		t.Errorf("expected only the seed users, got %d users", resp.Users)
+	}
+	if resp.Version <= before {
+		t.Errorf("expected the version to keep increasing, got %d after %d", resp.Version, before)
+	}
+	if mfa.Enabled(4) {
+		t.Error("expected MFA enrollments to be reset with the store")
+	}
+	if keys := apiKeys.List(1); len(keys) != 0 {
+		t.Errorf("expected API keys to be reset with the store, got %d", len(keys))
+	}
+	// 以前のユーザーIDで発行したトークンは、振り直した同じIDのユーザーとして使えない
+	if !revocations.Revoked(issued) {
+		t.Error("expected tokens issued before the reset to be revoked")
+	}
+	if statuses := guard.Statuses(); len(statuses) != 0 {
+		t.Errorf("expected lockouts to be reset with the store, got %+v", statuses)
+	}
+	if buckets := rl.Buckets(); len(buckets) != 0 {
+		t.Errorf("expected rate limit buckets to be reset with the store, got %+v", buckets)
+	}
+}
+
+func TestAPI_RateLimit(t *testing.T) {
+	rl := middleware.NewRateLimiter(10, time.Minute)
+	rl.Allow("192.0.2.1")
+	h := Handler(Config{Token: testToken, RateLimiter: rl})
+
+	tests := []struct {
+		name             string
+		method           string
+		path             string
+		body             string
+		expectedStatus   int
+		expectedContains string
+	}{
+		{"list", http.MethodGet, "/admin/ratelimit", "", http.StatusOK, `"client":"192.0.2.1"`},
+		{"get", http.MethodGet, "/admin/ratelimit/192.0.2.1", "", http.StatusOK, `"remaining":9`},
+		{"set count", http.MethodPut, "/admin/ratelimit/192.0.2.1", `{"count":10}`, http.StatusOK, `"remaining":0`},
+		{"negative count", http.MethodPut, "/admin/ratelimit/192.0.2.1", `{"count":-1}`, http.StatusBadRequest, "validation_failed"},
+		{"unknown field", http.MethodPut, "/admin/ratelimit/192.0.2.1", `{"limit":1}`, http.StatusBadRequest, "invalid_body"},
+		{"reset", http.MethodDelete, "/admin/ratelimit/192.0.2.1", "", http.StatusNoContent, ""},
+		{"get after reset", http.MethodGet, "/admin/ratelimit/192.0.2.1", "", http.StatusNotFound, "not_found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveJSON(h, tt.method, tt.path, tt.body)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.expectedContains) {
+				t.Errorf("expected body to contain %q, got %s", tt.expectedContains, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPI_RevokeTokens(t *testing.T) {
+	h := Handler(Config{Token: testToken, Revocations: middleware.Revocations})
+	// ParseToken はグローバルの一覧を参照するため、専用のユーザーIDとjtiを使う
+	token := signToken(t, 9101, "admin-test-jti")
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"revoke token", `{"token":"` + token + `"}`, http.StatusOK},
+		{"already revoked", `{"token":"` + token + `"}`, http.StatusConflict},
+		{"token without jti", `{"token":"` + signToken(t, 9102, "") + `"}`, http.StatusBadRequest},
+		{"invalid token", `{"token":"not-a-jwt"}`, http.StatusBadRequest},
+		{"both token and user", `{"token":"x","user_id":1}`, http.StatusBadRequest},
+		{"neither", `{}`, http.StatusBadRequest},
+		{"revoke user", `{"user_id":9103}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveJSON(h, http.MethodPost, "/admin/tokens/revoke", tt.body)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	var summary middleware.RevocationSummary
+	json.NewDecoder(serveJSON(h, http.MethodGet, "/admin/tokens/revocations", "").Body).Decode(&summary)
+	if summary.Tokens == 0 || summary.Users[9103].IsZero() {
+		t.Errorf("expected revocations to be listed, got %+v", summary)
+	}
+}
+
+func TestAPI_Readiness(t *testing.T) {
+	readiness := handlers.NewReadiness()
+	h := Handler(Config{Token: testToken, Readiness: readiness})
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedReady  int
+	}{
+		{"mark not ready", `{"ready":false,"reason":"draining"}`, http.StatusOK, http.StatusServiceUnavailable},
+		{"ready is required", `{"reason":"x"}`, http.StatusBadRequest, http.StatusServiceUnavailable},
+		{"mark ready", `{"ready":true}`, http.StatusOK, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveJSON(h, http.MethodPut, "/admin/readiness", tt.body)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			ready := httptest.NewRecorder()
+			readiness.Ready(ready, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if ready.Code != tt.expectedReady {
+				t.Errorf("expected GET /ready %d, got %d", tt.expectedReady, ready.Code)
+			}
+		})
+	}
+}
+
+func TestAPI_LogLevel(t *testing.T) {
+	defer logging.SetLevel("info")
+	h := Handler(Config{Token: testToken})
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedLevel  string
+	}{
+		{"set warn", `{"level":"warn"}`, http.StatusOK, "warn"},
+		{"unknown level", `{"level":"verbose"}`, http.StatusBadRequest, "warn"},
+		{"set debug", `{"level":"debug"}`, http.StatusOK, "debug"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveJSON(h, http.MethodPut, "/admin/log-level", tt.body)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if logging.Level() != tt.expectedLevel {
+				t.Errorf("expected level %q, got %q", tt.expectedLevel, logging.Level())
+			}
+		})
+	}
+}
+
+func TestAPI_Connections(t *testing.T) {
+	conns := NewConnTracker()
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conns.Track(server, http.StateNew)
+	conns.Track(server, http.StateActive)
+	h := Handler(Config{Token: testToken, Connections: conns})
+
+	var resp ConnectionsResponse
+	json.NewDecoder(serveJSON(h, http.MethodGet, "/admin/connections", "").Body).Decode(&resp)
+	if resp.Count != 1 || resp.ByState["active"] != 1 {
+		t.Errorf("expected one active connection, got %+v", resp)
+	}
+
+	conns.Track(server, http.StateClosed)
+	if got := len(conns.Connections()); got != 0 {
+		t.Errorf("expected closed connections to be removed, got %d", got)
+	}
+}
+
+func TestAPI_Config(t *testing.T) {
+	type nested struct {
+		Timeout time.Duration
+		Origins []string
+	}
+	settings := &struct {
+		Addr          string
+		Token         string
+		Empty         string
+		Secret        []byte
+		WebhookURLs   []string
+		EmptyPassword []byte
+		Clients       config.OAuthClients
+		Settings      nested
+		hidden        string
+	}{
+		Addr:        ":8080",
+		Token:       "secret",
+		Secret:      []byte("secret"),
+		WebhookURLs: []string{"https://hooks.example.com/secret"},
+		Clients:     config.OAuthClients{"svc:secret", "spa::http://localhost/cb", "app:secret:http://localhost/app"},
+		Settings:    nested{Timeout: time.Second, Origins: []string{"a"}},
+		hidden:      "x",
+	}
+	h := Handler(Config{Token: testToken, Settings: settings})
+
+	body := serveJSON(h, http.MethodGet, "/admin/config", "").Body.String()
+
+	for _, expected := range []string{`"Addr":":8080"`, `"Token":"[REDACTED]"`, `"Secret":"[REDACTED]"`,
+		`"WebhookURLs":"[REDACTED]"`, `"EmptyPassword":[]`,
+		`"Clients":["svc:[REDACTED]","spa::http://localhost/cb","app:[REDACTED]:http://localhost/app"]`, `"Timeout":"1s"`, `"Origins":["a"]`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %s in %s", expected, body)
+		}
+	}
+	// []byte の鍵は数値の配列としても出さない
+	if strings.Contains(body, "secret") || strings.Contains(body, "hidden") || strings.Contains(body, "115,101,99") {
+		t.Errorf("expected secrets and unexported fields to be hidden, got %s", body)
+	}
+}
+
+func TestAPI_Upstream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	client := upstream.NewClient(upstream.Config{
+		BaseURL: srv.URL,
+		Breaker: upstream.BreakerConfig{Threshold: 1, Cooldown: time.Hour},
+	})
+	h := Handler(Config{Token: testToken, Upstream: client})
+
+	tests := []struct {
+		name          string
+		before        func()
+		method        string
+		path          string
+		expectedState string
+	}{
+		{"closed before any failure", nil, http.MethodGet, "/admin/upstream", "closed"},
+		{"open after the threshold", func() { client.Get(context.Background(), "/") }, http.MethodGet, "/admin/upstream", "open"},
+		{"reset closes the breaker", nil, http.MethodPost, "/admin/upstream/reset", "closed"},
+		{"stays closed after reset", nil, http.MethodGet, "/admin/upstream", "closed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.before != nil {
+				tt.before()
+			}
+			rec := serveJSON(h, tt.method, tt.path, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rec.Code)
+			}
+			var resp upstream.BreakerStatus
+			json.NewDecoder(rec.Body).Decode(&resp)
+			if resp.State != tt.expectedState {
+				t.Errorf("expected state %q, got %q", tt.expectedState, resp.State)
+			}
+		})
+	}
+}
+
+func TestAPI_UnconfiguredEndpoints(t *testing.T) {
+	// 依存を渡さなかった管理用APIは登録しない
+	rec := serveJSON(Handler(Config{Token: testToken}), http.MethodPost, "/admin/store/reset", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestAPI_SecurityEvents(t *testing.T) {
+	rules, _ := security.ParseRules([]string{"AUTH_FAILURE:2/2h"})
+	monitor := security.NewMonitor(security.Config{Buffer: 10, Rules: rules})
+	monitor.Record(security.Event{Type: "AUTH_FAILURE", IP: "192.0.2.1", Time: time.Now().Add(-time.Hour)})
+	monitor.Record(security.Event{Type: "CSRF_BLOCKED", IP: "192.0.2.2"})
+	monitor.Record(security.Event{Type: "AUTH_FAILURE", IP: "192.0.2.1"})
+	h := Handler(Config{Token: testToken, Security: monitor})
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedTypes  string
+	}{
+		{"all newest first", "", http.StatusOK, "SECURITY_ALERT AUTH_FAILURE CSRF_BLOCKED AUTH_FAILURE"},
+		{"by type", "?type=AUTH_FAILURE", http.StatusOK, "AUTH_FAILURE AUTH_FAILURE"},
+		{"by ip", "?ip=192.0.2.2", http.StatusOK, "CSRF_BLOCKED"},
+		{"since duration", "?since=5m", http.StatusOK, "SECURITY_ALERT AUTH_FAILURE CSRF_BLOCKED"},
+		{"limit", "?limit=1", http.StatusOK, "SECURITY_ALERT"},
+		{"invalid since", "?since=yesterday", http.StatusBadRequest, ""},
+		{"invalid limit", "?limit=-1", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveJSON(h, http.MethodGet, "/admin/security-events"+tt.query, "")
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var resp SecurityEventsResponse
+			json.NewDecoder(rec.Body).Decode(&resp)
+			var types []string
+			for _, e := range resp.Events {
+				types = append(types, e.Type)
+			}
+			if got := strings.Join(types, " "); got != tt.expectedTypes {
+				t.Errorf("expected %q, got %q", tt.expectedTypes, got)
+			}
+			if resp.Counts["AUTH_FAILURE"] != 2 || len(resp.Rules) != 1 || resp.Rules[0] != "AUTH_FAILURE:2/2h0m0s" {
+				t.Errorf("unexpected counts or rules: %+v %+v", resp.Counts, resp.Rules)
+			}
+		})
+	}
+}
+
+func TestAPI_Lockouts(t *testing.T) {
+	guard := handlers.NewLoginGuard(handlers.LockoutConfig{AccountThreshold: 1, Window: time.Minute, Duration: time.Minute})
+	attempt, _ := guard.Begin("alice@example.com", "192.0.2.1")
+	attempt.Failure()
+	h := Handler(Config{Token: testToken, LoginGuard: guard})
+
+	rec := serveJSON(h, http.MethodGet, "/admin/lockouts", "")
+	var statuses []handlers.LockoutStatus
+	json.NewDecoder(rec.Body).Decode(&statuses)
+	if rec.Code != http.StatusOK || len(statuses) != 2 || statuses[0].Key != "alice@example.com" || statuses[0].LockedUntil == nil {
+		t.Fatalf("expected the locked account first, got %d %+v", rec.Code, statuses)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{"unlock account", "/admin/lockouts/account/alice@example.com", http.StatusNoContent},
+		{"already unlocked", "/admin/lockouts/account/alice@example.com", http.StatusNotFound},
+		{"unlock ip", "/admin/lockouts/ip/192.0.2.1", http.StatusNoContent},
+		{"invalid scope", "/admin/lockouts/user/alice@example.com", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serveJSON(h, http.MethodDelete, tt.path, ""); rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+
+	attempt, lock := guard.Begin("alice@example.com", "192.0.2.1")
+	if lock != nil {
+		t.Errorf("expected the lockout to be cleared, got %+v", lock)
+	} else {
+		attempt.Release()
+	}
+}
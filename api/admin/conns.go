@@ -0,0 +1,72 @@
+package admin
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Connection は公開側のTCPコネクション（GET /admin/connections）
+type Connection struct {
+	RemoteAddr string    `json:"remote_addr"`
+	State      string    `json:"state"`
+	Since      time.Time `json:"since"`
+	StateSince time.Time `json:"state_since"`
+}
+
+type connInfo struct {
+	since      time.Time
+	state      http.ConnState
+	stateSince time.Time
+}
+
+// ConnTracker は http.Server.ConnState でコネクションの状態を追跡する
+// WebSocketなどハイジャックしたコネクションと、HTTP/3・gRPCのコネクションは含まない
+type ConnTracker struct {
+	mu    sync.Mutex
+	conns map[net.Conn]*connInfo
+}
+
+func NewConnTracker() *ConnTracker {
+	return &ConnTracker{conns: make(map[net.Conn]*connInfo)}
+}
+
+// Track は http.Server.ConnState に設定する
+func (t *ConnTracker) Track(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		delete(t.conns, c)
+		return
+	}
+	now := time.Now()
+	info, ok := t.conns[c]
+	if !ok {
+		info = &connInfo{since: now}
+		t.conns[c] = info
+	}
+	info.state = state
+	info.stateSince = now
+}
+
+// Connections は追跡中のコネクション（古い順）
+func (t *ConnTracker) Connections() []Connection {
+	t.mu.Lock()
+	conns := make([]Connection, 0, len(t.conns))
+	for c, info := range t.conns {
+		conns = append(conns, Connection{
+			RemoteAddr: c.RemoteAddr().String(),
+			State:      info.state.String(),
+			Since:      info.since,
+			StateSince: info.stateSince,
+		})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(conns, func(i, j int) bool { return conns[i].Since.Before(conns[j].Since) })
+	return conns
+}
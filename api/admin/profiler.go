@@ -0,0 +1,239 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k6-practice/api/metrics"
+)
+
+// ErrCapturing は別のプロファイル取得が実行中
+var ErrCapturing = errors.New("admin: profile capture already in progress")
+
+// ErrProfileNotFound は指定した名前のプロファイルがない
+var ErrProfileNotFound = errors.New("admin: profile not found")
+
+// ProfilerConfig は連続プロファイリングの設定
+type ProfilerConfig struct {
+	// Interval: しきい値を確認する間隔（直近のレイテンシはこの間隔で集計）
+	Interval time.Duration
+	// LatencyThreshold: 直近のp99レイテンシのしきい値（0は判定しない）
+	LatencyThreshold time.Duration
+	// InFlightThreshold: 処理中のリクエスト数のしきい値（0は判定しない）
+	InFlightThreshold int
+	// CPUDuration: CPUプロファイルを取得する時間
+	CPUDuration time.Duration
+	// Cooldown: 取得後に次の自動取得を始めない時間
+	Cooldown time.Duration
+	// Dir: プロファイルの保存先
+	Dir string
+	// MaxProfiles: 保存するプロファイル数の上限（古いものから削除、0は無制限）
+	MaxProfiles int
+}
+
+// Profile は保存したプロファイル
+type Profile struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Reason    string    `json:"reason"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// プロファイリングの統計
+var profilingStats = new(expvar.Map).Init()
+
+func init() {
+	metrics.Set("profiling", profilingStats)
+}
+
+// Profiler はレイテンシや処理中のリクエスト数がしきい値を超えたときにプロファイルを自動で取得する
+// 1回の取得で CPU（CPUDuration の間）・ヒープ・ゴルーチンのプロファイルを Dir に保存する
+// 負荷試験の再実行やプロファイル付きの再ビルドなしで、劣化した時点の状態を残すためのもの
+type Profiler struct {
+	cfg       ProfilerConfig
+	capturing atomic.Bool
+
+	mu          sync.Mutex
+	profiles    []Profile
+	lastCapture time.Time
+
+	// 判定に使う値（テストで差し替える）
+	latency  func(window time.Duration) (time.Duration, int)
+	inFlight func() int64
+}
+
+// NewProfiler は保存先を作成してProfilerを返す
+func NewProfiler(cfg ProfilerConfig) (*Profiler, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("admin: create profile dir: %w", err)
+	}
+	return &Profiler{
+		cfg: cfg,
+		latency: func(window time.Duration) (time.Duration, int) {
+			return metrics.RecentLatency(0.99, window)
+		},
+		inFlight: metrics.InFlight,
+	}, nil
+}
+
+// Run は ctx が終わるまで Interval ごとにしきい値を確認する
+func (p *Profiler) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reason := p.check()
+		if reason == "" || !p.cooledDown() {
+			continue
+		}
+		log.Printf("[PROFILING] capturing profiles: %s", reason)
+		if _, err := p.Capture(ctx, reason); err != nil {
+			log.Printf("[PROFILING] capture failed: %v", err)
+		}
+	}
+}
+
+// check はしきい値を超えていればその理由を返す
+func (p *Profiler) check() string {
+	if p.cfg.LatencyThreshold > 0 {
+		if d, n := p.latency(p.cfg.Interval); n > 0 && d >= p.cfg.LatencyThreshold {
+			return fmt.Sprintf("p99 latency %s >= %s over %d requests", d, p.cfg.LatencyThreshold, n)
+		}
+	}
+	if p.cfg.InFlightThreshold > 0 {
+		if n := p.inFlight(); n >= int64(p.cfg.InFlightThreshold) {
+			return fmt.Sprintf("%d requests in flight >= %d", n, p.cfg.InFlightThreshold)
+		}
+	}
+	return ""
+}
+
+func (p *Profiler) cooledDown() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastCapture.IsZero() || time.Since(p.lastCapture) >= p.cfg.Cooldown
+}
+
+// Capture はCPU・ヒープ・ゴルーチンのプロファイルを取得して保存する
+// CPUプロファイルは同時に1つしか取れないため、/debug/pprof/profile の実行中はCPUだけ失敗する
+func (p *Profiler) Capture(ctx context.Context, reason string) ([]Profile, error) {
+	if !p.capturing.CompareAndSwap(false, true) {
+		return nil, ErrCapturing
+	}
+	defer p.capturing.Store(false)
+
+	prefix := time.Now().UTC().Format("20060102T150405.000")
+	var captured []Profile
+	var errs []error
+	for _, kind := range []string{"cpu", "heap", "goroutine"} {
+		profile, err := p.write(ctx, prefix, kind, reason)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", kind, err))
+			continue
+		}
+		captured = append(captured, profile)
+	}
+
+	profilingStats.Add("captures", 1)
+	if len(errs) > 0 {
+		profilingStats.Add("failures", 1)
+	}
+	p.mu.Lock()
+	p.lastCapture = time.Now()
+	p.profiles = append(p.profiles, captured...)
+	p.prune()
+	p.mu.Unlock()
+	return captured, errors.Join(errs...)
+}
+
+// write は1種類のプロファイルをファイルに書き出す
+func (p *Profiler) write(ctx context.Context, prefix, kind, reason string) (Profile, error) {
+	name := prefix + "-" + kind + ".pprof"
+	f, err := os.Create(filepath.Join(p.cfg.Dir, name))
+	if err != nil {
+		return Profile{}, err
+	}
+	defer f.Close()
+
+	if kind == "cpu" {
+		err = writeCPUProfile(ctx, f, p.cfg.CPUDuration)
+	} else {
+		err = pprof.Lookup(kind).WriteTo(f, 0)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return Profile{}, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return Profile{}, err
+	}
+	return Profile{Name: name, Kind: kind, Reason: reason, Size: info.Size(), CreatedAt: info.ModTime()}, nil
+}
+
+// writeCPUProfile は d の間（ctx が終わればそこまで）のCPUプロファイルを書き出す
+func writeCPUProfile(ctx context.Context, f *os.File, d time.Duration) error {
+	if err := pprof.StartCPUProfile(f); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+	pprof.StopCPUProfile()
+	return nil
+}
+
+// prune は上限を超えた古いプロファイルを削除する（p.mu を保持して呼ぶ）
+func (p *Profiler) prune() {
+	if p.cfg.MaxProfiles <= 0 || len(p.profiles) <= p.cfg.MaxProfiles {
+		return
+	}
+	excess := len(p.profiles) - p.cfg.MaxProfiles
+	for _, profile := range p.profiles[:excess] {
+		if err := os.Remove(filepath.Join(p.cfg.Dir, profile.Name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[PROFILING] failed to remove %s: %v", profile.Name, err)
+		}
+	}
+	p.profiles = append([]Profile(nil), p.profiles[excess:]...)
+}
+
+// Profiles は保存しているプロファイル（新しい順）
+func (p *Profiler) Profiles() []Profile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	profiles := make([]Profile, len(p.profiles))
+	for i, profile := range p.profiles {
+		profiles[len(p.profiles)-1-i] = profile
+	}
+	return profiles
+}
+
+// Open は保存したプロファイルを開く（一覧にある名前だけ。パスの指定は受け付けない）
+func (p *Profiler) Open(name string) (*os.File, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, profile := range p.profiles {
+		if profile.Name == name {
+			return os.Open(filepath.Join(p.cfg.Dir, name))
+		}
+	}
+	return nil, ErrProfileNotFound
+}
@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestProfiler(t *testing.T, cfg ProfilerConfig) *Profiler {
+	t.Helper()
+	cfg.Dir = t.TempDir()
+	if cfg.CPUDuration == 0 {
+		cfg.CPUDuration = 10 * time.Millisecond
+	}
+	p, err := NewProfiler(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return p
+}
+
+func TestProfiler_Check(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      ProfilerConfig
+		latency  time.Duration
+		requests int
+		inFlight int64
+		expected string
+	}{
+		{"below thresholds", ProfilerConfig{LatencyThreshold: time.Second, InFlightThreshold: 100}, 10 * time.Millisecond, 50, 10, ""},
+		{"slow requests", ProfilerConfig{LatencyThreshold: time.Second, InFlightThreshold: 100}, 2 * time.Second, 50, 10, "p99 latency"},
+		{"no recent requests", ProfilerConfig{LatencyThreshold: time.Second}, 0, 0, 0, ""},
+		{"too many in flight", ProfilerConfig{LatencyThreshold: time.Second, InFlightThreshold: 100}, 0, 0, 150, "in flight"},
+		{"disabled thresholds", ProfilerConfig{}, time.Hour, 50, 1000, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProfiler(t, tt.cfg)
+			p.latency = func(time.Duration) (time.Duration, int) { return tt.latency, tt.requests }
+			p.inFlight = func() int64 { return tt.inFlight }
+
+			got := p.check()
+			if tt.expected == "" && got != "" || !strings.Contains(got, tt.expected) {
+				t.Errorf("expected reason containing %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestProfiler_Capture(t *testing.T) {
+	p := newTestProfiler(t, ProfilerConfig{MaxProfiles: 4})
+
+	captured, err := p.Capture(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kinds := make(map[string]bool)
+	for _, profile := range captured {
+		kinds[profile.Kind] = true
+		f, err := p.Open(profile.Name)
+		if err != nil {
+			t.Fatalf("expected %s to be readable: %v", profile.Name, err)
+		}
+		f.Close()
+		if profile.Reason != "test" || profile.Size == 0 {
+			t.Errorf("unexpected profile %+v", profile)
+		}
+	}
+	if !kinds["cpu"] || !kinds["heap"] || !kinds["goroutine"] {
+		t.Errorf("expected cpu, heap and goroutine profiles, got %v", kinds)
+	}
+
+	t.Run("prunes old profiles", func(t *testing.T) {
+		if _, err := p.Capture(context.Background(), "second"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		profiles := p.Profiles()
+		if len(profiles) != 4 || profiles[0].Reason != "second" {
+			t.Fatalf("expected the newest 4 profiles, got %+v", profiles)
+		}
+		if _, err := os.Stat(p.cfg.Dir + "/" + captured[0].Name); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %s to be removed, got %v", captured[0].Name, err)
+		}
+	})
+
+	t.Run("rejects unknown names", func(t *testing.T) {
+		if _, err := p.Open("../" + captured[2].Name); !errors.Is(err, ErrProfileNotFound) {
+			t.Errorf("expected ErrProfileNotFound, got %v", err)
+		}
+	})
+}
+
+func TestProfiler_CaptureInProgress(t *testing.T) {
+	p := newTestProfiler(t, ProfilerConfig{CPUDuration: 200 * time.Millisecond})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Capture(context.Background(), "first")
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := p.Capture(context.Background(), "second"); !errors.Is(err, ErrCapturing) {
+		t.Errorf("expected ErrCapturing, got %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected first capture to succeed, got %v", err)
+	}
+}
+
+func TestProfiler_Run(t *testing.T) {
+	p := newTestProfiler(t, ProfilerConfig{
+		Interval:          10 * time.Millisecond,
+		InFlightThreshold: 1,
+		Cooldown:          time.Hour,
+	})
+	p.inFlight = func() int64 { return 5 }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	p.Run(ctx)
+
+	// クールダウン中は再取得しない
+	if got := len(p.Profiles()); got != 3 {
+		t.Errorf("expected a single capture of 3 profiles, got %d", got)
+	}
+}
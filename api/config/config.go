@@ -2,22 +2,91 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Config はアプリケーション設定を保持する
 type Config struct {
-	Server     ServerConfig
-	RateLimit  RateLimitConfig
-	BodyLimit  int64
-	CORS       CORSConfig
-	CSRF       CSRFConfig
-	JWT        JWTConfig
+	Server      ServerConfig
+	RateLimit   RateLimitConfig
+	BodyLimit   int64
+	Compression CompressionConfig
+	CORS        CORSConfig
+	CSRF        CSRFConfig
+	JWT         JWTConfig
+	OpenAPI     OpenAPIConfig
+	API         APIConfig
+	WebSocket   WebSocketConfig
+	SSE         SSEConfig
+	GraphQL     GraphQLConfig
+	Idempotency IdempotencyConfig
+	Cache       CacheConfig
+	Timeout     TimeoutConfig
+	Concurrency ConcurrencyConfig
+	Upstream    UpstreamConfig
+	Tracing     TracingConfig
+	Admin       AdminConfig
+	Security    SecurityConfig
+	Lockout     LockoutConfig
+	MFA         MFAConfig
+	OAuth       OAuthConfig
+	APIKeys     APIKeyConfig
+	// LogLevel: debug / info（アクセスログ）/ warn（セキュリティイベント）/ error
+	LogLevel string
 }
 
 type ServerConfig struct {
 	Addr string
+	// HTTP2: falseの場合はTLSでもHTTP/1.1のみで応答する（プロトコル比較用）
+	HTTP2 bool
+	// H2C: 平文のHTTP/2（h2c）を受け付ける（TLS無効時のみ）
+	H2C   bool
+	HTTP3 HTTP3Config
+	TLS   TLSConfig
+	GRPC  GRPCConfig
+	// ReadHeaderTimeout: リクエストヘッダーの受信期限（Slowloris対策）
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout: リクエスト全体（ボディを含む）の受信期限
+	// WriteTimeoutはWebSocket・SSEの長時間接続を切ってしまうため設定せず、ルートごとのTimeoutで制限する
+	ReadTimeout time.Duration
+	// IdleTimeout: keep-alive接続を待つ時間
+	IdleTimeout time.Duration
+}
+
+type GRPCConfig struct {
+	// Enabled: 同じUserStoreをgRPCでも別ポートで提供する（REST・gRPCの比較用）
+	// HTTPのミドルウェア（レート制限・ロックアウト等）を通らないため既定では無効
+	Enabled bool
+	// Addr: gRPCのTCPアドレス（TLS有効時はHTTPと同じ証明書を使う）
+	Addr string
+	// Reflection: サーバーリフレクションを公開する
+	Reflection bool
+}
+
+type HTTP3Config struct {
+	// Enabled: UDPでHTTP/3（QUIC）も待ち受ける（TLS必須）
+	Enabled bool
+	// Addr: HTTP/3のUDPアドレス（既定はSERVER_ADDRと同じポート）
+	Addr string
+}
+
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// SelfSigned: 起動時に自己署名証明書を生成する（ローカル実行用）
+	SelfSigned bool
+	// ClientCAFile: 設定するとクライアント証明書（mTLS）を検証し、メールアドレスでユーザーに対応付ける
+	ClientCAFile string
+	// ClientAuth: "request"は証明書があれば検証、"require"は証明書を必須にする
+	ClientAuth string
+}
+
+// Enabled はTLSで待ち受けるか
+func (c TLSConfig) Enabled() bool {
+	return c.SelfSigned || (c.CertFile != "" && c.KeyFile != "")
 }
 
 type RateLimitConfig struct {
@@ -25,6 +94,19 @@ type RateLimitConfig struct {
 	Window   time.Duration
 }
 
+type CompressionConfig struct {
+	// Enabled: falseの場合はレスポンスを圧縮しない（圧縮あり・なしの負荷比較用）
+	Enabled bool
+	// Encodings: 圧縮方式の優先順（br, zstd, gzip, deflate）
+	Encodings []string
+	// MinSize: これより小さいレスポンスは圧縮しない（バイト）
+	MinSize int
+	// ContentTypes: 圧縮するContent-Type
+	ContentTypes []string
+	// MaxDecompressedBytes: Content-Encoding付きリクエストボディの展開後の上限
+	MaxDecompressedBytes int64
+}
+
 type CORSConfig struct {
 	AllowedOrigins []string
 	AllowedMethods []string
@@ -40,26 +122,301 @@ type JWTConfig struct {
 	Secret []byte
 }
 
+type APIConfig struct {
+	// DefaultVersion: バージョンなしのパス・Acceptヘッダーなしのリクエストに使うバージョン
+	DefaultVersion string
+	// V1DeprecatedAt, V1Sunset: v1の非推奨日・提供終了予定日（Deprecation/Sunsetヘッダー）
+	V1DeprecatedAt time.Time
+	V1Sunset       time.Time
+}
+
+type WebSocketConfig struct {
+	// PingInterval: サーバーから送るPingの間隔（Pongが2間隔分届かなければ切断）
+	PingInterval time.Duration
+	// ReadLimit: クライアントから受け付けるメッセージの最大サイズ（バイト）
+	ReadLimit int64
+	// WriteTimeout: 1メッセージの送信タイムアウト
+	WriteTimeout time.Duration
+}
+
+type SSEConfig struct {
+	// Heartbeat: 変更がなくても送るコメント行の間隔
+	Heartbeat time.Duration
+	// WriteTimeout: 1イベントの送信タイムアウト
+	WriteTimeout time.Duration
+	// Buffer: 接続ごとにためておける変更通知の数（溢れた遅い購読者は切断）
+	Buffer int
+}
+
+type GraphQLConfig struct {
+	// MaxDepth: フィールドのネストの上限
+	MaxDepth int
+	// MaxComplexity: クエリの複雑さの上限（users は first 倍で数える）
+	MaxComplexity int
+	// Introspection: スキーマのイントロスペクションを許可する
+	Introspection bool
+}
+
+type IdempotencyConfig struct {
+	// TTL: Idempotency-Key に対して最初のレスポンスを再送する期間
+	TTL time.Duration
+	// MaxKeys: 保存するキーの上限（超えた場合は古いものから破棄）
+	MaxKeys int
+}
+
+type CacheConfig struct {
+	// UsersPolicy: ユーザーの一覧・詳細の Cache-Control（既定はブラウザだけが保存し、毎回ETagで再検証する）
+	UsersPolicy string
+	// DocsPolicy: OpenAPIドキュメントの Cache-Control
+	DocsPolicy string
+	// ResponseCache: ユーザーの一覧・詳細をプロセス内にキャッシュする（キャッシュ層の効果の比較用）
+	ResponseCache bool
+	// ResponseCacheTTL: レスポンスキャッシュの有効期間（ストアが変更されるとすぐに無効になる）
+	ResponseCacheTTL time.Duration
+	// ResponseCacheMaxEntries: 保存するレスポンスの上限
+	ResponseCacheMaxEntries int
+}
+
+type TimeoutConfig struct {
+	// Request: ユーザー・認証・GraphQLの処理時間の上限（超えると503）
+	Request time.Duration
+	// Delay: 遅延シミュレーションの処理時間の上限（指定した遅延より短いと504）
+	Delay time.Duration
+}
+
+type ConcurrencyConfig struct {
+	// Enabled: 同時実行数の制限と負荷制限（超過分は503）
+	Enabled bool
+	// GlobalLimit: サーバー全体で同時に処理するリクエスト数（WebSocket・SSEは数えない）
+	GlobalLimit int
+	// RouteLimit: ルートごとの同時実行数の初期値（レイテンシを見て RouteMinLimit〜RouteMaxLimit の間で調整）
+	RouteLimit    int
+	RouteMinLimit int
+	RouteMaxLimit int
+	// LatencyTarget: これより遅いレスポンスが出たらルートの上限を下げる
+	LatencyTarget time.Duration
+	// QueueSize: 上限に達したときに待たせるリクエスト数（超えたら優先度の低いものから503）
+	QueueSize int
+	// QueueTimeout: 待ち行列で待つ最大時間
+	QueueTimeout time.Duration
+}
+
+type UpstreamConfig struct {
+	// URL: 上流のベースURL（空なら上流を呼び出さない。例: http://localhost:8080）
+	URL string
+	// Path: ユーザー詳細で呼び出すパス（自身の /v2/delay/{ms} や /v2/error-rate/{pct} で障害を再現する）
+	Path string
+	// Required: 上流が失敗したらユーザー詳細もエラーにする（falseなら上流なしで応答する）
+	Required bool
+	// Timeout: 1回の呼び出しの上限
+	Timeout time.Duration
+	// Retries: 再試行回数（BackoffBase×2^n を上限にランダムに待つ）
+	Retries     int
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// MaxConcurrent: 同時に呼び出す数の上限（バルクヘッド、0は無制限）
+	MaxConcurrent int
+	// BreakerThreshold: 連続した失敗でサーキットブレーカーを開く回数（0は無効）
+	BreakerThreshold int
+	// BreakerCooldown: 開いてから試行を再開するまでの時間
+	BreakerCooldown time.Duration
+	// BreakerHalfOpenRequests: 半開で試す呼び出し数
+	BreakerHalfOpenRequests int
+}
+
+type TracingConfig struct {
+	// Exporter: スパンの送信先（none / otlp / stdout）。none でもW3C traceparentは伝播する
+	Exporter string
+	// Endpoint: OTLP/HTTPの送信先
+	Endpoint string
+	// ServiceName: service.name
+	ServiceName string
+	// SampleRatio: traceparentのないリクエストを記録する割合
+	SampleRatio float64
+	// MiddlewareSpans: ミドルウェアごとに子スパンを作る（各ミドルウェアの処理時間を見る）
+	MiddlewareSpans bool
+}
+
+type AdminConfig struct {
+	// Enabled: 管理用の別リスナーを起動する（Tokenが必須）
+	Enabled bool
+	// Addr: 管理用リスナーのアドレス（既定はローカルホストのみ）
+	Addr string
+	// Token: 管理用エンドポイントの認証トークン（Authorization: Bearer）
+	Token     string
+	Profiling ProfilingConfig
+}
+
+type ProfilingConfig struct {
+	// Enabled: しきい値を超えたときにCPU・ヒーププロファイルを自動で取得する
+	Enabled bool
+	// Interval: しきい値を確認する間隔（直近のレイテンシはこの間隔で集計）
+	Interval time.Duration
+	// LatencyThreshold: 直近のp99レイテンシのしきい値（0は判定しない）
+	LatencyThreshold time.Duration
+	// InFlightThreshold: 処理中のリクエスト数のしきい値（0は判定しない）
+	InFlightThreshold int
+	// CPUDuration: CPUプロファイルを取得する時間
+	CPUDuration time.Duration
+	// Cooldown: 取得後に次の取得を始めない時間
+	Cooldown time.Duration
+	// Dir: プロファイルの保存先
+	Dir string
+	// MaxProfiles: 保存するプロファイル数の上限（古いものから削除）
+	MaxProfiles int
+}
+
+type SecurityConfig struct {
+	// Log: セキュリティイベントを標準のログに出力する（LOG_LEVEL が warn 以下の場合）
+	Log bool
+	// File: JSON Linesで追記するファイル（空なら書き出さない）
+	File string
+	// FileMaxBytes: ファイルがこのサイズを超える前にローテーションする
+	FileMaxBytes int64
+	// FileMaxBackups: 残すローテーション済みのファイル数（File.1〜File.N）
+	FileMaxBackups int
+	// WebhookURL: イベントをJSONでPOSTする先（空なら送らない）
+	WebhookURL string
+	// WebhookAlertsOnly: Webhookにはしきい値アラートだけを送る
+	WebhookAlertsOnly bool
+	// WebhookTimeout: 1回のPOSTの上限
+	WebhookTimeout time.Duration
+	// SyslogAddr: RFC 5424形式でUDP送信する先（例: 127.0.0.1:514、空なら送らない）
+	SyslogAddr string
+	// Buffer: GET /admin/security-events で照会できる直近のイベント数
+	Buffer int
+	// AlertRules: "種類:回数/期間"（同じIPから期間内に回数に達したらSECURITY_ALERTを記録）
+	AlertRules []string
+}
+
+type LockoutConfig struct {
+	// AccountThreshold: 同じアカウントへのログインの失敗でロックする回数（0は無効）
+	AccountThreshold int
+	// IPThreshold: 同じIPからのログインの失敗でロックする回数（アカウントをまたいで数える、0は無効）
+	IPThreshold int
+	// Window: 失敗を数える期間（最後の失敗からこの期間が過ぎたら数え直す）
+	Window time.Duration
+	// Duration: 最初のロックの期間（続けてロックするたびに倍にし、MaxDurationで頭打ち）
+	Duration    time.Duration
+	MaxDuration time.Duration
+	// DelayBase: 失敗したログインの応答を遅らせる時間（失敗のたびに倍にし、DelayMaxで頭打ち）
+	DelayBase time.Duration
+	DelayMax  time.Duration
+	// TrustedProxies: X-Forwarded-For を信頼するプロキシ（CIDRまたはIP、空ならRemoteAddrでIPを数える）
+	TrustedProxies []string
+}
+
+type MFAConfig struct {
+	// Issuer: 認証アプリに表示する発行者名
+	Issuer string
+	// ChallengeTTL: ログインの2段階目に使うトークン（mfa_token）の有効期限
+	ChallengeTTL time.Duration
+	// Skew: 時計のずれとして前後に受け付ける時間ステップ（30秒）の数
+	Skew int
+	// RecoveryCodes: 有効化したときに発行するリカバリーコードの数
+	RecoveryCodes int
+}
+
+// OAuthConfig はOAuth 2.0 / OpenID Connect の認可サーバー（負荷テスト用のIDプロバイダー）の設定
+type OAuthConfig struct {
+	Enabled bool
+	// Issuer: トークンの iss とディスカバリーのエンドポイントのベースURL（外から見えるURL）
+	Issuer string
+	// Clients: "ID:シークレット:リダイレクトURI|リダイレクトURI"（シークレットが空なら公開クライアント）
+	Clients OAuthClients
+	Scopes  []string
+	// SigningKeyFile: RS256の秘密鍵（PEM）。空の場合は起動ごとに生成する
+	SigningKeyFile  string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	CodeTTL         time.Duration
+}
+
+// OAuthClients は "ID:シークレット:リダイレクトURI" 形式のクライアントの一覧
+type OAuthClients []string
+
+// Redact はシークレットを mask に置き換えた一覧（GET /admin/config で返す）
+func (c OAuthClients) Redact(mask string) any {
+	specs := make([]string, len(c))
+	for i, spec := range c {
+		parts := strings.SplitN(spec, ":", 3)
+		if len(parts) >= 2 && parts[1] != "" {
+			parts[1] = mask
+		}
+		specs[i] = strings.Join(parts, ":")
+	}
+	return specs
+}
+
+// APIKeyConfig はAPIキー（JWTの代わりに Authorization: ApiKey / X-API-Key で認証する）の設定
+type APIKeyConfig struct {
+	Enabled bool
+	// RateLimit: キーごとのリクエスト数の上限（Window あたり）
+	// 有効なキーのリクエストはIPごとの RATE_LIMIT の代わりにこの上限で制限する
+	RateLimit  int
+	Window     time.Duration
+	MaxPerUser int
+}
+
+type OpenAPIConfig struct {
+	// ValidateResponses: レスポンスのスキーマ検証（デバッグ用、違反はログに出力）
+	ValidateResponses bool
+}
+
 // Load は設定を読み込む
 func Load() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Addr: getEnv("SERVER_ADDR", ":8080"),
+			Addr:  getEnv("SERVER_ADDR", ":8080"),
+			HTTP2: getEnvBool("HTTP2_ENABLED", true),
+			H2C:   getEnvBool("H2C_ENABLED", false),
+			HTTP3: HTTP3Config{
+				Enabled: getEnvBool("HTTP3_ENABLED", false),
+				Addr:    getEnv("HTTP3_ADDR", getEnv("SERVER_ADDR", ":8080")),
+			},
+			TLS: TLSConfig{
+				CertFile:     getEnv("TLS_CERT_FILE", ""),
+				KeyFile:      getEnv("TLS_KEY_FILE", ""),
+				SelfSigned:   getEnvBool("TLS_SELF_SIGNED", false),
+				ClientCAFile: getEnv("TLS_CLIENT_CA_FILE", ""),
+				ClientAuth:   getEnv("TLS_CLIENT_AUTH", "request"),
+			},
+			GRPC: GRPCConfig{
+				Enabled:    getEnvBool("GRPC_ENABLED", false),
+				Addr:       getEnv("GRPC_ADDR", ":9090"),
+				Reflection: getEnvBool("GRPC_REFLECTION", true),
+			},
+			ReadHeaderTimeout: getEnvDuration("SERVER_READ_HEADER_TIMEOUT", 5*time.Second),
+			ReadTimeout:       getEnvDuration("SERVER_READ_TIMEOUT", 30*time.Second),
+			IdleTimeout:       getEnvDuration("SERVER_IDLE_TIMEOUT", 120*time.Second),
 		},
 		RateLimit: RateLimitConfig{
 			Requests: getEnvInt("RATE_LIMIT", 100),
 			Window:   1 * time.Minute,
 		},
 		BodyLimit: 1 * 1024 * 1024, // 1MB
+		Compression: CompressionConfig{
+			Enabled:   getEnvBool("COMPRESSION_ENABLED", true),
+			Encodings: getEnvList("COMPRESSION_ENCODINGS", []string{"br", "zstd", "gzip", "deflate"}),
+			MinSize:   getEnvInt("COMPRESSION_MIN_SIZE", 1024),
+			ContentTypes: []string{
+				"application/json",
+				"application/problem+json",
+				"text/*",
+			},
+			MaxDecompressedBytes: int64(getEnvInt("DECOMPRESSED_BODY_LIMIT", 4*1024*1024)), // 4MB
+		},
 		CORS: CORSConfig{
 			AllowedOrigins: []string{
 				"http://localhost:8080",
 				"http://localhost:3000",
 				"http://127.0.0.1:8080",
 				"http://127.0.0.1:3000",
+				"https://localhost:8080",
+				"https://127.0.0.1:8080",
 			},
 			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowedHeaders: []string{"Content-Type", "Authorization", "X-Requested-With"},
+			AllowedHeaders: []string{"Content-Type", "Authorization", "X-Requested-With", "Idempotency-Key", "X-API-Key"},
 		},
 		CSRF: CSRFConfig{
 			AllowedOrigins: []string{
@@ -67,12 +424,152 @@ func Load() *Config {
 				"http://localhost:3000",
 				"http://127.0.0.1:8080",
 				"http://127.0.0.1:3000",
+				"https://localhost:8080",
+				"https://127.0.0.1:8080",
 			},
 			StrictMode: false, // 開発用
 		},
 		JWT: JWTConfig{
 			Secret: getJWTSecret(),
 		},
+		OpenAPI: OpenAPIConfig{
+			ValidateResponses: getEnvBool("VALIDATE_RESPONSES", false),
+		},
+		WebSocket: WebSocketConfig{
+			PingInterval: getEnvPositiveDuration("WS_PING_INTERVAL", 30*time.Second),
+			ReadLimit:    int64(getEnvInt("WS_READ_LIMIT", 64*1024)), // 64KB
+			WriteTimeout: getEnvPositiveDuration("WS_WRITE_TIMEOUT", 10*time.Second),
+		},
+		SSE: SSEConfig{
+			Heartbeat:    getEnvPositiveDuration("SSE_HEARTBEAT", 15*time.Second),
+			WriteTimeout: getEnvPositiveDuration("SSE_WRITE_TIMEOUT", 10*time.Second),
+			Buffer:       getEnvInt("SSE_BUFFER", 64),
+		},
+		GraphQL: GraphQLConfig{
+			MaxDepth:      getEnvInt("GRAPHQL_MAX_DEPTH", 6),
+			MaxComplexity: getEnvInt("GRAPHQL_MAX_COMPLEXITY", 1000),
+			Introspection: getEnvBool("GRAPHQL_INTROSPECTION", true),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:     getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+			MaxKeys: getEnvInt("IDEMPOTENCY_MAX_KEYS", 100000),
+		},
+		Timeout: TimeoutConfig{
+			Request: getEnvDuration("REQUEST_TIMEOUT", 10*time.Second),
+			Delay:   getEnvDuration("DELAY_TIMEOUT", 15*time.Second),
+		},
+		Concurrency: ConcurrencyConfig{
+			Enabled:       getEnvBool("CONCURRENCY_ENABLED", true),
+			GlobalLimit:   getEnvInt("CONCURRENCY_GLOBAL_LIMIT", 1000),
+			RouteLimit:    getEnvInt("CONCURRENCY_ROUTE_LIMIT", 100),
+			RouteMinLimit: getEnvInt("CONCURRENCY_ROUTE_MIN_LIMIT", 5),
+			RouteMaxLimit: getEnvInt("CONCURRENCY_ROUTE_MAX_LIMIT", 500),
+			LatencyTarget: getEnvDuration("CONCURRENCY_LATENCY_TARGET", 250*time.Millisecond),
+			QueueSize:     getEnvInt("CONCURRENCY_QUEUE_SIZE", 200),
+			QueueTimeout:  getEnvDuration("CONCURRENCY_QUEUE_TIMEOUT", time.Second),
+		},
+		Upstream: UpstreamConfig{
+			URL:                     getEnv("UPSTREAM_URL", ""),
+			Path:                    getEnv("UPSTREAM_PATH", "/v2/delay/50"),
+			Required:                getEnvBool("UPSTREAM_REQUIRED", false),
+			Timeout:                 getEnvDuration("UPSTREAM_TIMEOUT", time.Second),
+			Retries:                 getEnvInt("UPSTREAM_RETRIES", 2),
+			BackoffBase:             getEnvDuration("UPSTREAM_BACKOFF_BASE", 50*time.Millisecond),
+			BackoffMax:              getEnvDuration("UPSTREAM_BACKOFF_MAX", time.Second),
+			MaxConcurrent:           getEnvInt("UPSTREAM_MAX_CONCURRENT", 20),
+			BreakerThreshold:        getEnvInt("UPSTREAM_BREAKER_THRESHOLD", 5),
+			BreakerCooldown:         getEnvDuration("UPSTREAM_BREAKER_COOLDOWN", 5*time.Second),
+			BreakerHalfOpenRequests: getEnvInt("UPSTREAM_BREAKER_HALF_OPEN_REQUESTS", 1),
+		},
+		// OpenTelemetryの標準の環境変数名を使う
+		Tracing: TracingConfig{
+			Exporter:        getEnv("OTEL_TRACES_EXPORTER", "none"),
+			Endpoint:        getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318"),
+			ServiceName:     getEnv("OTEL_SERVICE_NAME", "k6-practice-api"),
+			SampleRatio:     getEnvFloat("OTEL_TRACES_SAMPLER_ARG", 1),
+			MiddlewareSpans: getEnvBool("TRACING_MIDDLEWARE_SPANS", false),
+		},
+		LogLevel: getEnv("LOG_LEVEL", "info"),
+		Admin: AdminConfig{
+			Enabled: getEnvBool("ADMIN_ENABLED", false),
+			Addr:    getEnv("ADMIN_ADDR", "127.0.0.1:6060"),
+			Token:   getEnv("ADMIN_TOKEN", ""),
+			Profiling: ProfilingConfig{
+				Enabled:           getEnvBool("PROFILING_ENABLED", false),
+				Interval:          getEnvDuration("PROFILING_INTERVAL", 5*time.Second),
+				LatencyThreshold:  getEnvDuration("PROFILING_LATENCY_THRESHOLD", 500*time.Millisecond),
+				InFlightThreshold: getEnvInt("PROFILING_IN_FLIGHT_THRESHOLD", 500),
+				CPUDuration:       getEnvDuration("PROFILING_CPU_DURATION", 10*time.Second),
+				Cooldown:          getEnvDuration("PROFILING_COOLDOWN", time.Minute),
+				Dir:               getEnv("PROFILING_DIR", filepath.Join(os.TempDir(), "k6-practice-profiles")),
+				MaxProfiles:       getEnvInt("PROFILING_MAX_PROFILES", 30),
+			},
+		},
+		Security: SecurityConfig{
+			Log:               getEnvBool("SECURITY_LOG", true),
+			File:              getEnv("SECURITY_EVENTS_FILE", ""),
+			FileMaxBytes:      int64(getEnvInt("SECURITY_EVENTS_FILE_MAX_BYTES", 10*1024*1024)), // 10MB
+			FileMaxBackups:    getEnvInt("SECURITY_EVENTS_FILE_MAX_BACKUPS", 5),
+			WebhookURL:        getEnv("SECURITY_WEBHOOK_URL", ""),
+			WebhookAlertsOnly: getEnvBool("SECURITY_WEBHOOK_ALERTS_ONLY", true),
+			WebhookTimeout:    getEnvDuration("SECURITY_WEBHOOK_TIMEOUT", 5*time.Second),
+			SyslogAddr:        getEnv("SECURITY_SYSLOG_ADDR", ""),
+			Buffer:            getEnvInt("SECURITY_EVENTS_BUFFER", 1000),
+			AlertRules: getEnvList("SECURITY_ALERT_RULES", []string{
+				"AUTH_FAILURE:20/1m",
+				"UNAUTHORIZED:50/1m",
+				"CSRF_BLOCKED:10/1m",
+				"SUSPICIOUS_INPUT:5/1m",
+				"RATE_LIMIT_HIT:100/1m",
+			}),
+		},
+		Lockout: LockoutConfig{
+			AccountThreshold: getEnvInt("LOCKOUT_ACCOUNT_THRESHOLD", 5),
+			IPThreshold:      getEnvInt("LOCKOUT_IP_THRESHOLD", 20),
+			Window:           getEnvDuration("LOCKOUT_WINDOW", 15*time.Minute),
+			Duration:         getEnvDuration("LOCKOUT_DURATION", time.Minute),
+			MaxDuration:      getEnvDuration("LOCKOUT_MAX_DURATION", time.Hour),
+			DelayBase:        getEnvDuration("LOCKOUT_DELAY_BASE", 100*time.Millisecond),
+			DelayMax:         getEnvDuration("LOCKOUT_DELAY_MAX", 2*time.Second),
+			TrustedProxies:   getEnvList("LOCKOUT_TRUSTED_PROXIES", nil),
+		},
+		MFA: MFAConfig{
+			Issuer:        getEnv("MFA_ISSUER", "k6-practice-api"),
+			ChallengeTTL:  getEnvDuration("MFA_CHALLENGE_TTL", 5*time.Minute),
+			Skew:          getEnvInt("MFA_SKEW", 1),
+			RecoveryCodes: getEnvInt("MFA_RECOVERY_CODES", 10),
+		},
+		OAuth: OAuthConfig{
+			Enabled: getEnvBool("OAUTH_ENABLED", false),
+			Issuer:  getEnv("OAUTH_ISSUER", "http://localhost:8080"),
+			Clients: getEnvList("OAUTH_CLIENTS", []string{
+				"k6-service:k6-service-secret",
+				"k6-web::http://localhost:3000/callback",
+			}),
+			Scopes:          getEnvList("OAUTH_SCOPES", []string{"openid", "profile", "email", "users:read", "users:write"}),
+			SigningKeyFile:  getEnv("OAUTH_SIGNING_KEY_FILE", ""),
+			AccessTokenTTL:  getEnvDuration("OAUTH_ACCESS_TOKEN_TTL", 15*time.Minute),
+			RefreshTokenTTL: getEnvDuration("OAUTH_REFRESH_TOKEN_TTL", 24*time.Hour),
+			CodeTTL:         getEnvDuration("OAUTH_CODE_TTL", time.Minute),
+		},
+		APIKeys: APIKeyConfig{
+			Enabled:    getEnvBool("APIKEY_ENABLED", true),
+			RateLimit:  getEnvInt("APIKEY_RATE_LIMIT", 600),
+			Window:     getEnvDuration("APIKEY_RATE_WINDOW", time.Minute),
+			MaxPerUser: getEnvInt("APIKEY_MAX_PER_USER", 10),
+		},
+		Cache: CacheConfig{
+			UsersPolicy:             getEnv("CACHE_CONTROL_USERS", "private, no-cache"),
+			DocsPolicy:              getEnv("CACHE_CONTROL_DOCS", "public, max-age=300"),
+			ResponseCache:           getEnvBool("RESPONSE_CACHE_ENABLED", false),
+			ResponseCacheTTL:        getEnvDuration("RESPONSE_CACHE_TTL", 5*time.Second),
+			ResponseCacheMaxEntries: getEnvInt("RESPONSE_CACHE_MAX_ENTRIES", 10000),
+		},
+		API: APIConfig{
+			DefaultVersion: getEnv("API_DEFAULT_VERSION", "v1"),
+			V1DeprecatedAt: getEnvTime("API_V1_DEPRECATED_AT", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)),
+			V1Sunset:       getEnvTime("API_V1_SUNSET", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)),
+		},
 	}
 }
 
@@ -92,6 +589,67 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvBool(key string, defaultValue bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
+
+// getEnvDuration は "30s" のような time.ParseDuration 形式の期間を読み込む
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// getEnvPositiveDuration は getEnvDuration と同じだが、0以下の値は既定値にする（ティッカーの間隔やタイムアウトに使う）
+func getEnvPositiveDuration(key string, defaultValue time.Duration) time.Duration {
+	if d := getEnvDuration(key, defaultValue); d > 0 {
+		return d
+	}
+	return defaultValue
+}
+
+// getEnvList はカンマ区切りのリストを読み込む
+func getEnvList(key string, defaultValue []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvTime はRFC 3339形式の日時を読み込む
+func getEnvTime(key string, defaultValue time.Time) time.Time {
+	if v := os.Getenv(key); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t
+		}
+	}
+	return defaultValue
+}
+
 func getJWTSecret() []byte {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
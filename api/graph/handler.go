@@ -0,0 +1,188 @@
+package graph
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/complexity"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"k6-practice/api/metrics"
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+)
+
+// HandlerConfig はGraphQLエンドポイントの設定
+type HandlerConfig struct {
+	// MaxDepth: フィールドのネストの上限（イントロスペクションのフィールドは数えない）
+	MaxDepth int
+	// MaxComplexity: クエリの複雑さの上限（1フィールド1、users は first 倍で数える）
+	MaxComplexity int
+	// Introspection: スキーマのイントロスペクションを許可する
+	Introspection bool
+}
+
+// Request は POST /graphql のボディ（OpenAPIドキュメント用）
+type Request struct {
+	Query         string                 `json:"query" openapi:"required,minLength=1"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Response は POST /graphql のレスポンス（OpenAPIドキュメント用）
+type Response struct {
+	Data       interface{}            `json:"data,omitempty"`
+	Errors     []ResponseError        `json:"errors,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type ResponseError struct {
+	Message    string                 `json:"message" openapi:"required"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  []interface{}          `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// GraphQLの統計（操作名ごと。HTTPのルート名はすべて同じになるため）
+var (
+	gqlOperations = new(expvar.Map).Init()
+	gqlErrors     = new(expvar.Map).Init()
+	gqlDurations  = new(expvar.Map).Init()
+	gqlRejected   = new(expvar.Map).Init()
+)
+
+func init() {
+	m := new(expvar.Map).Init()
+	m.Set("operations", gqlOperations)
+	m.Set("errors", gqlErrors)
+	m.Set("duration_ms_total", gqlDurations)
+	m.Set("rejected", gqlRejected)
+	metrics.Set("graphql", m)
+}
+
+// NewHandler は POST /graphql のハンドラーを作成する
+func NewHandler(store *models.UserStore, cfg HandlerConfig) http.Handler {
+	var c ComplexityRoot
+	// 一覧は取得件数に比例して重くなる
+	c.Query.Users = func(childComplexity int, first *int, after *string) int {
+		return 1 + max(pageSize(first), 1)*childComplexity
+	}
+
+	srv := handler.New(NewExecutableSchema(Config{
+		Resolvers:  &Resolver{store: store},
+		Complexity: c,
+	}))
+	srv.AddTransport(transport.POST{})
+	// 同じクエリ文字列の解析・検証結果を再利用する（負荷テストでは同じクエリが繰り返される）
+	srv.SetQueryCache(lru.New(1000))
+	if cfg.Introspection {
+		srv.Use(extension.Introspection{})
+	}
+	srv.Use(&limits{maxDepth: cfg.MaxDepth, maxComplexity: cfg.MaxComplexity})
+	srv.AroundResponses(observe)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// リゾルバーがセキュリティイベントを記録できるようにする
+		ctx := context.WithValue(r.Context(), requestContextKey{}, r)
+		srv.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// limits は実行前にクエリの深さと複雑さを検証する
+// A04:2021 - Insecure Design 対策（深いネストや大量取得によるDoS防止）
+type limits struct {
+	maxDepth      int
+	maxComplexity int
+	es            graphql.ExecutableSchema
+}
+
+func (l *limits) ExtensionName() string {
+	return "Limits"
+}
+
+func (l *limits) Validate(es graphql.ExecutableSchema) error {
+	l.es = es
+	return nil
+}
+
+func (l *limits) MutateOperationContext(ctx context.Context, oc *graphql.OperationContext) *gqlerror.Error {
+	op := oc.Doc.Operations.ForName(oc.OperationName)
+	if op == nil {
+		return nil
+	}
+
+	if depth := selectionDepth(op.SelectionSet); depth > l.maxDepth {
+		gqlRejected.Add("depth", 1)
+		err := gqlerror.Errorf("operation has depth %d, which exceeds the limit of %d", depth, l.maxDepth)
+		errcode.Set(err, "DEPTH_LIMIT_EXCEEDED")
+		return err
+	}
+	if c := complexity.Calculate(l.es, op, oc.Variables); c > l.maxComplexity {
+		gqlRejected.Add("complexity", 1)
+		err := gqlerror.Errorf("operation has complexity %d, which exceeds the limit of %d", c, l.maxComplexity)
+		errcode.Set(err, "COMPLEXITY_LIMIT_EXCEEDED")
+		return err
+	}
+	return nil
+}
+
+// selectionDepth はフィールドのネストの深さを返す（フラグメントは展開して数える）
+// フラグメントの循環はパース時の検証で拒否される
+func selectionDepth(set ast.SelectionSet) int {
+	depth := 0
+	for _, sel := range set {
+		d := 0
+		switch s := sel.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name, "__") {
+				continue
+			}
+			d = 1 + selectionDepth(s.SelectionSet)
+		case *ast.InlineFragment:
+			d = selectionDepth(s.SelectionSet)
+		case *ast.FragmentSpread:
+			if s.Definition != nil {
+				d = selectionDepth(s.Definition.SelectionSet)
+			}
+		}
+		depth = max(depth, d)
+	}
+	return depth
+}
+
+// observe は操作名ごとの件数・エラー・処理時間を記録する
+func observe(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	start := time.Now()
+	resp := next(ctx)
+
+	name := graphql.GetOperationContext(ctx).OperationName
+	if name == "" {
+		name = "anonymous"
+	}
+	gqlOperations.Add(name, 1)
+	gqlDurations.AddFloat(name, float64(time.Since(start))/float64(time.Millisecond))
+	if resp != nil && len(resp.Errors) > 0 {
+		gqlErrors.Add(name, 1)
+	}
+	return resp
+}
+
+type requestContextKey struct{}
+
+// logSecurityEvent はGraphQLのリクエストに対するセキュリティイベントを記録する
+func logSecurityEvent(ctx context.Context, event middleware.SecurityEvent, details string) {
+	if r, ok := ctx.Value(requestContextKey{}).(*http.Request); ok {
+		middleware.LogSecurityEvent(event, r, details)
+	}
+}
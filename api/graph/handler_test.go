@@ -0,0 +1,131 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+)
+
+var testHandlerConfig = HandlerConfig{
+	MaxDepth:      6,
+	MaxComplexity: 1000,
+	Introspection: true,
+}
+
+type testResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// do はクエリをPOSTしてレスポンスを返す（claimsがあれば認証済みとして扱う）
+func do(t *testing.T, h http.Handler, claims *middleware.Claims, query string, variables map[string]interface{}) (int, testResponse) {
+	t.Helper()
+
+	body, _ := json.Marshal(Request{Query: query, Variables: variables})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if claims != nil {
+		req = req.WithContext(middleware.NewContext(req.Context(), claims))
+	}
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	var resp testResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+// errorCode は最初のエラーの extensions.code を返す
+func (r testResponse) errorCode() string {
+	if len(r.Errors) == 0 {
+		return ""
+	}
+	code, _ := r.Errors[0].Extensions["code"].(string)
+	return code
+}
+
+func TestNewHandler_Limits(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          HandlerConfig
+		query        string
+		expectedCode string
+	}{
+		{
+			name:  "within limits",
+			cfg:   testHandlerConfig,
+			query: `{ users(first: 100) { nodes { id name email } totalCount } }`,
+		},
+		{
+			name:         "too deep",
+			cfg:          HandlerConfig{MaxDepth: 2, MaxComplexity: 1000},
+			query:        `{ users { nodes { id } } }`,
+			expectedCode: "DEPTH_LIMIT_EXCEEDED",
+		},
+		{
+			name:         "fragments count toward depth",
+			cfg:          HandlerConfig{MaxDepth: 2, MaxComplexity: 1000},
+			query:        `{ ...Page } fragment Page on Query { users { ... on UserConnection { nodes { id } } } }`,
+			expectedCode: "DEPTH_LIMIT_EXCEEDED",
+		},
+		{
+			name:  "introspection does not count toward depth",
+			cfg:   HandlerConfig{MaxDepth: 1, MaxComplexity: 1000, Introspection: true},
+			query: `{ __schema { types { name fields { name type { name ofType { name } } } } } }`,
+		},
+		{
+			name:         "page size multiplies complexity",
+			cfg:          HandlerConfig{MaxDepth: 6, MaxComplexity: 100},
+			query:        `{ users(first: 50) { nodes { id name } } }`,
+			expectedCode: "COMPLEXITY_LIMIT_EXCEEDED",
+		},
+		{
+			name:         "aliases add up",
+			cfg:          HandlerConfig{MaxDepth: 6, MaxComplexity: 100},
+			query:        `{ a: users(first: 20) { nodes { id } } b: users(first: 20) { nodes { id } } c: users(first: 20) { nodes { id } } }`,
+			expectedCode: "COMPLEXITY_LIMIT_EXCEEDED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, resp := do(t, NewHandler(models.NewUserStore(), tt.cfg), nil, tt.query, nil)
+
+			if code := resp.errorCode(); code != tt.expectedCode {
+				t.Errorf("expected error code %q, got %q (%+v)", tt.expectedCode, code, resp.Errors)
+			}
+		})
+	}
+}
+
+func TestNewHandler_ParseError(t *testing.T) {
+	status, resp := do(t, NewHandler(models.NewUserStore(), testHandlerConfig), nil, `{ users {`, nil)
+
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, status)
+	}
+	if code := resp.errorCode(); code != "GRAPHQL_PARSE_FAILED" {
+		t.Errorf("expected error code GRAPHQL_PARSE_FAILED, got %q", code)
+	}
+}
+
+func TestNewHandler_IntrospectionDisabled(t *testing.T) {
+	h := NewHandler(models.NewUserStore(), HandlerConfig{MaxDepth: 6, MaxComplexity: 1000})
+
+	_, resp := do(t, h, nil, `{ __schema { queryType { name } } }`, nil)
+
+	if len(resp.Errors) == 0 || resp.Errors[0].Message != "introspection disabled" {
+		t.Errorf("expected introspection to be rejected, got %+v", resp.Errors)
+	}
+}
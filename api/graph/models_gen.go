@@ -0,0 +1,31 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package graph
+
+import (
+	"k6-practice/api/models"
+)
+
+type Mutation struct {
+}
+
+type PageInfo struct {
+	// 次のページを取得するときに after に渡す値
+	EndCursor   *string `json:"endCursor,omitempty"`
+	HasNextPage bool    `json:"hasNextPage"`
+}
+
+type Query struct {
+}
+
+// ユーザーの1ページ分
+type UserConnection struct {
+	Nodes      []*models.User `json:"nodes"`
+	PageInfo   *PageInfo      `json:"pageInfo"`
+	TotalCount int            `json:"totalCount"`
+}
+
+type UserInput struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
@@ -0,0 +1,233 @@
+package graph
+
+//go:generate go run github.com/99designs/gqlgen@v0.17.49 generate
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"k6-practice/api/handlers"
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+	"k6-practice/api/problem"
+)
+
+// MaxPageSize は users の first の上限
+const MaxPageSize = 100
+
+// Resolver はRESTの UsersHandler・AuthHandler と同じUserStoreを使う
+type Resolver struct {
+	store *models.UserStore
+}
+
+// CreateUser is the resolver for the createUser field.
+func (r *mutationResolver) CreateUser(ctx context.Context, input UserInput) (*models.User, error) {
+	if err := requireScope(ctx, handlers.ScopeUsersWrite); err != nil {
+		return nil, err
+	}
+	name, email, err := validateUser(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.store.CreateContext(ctx, name, email)
+	if err != nil {
+		return nil, contextError(err)
+	}
+	return user, nil
+}
+
+// UpdateUser is the resolver for the updateUser field.
+func (r *mutationResolver) UpdateUser(ctx context.Context, id int, input UserInput) (*models.User, error) {
+	if err := requireScope(ctx, handlers.ScopeUsersWrite); err != nil {
+		return nil, err
+	}
+	if !middleware.ValidateID(id) {
+		return nil, codeError(problem.CodeInvalidParameter, "invalid user id")
+	}
+	name, email, err := validateUser(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := r.store.UpdateContext(ctx, id, name, email)
+	if err != nil {
+		return nil, contextError(err)
+	}
+	if user == nil {
+		return nil, codeError(problem.CodeUserNotFound, "user not found")
+	}
+	return user, nil
+}
+
+// DeleteUser is the resolver for the deleteUser field.
+func (r *mutationResolver) DeleteUser(ctx context.Context, id int) (bool, error) {
+	if err := requireScope(ctx, handlers.ScopeUsersWrite); err != nil {
+		return false, err
+	}
+	if !middleware.ValidateID(id) {
+		return false, codeError(problem.CodeInvalidParameter, "invalid user id")
+	}
+	deleted, err := r.store.DeleteContext(ctx, id)
+	if err != nil {
+		return false, contextError(err)
+	}
+	if !deleted {
+		return false, codeError(problem.CodeUserNotFound, "user not found")
+	}
+	return true, nil
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, first *int, after *string) (*UserConnection, error) {
+	if err := requireScope(ctx, handlers.ScopeUsersRead); err != nil {
+		return nil, err
+	}
+	size := pageSize(first)
+	if size < 1 || size > MaxPageSize {
+		return nil, codeError(problem.CodeInvalidParameter, "first must be between 1 and "+strconv.Itoa(MaxPageSize))
+	}
+	afterID := 0
+	if after != nil {
+		id, ok := decodeCursor(*after)
+		if !ok {
+			return nil, codeError(problem.CodeInvalidParameter, "invalid cursor")
+		}
+		afterID = id
+	}
+
+	// ページングが安定するようIDの昇順で返す
+	users, err := r.store.ListContext(ctx)
+	if err != nil {
+		return nil, contextError(err)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	start := sort.Search(len(users), func(i int) bool { return users[i].ID > afterID })
+	end := min(start+size, len(users))
+
+	conn := &UserConnection{
+		Nodes:      users[start:end],
+		PageInfo:   &PageInfo{HasNextPage: end < len(users)},
+		TotalCount: len(users),
+	}
+	if end > start {
+		cursor := encodeCursor(users[end-1].ID)
+		conn.PageInfo.EndCursor = &cursor
+	}
+	return conn, nil
+}
+
+// User is the resolver for the user field.
+func (r *queryResolver) User(ctx context.Context, id int) (*models.User, error) {
+	if err := requireScope(ctx, handlers.ScopeUsersRead); err != nil {
+		return nil, err
+	}
+	if !middleware.ValidateID(id) {
+		return nil, codeError(problem.CodeInvalidParameter, "invalid user id")
+	}
+	// 存在しない場合はnull
+	user, err := r.store.GetContext(ctx, id)
+	if err != nil {
+		return nil, contextError(err)
+	}
+	return user, nil
+}
+
+// Me is the resolver for the me field.
+func (r *queryResolver) Me(ctx context.Context) (*models.Claims, error) {
+	claims := middleware.GetUserFromContext(ctx)
+	if claims == nil {
+		return nil, codeError(problem.CodeUnauthorized, "unauthorized")
+	}
+	if err := requireScope(ctx, handlers.ScopeUsersRead); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Mutation returns MutationResolver implementation.
+func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+type mutationResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
+
+// validateUser はRESTのリクエストボディと同じサニタイズとバリデーションを行う
+func validateUser(ctx context.Context, input UserInput) (string, string, error) {
+	if middleware.IsSuspicious(input.Name, input.Email) {
+		logSecurityEvent(ctx, middleware.EventSuspiciousInput, "possible injection in user fields")
+	}
+	name := middleware.SanitizeString(input.Name)
+	email := middleware.SanitizeString(input.Email)
+
+	if name == "" || email == "" {
+		return "", "", codeError(problem.CodeInvalidBody, "name and email are required")
+	}
+	if !middleware.ValidateName(name) {
+		logSecurityEvent(ctx, middleware.EventInvalidInput, "invalid name format")
+		return "", "", codeError(problem.CodeInvalidBody, "invalid name format")
+	}
+	if !middleware.ValidateEmail(email) {
+		logSecurityEvent(ctx, middleware.EventInvalidInput, "invalid email format")
+		return "", "", codeError(problem.CodeInvalidBody, "invalid email format")
+	}
+	return name, email, nil
+}
+
+// pageSize は first の値（未指定はスキーマの既定値と同じ20）
+func pageSize(first *int) int {
+	if first == nil {
+		return 20
+	}
+	return *first
+}
+
+// カーソルはIDを隠すためにbase64にする（クライアントは中身に依存しない）
+const cursorPrefix = "user:"
+
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false
+	}
+	raw, ok := strings.CutPrefix(string(b), cursorPrefix)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id < 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// codeError はRESTのProblemと同じコードを extensions.code に持つエラー
+func codeError(code problem.Code, message string) *gqlerror.Error {
+	err := gqlerror.Errorf("%s", message)
+	errcode.Set(err, string(code))
+	return err
+}
+
+// requireScope はRESTの middleware.RequireScope と同じく、APIキーのスコープを確認する（匿名・JWTは制限なし）
+func requireScope(ctx context.Context, scope string) error {
+	if claims := middleware.GetUserFromContext(ctx); claims != nil && !claims.HasScope(scope) {
+		return codeError(problem.CodeInsufficientScope, "requires scope "+scope)
+	}
+	return nil
+}
+
+// contextError はリクエストが終了して中断した場合のエラー（RESTの503と同じコード）
+func contextError(err error) *gqlerror.Error {
+	return codeError(problem.CodeTimeout, err.Error())
+}
@@ -0,0 +1,151 @@
+package graph
+
+import (
+	"encoding/json"
+	"testing"
+
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+)
+
+type testUserConnection struct {
+	Nodes []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"nodes"`
+	PageInfo struct {
+		EndCursor   *string `json:"endCursor"`
+		HasNextPage bool    `json:"hasNextPage"`
+	} `json:"pageInfo"`
+	TotalCount int `json:"totalCount"`
+}
+
+func TestResolver_UsersPagination(t *testing.T) {
+	h := NewHandler(models.NewUserStore(), testHandlerConfig)
+	const query = `query Page($after: String) {
+		users(first: 2, after: $after) { nodes { id name } pageInfo { endCursor hasNextPage } totalCount }
+	}`
+
+	var ids []string
+	var after interface{}
+	for page := 0; page < 3; page++ {
+		_, resp := do(t, h, nil, query, map[string]interface{}{"after": after})
+		if len(resp.Errors) > 0 {
+			t.Fatalf("unexpected errors: %+v", resp.Errors)
+		}
+
+		var conn testUserConnection
+		json.Unmarshal(resp.Data["users"], &conn)
+		if conn.TotalCount != 3 {
+			t.Errorf("expected totalCount 3, got %d", conn.TotalCount)
+		}
+		for _, n := range conn.Nodes {
+			ids = append(ids, n.ID)
+		}
+		if !conn.PageInfo.HasNextPage {
+			break
+		}
+		after = *conn.PageInfo.EndCursor
+	}
+
+	expected := []string{"1", "2", "3"}
+	if len(ids) != len(expected) {
+		t.Fatalf("expected ids %v, got %v", expected, ids)
+	}
+	for i := range expected {
+		if ids[i] != expected[i] {
+			t.Errorf("expected ids %v, got %v", expected, ids)
+			break
+		}
+	}
+}
+
+// APIキーのユーザー（スコープで操作を制限する）
+var (
+	readKey  = &middleware.Claims{UserID: 1, AuthMethod: middleware.AuthMethodAPIKey, Scopes: []string{"users:read"}}
+	writeKey = &middleware.Claims{UserID: 1, AuthMethod: middleware.AuthMethodAPIKey, Scopes: []string{"users:write"}}
+)
+
+func TestResolver_Queries(t *testing.T) {
+	h := NewHandler(models.NewUserStore(), testHandlerConfig)
+
+	tests := []struct {
+		name         string
+		claims       *middleware.Claims
+		query        string
+		expectedData string
+		expectedCode string
+	}{
+		{"get user", nil, `{ user(id: 2) { name } }`, `{"name":"Bob"}`, ""},
+		{"missing user is null", nil, `{ user(id: 999) { name } }`, `null`, ""},
+		{"invalid user id", nil, `{ user(id: 0) { name } }`, ``, "invalid_parameter"},
+		{"page size above limit", nil, `{ users(first: 101) { totalCount } }`, ``, "invalid_parameter"},
+		{"invalid cursor", nil, `{ users(after: "!!") { totalCount } }`, ``, "invalid_parameter"},
+		{"me requires authentication", nil, `{ me { email } }`, ``, "unauthorized"},
+		{"me returns claims", &middleware.Claims{UserID: 1, Email: "alice@example.com"}, `{ me { userId email } }`, `{"userId":"1","email":"alice@example.com"}`, ""},
+		{"read key gets users", readKey, `{ user(id: 2) { name } }`, `{"name":"Bob"}`, ""},
+		{"write key cannot get users", writeKey, `{ user(id: 2) { name } }`, ``, "insufficient_scope"},
+		{"write key cannot list users", writeKey, `{ users { totalCount } }`, ``, "insufficient_scope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, resp := do(t, h, tt.claims, tt.query, nil)
+
+			if code := resp.errorCode(); code != tt.expectedCode {
+				t.Fatalf("expected error code %q, got %q (%+v)", tt.expectedCode, code, resp.Errors)
+			}
+			if tt.expectedData == "" {
+				return
+			}
+			for _, v := range resp.Data {
+				if string(v) != tt.expectedData {
+					t.Errorf("expected data %s, got %s", tt.expectedData, v)
+				}
+			}
+		})
+	}
+}
+
+func TestResolver_Mutations(t *testing.T) {
+	store := models.NewUserStore()
+	h := NewHandler(store, testHandlerConfig)
+
+	tests := []struct {
+		name         string
+		claims       *middleware.Claims
+		query        string
+		expectedCode string
+	}{
+		{"read key cannot create users", readKey, `mutation { createUser(input: {name: "Eve", email: "eve@example.com"}) { id } }`, "insufficient_scope"},
+		{"read key cannot delete users", readKey, `mutation { deleteUser(id: 1) }`, "insufficient_scope"},
+		{"create user", writeKey, `mutation { createUser(input: {name: "Dave", email: "dave@example.com"}) { id } }`, ""},
+		{"create with invalid email", nil, `mutation { createUser(input: {name: "Dave", email: "not-an-email"}) { id } }`, "invalid_body"},
+		{"create with sanitized empty name", nil, `mutation { createUser(input: {name: "<script>", email: "dave@example.com"}) { id } }`, "invalid_body"},
+		{"update user", nil, `mutation { updateUser(id: 2, input: {name: "Robert", email: "robert@example.com"}) { name } }`, ""},
+		{"update missing user", nil, `mutation { updateUser(id: 999, input: {name: "Nobody", email: "nobody@example.com"}) { name } }`, "user_not_found"},
+		{"delete user", nil, `mutation { deleteUser(id: 3) }`, ""},
+		{"delete missing user", nil, `mutation { deleteUser(id: 3) }`, "user_not_found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, resp := do(t, h, tt.claims, tt.query, nil)
+
+			if code := resp.errorCode(); code != tt.expectedCode {
+				t.Errorf("expected error code %q, got %q (%+v)", tt.expectedCode, code, resp.Errors)
+			}
+		})
+	}
+
+	// RESTと同じストアが更新されている
+	if u := store.Get(2); u == nil || u.Name != "Robert" {
+		t.Errorf("expected store to be updated, got %+v", u)
+	}
+	if store.Get(3) != nil {
+		t.Error("expected user 3 to be deleted")
+	}
+	if store.FindByEmail("dave@example.com") == nil {
+		t.Error("expected Dave to be created")
+	}
+}
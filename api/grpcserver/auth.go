@@ -0,0 +1,182 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"k6-practice/api/handlers"
+	"k6-practice/api/middleware"
+	userv1 "k6-practice/api/proto/user/v1"
+	"k6-practice/api/requestid"
+	"k6-practice/api/security"
+)
+
+// authService はRESTの AuthHandler と同じトークンの発行・検証をgRPCで提供する
+type authService struct {
+	userv1.UnimplementedAuthServiceServer
+	auth *handlers.AuthHandler
+}
+
+func (s *authService) Login(ctx context.Context, req *userv1.LoginRequest) (*userv1.LoginResponse, error) {
+	tokens, err := s.auth.Authenticate(ctx, req.GetEmail(), req.GetPassword(), peerIP(ctx))
+	var locked *handlers.LockoutError
+	if errors.As(err, &locked) {
+		if locked.Triggered {
+			logSecurityEvent(ctx, middleware.EventAuthFailure, "invalid credentials")
+			logSecurityEvent(ctx, middleware.EventAccountLocked, locked.Error())
+		} else {
+			logSecurityEvent(ctx, middleware.EventAuthFailure, "login locked: "+locked.Scope)
+		}
+		return nil, status.Error(codes.ResourceExhausted, "too many failed login attempts, retry later")
+	}
+	// LoginResponse にはチャレンジの項目がないため、トークンをトレーラーで返す
+	// 2段階目はRESTの POST /auth/mfa/challenge で行う
+	var challenge *handlers.MFARequiredError
+	if errors.As(err, &challenge) {
+		grpc.SetTrailer(ctx, metadata.Pairs(mfaTokenTrailer, challenge.Token))
+		return nil, status.Error(codes.FailedPrecondition, "mfa required")
+	}
+	if errors.Is(err, handlers.ErrInvalidCredentials) {
+		logSecurityEvent(ctx, middleware.EventAuthFailure, "invalid credentials")
+		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+	}
+	if ctx.Err() != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to generate token")
+	}
+	logSecurityEvent(ctx, middleware.EventAuthSuccess, "login")
+	return &userv1.LoginResponse{Tokens: toTokenPair(tokens)}, nil
+}
+
+func (s *authService) Refresh(ctx context.Context, req *userv1.RefreshRequest) (*userv1.RefreshResponse, error) {
+	tokens, err := s.auth.RefreshTokens(ctx, req.GetRefreshToken())
+	if errors.Is(err, handlers.ErrInvalidRefreshToken) {
+		logSecurityEvent(ctx, middleware.EventAuthFailure, "invalid refresh token")
+		return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to generate token")
+	}
+	logSecurityEvent(ctx, middleware.EventAuthSuccess, "token refreshed")
+	return &userv1.RefreshResponse{Tokens: toTokenPair(tokens)}, nil
+}
+
+// Me はauthRequiredに含まれるため、unaryAuthの後段で呼ばれる
+func (s *authService) Me(ctx context.Context, req *userv1.MeRequest) (*userv1.MeResponse, error) {
+	claims := middleware.GetUserFromContext(ctx)
+	if claims == nil {
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return &userv1.MeResponse{UserId: int64(claims.UserID), Email: claims.Email}, nil
+}
+
+func toTokenPair(t *handlers.TokenResponse) *userv1.TokenPair {
+	return &userv1.TokenPair{
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		ExpiresIn:    int32(t.ExpiresIn),
+	}
+}
+
+// mfaTokenTrailer はMFAチャレンジのトークンを返すトレーラーのキー
+const mfaTokenTrailer = "mfa-token"
+
+// authRequired は認証が必要なメソッド（RESTで middleware.Auth を通すルートと揃える）
+var authRequired = map[string]bool{
+	userv1.AuthService_Me_FullMethodName: true,
+}
+
+// unaryAuth はメタデータ authorization のBearerトークンを検証してClaimsをコンテキストに設定する
+func unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !authRequired[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	ctx, err := authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func streamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !authRequired[info.FullMethod] {
+		return handler(srv, ss)
+	}
+	ctx, err := authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+func authenticate(ctx context.Context) (context.Context, error) {
+	values := metadata.ValueFromIncomingContext(ctx, "authorization")
+	if len(values) == 0 {
+		logSecurityEvent(ctx, middleware.EventUnauthorized, "missing authorization metadata")
+		return nil, status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok {
+		logSecurityEvent(ctx, middleware.EventUnauthorized, "invalid authorization metadata format")
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization metadata format")
+	}
+
+	claims, err := middleware.ParseToken(token)
+	if err != nil {
+		detail := "invalid token"
+		if errors.Is(err, middleware.ErrTokenRevoked) {
+			detail = "token revoked"
+		}
+		logSecurityEvent(ctx, middleware.EventAuthFailure, detail)
+		return nil, status.Error(codes.Unauthenticated, detail)
+	}
+	return middleware.NewContext(ctx, claims), nil
+}
+
+// logSecurityEvent はRESTと同じセキュリティイベントをgRPCの呼び出しについて記録する
+func logSecurityEvent(ctx context.Context, event middleware.SecurityEvent, details string) {
+	e := security.Event{
+		Time:      time.Now(),
+		Type:      string(event),
+		IP:        peerIP(ctx),
+		Method:    http.MethodPost,
+		RequestID: requestid.FromContext(ctx),
+		Details:   details,
+	}
+	if method, ok := grpc.Method(ctx); ok {
+		e.Path = method
+	}
+	if ua := metadata.ValueFromIncomingContext(ctx, "user-agent"); len(ua) > 0 {
+		e.UserAgent = ua[0]
+	}
+	if claims := middleware.GetUserFromContext(ctx); claims != nil {
+		e.UserID = claims.UserID
+	}
+	middleware.SecLogger.Record(e)
+}
+
+// peerIP はクライアントのIPアドレス（RESTの middleware.ClientIP と同じくポートを除く）
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,157 @@
+package grpcserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"k6-practice/api/handlers"
+	"k6-practice/api/models"
+	userv1 "k6-practice/api/proto/user/v1"
+	"k6-practice/api/totp"
+)
+
+func TestAuthService_Login(t *testing.T) {
+	client := userv1.NewAuthServiceClient(dial(t, models.NewUserStore()))
+
+	tests := []struct {
+		name         string
+		email        string
+		password     string
+		expectedCode codes.Code
+	}{
+		{"valid credentials", "alice@example.com", "password", codes.OK},
+		{"wrong password", "alice@example.com", "wrong", codes.Unauthenticated},
+		{"unknown user", "nobody@example.com", "password", codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Login(context.Background(), &userv1.LoginRequest{Email: tt.email, Password: tt.password})
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Fatalf("expected code %s, got %s", tt.expectedCode, code)
+			}
+			if err == nil {
+				if resp.GetTokens().GetAccessToken() == "" || resp.GetTokens().GetRefreshToken() == "" {
+					t.Error("expected both tokens")
+				}
+				if resp.GetTokens().GetExpiresIn() != 900 {
+					t.Errorf("expected expires_in 900, got %d", resp.GetTokens().GetExpiresIn())
+				}
+			}
+		})
+	}
+}
+
+func TestAuthService_Lockout(t *testing.T) {
+	guard := handlers.NewLoginGuard(handlers.LockoutConfig{AccountThreshold: 2, Window: time.Minute, Duration: time.Minute})
+	client := userv1.NewAuthServiceClient(dialConfig(t, models.NewUserStore(), Config{LoginGuard: guard}))
+
+	tests := []struct {
+		name         string
+		password     string
+		expectedCode codes.Code
+	}{
+		{"first failure", "wrong", codes.Unauthenticated},
+		{"locked by this failure", "wrong", codes.ResourceExhausted},
+		{"locked even with the right password", "password", codes.ResourceExhausted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Login(context.Background(), &userv1.LoginRequest{Email: "alice@example.com", Password: tt.password})
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Fatalf("expected code %s, got %s", tt.expectedCode, code)
+			}
+		})
+	}
+}
+
+func TestAuthService_MFARequired(t *testing.T) {
+	mfa := handlers.NewMFAStore(handlers.MFAConfig{Issuer: "k6-practice-api", ChallengeTTL: time.Minute, Skew: 1, RecoveryCodes: 1})
+	secret, _, err := mfa.Enroll(1, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := totp.Code(secret, time.Now())
+	if _, err := mfa.Activate(1, code); err != nil {
+		t.Fatal(err)
+	}
+	client := userv1.NewAuthServiceClient(dialConfig(t, models.NewUserStore(), Config{MFA: mfa}))
+
+	tests := []struct {
+		name          string
+		email         string
+		expectedCode  codes.Code
+		expectedToken bool
+	}{
+		{"user with mfa", "alice@example.com", codes.FailedPrecondition, true},
+		{"user without mfa", "bob@example.com", codes.OK, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var trailer metadata.MD
+			_, err := client.Login(context.Background(), &userv1.LoginRequest{Email: tt.email, Password: "password"}, grpc.Trailer(&trailer))
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Fatalf("expected code %s, got %s", tt.expectedCode, code)
+			}
+			if got := len(trailer.Get(mfaTokenTrailer)) == 1; got != tt.expectedToken {
+				t.Errorf("expected mfa token in trailer=%v, got %v", tt.expectedToken, trailer)
+			}
+		})
+	}
+}
+
+func TestAuthService_RefreshAndMe(t *testing.T) {
+	client := userv1.NewAuthServiceClient(dial(t, models.NewUserStore()))
+	ctx := context.Background()
+
+	login, err := client.Login(ctx, &userv1.LoginRequest{Email: "bob@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	refreshed, err := client.Refresh(ctx, &userv1.RefreshRequest{RefreshToken: login.GetTokens().GetRefreshToken()})
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	_, err = client.Refresh(ctx, &userv1.RefreshRequest{RefreshToken: "invalid"})
+	if code := status.Code(err); code != codes.Unauthenticated {
+		t.Errorf("expected code %s for invalid refresh token, got %s", codes.Unauthenticated, code)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		expectedCode  codes.Code
+	}{
+		{"access token", "Bearer " + refreshed.GetTokens().GetAccessToken(), codes.OK},
+		{"missing metadata", "", codes.Unauthenticated},
+		{"wrong scheme", "Basic " + refreshed.GetTokens().GetAccessToken(), codes.Unauthenticated},
+		{"invalid token", "Bearer invalid", codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.authorization != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tt.authorization)
+			}
+
+			resp, err := client.Me(ctx, &userv1.MeRequest{})
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Fatalf("expected code %s, got %s", tt.expectedCode, code)
+			}
+			if err == nil && resp.GetEmail() != "bob@example.com" {
+				t.Errorf("expected email bob@example.com, got %q", resp.GetEmail())
+			}
+		})
+	}
+}
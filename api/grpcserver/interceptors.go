@@ -0,0 +1,87 @@
+package grpcserver
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"k6-practice/api/metrics"
+	"k6-practice/api/requestid"
+)
+
+// requestIDKey はリクエストIDを受け渡すメタデータのキー（HTTPの X-Request-ID と同じ）
+const requestIDKey = "x-request-id"
+
+// gRPCの統計（メソッドごと。RESTの requests/statuses/duration_ms_total と比較できる形）
+var (
+	grpcRequests  = new(expvar.Map).Init()
+	grpcCodes     = new(expvar.Map).Init()
+	grpcDurations = new(expvar.Map).Init()
+)
+
+func init() {
+	m := new(expvar.Map).Init()
+	m.Set("requests", grpcRequests)
+	m.Set("codes", grpcCodes)
+	m.Set("duration_ms_total", grpcDurations)
+	metrics.Set("grpc", m)
+}
+
+// serverStream はコンテキストを差し替えたServerStream
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// unaryRequestID はリクエストIDを払い出してコンテキストとレスポンスヘッダーに設定する
+// クライアントが x-request-id を送った場合は妥当な値であればそれを引き継ぐ
+func unaryRequestID(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(withRequestID(ctx), req)
+}
+
+func streamRequestID(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &serverStream{ServerStream: ss, ctx: withRequestID(ss.Context())})
+}
+
+func withRequestID(ctx context.Context) context.Context {
+	var id string
+	if values := metadata.ValueFromIncomingContext(ctx, requestIDKey); len(values) > 0 {
+		id = values[0]
+	}
+	id = requestid.Resolve(id)
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+	return requestid.NewContext(ctx, id)
+}
+
+func unaryLogging(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observe(ctx, info.FullMethod, err, time.Since(start))
+	return resp, err
+}
+
+func streamLogging(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observe(ss.Context(), info.FullMethod, err, time.Since(start))
+	return err
+}
+
+// observe は1呼び出しの結果を記録する（HTTPの Logging と同じ形式のログ）
+func observe(ctx context.Context, method string, err error, d time.Duration) {
+	code := status.Code(err)
+	grpcRequests.Add(method, 1)
+	grpcCodes.Add(method+" "+code.String(), 1)
+	grpcDurations.AddFloat(method, float64(d)/float64(time.Millisecond))
+
+	log.Printf("GRPC %s %s %s proto=grpc request_id=%s", method, code, d, requestid.FromContext(ctx))
+}
@@ -0,0 +1,47 @@
+package grpcserver
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+
+	"k6-practice/api/handlers"
+	"k6-practice/api/models"
+	userv1 "k6-practice/api/proto/user/v1"
+)
+
+// Config はgRPCサーバーの設定
+type Config struct {
+	// Reflection: サーバーリフレクションを公開する（grpcurlなどでprotoなしに呼び出せる）
+	Reflection bool
+	// LoginGuard: RESTと共有するログインの失敗回数とロック（nilの場合は数えない）
+	LoginGuard *handlers.LoginGuard
+	// MFA: RESTと共有する多要素認証の登録（nilの場合はパスワードだけでログインできる）
+	MFA *handlers.MFAStore
+}
+
+// New はRESTと同じUserStore・トークン処理を使うgRPCサーバーを作成する
+// optsにはTLSの資格情報などを渡す
+func New(store *models.UserStore, cfg Config, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(unaryRequestID, unaryLogging, unaryAuth),
+		grpc.ChainStreamInterceptor(streamRequestID, streamLogging, streamAuth),
+	)
+	s := grpc.NewServer(opts...)
+
+	userv1.RegisterUserServiceServer(s, &userService{store: store})
+	userv1.RegisterAuthServiceServer(s, &authService{auth: handlers.NewAuthHandler(store, cfg.LoginGuard, cfg.MFA)})
+
+	// grpc.health.v1（サービス名なしはサーバー全体の状態）
+	healthServer := health.NewServer()
+	for _, service := range []string{"", userv1.UserService_ServiceDesc.ServiceName, userv1.AuthService_ServiceDesc.ServiceName} {
+		healthServer.SetServingStatus(service, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthpb.RegisterHealthServer(s, healthServer)
+
+	if cfg.Reflection {
+		reflection.Register(s)
+	}
+	return s
+}
@@ -0,0 +1,107 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+
+	"k6-practice/api/models"
+	userv1 "k6-practice/api/proto/user/v1"
+)
+
+// dial はメモリ上のリスナーでサーバーを起動して接続する
+func dial(t *testing.T, store *models.UserStore) *grpc.ClientConn {
+	t.Helper()
+	return dialConfig(t, store, Config{Reflection: true})
+}
+
+func dialConfig(t *testing.T, store *models.UserStore, cfg Config) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	s := New(store, cfg)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestServer_Health(t *testing.T) {
+	client := healthpb.NewHealthClient(dial(t, models.NewUserStore()))
+
+	tests := []struct {
+		name    string
+		service string
+	}{
+		{"server", ""},
+		{"user service", userv1.UserService_ServiceDesc.ServiceName},
+		{"auth service", userv1.AuthService_ServiceDesc.ServiceName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: tt.service})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+				t.Errorf("expected SERVING, got %s", resp.GetStatus())
+			}
+		})
+	}
+}
+
+func TestServer_RequestID(t *testing.T) {
+	client := userv1.NewUserServiceClient(dial(t, models.NewUserStore()))
+
+	tests := []struct {
+		name     string
+		sent     string
+		expected string
+	}{
+		{"propagates valid id", "k6-vu1-iter2", "k6-vu1-iter2"},
+		{"replaces invalid id", "bad id!", ""},
+		{"generates missing id", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.sent != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, requestIDKey, tt.sent)
+			}
+
+			var header metadata.MD
+			if _, err := client.GetUser(ctx, &userv1.GetUserRequest{Id: 1}, grpc.Header(&header)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := header.Get(requestIDKey)
+			if len(got) != 1 || got[0] == "" {
+				t.Fatalf("expected a request id header, got %v", got)
+			}
+			if tt.expected != "" && got[0] != tt.expected {
+				t.Errorf("expected request id %q, got %q", tt.expected, got[0])
+			}
+			if tt.sent != "" && tt.expected == "" && got[0] == tt.sent {
+				t.Errorf("expected invalid request id to be replaced")
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package grpcserver
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+	userv1 "k6-practice/api/proto/user/v1"
+)
+
+// userService はRESTの UsersHandler と同じ処理をgRPCで提供する
+type userService struct {
+	userv1.UnimplementedUserServiceServer
+	store *models.UserStore
+}
+
+// ListUsers は全ユーザーを1つのレスポンスで返す（GET /users と同じ）
+// ストアの操作はクライアントのデッドライン・キャンセルを受けて中断する
+func (s *userService) ListUsers(ctx context.Context, req *userv1.ListUsersRequest) (*userv1.ListUsersResponse, error) {
+	users, err := s.store.ListContext(ctx)
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	resp := &userv1.ListUsersResponse{Users: make([]*userv1.User, 0, len(users))}
+	for _, u := range users {
+		resp.Users = append(resp.Users, toProto(u))
+	}
+	return resp, nil
+}
+
+// StreamUsers は全ユーザーを1件ずつ送る
+func (s *userService) StreamUsers(req *userv1.StreamUsersRequest, stream grpc.ServerStreamingServer[userv1.StreamUsersResponse]) error {
+	users, err := s.store.ListContext(stream.Context())
+	if err != nil {
+		return status.FromContextError(err).Err()
+	}
+	for _, u := range users {
+		if err := stream.Send(&userv1.StreamUsersResponse{User: toProto(u)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *userService) GetUser(ctx context.Context, req *userv1.GetUserRequest) (*userv1.GetUserResponse, error) {
+	id, err := userID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.store.GetContext(ctx, id)
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	if user == nil {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return &userv1.GetUserResponse{User: toProto(user)}, nil
+}
+
+func (s *userService) CreateUser(ctx context.Context, req *userv1.CreateUserRequest) (*userv1.CreateUserResponse, error) {
+	name, email, err := validateUser(req.GetName(), req.GetEmail())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.store.CreateContext(ctx, name, email)
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return &userv1.CreateUserResponse{User: toProto(user)}, nil
+}
+
+func (s *userService) UpdateUser(ctx context.Context, req *userv1.UpdateUserRequest) (*userv1.UpdateUserResponse, error) {
+	id, err := userID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	name, email, err := validateUser(req.GetName(), req.GetEmail())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.store.UpdateContext(ctx, id, name, email)
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	if user == nil {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return &userv1.UpdateUserResponse{User: toProto(user)}, nil
+}
+
+func (s *userService) DeleteUser(ctx context.Context, req *userv1.DeleteUserRequest) (*userv1.DeleteUserResponse, error) {
+	id, err := userID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := s.store.DeleteContext(ctx, id)
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	if !deleted {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return &userv1.DeleteUserResponse{}, nil
+}
+
+// userID はリクエストのIDを正の整数として取り出す
+func userID(id int64) (int, error) {
+	if !middleware.ValidateID(int(id)) {
+		return 0, status.Error(codes.InvalidArgument, "invalid user id")
+	}
+	return int(id), nil
+}
+
+// validateUser はRESTのリクエストボディと同じサニタイズとバリデーションを行う
+func validateUser(name, email string) (string, string, error) {
+	name = middleware.SanitizeString(name)
+	email = middleware.SanitizeString(email)
+
+	if name == "" || email == "" {
+		return "", "", status.Error(codes.InvalidArgument, "name and email are required")
+	}
+	if !middleware.ValidateName(name) {
+		return "", "", status.Error(codes.InvalidArgument, "invalid name format")
+	}
+	if !middleware.ValidateEmail(email) {
+		return "", "", status.Error(codes.InvalidArgument, "invalid email format")
+	}
+	return name, email, nil
+}
+
+func toProto(u *models.User) *userv1.User {
+	return &userv1.User{
+		Id:        int64(u.ID),
+		Name:      u.Name,
+		Email:     u.Email,
+		CreatedAt: timestamppb.New(u.CreatedAt),
+		UpdatedAt: timestamppb.New(u.UpdatedAt),
+	}
+}
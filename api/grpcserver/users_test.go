@@ -0,0 +1,136 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"k6-practice/api/models"
+	userv1 "k6-practice/api/proto/user/v1"
+)
+
+func TestUserService_ListUsers(t *testing.T) {
+	client := userv1.NewUserServiceClient(dial(t, models.NewUserStore()))
+
+	resp, err := client.ListUsers(context.Background(), &userv1.ListUsersRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.GetUsers()) != 3 {
+		t.Errorf("expected 3 users, got %d", len(resp.GetUsers()))
+	}
+}
+
+func TestUserService_StreamUsers(t *testing.T) {
+	client := userv1.NewUserServiceClient(dial(t, models.NewUserStore()))
+
+	stream, err := client.StreamUsers(context.Background(), &userv1.StreamUsersRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	seen := make(map[int64]bool)
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		seen[resp.GetUser().GetId()] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("expected 3 users, got %d", len(seen))
+	}
+}
+
+func TestUserService_GetUser(t *testing.T) {
+	client := userv1.NewUserServiceClient(dial(t, models.NewUserStore()))
+
+	tests := []struct {
+		name         string
+		id           int64
+		expectedCode codes.Code
+		expectedName string
+	}{
+		{"existing user", 1, codes.OK, "Alice"},
+		{"missing user", 999, codes.NotFound, ""},
+		{"zero id", 0, codes.InvalidArgument, ""},
+		{"negative id", -1, codes.InvalidArgument, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.GetUser(context.Background(), &userv1.GetUserRequest{Id: tt.id})
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Fatalf("expected code %s, got %s", tt.expectedCode, code)
+			}
+			if err == nil && resp.GetUser().GetName() != tt.expectedName {
+				t.Errorf("expected name %q, got %q", tt.expectedName, resp.GetUser().GetName())
+			}
+		})
+	}
+}
+
+func TestUserService_CreateUser(t *testing.T) {
+	client := userv1.NewUserServiceClient(dial(t, models.NewUserStore()))
+
+	tests := []struct {
+		name         string
+		req          *userv1.CreateUserRequest
+		expectedCode codes.Code
+	}{
+		{"valid user", &userv1.CreateUserRequest{Name: "Dave", Email: "dave@example.com"}, codes.OK},
+		{"missing name", &userv1.CreateUserRequest{Email: "dave@example.com"}, codes.InvalidArgument},
+		{"invalid name", &userv1.CreateUserRequest{Name: "<script>", Email: "dave@example.com"}, codes.InvalidArgument},
+		{"invalid email", &userv1.CreateUserRequest{Name: "Dave", Email: "not-an-email"}, codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.CreateUser(context.Background(), tt.req)
+			if code := status.Code(err); code != tt.expectedCode {
+				t.Fatalf("expected code %s, got %s", tt.expectedCode, code)
+			}
+			if err == nil && resp.GetUser().GetId() == 0 {
+				t.Error("expected created user to have an id")
+			}
+		})
+	}
+}
+
+func TestUserService_UpdateAndDeleteUser(t *testing.T) {
+	store := models.NewUserStore()
+	client := userv1.NewUserServiceClient(dial(t, store))
+	ctx := context.Background()
+
+	resp, err := client.UpdateUser(ctx, &userv1.UpdateUserRequest{Id: 2, Name: "Robert", Email: "robert@example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.GetUser().GetName() != "Robert" {
+		t.Errorf("expected name Robert, got %q", resp.GetUser().GetName())
+	}
+	// RESTと同じストアを更新している
+	if u := store.Get(2); u == nil || u.Name != "Robert" {
+		t.Errorf("expected store to be updated, got %+v", u)
+	}
+
+	_, err = client.UpdateUser(ctx, &userv1.UpdateUserRequest{Id: 999, Name: "Nobody", Email: "nobody@example.com"})
+	if code := status.Code(err); code != codes.NotFound {
+		t.Errorf("expected code %s, got %s", codes.NotFound, code)
+	}
+
+	if _, err := client.DeleteUser(ctx, &userv1.DeleteUserRequest{Id: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = client.DeleteUser(ctx, &userv1.DeleteUserRequest{Id: 2})
+	if code := status.Code(err); code != codes.NotFound {
+		t.Errorf("expected code %s, got %s", codes.NotFound, code)
+	}
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k6-practice/api/metrics"
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+	"k6-practice/api/problem"
+)
+
+// APIKeyConfig はAPIキーの設定
+type APIKeyConfig struct {
+	// RateLimit: キーごとのリクエスト数の上限（Window あたり、作成時にこれ以下を指定できる）
+	RateLimit int
+	Window    time.Duration
+	// MaxPerUser: ユーザーごとに作成できるキーの数
+	MaxPerUser int
+}
+
+// APIキーのスコープ
+const (
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+)
+
+// APIKeyScopes は作成時に指定できるスコープ
+var APIKeyScopes = []string{ScopeUsersRead, ScopeUsersWrite}
+
+// apiKeyPrefix はAPIキーの接頭辞（シークレットスキャンなどでキーを見分ける）
+const apiKeyPrefix = "k6_"
+
+// apiKeyIDLength はキーに含まれるID（Base32の小文字）の長さ
+const apiKeyIDLength = 8
+
+// APIキーの操作の失敗
+var (
+	ErrAPIKeyNotFound    = errors.New("api key not found")
+	ErrTooManyAPIKeys    = errors.New("too many api keys")
+	ErrInvalidAPIKeySpec = errors.New("invalid api key")
+)
+
+// APIKey はAPIキーの情報（キー自体は作成時のレスポンスでしか返さない）
+type APIKey struct {
+	ID string `json:"id" openapi:"required"`
+	// Prefix: 一覧でキーを見分けるためのキーの先頭部分（k6_<ID>）
+	Prefix     string     `json:"prefix" openapi:"required"`
+	Name       string     `json:"name" openapi:"required"`
+	Scopes     []string   `json:"scopes" openapi:"required"`
+	RateLimit  int        `json:"rate_limit" openapi:"required"`
+	CreatedAt  time.Time  `json:"created_at" openapi:"required"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// apiKeyRecord は保持するAPIキー（キーはSHA-256だけを保持する）
+type apiKeyRecord struct {
+	APIKey
+	userID int
+	hash   [sha256.Size]byte
+	// キーごとのレート制限の時間窓
+	windowStart time.Time
+	count       int
+}
+
+// APIキーの統計
+var (
+	apiKeyStats       = new(expvar.Map).Init()
+	apiKeyCreated     = new(expvar.Int)
+	apiKeyRevoked     = new(expvar.Int)
+	apiKeyAccepted    = new(expvar.Int)
+	apiKeyRejected    = new(expvar.Int)
+	apiKeyRateLimited = new(expvar.Int)
+)
+
+func init() {
+	apiKeyStats.Set("created", apiKeyCreated)
+	apiKeyStats.Set("revoked", apiKeyRevoked)
+	apiKeyStats.Set("accepted", apiKeyAccepted)
+	apiKeyStats.Set("rejected", apiKeyRejected)
+	apiKeyStats.Set("rate_limited", apiKeyRateLimited)
+	metrics.Set("api_keys", apiKeyStats)
+}
+
+// APIKeyStore はユーザーごとのAPIキーを保持し、middleware.Authenticator としてリクエストを認証する
+type APIKeyStore struct {
+	cfg   APIKeyConfig
+	users *models.UserStore
+	// now はレート制限・有効期限に使う時計（テストで進める）
+	now func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]*apiKeyRecord
+}
+
+func NewAPIKeyStore(cfg APIKeyConfig, users *models.UserStore) *APIKeyStore {
+	return &APIKeyStore{cfg: cfg, users: users, now: time.Now, keys: make(map[string]*apiKeyRecord)}
+}
+
+// Create はキーを発行する（scopes が空の場合は読み取りだけ、rateLimit が0の場合は既定値）
+func (s *APIKeyStore) Create(userID int, name string, scopes []string, rateLimit int, ttl time.Duration) (string, APIKey, error) {
+	if len(scopes) == 0 {
+		scopes = []string{ScopeUsersRead}
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(APIKeyScopes, scope) {
+			return "", APIKey{}, ErrInvalidAPIKeySpec
+		}
+	}
+	if rateLimit == 0 {
+		rateLimit = s.cfg.RateLimit
+	}
+	if rateLimit < 0 || rateLimit > s.cfg.RateLimit || ttl < 0 {
+		return "", APIKey{}, ErrInvalidAPIKeySpec
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, rec := range s.keys {
+		if rec.userID == userID {
+			count++
+		}
+	}
+	if count >= s.cfg.MaxPerUser {
+		return "", APIKey{}, ErrTooManyAPIKeys
+	}
+
+	var id, secret string
+	for id == "" || s.keys[id] != nil {
+		var err error
+		if id, secret, err = newAPIKeySecret(); err != nil {
+			return "", APIKey{}, err
+		}
+	}
+	key := apiKeyPrefix + id + "_" + secret
+
+	sorted := slices.Clone(scopes)
+	slices.Sort(sorted)
+	now := s.now()
+	rec := &apiKeyRecord{
+		APIKey: APIKey{
+			ID:        id,
+			Prefix:    apiKeyPrefix + id,
+			Name:      name,
+			Scopes:    slices.Compact(sorted),
+			RateLimit: rateLimit,
+			CreatedAt: now,
+		},
+		userID: userID,
+		hash:   sha256.Sum256([]byte(key)),
+	}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		rec.ExpiresAt = &expiresAt
+	}
+	s.keys[id] = rec
+	apiKeyCreated.Add(1)
+	return key, rec.APIKey, nil
+}
+
+// List はユーザーのキーを作成順に返す
+func (s *APIKeyStore) List(userID int) []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []APIKey{}
+	for _, rec := range s.keys {
+		if rec.userID == userID {
+			keys = append(keys, rec.APIKey)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt) || (keys[i].CreatedAt.Equal(keys[j].CreatedAt) && keys[i].ID < keys[j].ID)
+	})
+	return keys
+}
+
+// Revoke はユーザーのキーを削除する（他のユーザーのキーは ErrAPIKeyNotFound）
+func (s *APIKeyStore) Revoke(userID int, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.keys[id]
+	if !ok || rec.userID != userID {
+		return ErrAPIKeyNotFound
+	}
+	delete(s.keys, id)
+	apiKeyRevoked.Add(1)
+	return nil
+}
+
+// Reset はすべてのキーを消す（ユーザーのストアを初期化したとき）
+func (s *APIKeyStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = make(map[string]*apiKeyRecord)
+}
+
+// Authenticate は Authorization: ApiKey または X-API-Key のキーを検証する（middleware.Authenticator）
+// 受け付けたキーはキーごとのレート制限に数える
+func (s *APIKeyStore) Authenticate(r *http.Request) (*middleware.Claims, error) {
+	key := r.Header.Get("X-API-Key")
+	if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey "); ok {
+		key = v
+	}
+	if key == "" {
+		return nil, middleware.ErrNoCredentials
+	}
+
+	id, ok := parseAPIKeyID(key)
+	if !ok {
+		apiKeyRejected.Add(1)
+		return nil, middleware.ErrInvalidAPIKey
+	}
+	hash := sha256.Sum256([]byte(key))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	rec, ok := s.keys[id]
+	if !ok || subtle.ConstantTimeCompare(rec.hash[:], hash[:]) != 1 || (rec.ExpiresAt != nil && now.After(*rec.ExpiresAt)) {
+		apiKeyRejected.Add(1)
+		return nil, middleware.ErrInvalidAPIKey
+	}
+	// 削除されたユーザーのキーは使えない
+	user := s.users.Get(rec.userID)
+	if user == nil {
+		apiKeyRejected.Add(1)
+		return nil, middleware.ErrInvalidAPIKey
+	}
+
+	if now.Sub(rec.windowStart) >= s.cfg.Window {
+		rec.windowStart = now
+		rec.count = 0
+	}
+	if rec.count >= rec.RateLimit {
+		apiKeyRateLimited.Add(1)
+		return nil, &middleware.RateLimitError{Limit: rec.RateLimit, RetryAfter: rec.windowStart.Add(s.cfg.Window).Sub(now)}
+	}
+	rec.count++
+	rec.LastUsedAt = &now
+	apiKeyAccepted.Add(1)
+
+	return &middleware.Claims{
+		UserID:     user.ID,
+		Email:      user.Email,
+		AuthMethod: middleware.AuthMethodAPIKey,
+		Scopes:     slices.Clone(rec.Scopes),
+		KeyID:      rec.ID,
+	}, nil
+}
+
+// newAPIKeySecret はキーのID（40ビット）とシークレット（256ビット）を生成する
+func newAPIKeySecret() (id, secret string, err error) {
+	b := make([]byte, 5+32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	id = strings.ToLower(base32.StdEncoding.EncodeToString(b[:5]))
+	return id, base64.RawURLEncoding.EncodeToString(b[5:]), nil
+}
+
+// parseAPIKeyID は "k6_<ID>_<シークレット>" 形式のキーからIDを取り出す
+func parseAPIKeyID(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok || len(rest) <= apiKeyIDLength+1 || rest[apiKeyIDLength] != '_' {
+		return "", false
+	}
+	return rest[:apiKeyIDLength], true
+}
+
+// CreateAPIKeyRequest は POST /auth/api-keys のリクエスト
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" openapi:"required,minLength=1,maxLength=100"`
+	Scopes []string `json:"scopes,omitempty" openapi:"description=users:read（既定）・users:write。ユーザーの取得・一覧と /auth/me などは users:read、作成・更新・削除は users:write が必要"`
+	// RateLimit: 時間窓あたりのリクエスト数（省略時は APIKEY_RATE_LIMIT）
+	RateLimit int `json:"rate_limit,omitempty" openapi:"minimum=1"`
+	// ExpiresIn: 有効期限の秒数（省略時は無期限）
+	ExpiresIn int `json:"expires_in,omitempty" openapi:"minimum=1"`
+}
+
+// CreateAPIKeyResponse は作成したキー（key はこのレスポンスでしか返さない）
+type CreateAPIKeyResponse struct {
+	Key string `json:"key" openapi:"required"`
+	APIKey
+}
+
+// APIKeysHandler は自分のAPIキーを管理するエンドポイント（middleware.Auth の後段で呼ばれる）
+type APIKeysHandler struct {
+	store *APIKeyStore
+}
+
+func NewAPIKeysHandler(store *APIKeyStore) *APIKeysHandler {
+	return &APIKeysHandler{store: store}
+}
+
+// principal はキーを管理できるユーザー（APIキーでAPIキーを作成・削除させない）
+func (h *APIKeysHandler) principal(w http.ResponseWriter, r *http.Request) *middleware.Claims {
+	return accountPrincipal(w, r, "manage api keys")
+}
+
+// accountPrincipal はアカウントの資格情報（APIキー・多要素認証）を変更できるユーザー
+// 漏れたAPIキーで持ち主を締め出したり第2要素を乗っ取ったりできないよう、APIキーでの認証は403にする
+func accountPrincipal(w http.ResponseWriter, r *http.Request, action string) *middleware.Claims {
+	claims := middleware.GetUserFromContext(r.Context())
+	if claims == nil {
+		writeError(w, r, problem.CodeUnauthorized, "unauthorized")
+		return nil
+	}
+	if claims.AuthMethod == middleware.AuthMethodAPIKey {
+		middleware.LogSecurityEvent(middleware.EventUnauthorized, r, "api key used to "+action)
+		writeError(w, r, problem.CodeInsufficientScope, "api keys cannot "+action)
+		return nil
+	}
+	return claims
+}
+
+// Create は POST /auth/api-keys
+func (h *APIKeysHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims := h.principal(w, r)
+	if claims == nil {
+		return
+	}
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, problem.CodeInvalidBody, "invalid request body")
+		return
+	}
+
+	key, info, err := h.store.Create(claims.UserID, req.Name, req.Scopes, req.RateLimit, time.Duration(req.ExpiresIn)*time.Second)
+	switch {
+	case errors.Is(err, ErrInvalidAPIKeySpec):
+		writeError(w, r, problem.CodeValidationFailed, "scopes must be users:read or users:write and rate_limit must not exceed the server limit")
+		return
+	case errors.Is(err, ErrTooManyAPIKeys):
+		writeError(w, r, problem.CodeConflict, "too many api keys")
+		return
+	case err != nil:
+		writeError(w, r, problem.CodeInternal, "failed to generate api key")
+		return
+	}
+
+	middleware.LogSecurityEvent(middleware.EventAPIKeyCreated, r, "api key "+info.Prefix+" created")
+	writeJSON(w, http.StatusCreated, CreateAPIKeyResponse{Key: key, APIKey: info})
+}
+
+// List は GET /auth/api-keys
+func (h *APIKeysHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims := h.principal(w, r)
+	if claims == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.store.List(claims.UserID))
+}
+
+// Revoke は DELETE /auth/api-keys/{id}
+func (h *APIKeysHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	claims := h.principal(w, r)
+	if claims == nil {
+		return
+	}
+	if err := h.store.Revoke(claims.UserID, r.PathValue("id")); err != nil {
+		writeError(w, r, problem.CodeNotFound, "api key not found")
+		return
+	}
+
+	middleware.LogSecurityEvent(middleware.EventAPIKeyRevoked, r, "api key "+apiKeyPrefix+r.PathValue("id")+" revoked")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+)
+
+// newTestAPIKeyStore は時計を固定したストア（ユーザーはalice=1, bob=2, charlie=3）
+func newTestAPIKeyStore() (*APIKeyStore, *models.UserStore, *time.Time) {
+	users := models.NewUserStore()
+	s := NewAPIKeyStore(APIKeyConfig{RateLimit: 3, Window: time.Minute, MaxPerUser: 2}, users)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	return s, users, &now
+}
+
+func apiKeyRequest(header, value string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/v2/auth/me", nil)
+	req.Header.Set(header, value)
+	return req
+}
+
+func TestAPIKeyStore_Create(t *testing.T) {
+	s, _, now := newTestAPIKeyStore()
+
+	tests := []struct {
+		name        string
+		scopes      []string
+		rateLimit   int
+		ttl         time.Duration
+		expectedErr error
+	}{
+		{"unknown scope", []string{"users:delete"}, 0, 0, ErrInvalidAPIKeySpec},
+		{"rate limit above the server limit", nil, 4, 0, ErrInvalidAPIKeySpec},
+		{"negative ttl", nil, 0, -time.Second, ErrInvalidAPIKeySpec},
+		{"default scope", nil, 0, 0, nil},
+		{"write scope", []string{"users:write", "users:read", "users:write"}, 2, time.Hour, nil},
+		{"limit per user", nil, 0, 0, ErrTooManyAPIKeys},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*now = now.Add(time.Second)
+			key, info, err := s.Create(1, tt.name, tt.scopes, tt.rateLimit, tt.ttl)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected %v, got %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if !strings.HasPrefix(key, info.Prefix+"_") || info.Prefix != "k6_"+info.ID || len(info.ID) != apiKeyIDLength {
+				t.Errorf("unexpected key %s for %+v", key, info)
+			}
+			if info.RateLimit == 0 || len(info.Scopes) == 0 {
+				t.Errorf("expected defaults to be applied, got %+v", info)
+			}
+		})
+	}
+
+	keys := s.List(1)
+	if len(keys) != 2 || keys[0].Scopes[0] != ScopeUsersRead || strings.Join(keys[1].Scopes, " ") != "users:read users:write" {
+		t.Errorf("unexpected keys %+v", keys)
+	}
+	if keys[1].ExpiresAt == nil || keys[1].RateLimit != 2 {
+		t.Errorf("expected expiry and rate limit to be kept, got %+v", keys[1])
+	}
+	if len(s.List(2)) != 0 {
+		t.Error("expected other users to have no keys")
+	}
+}
+
+func TestAPIKeyStore_Authenticate(t *testing.T) {
+	s, users, now := newTestAPIKeyStore()
+	key, info, _ := s.Create(2, "ci", nil, 2, time.Hour)
+	other, _, _ := s.Create(3, "deleted user", nil, 0, 0)
+	users.Delete(3)
+
+	tests := []struct {
+		name        string
+		header      string
+		value       string
+		expectedErr error
+	}{
+		{"no key", "X-Request-ID", "x", middleware.ErrNoCredentials},
+		{"bearer token is not an api key", "Authorization", "Bearer " + key, middleware.ErrNoCredentials},
+		{"X-API-Key", "X-API-Key", key, nil},
+		{"Authorization ApiKey", "Authorization", "ApiKey " + key, nil},
+		{"wrong secret", "X-API-Key", info.Prefix + "_wrong", middleware.ErrInvalidAPIKey},
+		{"malformed", "X-API-Key", "not-a-key", middleware.ErrInvalidAPIKey},
+		{"deleted user", "X-API-Key", other, middleware.ErrInvalidAPIKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := s.Authenticate(apiKeyRequest(tt.header, tt.value))
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected %v, got %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if claims.UserID != 2 || claims.Email != "bob@example.com" || claims.AuthMethod != middleware.AuthMethodAPIKey || claims.KeyID != info.ID {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+			if !claims.HasScope(ScopeUsersRead) || claims.HasScope(ScopeUsersWrite) {
+				t.Errorf("expected only the read scope, got %v", claims.Scopes)
+			}
+		})
+	}
+
+	// 2回使ったので時間窓の残りは制限される
+	_, err := s.Authenticate(apiKeyRequest("X-API-Key", key))
+	var rateErr *middleware.RateLimitError
+	if !errors.As(err, &rateErr) || rateErr.Limit != 2 || rateErr.RetryAfter != time.Minute {
+		t.Fatalf("expected a rate limit error, got %v", err)
+	}
+	*now = now.Add(time.Minute)
+	if _, err := s.Authenticate(apiKeyRequest("X-API-Key", key)); err != nil {
+		t.Errorf("expected the next window to accept the key, got %v", err)
+	}
+	if keys := s.List(2); keys[0].LastUsedAt == nil || !keys[0].LastUsedAt.Equal(*now) {
+		t.Errorf("expected last_used_at to be updated, got %+v", keys[0])
+	}
+
+	*now = now.Add(time.Hour)
+	if _, err := s.Authenticate(apiKeyRequest("X-API-Key", key)); !errors.Is(err, middleware.ErrInvalidAPIKey) {
+		t.Errorf("expected an expired key to be rejected, got %v", err)
+	}
+}
+
+func TestAPIKeysHandler(t *testing.T) {
+	s, _, _ := newTestAPIKeyStore()
+	h := NewAPIKeysHandler(s)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /auth/api-keys", h.Create)
+	mux.HandleFunc("GET /auth/api-keys", h.List)
+	mux.HandleFunc("DELETE /auth/api-keys/{id}", h.Revoke)
+
+	serve := func(method, path, body string, claims *middleware.Claims) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if claims != nil {
+			req = req.WithContext(middleware.NewContext(req.Context(), claims))
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	alice := &middleware.Claims{UserID: 1, Email: "alice@example.com", AuthMethod: middleware.AuthMethodJWT}
+	bob := &middleware.Claims{UserID: 2, Email: "bob@example.com", AuthMethod: middleware.AuthMethodJWT}
+	aliceKey := &middleware.Claims{UserID: 1, Email: "alice@example.com", AuthMethod: middleware.AuthMethodAPIKey, Scopes: []string{ScopeUsersWrite}}
+
+	rec := serve(http.MethodPost, "/auth/api-keys", `{"name":"ci","scopes":["users:read"],"expires_in":60}`, alice)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var created CreateAPIKeyResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+	if !strings.HasPrefix(created.Key, created.Prefix+"_") || created.ExpiresAt == nil {
+		t.Errorf("unexpected response %+v", created)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		claims         *middleware.Claims
+		expectedStatus int
+	}{
+		{"unauthenticated", http.MethodGet, "/auth/api-keys", "", nil, http.StatusUnauthorized},
+		{"api keys cannot create keys", http.MethodPost, "/auth/api-keys", `{"name":"x"}`, aliceKey, http.StatusForbidden},
+		{"api keys cannot list keys", http.MethodGet, "/auth/api-keys", "", aliceKey, http.StatusForbidden},
+		{"invalid scope", http.MethodPost, "/auth/api-keys", `{"name":"x","scopes":["admin"]}`, alice, http.StatusBadRequest},
+		{"invalid body", http.MethodPost, "/auth/api-keys", `{`, alice, http.StatusBadRequest},
+		{"another user's key", http.MethodDelete, "/auth/api-keys/" + created.ID, "", bob, http.StatusNotFound},
+		{"revoke", http.MethodDelete, "/auth/api-keys/" + created.ID, "", alice, http.StatusNoContent},
+		{"revoked key", http.MethodDelete, "/auth/api-keys/" + created.ID, "", alice, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(tt.method, tt.path, tt.body, tt.claims); rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body)
+			}
+		})
+	}
+
+	rec = serve(http.MethodGet, "/auth/api-keys", "", alice)
+	var keys []APIKey
+	json.NewDecoder(rec.Body).Decode(&keys)
+	if rec.Code != http.StatusOK || keys == nil || len(keys) != 0 {
+		t.Errorf("expected an empty list after revoking, got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -1,39 +1,87 @@
 package handlers
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"k6-practice/api/middleware"
 	"k6-practice/api/models"
+	"k6-practice/api/problem"
 )
 
+var tracer = otel.Tracer("k6-practice/api/handlers")
+
 type AuthHandler struct {
 	store *models.UserStore
+	guard *LoginGuard
+	mfa   *MFAStore
 }
 
-func NewAuthHandler(store *models.UserStore) *AuthHandler {
-	return &AuthHandler{store: store}
+// NewAuthHandler は guard が nil の場合、ログインの失敗を数えない
+// mfa が nil の場合、多要素認証を有効にしたユーザーもパスワードだけでログインできる
+func NewAuthHandler(store *models.UserStore, guard *LoginGuard, mfa *MFAStore) *AuthHandler {
+	return &AuthHandler{store: store, guard: guard, mfa: mfa}
 }
 
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" openapi:"required"`
+	Password string `json:"password" openapi:"required"`
 }
 
 type TokenResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	ExpiresIn    int    `json:"expires_in"`
+	AccessToken  string `json:"access_token" openapi:"required"`
+	RefreshToken string `json:"refresh_token" openapi:"required"`
+	ExpiresIn    int    `json:"expires_in" openapi:"required"`
+}
+
+// RefreshRequest はトークンリフレッシュのリクエストボディ
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" openapi:"required"`
+}
+
+// MFAChallengeResponse は多要素認証を有効にしたユーザーのログインの1段階目の結果（202）
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required" openapi:"required"`
+	MFAToken    string `json:"mfa_token" openapi:"required"`
+	ExpiresIn   int    `json:"expires_in" openapi:"required"`
+}
+
+// MFAChallengeRequest はログインの2段階目のリクエストボディ（code はTOTPのコードかリカバリーコード）
+type MFAChallengeRequest struct {
+	MFAToken string `json:"mfa_token" openapi:"required"`
+	Code     string `json:"code" openapi:"required"`
+}
+
+// MFAEnrollResponse は認証アプリに登録する共有鍵
+type MFAEnrollResponse struct {
+	Secret     string `json:"secret" openapi:"required"`
+	OTPAuthURI string `json:"otpauth_uri" openapi:"required"`
+}
+
+// MFAVerifyRequest は登録の確認に使う認証アプリのコード
+type MFAVerifyRequest struct {
+	Code string `json:"code" openapi:"required"`
+}
+
+// MFAVerifyResponse は有効化したときに一度だけ返すリカバリーコード
+type MFAVerifyResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" openapi:"required"`
 }
 
 type MeResponse struct {
-	UserID int    `json:"user_id"`
-	Email  string `json:"email"`
+	UserID int    `json:"user_id" openapi:"required"`
+	Email  string `json:"email" openapi:"required"`
 }
 
 // トークン有効期限
@@ -43,125 +91,324 @@ const (
 	accessTokenExpiresIn = 900 // 15分（秒）
 )
 
-func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// Login は POST /auth/login
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, problem.CodeInvalidBody, "invalid request body")
+		return
+	}
+
+	tokens, err := h.Authenticate(r.Context(), req.Email, req.Password, h.clientIP(r))
+	var locked *LockoutError
+	if errors.As(err, &locked) {
+		writeLocked(w, r, locked, "invalid credentials")
+		return
+	}
+	var challenge *MFARequiredError
+	if errors.As(err, &challenge) {
+		writeJSON(w, http.StatusAccepted, MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    challenge.Token,
+			ExpiresIn:   challenge.ExpiresIn,
+		})
+		return
+	}
+	if errors.Is(err, ErrInvalidCredentials) {
+		middleware.LogSecurityEvent(middleware.EventAuthFailure, r, "invalid credentials")
+		writeError(w, r, problem.CodeInvalidCredentials, "invalid credentials")
+		return
+	}
+	if r.Context().Err() != nil {
+		writeContextError(w, r, err)
+		return
+	}
+	if err != nil {
+		writeError(w, r, problem.CodeInternal, "failed to generate token")
+		return
+	}
 
-	path := strings.TrimPrefix(r.URL.Path, "/auth/")
+	middleware.LogSecurityEvent(middleware.EventAuthSuccess, r, "login")
+	writeJSON(w, http.StatusOK, tokens)
+}
 
-	switch path {
-	case "login":
-		h.login(w, r)
-	case "refresh":
-		h.refresh(w, r)
-	case "me":
-		h.me(w, r)
-	default:
-		writeError(w, http.StatusNotFound, "not found")
+// clientIP はログインの失敗をIPごとに数えるためのクライアントのアドレス
+func (h *AuthHandler) clientIP(r *http.Request) string {
+	if h.guard == nil {
+		return middleware.ClientIP(r)
 	}
+	return h.guard.ClientIP(r)
 }
 
-func (h *AuthHandler) login(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		methodNotAllowed(w)
-		return
+// writeLocked はロック中のログインを 429 と Retry-After で拒否する
+// この失敗でロックした場合は、失敗（detail）とロックの両方を記録する
+func writeLocked(w http.ResponseWriter, r *http.Request, locked *LockoutError, detail string) {
+	if locked.Triggered {
+		middleware.LogSecurityEvent(middleware.EventAuthFailure, r, detail)
+		middleware.LogSecurityEvent(middleware.EventAccountLocked, r, locked.Error())
+	} else {
+		middleware.LogSecurityEvent(middleware.EventAuthFailure, r, "login locked: "+locked.Scope)
 	}
+	w.Header().Set("Retry-After", strconv.Itoa(locked.RetryAfter()))
+	writeError(w, r, problem.CodeLoginLocked, "too many failed login attempts, retry later")
+}
 
-	var req LoginRequest
+// ChallengeMFA は POST /auth/mfa/challenge（ログインの2段階目）
+func (h *AuthHandler) ChallengeMFA(w http.ResponseWriter, r *http.Request) {
+	var req MFAChallengeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid request body")
+		writeError(w, r, problem.CodeInvalidBody, "invalid request body")
 		return
 	}
 
-	// テスト用: パスワードは "password" で固定
-	if req.Password != "password" {
-		writeError(w, http.StatusUnauthorized, "invalid credentials")
+	tokens, recovery, err := h.CompleteMFA(r.Context(), req.MFAToken, req.Code, h.clientIP(r))
+	var locked *LockoutError
+	if errors.As(err, &locked) {
+		writeLocked(w, r, locked, "invalid mfa code")
 		return
 	}
-
-	user := h.findUserByEmail(req.Email)
-	if user == nil {
-		writeError(w, http.StatusUnauthorized, "invalid credentials")
+	if errors.Is(err, ErrInvalidMFAToken) {
+		middleware.LogSecurityEvent(middleware.EventAuthFailure, r, "invalid mfa token")
+		writeError(w, r, problem.CodeInvalidToken, "invalid mfa token")
+		return
+	}
+	if errors.Is(err, ErrInvalidMFACode) {
+		middleware.LogSecurityEvent(middleware.EventAuthFailure, r, "invalid mfa code")
+		writeError(w, r, problem.CodeInvalidMFACode, "invalid mfa code")
+		return
+	}
+	if r.Context().Err() != nil {
+		writeContextError(w, r, err)
 		return
 	}
-
-	tokens, err := h.generateTokenPair(user.ID, user.Email)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to generate token")
+		writeError(w, r, problem.CodeInternal, "failed to generate token")
 		return
 	}
 
-	json.NewEncoder(w).Encode(tokens)
+	detail := "login with mfa"
+	if recovery {
+		detail = "login with mfa recovery code"
+	}
+	middleware.LogSecurityEvent(middleware.EventAuthSuccess, r, detail)
+	writeJSON(w, http.StatusOK, tokens)
 }
 
-func (h *AuthHandler) refresh(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		methodNotAllowed(w)
+// EnrollMFA は POST /auth/mfa/enroll（middleware.Auth の後段で呼ばれる）
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	if h.mfa == nil {
+		writeError(w, r, problem.CodeUnauthorized, "unauthorized")
+		return
+	}
+	claims := accountPrincipal(w, r, "enroll mfa")
+	if claims == nil {
+		return
+	}
+
+	secret, uri, err := h.mfa.Enroll(claims.UserID, claims.Email)
+	if errors.Is(err, ErrMFAAlreadyEnabled) {
+		writeError(w, r, problem.CodeConflict, "mfa already enabled")
 		return
 	}
+	if err != nil {
+		writeError(w, r, problem.CodeInternal, "failed to generate secret")
+		return
+	}
+	writeJSON(w, http.StatusOK, MFAEnrollResponse{Secret: secret, OTPAuthURI: uri})
+}
 
-	var req struct {
-		RefreshToken string `json:"refresh_token"`
+// VerifyMFA は POST /auth/mfa/verify（登録の確認、middleware.Auth の後段で呼ばれる）
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	if h.mfa == nil {
+		writeError(w, r, problem.CodeUnauthorized, "unauthorized")
+		return
 	}
+	claims := accountPrincipal(w, r, "verify mfa")
+	if claims == nil {
+		return
+	}
+	var req MFAVerifyRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid request body")
+		writeError(w, r, problem.CodeInvalidBody, "invalid request body")
 		return
 	}
 
-	claims := &middleware.Claims{}
-	token, err := jwt.ParseWithClaims(req.RefreshToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return middleware.JWTSecret, nil
-	})
+	codes, err := h.mfa.Activate(claims.UserID, req.Code)
+	switch {
+	case errors.Is(err, ErrMFANotEnrolled):
+		writeError(w, r, problem.CodeConflict, "mfa enrollment not started")
+	case errors.Is(err, ErrMFAAlreadyEnabled):
+		writeError(w, r, problem.CodeConflict, "mfa already enabled")
+	case errors.Is(err, ErrInvalidMFACode):
+		middleware.LogSecurityEvent(middleware.EventAuthFailure, r, "invalid mfa code on enrollment")
+		writeError(w, r, problem.CodeInvalidMFACode, "invalid mfa code")
+	case err != nil:
+		writeError(w, r, problem.CodeInternal, "failed to generate recovery codes")
+	default:
+		middleware.LogSecurityEvent(middleware.EventMFAEnabled, r, "mfa enabled")
+		writeJSON(w, http.StatusOK, MFAVerifyResponse{RecoveryCodes: codes})
+	}
+}
 
-	if err != nil || !token.Valid {
-		writeError(w, http.StatusUnauthorized, "invalid refresh token")
+// Refresh は POST /auth/refresh
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, problem.CodeInvalidBody, "invalid request body")
 		return
 	}
 
-	tokens, err := h.generateTokenPair(claims.UserID, claims.Email)
+	tokens, err := h.RefreshTokens(r.Context(), req.RefreshToken)
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		middleware.LogSecurityEvent(middleware.EventAuthFailure, r, "invalid refresh token")
+		writeError(w, r, problem.CodeInvalidToken, "invalid refresh token")
+		return
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to generate token")
+		writeError(w, r, problem.CodeInternal, "failed to generate token")
 		return
 	}
 
-	json.NewEncoder(w).Encode(tokens)
+	middleware.LogSecurityEvent(middleware.EventAuthSuccess, r, "token refreshed")
+	writeJSON(w, http.StatusOK, tokens)
 }
 
-func (h *AuthHandler) me(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		methodNotAllowed(w)
-		return
-	}
-
+// Me は GET /auth/me（middleware.Auth の後段で呼ばれる）
+func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 	claims := middleware.GetUserFromContext(r.Context())
 	if claims == nil {
-		writeError(w, http.StatusUnauthorized, "unauthorized")
+		writeError(w, r, problem.CodeUnauthorized, "unauthorized")
 		return
 	}
 
-	json.NewEncoder(w).Encode(MeResponse{
+	writeJSON(w, http.StatusOK, MeResponse{
 		UserID: claims.UserID,
 		Email:  claims.Email,
 	})
 }
 
-// findUserByEmail はメールアドレスでユーザーを検索する
-func (h *AuthHandler) findUserByEmail(email string) *models.User {
-	for _, u := range h.store.List() {
-		if u.Email == email {
-			return u
+// 認証の失敗（REST・gRPCがそれぞれのエラー表現に変換する）
+var (
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+)
+
+// Authenticate はメールアドレスとパスワードを検証してトークンを発行する
+// ip はログインの失敗をIPごとに数えるためのクライアントのアドレス
+// ロック中、またはこの失敗でロックした場合は *LockoutError を返す
+// 多要素認証を有効にしたユーザーには、トークンの代わりに *MFARequiredError を返す
+func (h *AuthHandler) Authenticate(ctx context.Context, email, password, ip string) (*TokenResponse, error) {
+	var attempt *LoginAttempt
+	if h.guard != nil {
+		var locked *LockoutError
+		if attempt, locked = h.guard.Begin(email, ip); locked != nil {
+			return nil, locked
+		}
+		defer attempt.Release()
+	}
+
+	user, err := h.verify(ctx, email, password)
+	if errors.Is(err, ErrInvalidCredentials) && attempt != nil {
+		delay, locked := attempt.Failure()
+		if locked != nil {
+			return nil, locked
+		}
+		h.guard.Wait(ctx, delay)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 失敗回数は2段階目を終えるまで消さない（パスワードを知る攻撃者がコードを総当たりできないように）
+	if h.mfa != nil && h.mfa.Enabled(user.ID) {
+		token, err := generateMFAToken(user.ID, user.Email, h.mfa.cfg.ChallengeTTL)
+		if err != nil {
+			return nil, err
 		}
+		mfaChallenges.Add(1)
+		return nil, &MFARequiredError{Token: token, ExpiresIn: int(h.mfa.cfg.ChallengeTTL.Seconds())}
+	}
+	if attempt != nil {
+		attempt.Success()
 	}
-	return nil
+
+	return h.generateTokenPair(ctx, user.ID, user.Email)
+}
+
+// CompleteMFA はログインの2段階目で、MFAチャレンジのトークンとコードを検証してトークンを発行する
+// コードの誤りはパスワードの誤りと同じくログインの失敗として数える
+func (h *AuthHandler) CompleteMFA(ctx context.Context, mfaToken, code, ip string) (tokens *TokenResponse, recovery bool, err error) {
+	claims, err := parseMFAToken(mfaToken)
+	if err != nil || h.mfa == nil {
+		return nil, false, ErrInvalidMFAToken
+	}
+	var attempt *LoginAttempt
+	if h.guard != nil {
+		var locked *LockoutError
+		if attempt, locked = h.guard.Begin(claims.Email, ip); locked != nil {
+			return nil, false, locked
+		}
+		defer attempt.Release()
+	}
+
+	recovery, err = h.mfa.Verify(claims.UserID, code)
+	if errors.Is(err, ErrMFANotEnrolled) {
+		// チャレンジの発行後に登録が消えた（ストアの初期化など）
+		return nil, false, ErrInvalidMFAToken
+	}
+	if errors.Is(err, ErrInvalidMFACode) && attempt != nil {
+		delay, locked := attempt.Failure()
+		if locked != nil {
+			return nil, false, locked
+		}
+		h.guard.Wait(ctx, delay)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if attempt != nil {
+		attempt.Success()
+	}
+
+	tokens, err = h.generateTokenPair(ctx, claims.UserID, claims.Email)
+	return tokens, recovery, err
+}
+
+// verify はメールアドレスとパスワードを検証する
+func (h *AuthHandler) verify(ctx context.Context, email, password string) (*models.User, error) {
+	// テスト用: パスワードは "password" で固定
+	if password != "password" {
+		return nil, ErrInvalidCredentials
+	}
+
+	user, err := h.store.FindByEmailContext(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// RefreshTokens はリフレッシュトークンを検証して新しいトークンを発行する
+func (h *AuthHandler) RefreshTokens(ctx context.Context, refreshToken string) (*TokenResponse, error) {
+	claims, err := middleware.ParseToken(refreshToken)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return h.generateTokenPair(ctx, claims.UserID, claims.Email)
 }
 
 // generateTokenPair はアクセストークンとリフレッシュトークンを生成する
-func (h *AuthHandler) generateTokenPair(userID int, email string) (*TokenResponse, error) {
-	accessToken, err := generateToken(userID, email, accessTokenDuration)
+func (h *AuthHandler) generateTokenPair(ctx context.Context, userID int, email string) (*TokenResponse, error) {
+	accessToken, err := generateToken(ctx, userID, email, accessTokenDuration)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, err := generateToken(userID, email, refreshTokenDuration)
+	refreshToken, err := generateToken(ctx, userID, email, refreshTokenDuration)
 	if err != nil {
 		return nil, err
 	}
@@ -173,11 +420,21 @@ func (h *AuthHandler) generateTokenPair(userID int, email string) (*TokenRespons
 	}, nil
 }
 
-func generateToken(userID int, email string, duration time.Duration) (string, error) {
+// generateToken はJWTに署名する（署名のコストをスパンで計測する）
+func generateToken(ctx context.Context, userID int, email string, duration time.Duration) (string, error) {
+	_, span := tracer.Start(ctx, "jwt.Sign", trace.WithAttributes(
+		attribute.String("jwt.algorithm", jwt.SigningMethodHS256.Alg()),
+		attribute.Int("user.id", userID),
+	))
+	defer span.End()
+
 	claims := &middleware.Claims{
 		UserID: userID,
 		Email:  email,
+		Epoch:  middleware.Revocations.Epoch(),
 		RegisteredClaims: jwt.RegisteredClaims{
+			// jti: 管理用APIでトークン単位に失効させるためのID
+			ID:        newTokenID(),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
@@ -186,3 +443,10 @@ func generateToken(userID int, email string, duration time.Duration) (string, er
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(middleware.JWTSecret)
 }
+
+// newTokenID はトークンのID（jti）を生成する
+func newTokenID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
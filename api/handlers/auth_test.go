@@ -4,17 +4,22 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"k6-practice/api/middleware"
 	"k6-practice/api/models"
+	"k6-practice/api/security"
+	"k6-practice/api/totp"
 )
 
 func setupAuthHandler() *AuthHandler {
 	store := models.NewUserStore()
-	return NewAuthHandler(store)
+	return NewAuthHandler(store, nil, nil)
 }
 
 func TestAuthHandler_Login(t *testing.T) {
@@ -30,7 +35,7 @@ func TestAuthHandler_Login(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		handler.Login(rec, req)
 
 		if rec.Code != http.StatusOK {
 			t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
@@ -62,7 +67,7 @@ func TestAuthHandler_Login(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		handler.Login(rec, req)
 
 		if rec.Code != http.StatusUnauthorized {
 			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rec.Code)
@@ -79,7 +84,7 @@ func TestAuthHandler_Login(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		handler.Login(rec, req)
 
 		if rec.Code != http.StatusUnauthorized {
 			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rec.Code)
@@ -91,23 +96,12 @@ func TestAuthHandler_Login(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		handler.Login(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
 			t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
 		}
 	})
-
-	t.Run("GET /auth/login returns method not allowed", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodGet, "/auth/login", nil)
-		rec := httptest.NewRecorder()
-
-		handler.ServeHTTP(rec, req)
-
-		if rec.Code != http.StatusMethodNotAllowed {
-			t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
-		}
-	})
 }
 
 func TestAuthHandler_Refresh(t *testing.T) {
@@ -123,7 +117,7 @@ func TestAuthHandler_Refresh(t *testing.T) {
 		loginReq := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(jsonBody))
 		loginReq.Header.Set("Content-Type", "application/json")
 		loginRec := httptest.NewRecorder()
-		handler.ServeHTTP(loginRec, loginReq)
+		handler.Login(loginRec, loginReq)
 
 		var loginResp TokenResponse
 		json.NewDecoder(loginRec.Body).Decode(&loginResp)
@@ -139,7 +133,7 @@ func TestAuthHandler_Refresh(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		handler.Refresh(rec, req)
 
 		if rec.Code != http.StatusOK {
 			t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
@@ -166,7 +160,7 @@ func TestAuthHandler_Refresh(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		handler.Refresh(rec, req)
 
 		if rec.Code != http.StatusUnauthorized {
 			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rec.Code)
@@ -189,7 +183,7 @@ func TestAuthHandler_Me(t *testing.T) {
 		req = req.WithContext(ctx)
 
 		rec := httptest.NewRecorder()
-		handler.ServeHTTP(rec, req)
+		handler.Me(rec, req)
 
 		if rec.Code != http.StatusOK {
 			t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
@@ -212,36 +206,208 @@ func TestAuthHandler_Me(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		handler.Me(rec, req)
 
 		if rec.Code != http.StatusUnauthorized {
 			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rec.Code)
 		}
 	})
+}
 
-	t.Run("POST /auth/me returns method not allowed", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodPost, "/auth/me", nil)
-		rec := httptest.NewRecorder()
-
-		handler.ServeHTTP(rec, req)
+func TestAuthHandler_SecurityEvents(t *testing.T) {
+	handler := setupAuthHandler()
+	prev := middleware.SecLogger
+	defer func() { middleware.SecLogger = prev }()
+
+	tests := []struct {
+		name     string
+		password string
+		expected middleware.SecurityEvent
+	}{
+		{"login success", "password", middleware.EventAuthSuccess},
+		{"login failure", "wrongpassword", middleware.EventAuthFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := security.NewMonitor(security.Config{Buffer: 10})
+			middleware.SecLogger = middleware.NewSecurityLogger(true, monitor)
+
+			jsonBody, _ := json.Marshal(LoginRequest{Email: "alice@example.com", Password: tt.password})
+			req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(jsonBody))
+			handler.Login(httptest.NewRecorder(), req)
+
+			events := monitor.Query(security.Query{})
+			if len(events) != 1 || events[0].Type != string(tt.expected) {
+				t.Errorf("expected one %s event, got %+v", tt.expected, events)
+			}
+		})
+	}
+}
 
-		if rec.Code != http.StatusMethodNotAllowed {
-			t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
-		}
-	})
+func TestAuthHandler_Lockout(t *testing.T) {
+	guard := NewLoginGuard(LockoutConfig{AccountThreshold: 2, Window: time.Minute, Duration: time.Minute})
+	handler := NewAuthHandler(models.NewUserStore(), guard, nil)
+	prev := middleware.SecLogger
+	defer func() { middleware.SecLogger = prev }()
+	monitor := security.NewMonitor(security.Config{Buffer: 10})
+	middleware.SecLogger = middleware.NewSecurityLogger(true, monitor)
+
+	tests := []struct {
+		name           string
+		password       string
+		expectedStatus int
+		expectedEvents []string
+	}{
+		{"first failure", "wrong", http.StatusUnauthorized, []string{"AUTH_FAILURE"}},
+		{"failure reaching the threshold locks", "wrong", http.StatusTooManyRequests, []string{"ACCOUNT_LOCKED", "AUTH_FAILURE"}},
+		{"valid password while locked", "password", http.StatusTooManyRequests, []string{"AUTH_FAILURE"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			since := time.Now()
+			jsonBody, _ := json.Marshal(LoginRequest{Email: "alice@example.com", Password: tt.password})
+			req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(jsonBody))
+			rec := httptest.NewRecorder()
+			handler.Login(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+				t.Error("expected Retry-After header")
+			}
+
+			var types []string
+			for _, e := range monitor.Query(security.Query{Since: since}) {
+				types = append(types, e.Type)
+			}
+			if strings.Join(types, ",") != strings.Join(tt.expectedEvents, ",") {
+				t.Errorf("expected events %v, got %v", tt.expectedEvents, types)
+			}
+		})
+	}
 }
 
-func TestAuthHandler_NotFound(t *testing.T) {
-	handler := setupAuthHandler()
+func TestAuthHandler_LockoutIgnoresSpoofedForwardedFor(t *testing.T) {
+	guard := NewLoginGuard(LockoutConfig{IPThreshold: 2, Window: time.Minute, Duration: time.Minute})
+	handler := NewAuthHandler(models.NewUserStore(), guard, nil)
 
-	t.Run("GET /auth/unknown returns not found", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodGet, "/auth/unknown", nil)
+	// X-Forwarded-For を毎回変えても、信頼するプロキシがなければ同じIPとして数える
+	for i, expected := range []int{http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		jsonBody, _ := json.Marshal(LoginRequest{Email: fmt.Sprintf("user%d@example.com", i), Password: "wrong"})
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewReader(jsonBody))
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
 		rec := httptest.NewRecorder()
+		handler.Login(rec, req)
 
-		handler.ServeHTTP(rec, req)
+		if rec.Code != expected {
+			t.Fatalf("attempt %d: expected status %d, got %d", i+1, expected, rec.Code)
+		}
+	}
+}
 
-		if rec.Code != http.StatusNotFound {
-			t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+func TestAuthHandler_MFALogin(t *testing.T) {
+	mfa := newTestMFAStore()
+	now := fixedClock(mfa, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	guard := NewLoginGuard(LockoutConfig{AccountThreshold: 3, Window: time.Minute, Duration: time.Minute})
+	handler := NewAuthHandler(models.NewUserStore(), guard, mfa)
+
+	post := func(h http.HandlerFunc, path string, body any, claims *middleware.Claims) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(jsonBody))
+		if claims != nil {
+			req = req.WithContext(middleware.NewContext(req.Context(), claims))
 		}
-	})
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+	alice := &middleware.Claims{UserID: 1, Email: "alice@example.com"}
+
+	// APIキーでは書き込みのスコープがあっても登録・有効化できない
+	aliceKey := &middleware.Claims{UserID: 1, Email: "alice@example.com", AuthMethod: middleware.AuthMethodAPIKey, Scopes: []string{ScopeUsersWrite}}
+	if rec := post(handler.EnrollMFA, "/auth/mfa/enroll", nil, aliceKey); rec.Code != http.StatusForbidden {
+		t.Fatalf("enroll: expected status 403 for an api key, got %d", rec.Code)
+	}
+	if rec := post(handler.VerifyMFA, "/auth/mfa/verify", MFAVerifyRequest{Code: "000000"}, aliceKey); rec.Code != http.StatusForbidden {
+		t.Fatalf("verify: expected status 403 for an api key, got %d", rec.Code)
+	}
+
+	// 登録と有効化
+	rec := post(handler.EnrollMFA, "/auth/mfa/enroll", nil, alice)
+	var enrolled MFAEnrollResponse
+	json.NewDecoder(rec.Body).Decode(&enrolled)
+	if rec.Code != http.StatusOK || enrolled.Secret == "" {
+		t.Fatalf("enroll: expected status 200 with a secret, got %d", rec.Code)
+	}
+	if rec := post(handler.VerifyMFA, "/auth/mfa/verify", MFAVerifyRequest{Code: "000000"}, alice); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("verify: expected status 401 for a wrong code, got %d", rec.Code)
+	}
+	rec = post(handler.VerifyMFA, "/auth/mfa/verify", MFAVerifyRequest{Code: mustTOTP(t, enrolled.Secret, *now)}, alice)
+	var verified MFAVerifyResponse
+	json.NewDecoder(rec.Body).Decode(&verified)
+	if rec.Code != http.StatusOK || len(verified.RecoveryCodes) != 3 {
+		t.Fatalf("verify: expected status 200 with recovery codes, got %d", rec.Code)
+	}
+	if rec := post(handler.EnrollMFA, "/auth/mfa/enroll", nil, alice); rec.Code != http.StatusConflict {
+		t.Fatalf("enroll: expected status 409 once enabled, got %d", rec.Code)
+	}
+	*now = now.Add(totp.Period)
+
+	// login はトークンの代わりにチャレンジを返す
+	login := func(t *testing.T) string {
+		t.Helper()
+		rec := post(handler.Login, "/auth/login", LoginRequest{Email: "alice@example.com", Password: "password"}, nil)
+		var challenge MFAChallengeResponse
+		json.NewDecoder(rec.Body).Decode(&challenge)
+		if rec.Code != http.StatusAccepted || !challenge.MFARequired || challenge.MFAToken == "" || challenge.ExpiresIn != 60 {
+			t.Fatalf("login: expected status 202 with a challenge, got %d %+v", rec.Code, challenge)
+		}
+		return challenge.MFAToken
+	}
+
+	tests := []struct {
+		name           string
+		code           string
+		token          string
+		expectedStatus int
+	}{
+		{"wrong code", "000000", "", http.StatusUnauthorized},
+		{"invalid challenge token", mustTOTP(t, enrolled.Secret, *now), "invalid", http.StatusUnauthorized},
+		{"totp code", mustTOTP(t, enrolled.Secret, *now), "", http.StatusOK},
+		{"replayed totp code", mustTOTP(t, enrolled.Secret, *now), "", http.StatusUnauthorized},
+		{"recovery code", verified.RecoveryCodes[0], "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			if token == "" {
+				token = login(t)
+			}
+			rec := post(handler.ChallengeMFA, "/auth/mfa/challenge", MFAChallengeRequest{MFAToken: token, Code: tt.code}, nil)
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if rec.Code == http.StatusOK {
+				var tokens TokenResponse
+				json.NewDecoder(rec.Body).Decode(&tokens)
+				if _, err := middleware.ParseToken(tokens.AccessToken); err != nil {
+					t.Errorf("expected a valid access token, got %v", err)
+				}
+			}
+		})
+	}
+
+	// 2段階目の誤りもログインの失敗として数えてロックする
+	token := login(t)
+	for i := 0; i < 2; i++ {
+		post(handler.ChallengeMFA, "/auth/mfa/challenge", MFAChallengeRequest{MFAToken: token, Code: "000000"}, nil)
+	}
+	rec = post(handler.ChallengeMFA, "/auth/mfa/challenge", MFAChallengeRequest{MFAToken: token, Code: "000000"}, nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected wrong codes to lock the account, got %d", rec.Code)
+	}
 }
@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"math/rand"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
+
+	"k6-practice/api/problem"
 )
 
 // 遅延の制限値
@@ -17,32 +20,29 @@ const (
 )
 
 type DelayResponse struct {
-	DelayMs int       `json:"delay_ms"`
-	Time    time.Time `json:"time"`
+	DelayMs int       `json:"delay_ms" openapi:"required"`
+	Time    time.Time `json:"time" openapi:"required"`
 }
 
 type ErrorRateResponse struct {
-	Success     bool      `json:"success"`
-	ErrorRate   int       `json:"error_rate_percent"`
-	RandomValue int       `json:"random_value"`
-	Time        time.Time `json:"time"`
+	Success     bool      `json:"success" openapi:"required"`
+	ErrorRate   int       `json:"error_rate_percent" openapi:"required"`
+	RandomValue int       `json:"random_value" openapi:"required"`
+	Time        time.Time `json:"time" openapi:"required"`
 }
 
+// DelayHandler は GET /delay/{ms}
 func DelayHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		methodNotAllowed(w)
+	ms, err := strconv.Atoi(r.PathValue("ms"))
+	if err != nil || ms < 0 || ms > maxDelayMs {
+		writeError(w, r, problem.CodeInvalidParameter, "invalid delay value (0-10000ms)")
 		return
 	}
 
-	path := strings.TrimPrefix(r.URL.Path, "/delay/")
-	ms, err := strconv.Atoi(path)
-	if err != nil || ms < 0 || ms > maxDelayMs {
-		writeError(w, http.StatusBadRequest, "invalid delay value (0-10000ms)")
+	if !wait(w, r, time.Duration(ms)*time.Millisecond) {
 		return
 	}
 
-	time.Sleep(time.Duration(ms) * time.Millisecond)
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(DelayResponse{
 		DelayMs: ms,
@@ -50,15 +50,13 @@ func DelayHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// RandomDelayHandler は GET /random-delay
 func RandomDelayHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		methodNotAllowed(w)
+	ms := rand.Intn(maxRandomDelayMs)
+	if !wait(w, r, time.Duration(ms)*time.Millisecond) {
 		return
 	}
 
-	ms := rand.Intn(maxRandomDelayMs)
-	time.Sleep(time.Duration(ms) * time.Millisecond)
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(DelayResponse{
 		DelayMs: ms,
@@ -66,16 +64,11 @@ func RandomDelayHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// ErrorRateHandler は GET /error-rate/{pct}
 func ErrorRateHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		methodNotAllowed(w)
-		return
-	}
-
-	path := strings.TrimPrefix(r.URL.Path, "/error-rate/")
-	percent, err := strconv.Atoi(path)
+	percent, err := strconv.Atoi(r.PathValue("pct"))
 	if err != nil || percent < 0 || percent > maxErrorRate {
-		writeError(w, http.StatusBadRequest, "invalid error rate (0-100)")
+		writeError(w, r, problem.CodeInvalidParameter, "invalid error rate (0-100)")
 		return
 	}
 
@@ -97,3 +90,20 @@ func ErrorRateHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// wait は遅いアップストリームの代わりにdの間待つ
+// 先にリクエストが終了した場合は待つのをやめ、タイムアウトなら504を返す（切断なら何も書かない）
+func wait(w http.ResponseWriter, r *http.Request, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			writeError(w, r, problem.CodeUpstreamTimeout, "upstream did not respond within the request timeout")
+		}
+		return false
+	}
+}
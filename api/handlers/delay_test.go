@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestDelayHandler(t *testing.T) {
@@ -12,6 +14,7 @@ func TestDelayHandler(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/delay/10", nil)
 		rec := httptest.NewRecorder()
 
+		req.SetPathValue("ms", "10")
 		DelayHandler(rec, req)
 
 		if rec.Code != http.StatusOK {
@@ -32,6 +35,7 @@ func TestDelayHandler(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/delay/invalid", nil)
 		rec := httptest.NewRecorder()
 
+		req.SetPathValue("ms", "invalid")
 		DelayHandler(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
@@ -43,6 +47,7 @@ func TestDelayHandler(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/delay/-1", nil)
 		rec := httptest.NewRecorder()
 
+		req.SetPathValue("ms", "-1")
 		DelayHandler(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
@@ -54,23 +59,13 @@ func TestDelayHandler(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/delay/20000", nil)
 		rec := httptest.NewRecorder()
 
+		req.SetPathValue("ms", "20000")
 		DelayHandler(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
 			t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
 		}
 	})
-
-	t.Run("POST /delay/10 returns method not allowed", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodPost, "/delay/10", nil)
-		rec := httptest.NewRecorder()
-
-		DelayHandler(rec, req)
-
-		if rec.Code != http.StatusMethodNotAllowed {
-			t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
-		}
-	})
 }
 
 func TestRandomDelayHandler(t *testing.T) {
@@ -93,17 +88,6 @@ func TestRandomDelayHandler(t *testing.T) {
 			t.Errorf("expected delay_ms between 0-1000, got %d", resp.DelayMs)
 		}
 	})
-
-	t.Run("POST /delay/random returns method not allowed", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodPost, "/delay/random", nil)
-		rec := httptest.NewRecorder()
-
-		RandomDelayHandler(rec, req)
-
-		if rec.Code != http.StatusMethodNotAllowed {
-			t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
-		}
-	})
 }
 
 func TestErrorRateHandler(t *testing.T) {
@@ -111,6 +95,7 @@ func TestErrorRateHandler(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/error-rate/0", nil)
 		rec := httptest.NewRecorder()
 
+		req.SetPathValue("pct", "0")
 		ErrorRateHandler(rec, req)
 
 		if rec.Code != http.StatusOK {
@@ -131,6 +116,7 @@ func TestErrorRateHandler(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/error-rate/100", nil)
 		rec := httptest.NewRecorder()
 
+		req.SetPathValue("pct", "100")
 		ErrorRateHandler(rec, req)
 
 		if rec.Code != http.StatusInternalServerError {
@@ -151,6 +137,7 @@ func TestErrorRateHandler(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/error-rate/invalid", nil)
 		rec := httptest.NewRecorder()
 
+		req.SetPathValue("pct", "invalid")
 		ErrorRateHandler(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
@@ -162,6 +149,7 @@ func TestErrorRateHandler(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/error-rate/-1", nil)
 		rec := httptest.NewRecorder()
 
+		req.SetPathValue("pct", "-1")
 		ErrorRateHandler(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
@@ -173,21 +161,51 @@ func TestErrorRateHandler(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/error-rate/101", nil)
 		rec := httptest.NewRecorder()
 
+		req.SetPathValue("pct", "101")
 		ErrorRateHandler(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
 			t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
 		}
 	})
+}
 
-	t.Run("POST /error-rate/50 returns method not allowed", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodPost, "/error-rate/50", nil)
-		rec := httptest.NewRecorder()
-
-		ErrorRateHandler(rec, req)
-
-		if rec.Code != http.StatusMethodNotAllowed {
-			t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
-		}
-	})
+func TestDelayHandler_Context(t *testing.T) {
+	tests := []struct {
+		name           string
+		ctx            func() (context.Context, context.CancelFunc)
+		expectedStatus int
+	}{
+		{"deadline before delay returns gateway timeout", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 10*time.Millisecond)
+		}, http.StatusGatewayTimeout},
+		{"canceled request writes nothing", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(10*time.Millisecond, cancel)
+			return ctx, cancel
+		}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			req := httptest.NewRequest(http.MethodGet, "/delay/5000", nil).WithContext(ctx)
+			req.SetPathValue("ms", "5000")
+			rec := httptest.NewRecorder()
+
+			start := time.Now()
+			DelayHandler(rec, req)
+
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("expected delay to stop with the request, took %s", elapsed)
+			}
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedStatus == http.StatusOK && rec.Body.Len() != 0 {
+				t.Errorf("expected empty body, got %q", rec.Body.String())
+			}
+		})
+	}
 }
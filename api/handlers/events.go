@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"k6-practice/api/metrics"
+	"k6-practice/api/models"
+	"k6-practice/api/problem"
+	"k6-practice/api/requestid"
+)
+
+// EventsConfig はServer-Sent Eventsのハンドラーの設定
+type EventsConfig struct {
+	// Heartbeat: 変更がなくても送るコメント行の間隔（プロキシのアイドル切断を防ぐ、0以下は送らない）
+	Heartbeat time.Duration
+	// WriteTimeout: 1イベントの送信タイムアウト（超えた接続は切断する、0以下は設定しない）
+	WriteTimeout time.Duration
+	// Buffer: 接続ごとにためておける変更通知の数（溢れた接続は切断する）
+	Buffer int
+}
+
+// sseRetry は再接続までの待ち時間としてクライアントに伝える値（ミリ秒）
+const sseRetry = 3000
+
+// EventsHandler は /events 以下のServer-Sent Eventsのハンドラー
+// 遅い購読者は切断し、クライアントはLast-Event-IDで再接続して取りこぼしを受け取る
+type EventsHandler struct {
+	store *models.UserStore
+	cfg   EventsConfig
+}
+
+func NewEventsHandler(store *models.UserStore, cfg EventsConfig) *EventsHandler {
+	return &EventsHandler{store: store, cfg: cfg}
+}
+
+// SSEの統計（ストリーム名ごと）
+var (
+	sseActive        = new(expvar.Map).Init()
+	sseConnections   = new(expvar.Map).Init()
+	sseEventsOut     = new(expvar.Map).Init()
+	sseSlowConsumers = new(expvar.Map).Init()
+	sseResumed       = new(expvar.Map).Init()
+	sseResets        = new(expvar.Map).Init()
+)
+
+func init() {
+	m := new(expvar.Map).Init()
+	m.Set("connections_active", sseActive)
+	m.Set("connections_total", sseConnections)
+	m.Set("events_out", sseEventsOut)
+	m.Set("slow_consumer_disconnects", sseSlowConsumers)
+	m.Set("resumed", sseResumed)
+	m.Set("resets", sseResets)
+	metrics.Set("sse", m)
+}
+
+// Users は GET /events/users（middleware.Auth の後段で呼ばれる）
+// UserStoreの変更をtext/event-streamで送る。Last-Event-IDがあれば以降の変更を再送してから続ける
+func (h *EventsHandler) Users(w http.ResponseWriter, r *http.Request) {
+	const stream = "users"
+
+	var lastEventID uint64
+	resume := r.Header.Get("Last-Event-ID")
+	if resume != "" {
+		id, err := strconv.ParseUint(resume, 10, 64)
+		if err != nil {
+			writeError(w, r, problem.CodeInvalidParameter, "Last-Event-ID must be a non-negative integer")
+			return
+		}
+		lastEventID = id
+	}
+
+	// Last-Event-IDがなければ接続以降の変更だけを送る
+	var (
+		replay   []models.Event
+		complete = true
+		events   <-chan models.Event
+		cancel   func()
+	)
+	if resume != "" {
+		replay, complete, events, cancel = h.store.SubscribeFrom(lastEventID, h.cfg.Buffer)
+	} else {
+		events, cancel = h.store.Subscribe(h.cfg.Buffer)
+	}
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginxなどのリバースプロキシにバッファさせない
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sseActive.Add(stream, 1)
+	sseConnections.Add(stream, 1)
+	defer sseActive.Add(stream, -1)
+
+	start, sent := time.Now(), 0
+	reason := "client closed"
+	defer func() {
+		log.Printf("[SSE] stream=%s request_id=%s duration=%s events=%d last_event_id=%d reason=%q",
+			stream, requestid.FromContext(r.Context()), time.Since(start), sent, lastEventID, reason)
+	}()
+
+	// send はタイムアウト付きで書き込んでフラッシュする
+	send := func(write func(io.Writer) error) bool {
+		if h.cfg.WriteTimeout > 0 {
+			rc.SetWriteDeadline(time.Now().Add(h.cfg.WriteTimeout))
+		}
+		if err := write(w); err != nil {
+			reason = "write failed: " + err.Error()
+			return false
+		}
+		if err := rc.Flush(); err != nil {
+			reason = "flush failed: " + err.Error()
+			return false
+		}
+		return true
+	}
+
+	if !send(func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetry)
+		return err
+	}) {
+		return
+	}
+
+	if resume != "" {
+		sseResumed.Add(stream, 1)
+		if !complete {
+			// 取りこぼしを再送できないため、クライアントに全件の再取得を促す
+			sseResets.Add(stream, 1)
+			if !send(func(w io.Writer) error {
+				_, err := io.WriteString(w, "event: reset\ndata: {}\n\n")
+				return err
+			}) {
+				return
+			}
+		}
+	}
+	for _, ev := range replay {
+		if !send(writeEvent(ev)) {
+			return
+		}
+		sent++
+		lastEventID = ev.ID
+		sseEventsOut.Add(stream, 1)
+	}
+
+	// time.NewTicker は0以下の間隔でpanicするため、その場合はハートビートを送らない（nilのチャネルは受信しない）
+	var heartbeat <-chan time.Time
+	if h.cfg.Heartbeat > 0 {
+		ticker := time.NewTicker(h.cfg.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				// バッファが溢れた（遅い購読者）。切断して再接続時に再送する
+				reason = "slow consumer"
+				sseSlowConsumers.Add(stream, 1)
+				return
+			}
+			if !send(writeEvent(ev)) {
+				return
+			}
+			sent++
+			lastEventID = ev.ID
+			sseEventsOut.Add(stream, 1)
+		case <-heartbeat:
+			if !send(func(w io.Writer) error {
+				_, err := io.WriteString(w, ": heartbeat\n\n")
+				return err
+			}) {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent は1件の変更をSSEのイベントとして書き込む
+func writeEvent(ev models.Event) func(io.Writer) error {
+	return func(w io.Writer) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+		return err
+	}
+}
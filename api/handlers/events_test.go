@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k6-practice/api/models"
+)
+
+var testEventsConfig = EventsConfig{
+	Heartbeat:    time.Minute,
+	WriteTimeout: time.Second,
+	Buffer:       16,
+}
+
+// sseEvent はテスト用にパースした1件のイベント
+type sseEvent struct {
+	id, event, data, comment string
+}
+
+// readEvent は空行までを1件のイベントとして読む
+func readEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+	var ev sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return ev
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			ev.id = value
+		case "event":
+			ev.event = value
+		case "data":
+			ev.data = value
+		case "":
+			ev.comment = value
+		}
+	}
+}
+
+func openEventStream(t *testing.T, store *models.UserStore, cfg EventsConfig, lastEventID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(NewEventsHandler(store, cfg).Users))
+	t.Cleanup(ts.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/events/users", nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	r := bufio.NewReader(resp.Body)
+	if retry := readEvent(t, r); retry.id != "" || retry.event != "" {
+		t.Fatalf("expected retry preamble, got %+v", retry)
+	}
+	return resp, r
+}
+
+func TestEventsHandler_Users(t *testing.T) {
+	t.Run("streams store changes", func(t *testing.T) {
+		store := models.NewUserStore()
+		resp, r := openEventStream(t, store, testEventsConfig, "")
+
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("expected Content-Type text/event-stream, got %q", ct)
+		}
+
+		user := store.Create("Dave", "dave@example.com")
+		store.Delete(user.ID)
+
+		for _, expected := range []models.EventType{models.EventUserCreated, models.EventUserDeleted} {
+			ev := readEvent(t, r)
+			if ev.event != string(expected) {
+				t.Errorf("expected event %s, got %+v", expected, ev)
+			}
+			if !strings.Contains(ev.data, `"email":"dave@example.com"`) {
+				t.Errorf("expected user in data, got %s", ev.data)
+			}
+		}
+	})
+
+	t.Run("Last-Event-ID replays missed changes", func(t *testing.T) {
+		store := models.NewUserStore()
+		events, cancel := store.Subscribe(8)
+		store.Create("Dave", "dave@example.com")
+		store.Create("Erin", "erin@example.com")
+		cancel()
+		first := <-events
+
+		_, r := openEventStream(t, store, testEventsConfig, strconv.FormatUint(first.ID, 10))
+
+		ev := readEvent(t, r)
+		if ev.id != strconv.FormatUint(first.ID+1, 10) || !strings.Contains(ev.data, "erin@example.com") {
+			t.Errorf("expected replay of event %d, got %+v", first.ID+1, ev)
+		}
+	})
+
+	t.Run("Last-Event-ID outside replay buffer asks for reset", func(t *testing.T) {
+		store := models.NewUserStore()
+		for i := 0; i < models.ReplayBufferSize; i++ {
+			store.Update(1, "Alice", "alice@example.com")
+		}
+
+		_, r := openEventStream(t, store, testEventsConfig, "1")
+
+		if ev := readEvent(t, r); ev.event != "reset" {
+			t.Errorf("expected reset event, got %+v", ev)
+		}
+		if ev := readEvent(t, r); ev.event != string(models.EventUserUpdated) {
+			t.Errorf("expected buffered events after reset, got %+v", ev)
+		}
+	})
+
+	t.Run("sends heartbeats", func(t *testing.T) {
+		cfg := testEventsConfig
+		cfg.Heartbeat = 20 * time.Millisecond
+		_, r := openEventStream(t, models.NewUserStore(), cfg, "")
+
+		if ev := readEvent(t, r); ev.comment != "heartbeat" {
+			t.Errorf("expected heartbeat comment, got %+v", ev)
+		}
+	})
+
+	t.Run("non-positive heartbeat and write timeout are disabled", func(t *testing.T) {
+		for _, d := range []time.Duration{0, -time.Second} {
+			cfg := testEventsConfig
+			cfg.Heartbeat = d
+			cfg.WriteTimeout = d
+			store := models.NewUserStore()
+			_, r := openEventStream(t, store, cfg, "")
+
+			store.Create("Dave", "dave@example.com")
+			if ev := readEvent(t, r); ev.event != string(models.EventUserCreated) {
+				t.Errorf("%s: expected the stream to keep working, got %+v", d, ev)
+			}
+		}
+	})
+
+	t.Run("invalid Last-Event-ID returns bad request", func(t *testing.T) {
+		resp, _ := openEventStream(t, models.NewUserStore(), testEventsConfig, "abc")
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+		}
+	})
+}
+
+// blockingWriter は解放されるまで書き込みをブロックする（遅い購読者）
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	mu      sync.Mutex
+	writes  int
+	started chan struct{}
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (bw *blockingWriter) Write(b []byte) (int, error) {
+	bw.mu.Lock()
+	bw.writes++
+	n := bw.writes
+	bw.mu.Unlock()
+	// 1回目（retry）で購読の開始を知らせ、2回目の書き込みで止める
+	if n == 1 {
+		close(bw.started)
+	}
+	if n == 2 {
+		close(bw.blocked)
+		<-bw.release
+	}
+	return bw.ResponseRecorder.Write(b)
+}
+
+func TestEventsHandler_SlowConsumer(t *testing.T) {
+	store := models.NewUserStore()
+	cfg := testEventsConfig
+	cfg.Buffer = 1
+
+	w := &blockingWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		started:          make(chan struct{}),
+		blocked:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	req := httptest.NewRequest(http.MethodGet, "/events/users", nil)
+
+	done := make(chan struct{})
+	go func() {
+		NewEventsHandler(store, cfg).Users(w, req)
+		close(done)
+	}()
+
+	<-w.started
+	store.Create("Dave", "dave@example.com")
+	<-w.blocked
+	// 送信が止まっている間にバッファを溢れさせる
+	for i := 0; i < 3; i++ {
+		store.Update(1, "Alice", "alice@example.com")
+	}
+	close(w.release)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected slow consumer to be disconnected")
+	}
+}
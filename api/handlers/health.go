@@ -3,23 +3,67 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"sync"
 	"time"
 )
 
 type HealthResponse struct {
-	Status    string    `json:"status"`
-	Timestamp time.Time `json:"timestamp"`
+	Status    string    `json:"status" openapi:"required"`
+	Timestamp time.Time `json:"timestamp" openapi:"required"`
 }
 
+// HealthCheck は GET /health
 func HealthCheck(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		methodNotAllowed(w)
-		return
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(HealthResponse{
 		Status:    "ok",
 		Timestamp: time.Now(),
 	})
 }
+
+// Readiness はトラフィックを受け付けるかどうか（管理用APIで切り替える）
+// 停止前にロードバランサーから外す、負荷試験中に一部のインスタンスを外すといった操作に使う
+type Readiness struct {
+	mu     sync.RWMutex
+	ready  bool
+	reason string
+}
+
+func NewReadiness() *Readiness {
+	return &Readiness{ready: true}
+}
+
+// Set は状態と、その理由（準備中の場合にレスポンスに含める）を設定する
+func (rd *Readiness) Set(ready bool, reason string) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	rd.ready = ready
+	rd.reason = reason
+}
+
+// Status は現在の状態
+func (rd *Readiness) Status() ReadinessResponse {
+	rd.mu.RLock()
+	defer rd.mu.RUnlock()
+	status := "ready"
+	if !rd.ready {
+		status = "not_ready"
+	}
+	return ReadinessResponse{Ready: rd.ready, Status: status, Reason: rd.reason}
+}
+
+type ReadinessResponse struct {
+	Ready  bool   `json:"ready" openapi:"required"`
+	Status string `json:"status" openapi:"required"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Ready は GET /ready（準備中は503）
+func (rd *Readiness) Ready(w http.ResponseWriter, r *http.Request) {
+	status := rd.Status()
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
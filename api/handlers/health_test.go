@@ -31,15 +31,36 @@ func TestHealthCheck(t *testing.T) {
 			t.Error("expected timestamp to be set")
 		}
 	})
+}
 
-	t.Run("POST /health returns method not allowed", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodPost, "/health", nil)
-		rec := httptest.NewRecorder()
+func TestReadiness(t *testing.T) {
+	readiness := NewReadiness()
 
-		HealthCheck(rec, req)
+	tests := []struct {
+		name           string
+		ready          bool
+		reason         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"ready by default", true, "", http.StatusOK, "ready"},
+		{"not ready with reason", false, "draining", http.StatusServiceUnavailable, "not_ready"},
+	}
 
-		if rec.Code != http.StatusMethodNotAllowed {
-			t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
-		}
-	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readiness.Set(tt.ready, tt.reason)
+			rec := httptest.NewRecorder()
+			readiness.Ready(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			var resp ReadinessResponse
+			json.NewDecoder(rec.Body).Decode(&resp)
+			if resp.Status != tt.expectedBody || resp.Reason != tt.reason {
+				t.Errorf("unexpected response %+v", resp)
+			}
+		})
+	}
 }
@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k6-practice/api/metrics"
+	"k6-practice/api/middleware"
+)
+
+// LockoutConfig はログインの総当たり対策の設定
+type LockoutConfig struct {
+	// AccountThreshold: 同じアカウントへの失敗でロックする回数（0は無効）
+	AccountThreshold int
+	// IPThreshold: 同じIPからの失敗でロックする回数（アカウントをまたいで数える、0は無効）
+	IPThreshold int
+	// Window: 失敗を数える期間（最後の失敗からこの期間が過ぎたら数え直す）
+	Window time.Duration
+	// Duration: 最初のロックの期間（続けてロックするたびに倍にし、MaxDurationで頭打ち）
+	Duration    time.Duration
+	MaxDuration time.Duration
+	// DelayBase: 失敗したログインの応答を遅らせる時間（失敗のたびに倍にし、DelayMaxで頭打ち、0は遅らせない）
+	DelayBase time.Duration
+	DelayMax  time.Duration
+	// TrustedProxies: X-Forwarded-For を信頼するプロキシのアドレス（CIDRまたはIP、空ならRemoteAddrだけでIPを数える）
+	TrustedProxies []string
+}
+
+// ロックの対象
+const (
+	LockoutScopeAccount = "account"
+	LockoutScopeIP      = "ip"
+)
+
+// ErrInvalidLockoutScope はロックの対象が account でも ip でもない
+var ErrInvalidLockoutScope = errors.New("lockout scope must be account or ip")
+
+// LockoutError はロック中のためログインを受け付けない
+type LockoutError struct {
+	Scope string
+	Key   string
+	Until time.Time
+	// Failures: ロックしたときの失敗回数
+	Failures int
+	// Triggered: この失敗でロックした（ロック中の試行では false）
+	Triggered bool
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("login locked for %s %s until %s after %d failed attempts",
+		e.Scope, e.Key, e.Until.Format(time.RFC3339), e.Failures)
+}
+
+// RetryAfter はロックが解除されるまでの秒数（Retry-After ヘッダー用、最低1秒）
+func (e *LockoutError) RetryAfter() int {
+	return max(1, int(time.Until(e.Until).Seconds()+0.999))
+}
+
+// LockoutStatus はアカウントまたはIPの失敗回数とロックの状態（管理用APIで参照する）
+type LockoutStatus struct {
+	Scope       string     `json:"scope"`
+	Key         string     `json:"key"`
+	Failures    int        `json:"failures"`
+	Lockouts    int        `json:"lockouts"`
+	LastFailure time.Time  `json:"last_failure"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+type loginAttempts struct {
+	failures int
+	// pending: 結果が出ていない試行の数（失敗になる可能性があるものとしてしきい値に数える）
+	pending     int
+	lastFailure time.Time
+	lockouts    int
+	lockedUntil time.Time
+	lockedAfter int
+}
+
+// ログインの総当たり対策の統計
+var (
+	lockoutStats    = new(expvar.Map).Init()
+	loginFailures   = new(expvar.Int)
+	loginLockouts   = new(expvar.Map).Init()
+	loginRejected   = new(expvar.Int)
+	loginDelayTotal = new(expvar.Float)
+)
+
+func init() {
+	lockoutStats.Set("failures", loginFailures)
+	lockoutStats.Set("lockouts", loginLockouts)
+	lockoutStats.Set("rejected_while_locked", loginRejected)
+	lockoutStats.Set("delay_ms_total", loginDelayTotal)
+	metrics.Set("login_guard", lockoutStats)
+}
+
+// LoginGuard はアカウントごと・IPごとにログインの失敗を数え、応答の遅延とロックを行う
+// 存在しないアカウントも同じように数える（ロックの有無でアカウントの存在がわからないようにする）
+type LoginGuard struct {
+	cfg     LockoutConfig
+	trusted []netip.Prefix
+
+	mu        sync.Mutex
+	accounts  map[string]*loginAttempts
+	ips       map[string]*loginAttempts
+	lastSweep time.Time
+}
+
+func NewLoginGuard(cfg LockoutConfig) *LoginGuard {
+	g := &LoginGuard{
+		cfg:      cfg,
+		accounts: make(map[string]*loginAttempts),
+		ips:      make(map[string]*loginAttempts),
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				log.Printf("lockout: ignoring invalid trusted proxy %q", proxy)
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		g.trusted = append(g.trusted, prefix.Masked())
+	}
+	return g
+}
+
+// ClientIP は失敗をIPごとに数えるためのクライアントのアドレス
+// X-Forwarded-For は TrustedProxies からの場合だけ使う（ヘッダーを変えてIPのロックを逃れられないように）
+func (g *LoginGuard) ClientIP(r *http.Request) string {
+	return middleware.TrustedClientIP(r, g.trusted)
+}
+
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// LoginAttempt はロックを確認して予約したログインの試行
+// Failure・Success・Release のいずれかで予約を返す（2回目以降の呼び出しは何もしない）
+type LoginAttempt struct {
+	g       *LoginGuard
+	account string
+	ip      string
+	done    bool
+}
+
+// Begin はアカウントとIPがロック中でなければ試行を予約する（ロック中なら LockoutError を返す）
+// 確認と予約を1回のロックで行い、結果の出ていない試行もしきい値に数える
+// （同じアカウントへの並行した試行がすべて確認を通り、しきい値を超えて試せないようにする）
+func (g *LoginGuard) Begin(email, ip string) (*LoginAttempt, *LockoutError) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	g.sweep(now)
+	account := accountKey(email)
+	targets := []struct {
+		scope, key string
+		threshold  int
+		entries    map[string]*loginAttempts
+	}{
+		{LockoutScopeAccount, account, g.cfg.AccountThreshold, g.accounts},
+		{LockoutScopeIP, ip, g.cfg.IPThreshold, g.ips},
+	}
+	for _, target := range targets {
+		a, ok := target.entries[target.key]
+		if !ok {
+			continue
+		}
+		if now.Before(a.lockedUntil) {
+			loginRejected.Add(1)
+			return nil, &LockoutError{Scope: target.scope, Key: target.key, Until: a.lockedUntil, Failures: a.lockedAfter}
+		}
+		// 結果待ちの試行がすべて失敗するとしきい値に達する場合は、結果が出るまで受け付けない
+		if failures := g.failures(a, now); target.threshold > 0 && failures+a.pending >= target.threshold {
+			loginRejected.Add(1)
+			return nil, &LockoutError{Scope: target.scope, Key: target.key, Until: now, Failures: failures}
+		}
+	}
+	for _, target := range targets {
+		a, ok := target.entries[target.key]
+		if !ok {
+			a = &loginAttempts{}
+			target.entries[target.key] = a
+		}
+		a.pending++
+	}
+	return &LoginAttempt{g: g, account: account, ip: ip}, nil
+}
+
+// Failure は失敗を記録し、応答を遅らせる時間と、この失敗でロックした場合は LockoutError を返す
+func (a *LoginAttempt) Failure() (time.Duration, *LockoutError) {
+	g := a.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if a.done {
+		return 0, nil
+	}
+	a.done = true
+
+	now := time.Now()
+	loginFailures.Add(1)
+
+	account := g.record(g.accounts, a.account, now)
+	client := g.record(g.ips, a.ip, now)
+	failures := max(account.failures, client.failures)
+
+	// 両方がしきい値に達した場合は両方ロックし、アカウントのロックを返す
+	accountLocked := g.lock(account, LockoutScopeAccount, a.account, g.cfg.AccountThreshold, now)
+	ipLocked := g.lock(client, LockoutScopeIP, a.ip, g.cfg.IPThreshold, now)
+	if accountLocked != nil {
+		return 0, accountLocked
+	}
+	if ipLocked != nil {
+		return 0, ipLocked
+	}
+
+	if g.cfg.DelayBase <= 0 {
+		return 0, nil
+	}
+	delay := g.cfg.DelayBase << min(failures-1, 20)
+	if g.cfg.DelayMax > 0 && delay > g.cfg.DelayMax {
+		delay = g.cfg.DelayMax
+	}
+	return delay, nil
+}
+
+// Success はアカウントの失敗回数とロックの履歴を消す
+// IPの失敗回数は消さない（クレデンシャルスタッフィングで一部が成功しても数え続ける）
+func (a *LoginAttempt) Success() {
+	g := a.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if a.done {
+		return
+	}
+	a.done = true
+
+	// 同じアカウントへの結果待ちの予約は残す
+	if account, ok := g.accounts[a.account]; ok && account.pending > 1 {
+		g.accounts[a.account] = &loginAttempts{pending: account.pending - 1}
+	} else {
+		delete(g.accounts, a.account)
+	}
+	g.release(g.ips, a.ip)
+}
+
+// Release は結果を数えずに予約を返す（認証以外のエラーや、多要素認証の2段階目を待つ場合）
+func (a *LoginAttempt) Release() {
+	g := a.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if a.done {
+		return
+	}
+	a.done = true
+
+	g.release(g.accounts, a.account)
+	g.release(g.ips, a.ip)
+}
+
+// release は予約を1つ返し、何も記録していなければ削除する（g.mu を保持して呼ぶ）
+func (g *LoginGuard) release(entries map[string]*loginAttempts, key string) {
+	a, ok := entries[key]
+	if !ok {
+		return
+	}
+	a.pending = max(0, a.pending-1)
+	if a.pending == 0 && a.lastFailure.IsZero() && a.lockouts == 0 {
+		delete(entries, key)
+	}
+}
+
+// failures は期間内の失敗回数（g.mu を保持して呼ぶ）
+func (g *LoginGuard) failures(a *loginAttempts, now time.Time) int {
+	if now.Sub(a.lastFailure) > g.cfg.Window {
+		return 0
+	}
+	return a.failures
+}
+
+// record は予約を返して失敗回数を1つ増やす（g.mu を保持して呼ぶ）
+func (g *LoginGuard) record(entries map[string]*loginAttempts, key string, now time.Time) *loginAttempts {
+	a, ok := entries[key]
+	if !ok {
+		a = &loginAttempts{}
+		entries[key] = a
+	}
+	a.pending = max(0, a.pending-1)
+	a.failures = g.failures(a, now) + 1
+	a.lastFailure = now
+	return a
+}
+
+// lock は失敗回数がしきい値に達していればロックする（g.mu を保持して呼ぶ）
+func (g *LoginGuard) lock(a *loginAttempts, scope, key string, threshold int, now time.Time) *LockoutError {
+	if threshold <= 0 || a.failures < threshold {
+		return nil
+	}
+
+	duration := g.cfg.Duration << min(a.lockouts, 20)
+	if g.cfg.MaxDuration > 0 && duration > g.cfg.MaxDuration {
+		duration = g.cfg.MaxDuration
+	}
+	a.lockouts++
+	a.lockedUntil = now.Add(duration)
+	a.lockedAfter = a.failures
+	a.failures = 0
+	loginLockouts.Add(scope, 1)
+
+	return &LockoutError{Scope: scope, Key: key, Until: a.lockedUntil, Failures: a.lockedAfter, Triggered: true}
+}
+
+// Wait は失敗したログインの応答を遅らせる（コンテキストが終了したら戻る）
+func (g *LoginGuard) Wait(ctx context.Context, delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+	loginDelayTotal.Add(float64(delay) / float64(time.Millisecond))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// sweep は期間を過ぎてロックもしていない記録を削除する（Window に1回まで、g.mu を保持して呼ぶ）
+func (g *LoginGuard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < g.cfg.Window {
+		return
+	}
+	g.lastSweep = now
+	for _, entries := range []map[string]*loginAttempts{g.accounts, g.ips} {
+		for key, a := range entries {
+			if a.pending == 0 && now.Sub(a.lastFailure) > g.cfg.Window && now.Sub(a.lockedUntil) > g.cfg.Window {
+				delete(entries, key)
+			}
+		}
+	}
+}
+
+// Statuses は失敗を記録しているアカウントとIP（ロック中のものから、次に対象・キーの順）
+func (g *LoginGuard) Statuses() []LockoutStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	statuses := []LockoutStatus{}
+	for scope, entries := range map[string]map[string]*loginAttempts{LockoutScopeAccount: g.accounts, LockoutScopeIP: g.ips} {
+		for key, a := range entries {
+			if a.lastFailure.IsZero() {
+				// 結果待ちの試行だけで、まだ失敗を記録していない
+				continue
+			}
+			s := LockoutStatus{Scope: scope, Key: key, Failures: a.failures, Lockouts: a.lockouts, LastFailure: a.lastFailure}
+			if now.Before(a.lockedUntil) {
+				until := a.lockedUntil
+				s.LockedUntil = &until
+			}
+			statuses = append(statuses, s)
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		a, b := statuses[i], statuses[j]
+		if (a.LockedUntil != nil) != (b.LockedUntil != nil) {
+			return a.LockedUntil != nil
+		}
+		if a.Scope != b.Scope {
+			return a.Scope < b.Scope
+		}
+		return a.Key < b.Key
+	})
+	return statuses
+}
+
+// Reset はすべてのアカウントとIPのロックと失敗回数を消す（結果待ちの予約は残さない）
+func (g *LoginGuard) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.accounts = make(map[string]*loginAttempts)
+	g.ips = make(map[string]*loginAttempts)
+}
+
+// Unlock はアカウントまたはIPのロックと失敗回数を消す（記録がなければ false）
+// scope が account でも ip でもなければ ErrInvalidLockoutScope を返す
+func (g *LoginGuard) Unlock(scope, key string) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var entries map[string]*loginAttempts
+	switch scope {
+	case LockoutScopeAccount:
+		entries = g.accounts
+		key = accountKey(key)
+	case LockoutScopeIP:
+		entries = g.ips
+	default:
+		return false, ErrInvalidLockoutScope
+	}
+	a, ok := entries[key]
+	if !ok || a.lastFailure.IsZero() {
+		return false, nil
+	}
+	if a.pending > 0 {
+		// 結果待ちの予約は残す
+		entries[key] = &loginAttempts{pending: a.pending}
+		return true, nil
+	}
+	delete(entries, key)
+	return true, nil
+}
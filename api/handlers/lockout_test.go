@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failure は失敗を記録する（ロック中でも Begin を通さずに数える）
+func failure(g *LoginGuard, email, ip string) (time.Duration, *LockoutError) {
+	return (&LoginAttempt{g: g, account: accountKey(email), ip: ip}).Failure()
+}
+
+// check はロック中なら LockoutError を返す（予約はすぐに返す）
+func check(g *LoginGuard, email, ip string) *LockoutError {
+	attempt, lock := g.Begin(email, ip)
+	if attempt != nil {
+		attempt.Release()
+	}
+	return lock
+}
+
+func TestLoginGuard_AccountLockout(t *testing.T) {
+	g := NewLoginGuard(LockoutConfig{AccountThreshold: 3, IPThreshold: 100, Window: time.Minute, Duration: time.Minute, MaxDuration: 3 * time.Minute})
+
+	// IPを変えても同じアカウントの失敗として数える（大文字小文字は区別しない）
+	for i, email := range []string{"alice@example.com", "Alice@Example.com"} {
+		if _, lock := failure(g, email, "192.0.2."+string(rune('1'+i))); lock != nil {
+			t.Fatalf("failure %d: unexpected lockout %v", i+1, lock)
+		}
+	}
+	_, lock := failure(g, " alice@example.com ", "192.0.2.9")
+	if lock == nil || !lock.Triggered || lock.Scope != LockoutScopeAccount || lock.Failures != 3 {
+		t.Fatalf("expected the third failure to lock the account, got %+v", lock)
+	}
+	if d := time.Until(lock.Until); d < 59*time.Second || d > time.Minute {
+		t.Errorf("expected the first lockout to last 1m, got %s", d)
+	}
+
+	lock = check(g, "alice@example.com", "198.51.100.1")
+	if lock == nil || lock.Triggered || lock.Scope != LockoutScopeAccount {
+		t.Fatalf("expected the account to be locked from any IP, got %+v", lock)
+	}
+	if lock.RetryAfter() < 59 || lock.RetryAfter() > 60 {
+		t.Errorf("expected Retry-After of about 60, got %d", lock.RetryAfter())
+	}
+	if lock := check(g, "bob@example.com", "192.0.2.9"); lock != nil {
+		t.Errorf("expected other accounts to be unaffected, got %+v", lock)
+	}
+}
+
+func TestLoginGuard_ProgressiveLockDuration(t *testing.T) {
+	g := NewLoginGuard(LockoutConfig{AccountThreshold: 1, Window: time.Minute, Duration: time.Minute, MaxDuration: 3 * time.Minute})
+
+	tests := []struct {
+		name     string
+		expected time.Duration
+	}{
+		{"first lockout", time.Minute},
+		{"doubled", 2 * time.Minute},
+		{"capped by MaxDuration", 3 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, lock := failure(g, "alice@example.com", "192.0.2.1")
+			if lock == nil {
+				t.Fatal("expected a lockout")
+			}
+			if d := time.Until(lock.Until); d < tt.expected-time.Second || d > tt.expected {
+				t.Errorf("expected lockout of %s, got %s", tt.expected, d)
+			}
+		})
+	}
+}
+
+func TestLoginGuard_IPLockout(t *testing.T) {
+	g := NewLoginGuard(LockoutConfig{AccountThreshold: 100, IPThreshold: 3, Window: time.Minute, Duration: time.Minute})
+
+	// 1つのIPから多数のアカウントを試す
+	var lock *LockoutError
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		_, lock = failure(g, email, "203.0.113.1")
+	}
+	if lock == nil || lock.Scope != LockoutScopeIP || lock.Key != "203.0.113.1" {
+		t.Fatalf("expected the IP to be locked, got %+v", lock)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		ip       string
+		expected bool
+	}{
+		{"new account from the locked IP", "d@example.com", "203.0.113.1", true},
+		{"same account from another IP", "a@example.com", "203.0.113.2", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if locked := check(g, tt.email, tt.ip) != nil; locked != tt.expected {
+				t.Errorf("expected locked=%v, got %v", tt.expected, locked)
+			}
+		})
+	}
+}
+
+func TestLoginGuard_ProgressiveDelay(t *testing.T) {
+	g := NewLoginGuard(LockoutConfig{Window: time.Minute, DelayBase: 100 * time.Millisecond, DelayMax: 300 * time.Millisecond})
+
+	for i, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond} {
+		if delay, _ := failure(g, "alice@example.com", "192.0.2.1"); delay != expected {
+			t.Errorf("failure %d: expected delay %s, got %s", i+1, expected, delay)
+		}
+	}
+}
+
+func TestLoginGuard_SuccessAndUnlock(t *testing.T) {
+	g := NewLoginGuard(LockoutConfig{AccountThreshold: 2, IPThreshold: 2, Window: time.Minute, Duration: time.Minute})
+
+	failure(g, "alice@example.com", "192.0.2.1")
+	attempt, _ := g.Begin("alice@example.com", "192.0.2.1")
+	attempt.Success()
+	// 成功でアカウントは数え直すが、IPは数え続ける
+	if _, lock := failure(g, "alice@example.com", "192.0.2.1"); lock == nil || lock.Scope != LockoutScopeIP {
+		t.Fatalf("expected only the IP to reach the threshold, got %+v", lock)
+	}
+
+	statuses := g.Statuses()
+	if len(statuses) != 2 || statuses[0].Scope != LockoutScopeIP || statuses[0].LockedUntil == nil || statuses[1].LockedUntil != nil {
+		t.Fatalf("expected the locked IP first, got %+v", statuses)
+	}
+
+	tests := []struct {
+		name     string
+		scope    string
+		key      string
+		expected bool
+	}{
+		{"locked IP", LockoutScopeIP, "192.0.2.1", true},
+		{"already unlocked", LockoutScopeIP, "192.0.2.1", false},
+		{"account is case insensitive", LockoutScopeAccount, "ALICE@example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.Unlock(tt.scope, tt.key)
+			if err != nil || got != tt.expected {
+				t.Errorf("expected %v, got %v (%v)", tt.expected, got, err)
+			}
+		})
+	}
+
+	if lock := check(g, "alice@example.com", "192.0.2.1"); lock != nil {
+		t.Errorf("expected no lockout after unlock, got %+v", lock)
+	}
+	if statuses := g.Statuses(); len(statuses) != 0 {
+		t.Errorf("expected no entries after unlock, got %+v", statuses)
+	}
+}
+
+func TestLoginGuard_ConcurrentAttempts(t *testing.T) {
+	g := NewLoginGuard(LockoutConfig{AccountThreshold: 3, IPThreshold: 100, Window: time.Minute, Duration: time.Minute})
+
+	// 結果が出る前の並行した試行もしきい値に数える
+	var (
+		mu       sync.Mutex
+		attempts []*LoginAttempt
+		rejected int
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attempt, lock := g.Begin("alice@example.com", "192.0.2.1")
+			mu.Lock()
+			defer mu.Unlock()
+			if lock != nil {
+				rejected++
+				return
+			}
+			attempts = append(attempts, attempt)
+		}()
+	}
+	wg.Wait()
+	if len(attempts) != 3 || rejected != 7 {
+		t.Fatalf("expected 3 reserved and 7 rejected attempts, got %d and %d", len(attempts), rejected)
+	}
+
+	// 結果を数えずに返した予約は次の試行に使える
+	attempts[0].Release()
+	attempts[0].Release()
+	next, lock := g.Begin("alice@example.com", "192.0.2.1")
+	if lock != nil {
+		t.Fatalf("expected a released reservation to be reusable, got %+v", lock)
+	}
+
+	var locked *LockoutError
+	for _, attempt := range append(attempts[1:], next) {
+		if _, lock := attempt.Failure(); lock != nil {
+			locked = lock
+		}
+	}
+	if locked == nil || !locked.Triggered || locked.Failures != 3 {
+		t.Fatalf("expected the reserved failures to lock the account at the threshold, got %+v", locked)
+	}
+	if lock := check(g, "alice@example.com", "192.0.2.2"); lock == nil || lock.Scope != LockoutScopeAccount {
+		t.Errorf("expected the account to be locked, got %+v", lock)
+	}
+}
+
+func TestLoginGuard_UnlockInvalidScope(t *testing.T) {
+	g := NewLoginGuard(LockoutConfig{AccountThreshold: 1, Window: time.Minute, Duration: time.Minute})
+	failure(g, "alice@example.com", "192.0.2.1")
+
+	if _, err := g.Unlock("accounts", "alice@example.com"); !errors.Is(err, ErrInvalidLockoutScope) {
+		t.Errorf("expected ErrInvalidLockoutScope, got %v", err)
+	}
+	if lock := check(g, "alice@example.com", "192.0.2.1"); lock == nil {
+		t.Error("expected the account to stay locked")
+	}
+}
+
+func TestLoginGuard_ClientIP(t *testing.T) {
+	g := NewLoginGuard(LockoutConfig{TrustedProxies: []string{"10.0.0.0/8", "192.0.2.10", "invalid"}})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{"remote addr without port", "198.51.100.1:54321", nil, "198.51.100.1"},
+		{"forwarded for from an untrusted client", "198.51.100.1:54321", []string{"203.0.113.7"}, "198.51.100.1"},
+		{"forwarded for from a trusted proxy", "10.0.0.1:54321", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"single trusted address", "192.0.2.10:443", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"spoofed hop before the proxy", "10.0.0.1:54321", []string{"192.0.2.99, 203.0.113.7"}, "203.0.113.7"},
+		{"chained trusted proxies", "10.0.0.1:54321", []string{"203.0.113.7, 10.0.0.2", "10.0.0.3"}, "203.0.113.7"},
+		{"trusted proxy without forwarded for", "10.0.0.1:54321", nil, "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := g.ClientIP(req); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"k6-practice/api/metrics"
+	"k6-practice/api/middleware"
+	"k6-practice/api/totp"
+)
+
+// MFAConfig はTOTPによる多要素認証の設定
+type MFAConfig struct {
+	// Issuer: 認証アプリに表示する発行者名
+	Issuer string
+	// ChallengeTTL: ログインの2段階目に使うトークン（mfa_token）の有効期限
+	ChallengeTTL time.Duration
+	// Skew: 時計のずれとして前後に受け付ける時間ステップ（30秒）の数
+	Skew int
+	// RecoveryCodes: 有効化したときに発行するリカバリーコードの数
+	RecoveryCodes int
+}
+
+// 多要素認証の失敗（REST・gRPCがそれぞれのエラー表現に変換する）
+var (
+	ErrMFAAlreadyEnabled = errors.New("mfa already enabled")
+	ErrMFANotEnrolled    = errors.New("mfa not enrolled")
+	ErrInvalidMFACode    = errors.New("invalid mfa code")
+	ErrInvalidMFAToken   = errors.New("invalid mfa token")
+)
+
+// MFARequiredError はパスワードは正しいが、ログインにTOTPの確認（2段階目）が必要
+type MFARequiredError struct {
+	// Token: 2段階目（POST /auth/mfa/challenge）に渡すトークン
+	Token     string
+	ExpiresIn int
+}
+
+func (e *MFARequiredError) Error() string {
+	return "mfa required"
+}
+
+type mfaEnrollment struct {
+	secret  string
+	enabled bool
+	// lastStep: 最後に受け付けた時間ステップ（同じコードの再利用を防ぐ）
+	lastStep int64
+	// recovery: 未使用のリカバリーコード（SHA-256）
+	recovery map[string]struct{}
+}
+
+// 多要素認証の統計
+var (
+	mfaStats        = new(expvar.Map).Init()
+	mfaEnrollments  = new(expvar.Int)
+	mfaActivations  = new(expvar.Int)
+	mfaChallenges   = new(expvar.Int)
+	mfaVerified     = new(expvar.Int)
+	mfaFailed       = new(expvar.Int)
+	mfaRecoveryUsed = new(expvar.Int)
+)
+
+func init() {
+	mfaStats.Set("enrollments", mfaEnrollments)
+	mfaStats.Set("activations", mfaActivations)
+	mfaStats.Set("challenges", mfaChallenges)
+	mfaStats.Set("verified", mfaVerified)
+	mfaStats.Set("failed", mfaFailed)
+	mfaStats.Set("recovery_used", mfaRecoveryUsed)
+	metrics.Set("mfa", mfaStats)
+}
+
+// MFAStore はユーザーごとのTOTPの共有鍵とリカバリーコードを保持する
+type MFAStore struct {
+	cfg MFAConfig
+	// now はTOTPの検証に使う時計（テストで固定する）
+	now func() time.Time
+
+	mu    sync.Mutex
+	users map[int]*mfaEnrollment
+}
+
+func NewMFAStore(cfg MFAConfig) *MFAStore {
+	return &MFAStore{cfg: cfg, now: time.Now, users: make(map[int]*mfaEnrollment)}
+}
+
+// Enroll は共有鍵を発行する（有効化は Activate でコードを確認してから）
+// 有効化する前に呼び直した場合は鍵を発行し直す
+func (s *MFAStore) Enroll(userID int, email string) (secret, uri string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.users[userID]; ok && e.enabled {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+	secret, err = totp.NewSecret()
+	if err != nil {
+		return "", "", err
+	}
+	s.users[userID] = &mfaEnrollment{secret: secret}
+	mfaEnrollments.Add(1)
+	return secret, totp.URI(s.cfg.Issuer, email, secret), nil
+}
+
+// Activate は認証アプリのコードを確認して有効化し、リカバリーコードを返す
+// リカバリーコードは平文では保持しないため、ここでしか返せない
+func (s *MFAStore) Activate(userID int, code string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.users[userID]
+	if !ok {
+		return nil, ErrMFANotEnrolled
+	}
+	if e.enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	step, ok := totp.Validate(e.secret, code, s.now(), s.cfg.Skew)
+	if !ok {
+		mfaFailed.Add(1)
+		return nil, ErrInvalidMFACode
+	}
+
+	codes := make([]string, s.cfg.RecoveryCodes)
+	e.recovery = make(map[string]struct{}, len(codes))
+	for i := range codes {
+		c, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = c
+		e.recovery[hashRecoveryCode(c)] = struct{}{}
+	}
+	e.enabled = true
+	e.lastStep = step
+	mfaActivations.Add(1)
+	return codes, nil
+}
+
+// Enabled はユーザーが多要素認証を有効にしているか
+func (s *MFAStore) Enabled(userID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.users[userID]
+	return ok && e.enabled
+}
+
+// Verify はTOTPのコード（6桁）またはリカバリーコードを確認する
+// 受け付けたTOTPの時間ステップとリカバリーコードは再び使えない
+func (s *MFAStore) Verify(userID int, code string) (recovery bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.users[userID]
+	if !ok || !e.enabled {
+		return false, ErrMFANotEnrolled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		if step, ok := totp.Validate(e.secret, code, s.now(), s.cfg.Skew); ok && step > e.lastStep {
+			e.lastStep = step
+			mfaVerified.Add(1)
+			return false, nil
+		}
+	} else if h := hashRecoveryCode(code); hasRecoveryCode(e, h) {
+		delete(e.recovery, h)
+		mfaVerified.Add(1)
+		mfaRecoveryUsed.Add(1)
+		return true, nil
+	}
+	mfaFailed.Add(1)
+	return false, ErrInvalidMFACode
+}
+
+func hasRecoveryCode(e *mfaEnrollment, hash string) bool {
+	_, ok := e.recovery[hash]
+	return ok
+}
+
+// Reset はすべてのユーザーの登録を消す（ユーザーのストアを初期化したとき）
+func (s *MFAStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = make(map[int]*mfaEnrollment)
+}
+
+// newRecoveryCode は "xxxxx-xxxxx" 形式（Base32の小文字、50ビット）のリカバリーコードを生成する
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+	return s[:5] + "-" + s[5:], nil
+}
+
+// hashRecoveryCode は区切り・大文字小文字を無視してリカバリーコードをハッシュにする
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// mfaAudience はMFAチャレンジのトークンの aud（アクセストークンとして使えないよう鍵も分ける）
+const mfaAudience = "mfa-challenge"
+
+// mfaTokenKey はJWTの鍵から導出したMFAチャレンジのトークン用の鍵
+func mfaTokenKey() []byte {
+	mac := hmac.New(sha256.New, middleware.JWTSecret)
+	mac.Write([]byte(mfaAudience))
+	return mac.Sum(nil)
+}
+
+// generateMFAToken はパスワードを確認したユーザーのMFAチャレンジのトークンに署名する
+func generateMFAToken(userID int, email string, ttl time.Duration) (string, error) {
+	claims := &middleware.Claims{
+		UserID: userID,
+		Email:  email,
+		Epoch:  middleware.Revocations.Epoch(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        newTokenID(),
+			Audience:  jwt.ClaimStrings{mfaAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(mfaTokenKey())
+}
+
+// parseMFAToken はMFAチャレンジのトークンを検証する
+func parseMFAToken(token string) (*middleware.Claims, error) {
+	claims := &middleware.Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return mfaTokenKey(), nil
+	}, jwt.WithAudience(mfaAudience), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || middleware.Revocations.Revoked(claims) {
+		return nil, ErrInvalidMFAToken
+	}
+	return claims, nil
+}
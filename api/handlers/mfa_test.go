@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"k6-practice/api/middleware"
+	"k6-practice/api/totp"
+)
+
+// fixedClock はTOTPの検証に使う時計を固定する
+func fixedClock(s *MFAStore, at time.Time) *time.Time {
+	now := at
+	s.now = func() time.Time { return now }
+	return &now
+}
+
+func newTestMFAStore() *MFAStore {
+	return NewMFAStore(MFAConfig{Issuer: "k6-practice-api", ChallengeTTL: time.Minute, Skew: 1, RecoveryCodes: 3})
+}
+
+func mustTOTP(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := totp.Code(secret, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// enrollMFA は登録と有効化を行い、共有鍵とリカバリーコードを返す
+func enrollMFA(t *testing.T, s *MFAStore, userID int, email string) (string, []string) {
+	t.Helper()
+	secret, _, err := s.Enroll(userID, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := s.Activate(userID, mustTOTP(t, secret, s.now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret, codes
+}
+
+func TestMFAStore_Enrollment(t *testing.T) {
+	s := newTestMFAStore()
+	now := fixedClock(s, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	if _, err := s.Activate(1, "123456"); !errors.Is(err, ErrMFANotEnrolled) {
+		t.Fatalf("expected ErrMFANotEnrolled before enroll, got %v", err)
+	}
+
+	secret, uri, err := s.Enroll(1, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(uri, "otpauth://totp/k6-practice-api:alice@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("unexpected URI %s", uri)
+	}
+	if s.Enabled(1) {
+		t.Error("expected MFA to stay disabled until the code is confirmed")
+	}
+
+	if _, err := s.Activate(1, mustTOTP(t, secret, now.Add(-2*totp.Period))); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("expected a stale code to be rejected, got %v", err)
+	}
+	codes, err := s.Activate(1, mustTOTP(t, secret, *now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 3 || !s.Enabled(1) {
+		t.Fatalf("expected MFA enabled with 3 recovery codes, got %v", codes)
+	}
+
+	if _, _, err := s.Enroll(1, "alice@example.com"); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Errorf("expected re-enrollment to be rejected, got %v", err)
+	}
+
+	s.Reset()
+	if s.Enabled(1) {
+		t.Error("expected Reset to remove enrollments")
+	}
+}
+
+func TestMFAStore_Verify(t *testing.T) {
+	s := newTestMFAStore()
+	now := fixedClock(s, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	secret, codes := enrollMFA(t, s, 1, "alice@example.com")
+	// 有効化に使ったステップは使用済み
+	*now = now.Add(totp.Period)
+
+	tests := []struct {
+		name             string
+		code             string
+		expectedRecovery bool
+		expectedErr      error
+	}{
+		{"current code", mustTOTP(t, secret, *now), false, nil},
+		{"same code again", mustTOTP(t, secret, *now), false, ErrInvalidMFACode},
+		{"older code within skew after a newer one", mustTOTP(t, secret, now.Add(-totp.Period)), false, ErrInvalidMFACode},
+		{"next code within skew", mustTOTP(t, secret, now.Add(totp.Period)), false, nil},
+		{"wrong code", "000000", false, ErrInvalidMFACode},
+		{"recovery code", codes[0], true, nil},
+		{"recovery code reused", codes[0], false, ErrInvalidMFACode},
+		{"recovery code in upper case without dash", strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")), true, nil},
+		{"unknown recovery code", "aaaaa-aaaaa", false, ErrInvalidMFACode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recovery, err := s.Verify(1, tt.code)
+			if !errors.Is(err, tt.expectedErr) || recovery != tt.expectedRecovery {
+				t.Errorf("expected (%v, %v), got (%v, %v)", tt.expectedRecovery, tt.expectedErr, recovery, err)
+			}
+		})
+	}
+
+	if _, err := s.Verify(2, "000000"); !errors.Is(err, ErrMFANotEnrolled) {
+		t.Errorf("expected ErrMFANotEnrolled for a user without MFA, got %v", err)
+	}
+}
+
+func TestMFAToken(t *testing.T) {
+	token, err := generateMFAToken(1, "alice@example.com", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _ := generateMFAToken(1, "alice@example.com", -time.Minute)
+	access, _ := generateToken(context.Background(), 1, "alice@example.com", time.Minute)
+
+	tests := []struct {
+		name     string
+		token    string
+		expected bool
+	}{
+		{"challenge token", token, true},
+		{"expired", expired, false},
+		{"access token", access, false},
+		{"garbage", "not-a-token", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := parseMFAToken(tt.token)
+			if (err == nil) != tt.expected {
+				t.Fatalf("expected valid=%v, got %v", tt.expected, err)
+			}
+			if err == nil && (claims.UserID != 1 || claims.Email != "alice@example.com") {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+		})
+	}
+
+	// MFAチャレンジのトークンはアクセストークンとして使えない
+	if _, err := middleware.ParseToken(token); err == nil {
+		t.Error("expected the challenge token to be rejected as an access token")
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"k6-practice/api/openapi"
+)
+
+// OpenAPIHandler はOpenAPIドキュメントを配信する
+type OpenAPIHandler struct {
+	body []byte
+	etag string
+}
+
+// NewOpenAPIHandler はドキュメントを一度だけシリアライズしてハンドラーを作成
+func NewOpenAPIHandler(doc *openapi.Document) *OpenAPIHandler {
+	body, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		panic("handlers: failed to marshal OpenAPI document: " + err.Error())
+	}
+	sum := sha256.Sum256(body)
+	return &OpenAPIHandler{body: body, etag: `W/"` + hex.EncodeToString(sum[:8]) + `"`}
+}
+
+func (h *OpenAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// ドキュメントは起動中に変わらないため内容のハッシュで再検証させる
+	if notModified(w, r, h.etag, time.Time{}) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(h.body)
+}
@@ -1,14 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
-)
+	"strconv"
+	"time"
 
-// ErrorResponse はエラーレスポンスの構造体
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+	"k6-practice/api/problem"
+)
 
 // writeJSON はJSONレスポンスを送信する
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -17,12 +20,39 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-// writeError はエラーレスポンスを送信する
-func writeError(w http.ResponseWriter, status int, message string) {
-	writeJSON(w, status, ErrorResponse{Error: message})
+// writeError はRFC 7807形式のエラーレスポンスを送信する
+func writeError(w http.ResponseWriter, r *http.Request, code problem.Code, detail string) {
+	problem.Write(w, r, code, detail)
+}
+
+// writeContextError はリクエストのコンテキストが終了して処理を中断した場合のレスポンス
+// タイムアウトは503、クライアントが切断した場合は誰も受け取らないため何も書かない
+func writeContextError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, r, problem.CodeTimeout, "request timed out")
+	}
+}
+
+// notModified は検証子（ETag・Last-Modified）を設定し、条件付きGETが一致すれば304を返す
+// ETagは圧縮の有無でバイト列が変わるため弱い検証子にする
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if !middleware.NotModified(r, etag, modified) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// userETag はユーザー1件の検証子（更新日時が変わると変わる）
+func userETag(u *models.User) string {
+	return `W/"user-` + strconv.Itoa(u.ID) + "-" + strconv.FormatInt(u.UpdatedAt.UnixNano(), 36) + `"`
 }
 
-// methodNotAllowed は405エラーを返す
-func methodNotAllowed(w http.ResponseWriter) {
-	http.Error(w, `{"error": "method not allowed"}`, http.StatusMethodNotAllowed)
+// usersETag は一覧の検証子（ストアの版数。作成・更新・削除のたびに変わる）
+func usersETag(version uint64) string {
+	return `W/"users-` + strconv.FormatUint(version, 10) + `"`
 }
@@ -4,10 +4,10 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"k6-practice/api/middleware"
 	"k6-practice/api/models"
+	"k6-practice/api/problem"
 )
 
 type UsersHandler struct {
@@ -19,73 +19,64 @@ func NewUsersHandler(store *models.UserStore) *UsersHandler {
 }
 
 type CreateUserRequest struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	Name  string `json:"name" openapi:"required,minLength=1,maxLength=100"`
+	Email string `json:"email" openapi:"required,format=email,maxLength=254"`
 }
 
-func (h *UsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	path := strings.TrimPrefix(r.URL.Path, "/users")
-	path = strings.TrimPrefix(path, "/")
-
-	if path == "" {
-		switch r.Method {
-		case http.MethodGet:
-			h.list(w, r)
-		case http.MethodPost:
-			h.create(w, r)
-		default:
-			methodNotAllowed(w)
-		}
-		return
-	}
-
-	id, err := strconv.Atoi(path)
+// List は GET /users
+func (h *UsersHandler) List(w http.ResponseWriter, r *http.Request) {
+	users, version, modified, err := h.store.SnapshotContext(r.Context())
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid user id")
+		writeContextError(w, r, err)
 		return
 	}
-
-	switch r.Method {
-	case http.MethodGet:
-		h.get(w, r, id)
-	case http.MethodPut:
-		h.update(w, r, id)
-	case http.MethodDelete:
-		h.delete(w, r, id)
-	default:
-		methodNotAllowed(w)
+	if notModified(w, r, usersETag(version), modified) {
+		return
 	}
+	writeJSON(w, http.StatusOK, users)
 }
 
-func (h *UsersHandler) list(w http.ResponseWriter, r *http.Request) {
-	users := h.store.List()
-	json.NewEncoder(w).Encode(users)
-}
+// Get は GET /users/{id}
+func (h *UsersHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
 
-func (h *UsersHandler) get(w http.ResponseWriter, r *http.Request, id int) {
-	user := h.store.Get(id)
+	user, err := h.store.GetContext(r.Context(), id)
+	if err != nil {
+		writeContextError(w, r, err)
+		return
+	}
 	if user == nil {
-		writeError(w, http.StatusNotFound, "user not found")
+		writeError(w, r, problem.CodeUserNotFound, "user not found")
+		return
+	}
+	if notModified(w, r, userETag(user), user.UpdatedAt) {
 		return
 	}
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, http.StatusOK, user)
 }
 
-func (h *UsersHandler) create(w http.ResponseWriter, r *http.Request) {
+// Create は POST /users
+func (h *UsersHandler) Create(w http.ResponseWriter, r *http.Request) {
 	req, ok := h.parseAndValidateUserRequest(w, r)
 	if !ok {
 		return
 	}
 
-	user := h.store.Create(req.Name, req.Email)
+	user, err := h.store.CreateContext(r.Context(), req.Name, req.Email)
+	if err != nil {
+		writeContextError(w, r, err)
+		return
+	}
 	writeJSON(w, http.StatusCreated, user)
 }
 
-func (h *UsersHandler) update(w http.ResponseWriter, r *http.Request, id int) {
-	if !middleware.ValidateID(id) {
-		writeError(w, http.StatusBadRequest, "invalid user id")
+// Update は PUT /users/{id}
+func (h *UsersHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok {
 		return
 	}
 
@@ -94,52 +85,82 @@ func (h *UsersHandler) update(w http.ResponseWriter, r *http.Request, id int) {
 		return
 	}
 
-	user := h.store.Update(id, req.Name, req.Email)
+	user, err := h.store.UpdateContext(r.Context(), id, req.Name, req.Email)
+	if err != nil {
+		writeContextError(w, r, err)
+		return
+	}
 	if user == nil {
-		writeError(w, http.StatusNotFound, "user not found")
+		writeError(w, r, problem.CodeUserNotFound, "user not found")
 		return
 	}
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, http.StatusOK, user)
 }
 
-func (h *UsersHandler) delete(w http.ResponseWriter, r *http.Request, id int) {
-	if !h.store.Delete(id) {
-		writeError(w, http.StatusNotFound, "user not found")
+// Delete は DELETE /users/{id}
+func (h *UsersHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.store.DeleteContext(r.Context(), id)
+	if err != nil {
+		writeContextError(w, r, err)
+		return
+	}
+	if !deleted {
+		writeError(w, r, problem.CodeUserNotFound, "user not found")
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// userID はパスパラメータ {id} を正の整数として取り出す
+func userID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || !middleware.ValidateID(id) {
+		writeError(w, r, problem.CodeInvalidParameter, "invalid user id")
+		return 0, false
+	}
+	return id, true
+}
+
 // parseAndValidateUserRequest はリクエストボディをパースしてバリデーションを行う
 func (h *UsersHandler) parseAndValidateUserRequest(w http.ResponseWriter, r *http.Request) (*CreateUserRequest, bool) {
 	var req CreateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		middleware.LogSecurityEvent(middleware.EventInvalidInput, r, "invalid JSON body")
-		writeError(w, http.StatusBadRequest, "invalid request body")
+		writeError(w, r, problem.CodeInvalidBody, "invalid request body")
 		return nil, false
 	}
 
+	// 攻撃の試行を記録する（入力はこの後のサニタイズと検証で処理する）
+	if middleware.IsSuspicious(req.Name, req.Email) {
+		middleware.LogSecurityEvent(middleware.EventSuspiciousInput, r, "possible injection in user fields")
+	}
+
 	// 入力のサニタイズ
 	req.Name = middleware.SanitizeString(req.Name)
 	req.Email = middleware.SanitizeString(req.Email)
 
 	// 必須チェック
 	if req.Name == "" || req.Email == "" {
-		writeError(w, http.StatusBadRequest, "name and email are required")
+		writeError(w, r, problem.CodeInvalidBody, "name and email are required")
 		return nil, false
 	}
 
 	// Name検証
 	if !middleware.ValidateName(req.Name) {
 		middleware.LogSecurityEvent(middleware.EventInvalidInput, r, "invalid name format")
-		writeError(w, http.StatusBadRequest, "invalid name format")
+		writeError(w, r, problem.CodeInvalidBody, "invalid name format")
 		return nil, false
 	}
 
 	// Email検証
 	if !middleware.ValidateEmail(req.Email) {
 		middleware.LogSecurityEvent(middleware.EventInvalidInput, r, "invalid email format")
-		writeError(w, http.StatusBadRequest, "invalid email format")
+		writeError(w, r, problem.CodeInvalidBody, "invalid email format")
 		return nil, false
 	}
 
@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"k6-practice/api/models"
 )
@@ -22,7 +24,7 @@ func TestUsersHandler_List(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/users", nil)
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		handler.List(rec, req)
 
 		if rec.Code != http.StatusOK {
 			t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
@@ -47,7 +49,8 @@ func TestUsersHandler_Get(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		req.SetPathValue("id", "1")
+		handler.Get(rec, req)
 
 		if rec.Code != http.StatusOK {
 			t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
@@ -67,7 +70,8 @@ func TestUsersHandler_Get(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/users/999", nil)
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		req.SetPathValue("id", "999")
+		handler.Get(rec, req)
 
 		if rec.Code != http.StatusNotFound {
 			t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
@@ -78,7 +82,8 @@ func TestUsersHandler_Get(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/users/invalid", nil)
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		req.SetPathValue("id", "invalid")
+		handler.Get(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
 			t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
@@ -99,7 +104,7 @@ func TestUsersHandler_Create(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		handler.Create(rec, req)
 
 		if rec.Code != http.StatusCreated {
 			t.Errorf("expected status %d, got %d", http.StatusCreated, rec.Code)
@@ -130,7 +135,7 @@ func TestUsersHandler_Create(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		handler.Create(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
 			t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
@@ -144,7 +149,7 @@ func TestUsersHandler_Create(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		handler.Create(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
 			t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
@@ -163,7 +168,7 @@ func TestUsersHandler_Create(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		handler.Create(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
 			t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
@@ -184,7 +189,8 @@ func TestUsersHandler_Update(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		req.SetPathValue("id", "1")
+		handler.Update(rec, req)
 
 		if rec.Code != http.StatusOK {
 			t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
@@ -212,7 +218,8 @@ func TestUsersHandler_Update(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		req.SetPathValue("id", "999")
+		handler.Update(rec, req)
 
 		if rec.Code != http.StatusNotFound {
 			t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
@@ -227,7 +234,8 @@ func TestUsersHandler_Delete(t *testing.T) {
 		req := httptest.NewRequest(http.MethodDelete, "/users/1", nil)
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		req.SetPathValue("id", "1")
+		handler.Delete(rec, req)
 
 		if rec.Code != http.StatusNoContent {
 			t.Errorf("expected status %d, got %d", http.StatusNoContent, rec.Code)
@@ -236,7 +244,8 @@ func TestUsersHandler_Delete(t *testing.T) {
 		// 削除後に取得できないことを確認
 		req = httptest.NewRequest(http.MethodGet, "/users/1", nil)
 		rec = httptest.NewRecorder()
-		handler.ServeHTTP(rec, req)
+		req.SetPathValue("id", "1")
+		handler.Get(rec, req)
 
 		if rec.Code != http.StatusNotFound {
 			t.Errorf("expected status %d after delete, got %d", http.StatusNotFound, rec.Code)
@@ -249,7 +258,8 @@ func TestUsersHandler_Delete(t *testing.T) {
 		req := httptest.NewRequest(http.MethodDelete, "/users/999", nil)
 		rec := httptest.NewRecorder()
 
-		handler.ServeHTTP(rec, req)
+		req.SetPathValue("id", "999")
+		handler.Delete(rec, req)
 
 		if rec.Code != http.StatusNotFound {
 			t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
@@ -257,28 +267,105 @@ func TestUsersHandler_Delete(t *testing.T) {
 	})
 }
 
-func TestUsersHandler_MethodNotAllowed(t *testing.T) {
-	handler := setupUsersHandler()
-
-	t.Run("PATCH /users returns method not allowed", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodPatch, "/users", nil)
-		rec := httptest.NewRecorder()
-
-		handler.ServeHTTP(rec, req)
+func TestUsersHandler_ConditionalGet(t *testing.T) {
+	store := models.NewUserStore()
+	handler := NewUsersHandler(store)
 
-		if rec.Code != http.StatusMethodNotAllowed {
-			t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	get := func(fn http.HandlerFunc, id string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		if id != "" {
+			req.SetPathValue("id", id)
+		}
+		for k, v := range header {
+			req.Header[k] = v
 		}
-	})
-
-	t.Run("PATCH /users/1 returns method not allowed", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodPatch, "/users/1", nil)
 		rec := httptest.NewRecorder()
+		fn(rec, req)
+		return rec
+	}
+
+	first := get(handler.Get, "1", nil)
+	firstList := get(handler.List, "", nil)
+	etag, lastModified, listETag := first.Header().Get("ETag"), first.Header().Get("Last-Modified"), firstList.Header().Get("ETag")
+	if etag == "" || lastModified == "" || listETag == "" {
+		t.Fatalf("expected validators, got %v / %v", first.Header(), firstList.Header())
+	}
+
+	tests := []struct {
+		name           string
+		fn             http.HandlerFunc
+		id             string
+		header         http.Header
+		expectedStatus int
+	}{
+		{"matching etag", handler.Get, "1", http.Header{"If-None-Match": {etag}}, http.StatusNotModified},
+		{"etag in list", handler.Get, "1", http.Header{"If-None-Match": {`W/"other", ` + etag}}, http.StatusNotModified},
+		{"other etag", handler.Get, "1", http.Header{"If-None-Match": {`W/"other"`}}, http.StatusOK},
+		{"etag of another user", handler.Get, "2", http.Header{"If-None-Match": {etag}}, http.StatusOK},
+		{"not modified since", handler.Get, "1", http.Header{"If-Modified-Since": {lastModified}}, http.StatusNotModified},
+		{"if-none-match takes precedence", handler.Get, "1", http.Header{"If-None-Match": {`W/"other"`}, "If-Modified-Since": {lastModified}}, http.StatusOK},
+		{"matching list etag", handler.List, "", http.Header{"If-None-Match": {listETag}}, http.StatusNotModified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(tt.fn, tt.id, tt.header)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("expected empty body for 304, got %q", rec.Body.String())
+			}
+		})
+	}
+
+	// 変更後は検証子が変わる
+	store.Update(1, "Alice Updated", "alice@example.com")
+	if rec := get(handler.Get, "1", http.Header{"If-None-Match": {etag}}); rec.Code != http.StatusOK {
+		t.Errorf("expected status %d after update, got %d", http.StatusOK, rec.Code)
+	}
+	store.Delete(3)
+	if rec := get(handler.List, "", http.Header{"If-None-Match": {listETag}}); rec.Code != http.StatusOK {
+		t.Errorf("expected list status %d after delete, got %d", http.StatusOK, rec.Code)
+	}
+}
 
-		handler.ServeHTTP(rec, req)
-
-		if rec.Code != http.StatusMethodNotAllowed {
-			t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
-		}
-	})
+func TestUsersHandler_ContextDone(t *testing.T) {
+	store := models.NewUserStore()
+	handler := NewUsersHandler(store)
+
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		fn             http.HandlerFunc
+		expectedStatus int
+	}{
+		{"list", http.MethodGet, "", handler.List, http.StatusServiceUnavailable},
+		{"get", http.MethodGet, "", handler.Get, http.StatusServiceUnavailable},
+		{"update", http.MethodPut, `{"name":"Changed","email":"changed@example.com"}`, handler.Update, http.StatusServiceUnavailable},
+		{"delete", http.MethodDelete, "", handler.Delete, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+			defer cancel()
+			req := httptest.NewRequest(tt.method, "/users/1", bytes.NewBufferString(tt.body)).WithContext(ctx)
+			req.SetPathValue("id", "1")
+			rec := httptest.NewRecorder()
+
+			tt.fn(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+
+	// 期限切れのリクエストではストアを変更しない
+	if u := store.Get(1); u == nil || u.Name != "Alice" {
+		t.Errorf("expected user 1 to be unchanged, got %+v", u)
+	}
 }
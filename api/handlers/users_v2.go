@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+	"k6-practice/api/problem"
+)
+
+// UsersV2Handler は /v2/users の表現を返すハンドラー
+// ストアはv1と共有し、名前を姓・名に分割、リンクを付与、日時をUTCのRFC 3339で返す
+type UsersV2Handler struct {
+	store *models.UserStore
+}
+
+func NewUsersV2Handler(store *models.UserStore) *UsersV2Handler {
+	return &UsersV2Handler{store: store}
+}
+
+// UserV2 はv2のユーザー表現
+type UserV2 struct {
+	ID        int         `json:"id" openapi:"required"`
+	FirstName string      `json:"first_name" openapi:"required"`
+	LastName  string      `json:"last_name" openapi:"required"`
+	Email     string      `json:"email" openapi:"required"`
+	CreatedAt string      `json:"created_at" openapi:"required,format=date-time"`
+	UpdatedAt string      `json:"updated_at" openapi:"required,format=date-time"`
+	Links     UserV2Links `json:"links" openapi:"required"`
+}
+
+type UserV2Links struct {
+	Self       string `json:"self" openapi:"required"`
+	Collection string `json:"collection" openapi:"required"`
+}
+
+// UserV2List はv2のユーザー一覧（配列ではなくオブジェクトで包む）
+type UserV2List struct {
+	Data  []UserV2 `json:"data" openapi:"required"`
+	Count int      `json:"count" openapi:"required"`
+}
+
+type CreateUserV2Request struct {
+	FirstName string `json:"first_name" openapi:"required,minLength=1,maxLength=50"`
+	LastName  string `json:"last_name" openapi:"maxLength=49"`
+	Email     string `json:"email" openapi:"required,format=email,maxLength=254"`
+}
+
+const v2UsersPath = "/v2/users"
+
+// toUserV2 はストアのユーザーをv2表現に変換
+func toUserV2(u *models.User) UserV2 {
+	first, last, _ := strings.Cut(u.Name, " ")
+	self := v2UsersPath + "/" + strconv.Itoa(u.ID)
+	return UserV2{
+		ID:        u.ID,
+		FirstName: first,
+		LastName:  last,
+		Email:     u.Email,
+		CreatedAt: u.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt: u.UpdatedAt.UTC().Format(time.RFC3339),
+		Links:     UserV2Links{Self: self, Collection: v2UsersPath},
+	}
+}
+
+// List は GET /v2/users
+func (h *UsersV2Handler) List(w http.ResponseWriter, r *http.Request) {
+	users, version, modified, err := h.store.SnapshotContext(r.Context())
+	if err != nil {
+		writeContextError(w, r, err)
+		return
+	}
+	if notModified(w, r, usersETag(version), modified) {
+		return
+	}
+	resp := UserV2List{Data: make([]UserV2, 0, len(users)), Count: len(users)}
+	for _, u := range users {
+		resp.Data = append(resp.Data, toUserV2(u))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Get は GET /v2/users/{id}
+func (h *UsersV2Handler) Get(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.store.GetContext(r.Context(), id)
+	if err != nil {
+		writeContextError(w, r, err)
+		return
+	}
+	if user == nil {
+		writeError(w, r, problem.CodeUserNotFound, "user not found")
+		return
+	}
+	if notModified(w, r, userETag(user), user.UpdatedAt) {
+		return
+	}
+	writeJSON(w, http.StatusOK, toUserV2(user))
+}
+
+// Create は POST /v2/users
+func (h *UsersV2Handler) Create(w http.ResponseWriter, r *http.Request) {
+	name, email, ok := h.parseAndValidate(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.store.CreateContext(r.Context(), name, email)
+	if err != nil {
+		writeContextError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", v2UsersPath+"/"+strconv.Itoa(user.ID))
+	writeJSON(w, http.StatusCreated, toUserV2(user))
+}
+
+// Update は PUT /v2/users/{id}
+func (h *UsersV2Handler) Update(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
+
+	name, email, ok := h.parseAndValidate(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.store.UpdateContext(r.Context(), id, name, email)
+	if err != nil {
+		writeContextError(w, r, err)
+		return
+	}
+	if user == nil {
+		writeError(w, r, problem.CodeUserNotFound, "user not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, toUserV2(user))
+}
+
+// Delete は DELETE /v2/users/{id}
+func (h *UsersV2Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.store.DeleteContext(r.Context(), id)
+	if err != nil {
+		writeContextError(w, r, err)
+		return
+	}
+	if !deleted {
+		writeError(w, r, problem.CodeUserNotFound, "user not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseAndValidate はv2のリクエストをパースし、ストアに保存する名前とメールを返す
+func (h *UsersV2Handler) parseAndValidate(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	var req CreateUserV2Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.LogSecurityEvent(middleware.EventInvalidInput, r, "invalid JSON body")
+		writeError(w, r, problem.CodeInvalidBody, "invalid request body")
+		return "", "", false
+	}
+
+	// 攻撃の試行を記録する（入力はこの後のサニタイズと検証で処理する）
+	if middleware.IsSuspicious(req.FirstName, req.LastName, req.Email) {
+		middleware.LogSecurityEvent(middleware.EventSuspiciousInput, r, "possible injection in user fields")
+	}
+
+	// 入力のサニタイズ
+	first := middleware.SanitizeString(req.FirstName)
+	last := middleware.SanitizeString(req.LastName)
+	email := middleware.SanitizeString(req.Email)
+
+	// 名にスペースを含むと姓・名の分割が往復しないため拒否する
+	if first == "" || email == "" || strings.Contains(first, " ") {
+		writeError(w, r, problem.CodeInvalidBody, "first_name (without spaces) and email are required")
+		return "", "", false
+	}
+
+	name := strings.TrimSpace(first + " " + last)
+	if !middleware.ValidateName(name) {
+		middleware.LogSecurityEvent(middleware.EventInvalidInput, r, "invalid name format")
+		writeError(w, r, problem.CodeInvalidBody, "invalid name format")
+		return "", "", false
+	}
+
+	if !middleware.ValidateEmail(email) {
+		middleware.LogSecurityEvent(middleware.EventInvalidInput, r, "invalid email format")
+		writeError(w, r, problem.CodeInvalidBody, "invalid email format")
+		return "", "", false
+	}
+
+	return name, email, true
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k6-practice/api/models"
+)
+
+func setupUsersV2Handler() (*UsersV2Handler, *models.UserStore) {
+	store := models.NewUserStore()
+	return NewUsersV2Handler(store), store
+}
+
+func TestUsersV2Handler_Get(t *testing.T) {
+	handler, store := setupUsersV2Handler()
+	store.Update(1, "Alice Liddell", "alice@example.com")
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/users/1", nil)
+	req.SetPathValue("id", "1")
+	rec := httptest.NewRecorder()
+
+	handler.Get(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var user UserV2
+	if err := json.NewDecoder(rec.Body).Decode(&user); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if user.FirstName != "Alice" || user.LastName != "Liddell" {
+		t.Errorf("expected Alice / Liddell, got %q / %q", user.FirstName, user.LastName)
+	}
+	if user.Links.Self != "/v2/users/1" || user.Links.Collection != "/v2/users" {
+		t.Errorf("unexpected links: %+v", user.Links)
+	}
+	if _, err := time.Parse(time.RFC3339, user.CreatedAt); err != nil {
+		t.Errorf("expected RFC 3339 created_at, got %q", user.CreatedAt)
+	}
+}
+
+func TestUsersV2Handler_Create(t *testing.T) {
+	t.Run("POST /v2/users stores joined name", func(t *testing.T) {
+		handler, store := setupUsersV2Handler()
+
+		body, _ := json.Marshal(CreateUserV2Request{FirstName: "Test", LastName: "User", Email: "test@example.com"})
+		req := httptest.NewRequest(http.MethodPost, "/v2/users", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		handler.Create(rec, req)
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, rec.Code)
+		}
+		if loc := rec.Header().Get("Location"); loc != "/v2/users/4" {
+			t.Errorf("expected Location /v2/users/4, got %q", loc)
+		}
+		if got := store.Get(4); got == nil || got.Name != "Test User" {
+			t.Errorf("expected stored name 'Test User', got %+v", got)
+		}
+	})
+
+	t.Run("POST /v2/users with space in first_name returns bad request", func(t *testing.T) {
+		handler, _ := setupUsersV2Handler()
+
+		body, _ := json.Marshal(CreateUserV2Request{FirstName: "Mary Ann", LastName: "Smith", Email: "mary@example.com"})
+		req := httptest.NewRequest(http.MethodPost, "/v2/users", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		handler.Create(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+		}
+	})
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"encoding/json"
+	"expvar"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"k6-practice/api/metrics"
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+	"k6-practice/api/problem"
+	"k6-practice/api/requestid"
+)
+
+// 生成メッセージの上限（OpenAPIのパラメーター定義と共有）
+const (
+	MaxGeneratorRate = 1000    // 1秒あたりのメッセージ数
+	MaxGeneratorSize = 1 << 20 // 1メッセージのペイロード（バイト）
+)
+
+// defaultGeneratorSize はsize未指定時のペイロード
+const defaultGeneratorSize = 128
+
+// eventBuffer は購読者ごとにためておける変更通知の数
+const eventBuffer = 64
+
+// PingInterval・WriteTimeout が0以下の場合の値（config の既定値と同じ）
+const (
+	defaultPingInterval = 30 * time.Second
+	defaultWriteTimeout = 10 * time.Second
+)
+
+// WebSocketConfig はWebSocketハンドラーの設定
+type WebSocketConfig struct {
+	// PingInterval: サーバーから送るPingの間隔（Pongが2間隔分届かなければ切断、0以下は defaultPingInterval）
+	PingInterval time.Duration
+	// ReadLimit: クライアントから受け付けるメッセージの最大サイズ
+	ReadLimit int64
+	// WriteTimeout: 1メッセージの送信タイムアウト（0以下は defaultWriteTimeout）
+	WriteTimeout time.Duration
+	// AllowedOrigins: ブラウザからの接続を許可するOrigin（Originなしは許可）
+	// A01:2021 - Cross-Site WebSocket Hijacking 対策
+	AllowedOrigins []string
+}
+
+// WebSocketHandler は /ws 以下の長時間接続のハンドラー
+type WebSocketHandler struct {
+	store    *models.UserStore
+	cfg      WebSocketConfig
+	upgrader websocket.Upgrader
+}
+
+func NewWebSocketHandler(store *models.UserStore, cfg WebSocketConfig) *WebSocketHandler {
+	// time.NewTicker は0以下の間隔でpanicし、0のPong待ちは読み込みをすぐにタイムアウトさせる
+	if cfg.PingInterval <= 0 {
+		cfg.PingInterval = defaultPingInterval
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = defaultWriteTimeout
+	}
+	h := &WebSocketHandler{store: store, cfg: cfg}
+	h.upgrader = websocket.Upgrader{
+		CheckOrigin: h.checkOrigin,
+		Error:       upgradeError,
+	}
+	return h
+}
+
+// WebSocketの統計（エンドポイント名ごと。接続ごとの値は切断時にログに出す）
+var (
+	wsActive      = new(expvar.Map).Init()
+	wsConnections = new(expvar.Map).Init()
+	wsMessagesIn  = new(expvar.Map).Init()
+	wsMessagesOut = new(expvar.Map).Init()
+	wsBytesIn     = new(expvar.Map).Init()
+	wsBytesOut    = new(expvar.Map).Init()
+)
+
+func init() {
+	m := new(expvar.Map).Init()
+	m.Set("connections_active", wsActive)
+	m.Set("connections_total", wsConnections)
+	m.Set("messages_in", wsMessagesIn)
+	m.Set("messages_out", wsMessagesOut)
+	m.Set("bytes_in", wsBytesIn)
+	m.Set("bytes_out", wsBytesOut)
+	metrics.Set("websocket", m)
+}
+
+// GeneratedMessage は /ws/echo でサーバーが生成するメッセージ
+// SentAtで片方向の遅延を計測できる
+type GeneratedMessage struct {
+	Seq     int64     `json:"seq"`
+	SentAt  time.Time `json:"sent_at"`
+	Payload string    `json:"payload"`
+}
+
+// Echo は GET /ws/echo
+// 受信したメッセージをそのまま返す。rate（件/秒）を指定するとsizeバイトのメッセージも送り続ける
+func (h *WebSocketHandler) Echo(w http.ResponseWriter, r *http.Request) {
+	rate, ok := queryInt(w, r, "rate", 0, 0, MaxGeneratorRate)
+	if !ok {
+		return
+	}
+	size, ok := queryInt(w, r, "size", defaultGeneratorSize, 0, MaxGeneratorSize)
+	if !ok {
+		return
+	}
+
+	s := h.open(w, r, "echo")
+	if s == nil {
+		return
+	}
+	defer s.close()
+
+	var generate <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+		generate = ticker.C
+	}
+	payload := strings.Repeat("x", size)
+	var seq int64
+
+	go s.readLoop(true)
+	s.writeLoop(func() (int, []byte, bool) {
+		select {
+		case msg := <-s.echo:
+			return msg.messageType, msg.data, true
+		case <-generate:
+			seq++
+			data, _ := json.Marshal(GeneratedMessage{Seq: seq, SentAt: time.Now(), Payload: payload})
+			return websocket.TextMessage, data, true
+		case <-s.ping.C:
+			return websocket.PingMessage, nil, true
+		case <-s.done:
+			return 0, nil, false
+		}
+	})
+}
+
+// Users は GET /ws/users（middleware.Auth の後段で呼ばれる）
+// UserStoreの変更（作成・更新・削除）をJSONで送る。読み取りが追いつかない接続は1013で切断する
+func (h *WebSocketHandler) Users(w http.ResponseWriter, r *http.Request) {
+	// アップグレード完了前に購読し、接続直後の変更も取りこぼさない
+	events, cancel := h.store.Subscribe(eventBuffer)
+	defer cancel()
+
+	s := h.open(w, r, "users")
+	if s == nil {
+		return
+	}
+	defer s.close()
+
+	go s.readLoop(false)
+	s.writeLoop(func() (int, []byte, bool) {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				s.closeWith(websocket.CloseTryAgainLater, "consumer too slow")
+				return 0, nil, false
+			}
+			data, _ := json.Marshal(ev)
+			return websocket.TextMessage, data, true
+		case <-s.ping.C:
+			return websocket.PingMessage, nil, true
+		case <-s.done:
+			return 0, nil, false
+		}
+	})
+}
+
+// open はコネクションをアップグレードしてセッションを開始する
+// 失敗時はUpgraderがエラーレスポンスを返しているのでnilを返す
+func (h *WebSocketHandler) open(w http.ResponseWriter, r *http.Request, endpoint string) *wsSession {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil
+	}
+
+	s := &wsSession{
+		conn:      conn,
+		cfg:       h.cfg,
+		endpoint:  endpoint,
+		requestID: requestid.FromContext(r.Context()),
+		start:     time.Now(),
+		echo:      make(chan wsMessage, 16),
+		done:      make(chan struct{}),
+		closed:    make(chan struct{}),
+		ping:      time.NewTicker(h.cfg.PingInterval),
+	}
+	wsActive.Add(endpoint, 1)
+	wsConnections.Add(endpoint, 1)
+	return s
+}
+
+func (h *WebSocketHandler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range h.cfg.AllowedOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	middleware.LogSecurityEvent(middleware.EventCSRFBlocked, r, "websocket origin not allowed: "+origin)
+	return false
+}
+
+// upgradeError はアップグレード失敗をProblem形式で返す
+func upgradeError(w http.ResponseWriter, r *http.Request, status int, reason error) {
+	code := problem.CodeBadRequest
+	if status == http.StatusForbidden {
+		code = problem.CodeCSRFFailed
+	}
+	writeError(w, r, code, reason.Error())
+}
+
+// queryInt は整数のクエリパラメーターを読む（未指定はdef）
+func queryInt(w http.ResponseWriter, r *http.Request, name string, def, min, max int) (int, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || n > max {
+		writeError(w, r, problem.CodeInvalidParameter, name+" must be between "+strconv.Itoa(min)+" and "+strconv.Itoa(max))
+		return 0, false
+	}
+	return n, true
+}
+
+type wsMessage struct {
+	messageType int
+	data        []byte
+}
+
+// wsSession は1つのWebSocket接続
+// 送信はwriteLoop（ハンドラーのgoroutine）、受信はreadLoopだけが行う
+type wsSession struct {
+	conn      *websocket.Conn
+	cfg       WebSocketConfig
+	endpoint  string
+	requestID string
+	start     time.Time
+
+	echo   chan wsMessage // readLoop → writeLoop
+	done   chan struct{}  // readLoopの終了（切断）
+	closed chan struct{}  // writeLoopの終了
+	ping   *time.Ticker
+
+	// 接続ごとの統計（readLoopとwriteLoopから更新する）
+	messagesIn, messagesOut atomic.Int64
+	bytesIn, bytesOut       atomic.Int64
+}
+
+// readLoop はPong待ちのタイムアウトを管理しながら受信する
+func (s *wsSession) readLoop(echo bool) {
+	defer close(s.done)
+
+	pongWait := 2 * s.cfg.PingInterval
+	s.conn.SetReadLimit(s.cfg.ReadLimit)
+	s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		messageType, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.conn.SetReadDeadline(time.Now().Add(pongWait))
+		s.messagesIn.Add(1)
+		s.bytesIn.Add(int64(len(data)))
+		wsMessagesIn.Add(s.endpoint, 1)
+		wsBytesIn.Add(s.endpoint, int64(len(data)))
+
+		if !echo {
+			continue
+		}
+		select {
+		case s.echo <- wsMessage{messageType, data}:
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// writeLoop はnextが返すメッセージを送信する。nextがfalseを返すか送信に失敗すると終了する
+func (s *wsSession) writeLoop(next func() (int, []byte, bool)) {
+	defer close(s.closed)
+
+	for {
+		messageType, data, ok := next()
+		if !ok {
+			return
+		}
+
+		deadline := time.Now().Add(s.cfg.WriteTimeout)
+		if messageType == websocket.PingMessage {
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+			continue
+		}
+
+		s.conn.SetWriteDeadline(deadline)
+		if err := s.conn.WriteMessage(messageType, data); err != nil {
+			return
+		}
+		s.messagesOut.Add(1)
+		s.bytesOut.Add(int64(len(data)))
+		wsMessagesOut.Add(s.endpoint, 1)
+		wsBytesOut.Add(s.endpoint, int64(len(data)))
+	}
+}
+
+// closeWith はクローズフレームを送る
+func (s *wsSession) closeWith(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(s.cfg.WriteTimeout))
+}
+
+// close は接続を閉じて接続ごとの統計をログに出す
+func (s *wsSession) close() {
+	s.ping.Stop()
+	s.conn.Close()
+	wsActive.Add(s.endpoint, -1)
+
+	log.Printf("[WS] endpoint=%s request_id=%s duration=%s messages_in=%d messages_out=%d bytes_in=%d bytes_out=%d",
+		s.endpoint, s.requestID, time.Since(s.start),
+		s.messagesIn.Load(), s.messagesOut.Load(), s.bytesIn.Load(), s.bytesOut.Load())
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"k6-practice/api/models"
+)
+
+var testWebSocketConfig = WebSocketConfig{
+	PingInterval:   time.Minute,
+	ReadLimit:      1024,
+	WriteTimeout:   time.Second,
+	AllowedOrigins: []string{"http://localhost:3000"},
+}
+
+func setupWebSocketServer(t *testing.T, cfg WebSocketConfig) (*models.UserStore, string) {
+	t.Helper()
+	store := models.NewUserStore()
+	handler := NewWebSocketHandler(store, cfg)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ws/echo", handler.Echo)
+	mux.HandleFunc("GET /ws/users", handler.Users)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	return store, "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+func dial(t *testing.T, url string, header http.Header) *websocket.Conn {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("dial %s failed (status %d): %v", url, status, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestWebSocketHandler_Echo(t *testing.T) {
+	_, url := setupWebSocketServer(t, testWebSocketConfig)
+
+	t.Run("echoes messages", func(t *testing.T) {
+		conn := dial(t, url+"/ws/echo", nil)
+
+		for _, msg := range []string{"hello", "k6"} {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			if string(data) != msg {
+				t.Errorf("expected %q, got %q", msg, data)
+			}
+		}
+	})
+
+	t.Run("generates messages at rate and size", func(t *testing.T) {
+		conn := dial(t, url+"/ws/echo?rate=100&size=32", nil)
+
+		for i := int64(1); i <= 3; i++ {
+			var msg GeneratedMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			if msg.Seq != i || len(msg.Payload) != 32 {
+				t.Errorf("unexpected message seq=%d payload=%d bytes", msg.Seq, len(msg.Payload))
+			}
+		}
+	})
+
+	t.Run("message over read limit closes connection", func(t *testing.T) {
+		conn := dial(t, url+"/ws/echo", nil)
+
+		conn.WriteMessage(websocket.TextMessage, make([]byte, 2048))
+		_, _, err := conn.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+			t.Errorf("expected close %d, got %v", websocket.CloseMessageTooBig, err)
+		}
+	})
+
+	t.Run("invalid rate returns bad request", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(url+"/ws/echo?rate=100000", nil)
+		if err == nil {
+			t.Fatal("expected dial to fail")
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+		}
+	})
+
+	t.Run("disallowed origin returns forbidden", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(url+"/ws/echo", http.Header{"Origin": {"http://evil.com"}})
+		if err == nil {
+			t.Fatal("expected dial to fail")
+		}
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("expected status %d, got %d", http.StatusForbidden, resp.StatusCode)
+		}
+	})
+
+	t.Run("plain GET returns bad request", func(t *testing.T) {
+		resp, err := http.Get("http" + strings.TrimPrefix(url, "ws") + "/ws/echo")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+		}
+	})
+}
+
+func TestWebSocketHandler_Ping(t *testing.T) {
+	cfg := testWebSocketConfig
+	cfg.PingInterval = 20 * time.Millisecond
+	_, url := setupWebSocketServer(t, cfg)
+
+	conn := dial(t, url+"/ws/echo", nil)
+	pinged := make(chan struct{}, 1)
+	conn.SetPingHandler(func(string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	go conn.ReadMessage()
+
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Error("expected server ping")
+	}
+}
+
+func TestWebSocketHandler_NonPositiveIntervals(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Second} {
+		cfg := testWebSocketConfig
+		cfg.PingInterval = d
+		cfg.WriteTimeout = d
+		if h := NewWebSocketHandler(models.NewUserStore(), cfg); h.cfg.PingInterval != defaultPingInterval || h.cfg.WriteTimeout != defaultWriteTimeout {
+			t.Errorf("%s: expected defaults, got ping %s write %s", d, h.cfg.PingInterval, h.cfg.WriteTimeout)
+		}
+
+		// 以前は接続のアップグレード後にpanicしていた
+		_, url := setupWebSocketServer(t, cfg)
+		conn := dial(t, url+"/ws/echo", nil)
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if _, data, err := conn.ReadMessage(); err != nil || string(data) != "hello" {
+			t.Errorf("%s: expected echo, got %q %v", d, data, err)
+		}
+	}
+}
+
+func TestWebSocketHandler_Users(t *testing.T) {
+	store, url := setupWebSocketServer(t, testWebSocketConfig)
+	conn := dial(t, url+"/ws/users", nil)
+
+	user := store.Create("Dave", "dave@example.com")
+	store.Update(user.ID, "David", "dave@example.com")
+	store.Delete(user.ID)
+
+	expected := []models.EventType{models.EventUserCreated, models.EventUserUpdated, models.EventUserDeleted}
+	var lastID uint64
+	for _, eventType := range expected {
+		var ev models.Event
+		if err := conn.ReadJSON(&ev); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if ev.Type != eventType || ev.User.ID != user.ID {
+			t.Errorf("expected %s for user %d, got %s for user %d", eventType, user.ID, ev.Type, ev.User.ID)
+		}
+		if ev.ID <= lastID {
+			t.Errorf("expected increasing event IDs, got %d after %d", ev.ID, lastID)
+		}
+		lastID = ev.ID
+	}
+}
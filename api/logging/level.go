@@ -0,0 +1,30 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// level は現在の出力レベル（アクセスログは info、セキュリティイベントは warn で出力する）
+var level slog.LevelVar
+
+// SetLevel はレベルを debug / info / warn / error の名前で設定する
+func SetLevel(name string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("logging: unknown level %q (use debug, info, warn or error)", name)
+	}
+	level.Set(l)
+	return nil
+}
+
+// Level は現在のレベルの名前
+func Level() string {
+	return strings.ToLower(level.Level().String())
+}
+
+// Enabled は l のログを出力するか
+func Enabled(l slog.Level) bool {
+	return l >= level.Level()
+}
@@ -0,0 +1,39 @@
+package logging
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestSetLevel(t *testing.T) {
+	defer SetLevel("info")
+
+	tests := []struct {
+		name        string
+		level       string
+		expected    string
+		expectedErr bool
+		infoEnabled bool
+		warnEnabled bool
+	}{
+		{"debug", "debug", "debug", false, true, true},
+		{"warn hides access logs", "warn", "warn", false, false, true},
+		{"case insensitive", "ERROR", "error", false, false, false},
+		{"unknown level keeps the current one", "verbose", "error", true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SetLevel(tt.level)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error %v, got %v", tt.expectedErr, err)
+			}
+			if Level() != tt.expected {
+				t.Errorf("expected level %q, got %q", tt.expected, Level())
+			}
+			if Enabled(slog.LevelInfo) != tt.infoEnabled || Enabled(slog.LevelWarn) != tt.warnEnabled {
+				t.Errorf("unexpected enabled levels for %q", Level())
+			}
+		})
+	}
+}
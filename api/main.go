@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"k6-practice/api/config"
+	"k6-practice/api/logging"
 	"k6-practice/api/server"
+	"k6-practice/api/tracing"
 )
 
 func main() {
@@ -16,9 +20,33 @@ func main() {
 		log.Println("[WARNING] JWT_SECRET is not set. Using default secret. Set JWT_SECRET in production!")
 	}
 
+	// ログの出力レベル（管理用APIで実行中に変更できる）
+	if err := logging.SetLevel(cfg.LogLevel); err != nil {
+		log.Fatal(err)
+	}
+
+	// トレース（W3C traceparentの伝播とエクスポーター）
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// サーバー起動
 	srv := server.New(cfg)
-	if err := srv.Run(); err != nil {
+	err = srv.Run()
+
+	// 未送信のスパンを送ってから終了する
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if shutdownErr := shutdownTracing(ctx); shutdownErr != nil {
+		log.Println("failed to flush traces:", shutdownErr)
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// root はこのAPIが公開するメトリクスの名前空間（expvarの "api"）
+var root = expvar.NewMap("api")
+
+var (
+	// requests はルート名ごとのリクエスト数
+	requests = new(expvar.Map).Init()
+	// statuses は「ルート名 ステータスコード」ごとのレスポンス数
+	statuses = new(expvar.Map).Init()
+	// durations はルート名ごとの処理時間の合計（ミリ秒）
+	durations = new(expvar.Map).Init()
+)
+
+func init() {
+	root.Set("requests", requests)
+	root.Set("statuses", statuses)
+	root.Set("duration_ms_total", durations)
+}
+
+// ObserveRequest は1リクエストの結果を記録する
+func ObserveRequest(route string, status int, d time.Duration) {
+	requests.Add(route, 1)
+	statuses.Add(route+" "+strconv.Itoa(status), 1)
+	durations.AddFloat(route, float64(d)/float64(time.Millisecond))
+	recent.add(time.Now(), d)
+}
+
+// Set はルート直下に任意のメトリクスを登録する（例: 各コンポーネントのゲージ）
+func Set(name string, v expvar.Var) {
+	root.Set(name, v)
+}
+
+// Handler は "api" 名前空間のメトリクスをJSONで返す
+// expvar.Handler と異なり cmdline や memstats は含めない
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(root.String()))
+	})
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// recentSize は直近のレイテンシとして保持するリクエスト数
+const recentSize = 4096
+
+var (
+	// inFlight は処理中のリクエスト数（WebSocket・SSEの接続中も含む）
+	inFlight atomic.Int64
+	// recent は直近のリクエストの完了時刻と処理時間
+	recent = &latencyRing{}
+)
+
+func init() {
+	root.Set("in_flight", expvar.Func(func() any { return inFlight.Load() }))
+}
+
+// StartRequest は処理中のリクエスト数を増やし、完了時に呼ぶ関数を返す
+func StartRequest() (done func()) {
+	inFlight.Add(1)
+	return func() { inFlight.Add(-1) }
+}
+
+// InFlight は処理中のリクエスト数
+func InFlight() int64 {
+	return inFlight.Load()
+}
+
+// RecentLatency は直近 window に完了したリクエストの処理時間の分位数と件数
+// 保持数（recentSize）を超えた古いリクエストは含まない
+func RecentLatency(q float64, window time.Duration) (time.Duration, int) {
+	return recent.quantile(q, time.Now().Add(-window))
+}
+
+type latencySample struct {
+	at time.Time
+	d  time.Duration
+}
+
+// latencyRing は処理時間を固定長のリングバッファに記録する
+type latencyRing struct {
+	mu      sync.Mutex
+	samples [recentSize]latencySample
+	next    int
+}
+
+func (l *latencyRing) add(at time.Time, d time.Duration) {
+	l.mu.Lock()
+	l.samples[l.next] = latencySample{at: at, d: d}
+	l.next = (l.next + 1) % recentSize
+	l.mu.Unlock()
+}
+
+func (l *latencyRing) quantile(q float64, since time.Time) (time.Duration, int) {
+	l.mu.Lock()
+	ds := make([]time.Duration, 0, recentSize)
+	for _, s := range l.samples {
+		if !s.at.IsZero() && !s.at.Before(since) {
+			ds = append(ds, s.d)
+		}
+	}
+	l.mu.Unlock()
+
+	if len(ds) == 0 {
+		return 0, 0
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	i := int(q*float64(len(ds)) + 0.5)
+	return ds[min(max(i-1, 0), len(ds)-1)], len(ds)
+}
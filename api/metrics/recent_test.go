@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyRing_Quantile(t *testing.T) {
+	now := time.Now()
+	l := &latencyRing{}
+	for i := 1; i <= 100; i++ {
+		l.add(now, time.Duration(i)*time.Millisecond)
+	}
+	// 集計期間より前のリクエストは含めない
+	l.add(now.Add(-time.Minute), time.Hour)
+
+	tests := []struct {
+		name     string
+		q        float64
+		expected time.Duration
+	}{
+		{"median", 0.5, 50 * time.Millisecond},
+		{"p99", 0.99, 99 * time.Millisecond},
+		{"max", 1, 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, n := l.quantile(tt.q, now.Add(-time.Second))
+			if d != tt.expected || n != 100 {
+				t.Errorf("expected %s over 100 requests, got %s over %d", tt.expected, d, n)
+			}
+		})
+	}
+}
+
+func TestLatencyRing_Wraps(t *testing.T) {
+	now := time.Now()
+	l := &latencyRing{}
+	l.add(now, time.Hour)
+	for i := 0; i < recentSize; i++ {
+		l.add(now, time.Millisecond)
+	}
+
+	if d, n := l.quantile(1, now.Add(-time.Second)); d != time.Millisecond || n != recentSize {
+		t.Errorf("expected the oldest sample to be overwritten, got %s over %d", d, n)
+	}
+}
+
+func TestStartRequest(t *testing.T) {
+	before := InFlight()
+	done := StartRequest()
+	if InFlight() != before+1 {
+		t.Errorf("expected %d in flight, got %d", before+1, InFlight())
+	}
+	done()
+	if InFlight() != before {
+		t.Errorf("expected %d in flight, got %d", before, InFlight())
+	}
+}
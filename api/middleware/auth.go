@@ -2,13 +2,19 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 
 	"k6-practice/api/models"
+	"k6-practice/api/problem"
 )
 
 type contextKey string
@@ -31,40 +37,206 @@ func getJWTSecret() []byte {
 // Claims はmodels.Claimsのエイリアス（後方互換性のため）
 type Claims = models.Claims
 
-func Auth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			LogSecurityEvent(EventUnauthorized, r, "missing authorization header")
-			http.Error(w, `{"error": "missing authorization header"}`, http.StatusUnauthorized)
-			return
-		}
+// 認証方式（Claims.AuthMethod）
+const (
+	AuthMethodJWT        = "jwt"
+	AuthMethodAPIKey     = "api_key"
+	AuthMethodClientCert = "client_cert"
+)
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			LogSecurityEvent(EventUnauthorized, r, "invalid authorization header format")
-			http.Error(w, `{"error": "invalid authorization header format"}`, http.StatusUnauthorized)
-			return
-		}
+// ErrNoCredentials は認証方式の資格情報がリクエストにない（次の認証方式を試す）
+var ErrNoCredentials = errors.New("no credentials")
+
+// ErrInvalidAPIKey は存在しない・失効した・期限切れのAPIキー
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// RateLimitError は資格情報（APIキー）ごとのレート制限を超えた
+type RateLimitError struct {
+	Limit      int
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit of %d exceeded", e.Limit)
+}
+
+// Authenticator はリクエストの資格情報を検証してユーザーを返す認証方式
+// 資格情報がない場合は ErrNoCredentials を返す
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Claims, error)
+}
+
+// AuthenticatorFunc は関数をAuthenticatorとして使う
+type AuthenticatorFunc func(r *http.Request) (*Claims, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Claims, error) {
+	return f(r)
+}
+
+// JWTAuthenticator は Authorization: Bearer のJWTを検証する
+var JWTAuthenticator = AuthenticatorFunc(func(r *http.Request) (*Claims, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	return ParseToken(token)
+})
+
+// Auth はJWTだけを受け付ける認証（NewAuth(JWTAuthenticator)）
+var Auth = NewAuth(JWTAuthenticator)
+
+// OptionalAuth はJWTだけを受け付ける任意の認証（NewOptionalAuth(JWTAuthenticator)）
+var OptionalAuth = NewOptionalAuth(JWTAuthenticator)
 
-		tokenString := parts[1]
-		claims := &Claims{}
+// NewAuth は認証方式を順に試し、最初に資格情報を見つけた方式で認証するミドルウェアを返す
+// 認証に成功したユーザーは GetUserFromContext で認証方式によらず同じ形で取得できる
+func NewAuth(authenticators ...Authenticator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// mTLSのクライアント証明書で認証済み（ClientCert）
+			if GetUserFromContext(r.Context()) != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return JWTSecret, nil
+			claims, err := authenticate(r, authenticators)
+			if err != nil {
+				writeAuthError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
 		})
+	}
+}
+
+// NewOptionalAuth は資格情報がある場合だけNewAuthと同じ検証を行う
+// 一部の操作だけ認証が必要なルート（GraphQLの me など）で使い、資格情報がなければそのまま通す
+func NewOptionalAuth(authenticators ...Authenticator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if GetUserFromContext(r.Context()) != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-		if err != nil || !token.Valid {
-			LogSecurityEvent(EventAuthFailure, r, "invalid token")
-			http.Error(w, `{"error": "invalid token"}`, http.StatusUnauthorized)
-			return
+			claims, err := authenticate(r, authenticators)
+			if errors.Is(err, ErrNoCredentials) && r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				writeAuthError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+		})
+	}
+}
+
+// authResultKey は先に行った認証の結果（レート制限がAPIキーを見分けるために認証した場合）
+const authResultKey contextKey = "authResult"
+
+type authResult struct {
+	claims *Claims
+	err    error
+}
+
+// preauthenticate は認証して結果をコンテキストに残す（資格情報がなければ何も残さない）
+// 後段の NewAuth・NewOptionalAuth は残した結果を使い、署名の検証などを繰り返さない
+func preauthenticate(r *http.Request, authenticators []Authenticator) (*http.Request, *Claims) {
+	if _, ok := r.Context().Value(authResultKey).(*authResult); ok {
+		claims, _ := authenticate(r, authenticators)
+		return r, claims
+	}
+	claims, err := authenticate(r, authenticators)
+	if errors.Is(err, ErrNoCredentials) {
+		return r, nil
+	}
+	return r.WithContext(context.WithValue(r.Context(), authResultKey, &authResult{claims: claims, err: err})), claims
+}
+
+// authenticate は資格情報を見つけた最初の認証方式の結果を返す（どれも見つけなければ ErrNoCredentials）
+// preauthenticate で認証済みのリクエストはその結果を返す
+func authenticate(r *http.Request, authenticators []Authenticator) (*Claims, error) {
+	if res, ok := r.Context().Value(authResultKey).(*authResult); ok {
+		return res.claims, res.err
+	}
+	for _, a := range authenticators {
+		claims, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
 		}
+		return claims, err
+	}
+	return nil, ErrNoCredentials
+}
 
-		ctx := context.WithValue(r.Context(), UserContextKey, claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
+// writeAuthError は認証の失敗をレスポンスに変換する
+func writeAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	var rateErr *RateLimitError
+	switch {
+	case errors.Is(err, ErrNoCredentials) && r.Header.Get("Authorization") == "":
+		LogSecurityEvent(EventUnauthorized, r, "missing authorization header")
+		problem.Write(w, r, problem.CodeUnauthorized, "missing authorization header")
+	case errors.Is(err, ErrNoCredentials):
+		LogSecurityEvent(EventUnauthorized, r, "invalid authorization header format")
+		problem.Write(w, r, problem.CodeUnauthorized, "invalid authorization header format")
+	case errors.As(err, &rateErr):
+		LogSecurityEvent(EventRateLimitHit, r, "api key "+err.Error())
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rateErr.RetryAfter.Seconds()))))
+		problem.Write(w, r, problem.CodeRateLimited, "api key rate limit exceeded")
+	case errors.Is(err, ErrInvalidAPIKey):
+		LogSecurityEvent(EventAuthFailure, r, "invalid api key")
+		problem.Write(w, r, problem.CodeInvalidToken, "invalid api key")
+	case errors.Is(err, ErrTokenRevoked):
+		LogSecurityEvent(EventAuthFailure, r, "token revoked")
+		problem.Write(w, r, problem.CodeInvalidToken, "token revoked")
+	default:
+		LogSecurityEvent(EventAuthFailure, r, "invalid token")
+		problem.Write(w, r, problem.CodeInvalidToken, "invalid token")
+	}
+}
+
+// RequireScope はプリンシパルが scope を持たない場合に403を返す（認証の後段に置く）
+// JWT・クライアント証明書のユーザーは制限がなく、APIキーは作成時に指定したスコープだけを持つ
+func RequireScope(scope string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if claims := GetUserFromContext(r.Context()); claims != nil && !claims.HasScope(scope) {
+				LogSecurityEvent(EventUnauthorized, r, "missing scope "+scope)
+				problem.Write(w, r, problem.CodeInsufficientScope, "requires scope "+scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ParseToken はJWTの署名と有効期限、失効（Revocations）を検証してClaimsを返す（REST・gRPCで共通）
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return JWTSecret, nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	if Revocations.Revoked(claims) {
+		return nil, ErrTokenRevoked
+	}
+	claims.AuthMethod = AuthMethodJWT
+	return claims, nil
+}
+
+// NewContext は認証済みユーザーのClaimsを持つコンテキストを返す
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, UserContextKey, claims)
 }
 
+// GetUserFromContext は認証済みのユーザー（認証方式は Claims.AuthMethod）
 func GetUserFromContext(ctx context.Context) *Claims {
 	claims, ok := ctx.Value(UserContextKey).(*Claims)
 	if !ok {
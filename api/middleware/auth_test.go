@@ -140,3 +140,138 @@ func TestGetUserFromContext(t *testing.T) {
 		}
 	})
 }
+
+func TestOptionalAuth(t *testing.T) {
+	var claims *Claims
+	handler := OptionalAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims = GetUserFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+		expectClaims   bool
+	}{
+		{"no header passes without claims", "", http.StatusOK, false},
+		{"valid token sets claims", "Bearer " + generateTestToken(1, "test@example.com", false), http.StatusOK, true},
+		{"invalid token is rejected", "Bearer invalid", http.StatusUnauthorized, false},
+		{"expired token is rejected", "Bearer " + generateTestToken(1, "test@example.com", true), http.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims = nil
+			req := httptest.NewRequest(http.MethodPost, "/graphql", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if (claims != nil) != tt.expectClaims {
+				t.Errorf("expected claims %v, got %+v", tt.expectClaims, claims)
+			}
+		})
+	}
+}
+
+func TestNewAuth_Chain(t *testing.T) {
+	// X-API-Key: good / limited / それ以外は無効なキー
+	apiKey := AuthenticatorFunc(func(r *http.Request) (*Claims, error) {
+		switch r.Header.Get("X-API-Key") {
+		case "":
+			return nil, ErrNoCredentials
+		case "good":
+			return &Claims{UserID: 2, Email: "bob@example.com", AuthMethod: AuthMethodAPIKey, Scopes: []string{"users:read"}}, nil
+		case "limited":
+			return nil, &RateLimitError{Limit: 1, RetryAfter: 1500 * time.Millisecond}
+		default:
+			return nil, ErrInvalidAPIKey
+		}
+	})
+
+	var claims *Claims
+	handler := NewAuth(JWTAuthenticator, apiKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims = GetUserFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name               string
+		authorization      string
+		apiKey             string
+		expectedStatus     int
+		expectedMethod     string
+		expectedRetryAfter string
+	}{
+		{"jwt", "Bearer " + generateTestToken(1, "alice@example.com", false), "", http.StatusOK, AuthMethodJWT, ""},
+		{"api key", "", "good", http.StatusOK, AuthMethodAPIKey, ""},
+		{"jwt is tried first", "Bearer " + generateTestToken(1, "alice@example.com", false), "unknown", http.StatusOK, AuthMethodJWT, ""},
+		{"invalid jwt does not fall back", "Bearer invalid", "good", http.StatusUnauthorized, "", ""},
+		{"invalid api key", "", "unknown", http.StatusUnauthorized, "", ""},
+		{"rate limited api key", "", "limited", http.StatusTooManyRequests, "", "2"},
+		{"no credentials", "", "", http.StatusUnauthorized, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims = nil
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.expectedRetryAfter {
+				t.Errorf("expected Retry-After %q, got %q", tt.expectedRetryAfter, got)
+			}
+			if tt.expectedMethod != "" && (claims == nil || claims.AuthMethod != tt.expectedMethod) {
+				t.Errorf("expected auth method %s, got %+v", tt.expectedMethod, claims)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := RequireScope("users:write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		claims         *Claims
+		expectedStatus int
+	}{
+		{"jwt user is unrestricted", &Claims{UserID: 1, AuthMethod: AuthMethodJWT}, http.StatusOK},
+		{"api key with the scope", &Claims{UserID: 1, AuthMethod: AuthMethodAPIKey, Scopes: []string{"users:read", "users:write"}}, http.StatusOK},
+		{"api key without the scope", &Claims{UserID: 1, AuthMethod: AuthMethodAPIKey, Scopes: []string{"users:read"}}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req = req.WithContext(NewContext(req.Context(), tt.claims))
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"net/http"
+
+	"k6-practice/api/problem"
 )
 
 // BodyLimit はリクエストボディのサイズを制限するミドルウェア
@@ -10,9 +12,7 @@ func BodyLimit(maxBytes int64) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.ContentLength > maxBytes {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusRequestEntityTooLarge)
-				w.Write([]byte(`{"error": "request body too large"}`))
+				problem.Write(w, r, problem.CodeBodyTooLarge, "request body too large")
 				return
 			}
 
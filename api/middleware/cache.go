@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"bufio"
+	"expvar"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k6-practice/api/metrics"
+)
+
+// CacheControl はルートごとのキャッシュポリシーを設定するミドルウェア
+// SecurityHeaders の既定（no-store）をキャッシュしてよいルートの成功したレスポンス（2xx・304）だけ上書きする
+// エラーのレスポンスは no-store のままにし、検証子（ETag・Last-Modified）も付けない
+func CacheControl(policy string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(&cacheControlWriter{ResponseWriter: w, policy: policy}, r)
+		})
+	}
+}
+
+// cacheControlWriter はステータスコードが決まったときにキャッシュポリシーを設定する
+type cacheControlWriter struct {
+	http.ResponseWriter
+	policy      string
+	wroteHeader bool
+}
+
+func (cw *cacheControlWriter) WriteHeader(code int) {
+	// 1xx（103 Early Hints など）の後に最終的なステータスが来る
+	if !cw.wroteHeader && code >= http.StatusOK {
+		cw.wroteHeader = true
+		h := cw.Header()
+		if code < http.StatusMultipleChoices || code == http.StatusNotModified {
+			h.Set("Cache-Control", cw.policy)
+			h.Del("Pragma")
+		} else {
+			h.Del("ETag")
+			h.Del("Last-Modified")
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cacheControlWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush はストリーミングレスポンスのためにラップ先へ転送する（ヘッダー未送信なら200として送る）
+func (cw *cacheControlWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Hijack はWebSocketなどのアップグレードでコネクションを引き渡す
+func (cw *cacheControlWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(cw.ResponseWriter).Hijack()
+}
+
+// Unwrap は http.ResponseController がラップ先のインターフェースを使えるようにする
+func (cw *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// NotModified は条件付きGET（If-None-Match / If-Modified-Since）が検証子と一致するか判定する
+// RFC 9110 13.2.2: If-None-Match があれば If-Modified-Since は無視する
+func NotModified(r *http.Request, etag string, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// GETでは弱い比較（W/ の有無は無視する）
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		// Last-Modifiedは秒単位
+		return !modified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// ResponseCacheConfig はプロセス内のレスポンスキャッシュの設定
+type ResponseCacheConfig struct {
+	// TTL: レスポンスを返し続ける期間
+	TTL time.Duration
+	// MaxEntries: 保存するレスポンスの上限（超えた分は保存しない）
+	MaxEntries int
+	// Version: データの版数。変わったら保存済みのレスポンスはすべて無効になる
+	Version func() uint64
+}
+
+// レスポンスキャッシュの統計（キャッシュの有無でスループットを比較する）
+var responseCacheStats = new(expvar.Map).Init()
+
+func init() {
+	metrics.Set("response_cache", responseCacheStats)
+}
+
+// ResponseCache はGETの200レスポンスをURLごとに保存して返す
+// データが変更されると（Versionが変わると）TTL内でも再生成する
+type ResponseCache struct {
+	mu      sync.RWMutex
+	entries map[string]*cachedResponse
+	cfg     ResponseCacheConfig
+}
+
+type cachedResponse struct {
+	version uint64
+	expires time.Time
+	status  int
+	header  http.Header
+	body    []byte
+}
+
+func NewResponseCache(cfg ResponseCacheConfig) *ResponseCache {
+	return &ResponseCache{
+		entries: make(map[string]*cachedResponse),
+		cfg:     cfg,
+	}
+}
+
+// Middleware はキャッシュがあれば返し、なければハンドラーのレスポンスを保存する
+// キャッシュの有無は X-Cache（HIT / MISS）で分かる
+func (c *ResponseCache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := r.URL.RequestURI()
+		version := c.cfg.Version()
+		if entry := c.get(key, version); entry != nil {
+			responseCacheStats.Add("hits", 1)
+			for k, v := range entry.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("X-Cache", "HIT")
+			modified, _ := http.ParseTime(entry.header.Get("Last-Modified"))
+			if NotModified(r, entry.header.Get("ETag"), modified) {
+				w.Header().Del("Content-Type")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.WriteHeader(entry.status)
+			w.Write(entry.body)
+			return
+		}
+
+		responseCacheStats.Add("misses", 1)
+		w.Header().Set("X-Cache", "MISS")
+		rec := newCaptureWriter(w)
+		next.ServeHTTP(rec, r)
+
+		// 条件付きGETの304やエラーは保存しない
+		if rec.statusCode == http.StatusOK {
+			c.put(key, &cachedResponse{
+				version: version,
+				expires: time.Now().Add(c.cfg.TTL),
+				status:  rec.statusCode,
+				header:  rec.header,
+				body:    rec.body.Bytes(),
+			})
+		}
+	})
+}
+
+// get は有効なキャッシュを返す（期限切れ・版数違いはnil）
+func (c *ResponseCache) get(key string, version uint64) *cachedResponse {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[key]
+	if !ok || entry.version != version || time.Now().After(entry.expires) {
+		return nil
+	}
+	return entry
+}
+
+func (c *ResponseCache) put(key string, entry *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && c.cfg.MaxEntries > 0 && len(c.entries) >= c.cfg.MaxEntries {
+		// 無効になったものを削除してから空きを確認する
+		now := time.Now()
+		for k, e := range c.entries {
+			if e.version != entry.version || now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.cfg.MaxEntries {
+			return
+		}
+	}
+	c.entries[key] = entry
+}
@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheControl(t *testing.T) {
+	const noStore = "no-store, no-cache, must-revalidate, private"
+
+	tests := []struct {
+		name                 string
+		status               int
+		expectedCacheControl string
+		expectedPragma       string
+		expectedETag         string
+	}{
+		{"success uses the route policy", http.StatusOK, "private, no-cache", "", `"v1"`},
+		{"not modified uses the route policy", http.StatusNotModified, "private, no-cache", "", `"v1"`},
+		{"client error stays no-store", http.StatusNotFound, noStore, "no-cache", ""},
+		{"server error stays no-store", http.StatusInternalServerError, noStore, "no-cache", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := SecurityHeaders(CacheControl("private, no-cache")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", `"v1"`)
+				w.WriteHeader(tt.status)
+			})))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+
+			if got := rec.Header().Get("Cache-Control"); got != tt.expectedCacheControl {
+				t.Errorf("expected Cache-Control %q, got %q", tt.expectedCacheControl, got)
+			}
+			if got := rec.Header().Get("Pragma"); got != tt.expectedPragma {
+				t.Errorf("expected Pragma %q, got %q", tt.expectedPragma, got)
+			}
+			if got := rec.Header().Get("ETag"); got != tt.expectedETag {
+				t.Errorf("expected ETag %q, got %q", tt.expectedETag, got)
+			}
+		})
+	}
+
+	t.Run("implicit 200 on write uses the route policy", func(t *testing.T) {
+		handler := SecurityHeaders(CacheControl("private, no-cache")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+
+		if got := rec.Header().Get("Cache-Control"); got != "private, no-cache" {
+			t.Errorf("expected the route policy, got %q", got)
+		}
+	})
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2026, 1, 1, 12, 0, 0, 500, time.UTC)
+	const etag = `W/"user-1-abc"`
+
+	tests := []struct {
+		name     string
+		method   string
+		header   map[string]string
+		expected bool
+	}{
+		{"no conditions", http.MethodGet, nil, false},
+		{"matching etag", http.MethodGet, map[string]string{"If-None-Match": etag}, true},
+		{"strong form of weak etag", http.MethodGet, map[string]string{"If-None-Match": `"user-1-abc"`}, true},
+		{"etag in list", http.MethodGet, map[string]string{"If-None-Match": `"a", W/"user-1-abc"`}, true},
+		{"wildcard", http.MethodGet, map[string]string{"If-None-Match": "*"}, true},
+		{"other etag", http.MethodGet, map[string]string{"If-None-Match": `W/"user-1-def"`}, false},
+		{"not modified since", http.MethodGet, map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, true},
+		{"modified since", http.MethodGet, map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)}, false},
+		{"invalid date", http.MethodGet, map[string]string{"If-Modified-Since": "yesterday"}, false},
+		{"etag takes precedence", http.MethodGet, map[string]string{
+			"If-None-Match":     `W/"other"`,
+			"If-Modified-Since": modified.Format(http.TimeFormat),
+		}, false},
+		{"head", http.MethodHead, map[string]string{"If-None-Match": etag}, true},
+		{"unsafe method", http.MethodPut, map[string]string{"If-None-Match": etag}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/v1/users/1", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+
+			if got := NotModified(req, etag, modified); got != tt.expected {
+				t.Errorf("NotModified() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	var calls int32
+	var version uint64 = 1
+	status := http.StatusOK
+	cache := NewResponseCache(ResponseCacheConfig{
+		TTL:        time.Hour,
+		MaxEntries: 10,
+		Version:    func() uint64 { return atomic.LoadUint64(&version) },
+	})
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `W/"users-1"`)
+		w.WriteHeader(status)
+		w.Write([]byte(`{"call":` + strconv.Itoa(int(n)) + `}`))
+	}))
+
+	steps := []struct {
+		name           string
+		method         string
+		path           string
+		ifNoneMatch    string
+		before         func()
+		expectedStatus int
+		expectedCache  string
+		expectedBody   string
+	}{
+		{"first request is a miss", http.MethodGet, "/v1/users", "", nil, http.StatusOK, "MISS", `{"call":1}`},
+		{"second request is a hit", http.MethodGet, "/v1/users", "", nil, http.StatusOK, "HIT", `{"call":1}`},
+		{"conditional hit", http.MethodGet, "/v1/users", `W/"users-1"`, nil, http.StatusNotModified, "HIT", ""},
+		{"query is part of the key", http.MethodGet, "/v1/users?x=1", "", nil, http.StatusOK, "MISS", `{"call":2}`},
+		{"store change invalidates", http.MethodGet, "/v1/users", "", func() { atomic.StoreUint64(&version, 2) }, http.StatusOK, "MISS", `{"call":3}`},
+		{"cached again", http.MethodGet, "/v1/users", "", nil, http.StatusOK, "HIT", `{"call":3}`},
+		{"errors are not cached", http.MethodGet, "/v1/users/9", "", func() { status = http.StatusNotFound }, http.StatusNotFound, "MISS", `{"call":4}`},
+		{"errors are not replayed", http.MethodGet, "/v1/users/9", "", nil, http.StatusNotFound, "MISS", `{"call":5}`},
+		{"other methods bypass the cache", http.MethodPost, "/v1/users", "", nil, http.StatusNotFound, "", `{"call":6}`},
+	}
+
+	for _, s := range steps {
+		if s.before != nil {
+			s.before()
+		}
+		req := httptest.NewRequest(s.method, s.path, nil)
+		if s.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", s.ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != s.expectedStatus {
+			t.Errorf("%s: expected status %d, got %d", s.name, s.expectedStatus, rec.Code)
+		}
+		if got := rec.Header().Get("X-Cache"); got != s.expectedCache {
+			t.Errorf("%s: expected X-Cache %q, got %q", s.name, s.expectedCache, got)
+		}
+		if rec.Body.String() != s.expectedBody {
+			t.Errorf("%s: expected body %q, got %q", s.name, s.expectedBody, rec.Body.String())
+		}
+	}
+}
+
+func TestResponseCache_Expiry(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           ResponseCacheConfig
+		wait          time.Duration
+		paths         []string
+		expectedCalls int32
+	}{
+		{"within ttl", ResponseCacheConfig{TTL: time.Hour}, 0, []string{"/a", "/a"}, 1},
+		{"after ttl", ResponseCacheConfig{TTL: time.Millisecond}, 10 * time.Millisecond, []string{"/a", "/a"}, 2},
+		{"full cache stores nothing new", ResponseCacheConfig{TTL: time.Hour, MaxEntries: 1}, 0, []string{"/a", "/b", "/b", "/a"}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			tt.cfg.Version = func() uint64 { return 1 }
+			handler := NewResponseCache(tt.cfg).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.Write([]byte("ok"))
+			}))
+
+			for _, path := range tt.paths {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+				time.Sleep(tt.wait)
+			}
+
+			if calls != tt.expectedCalls {
+				t.Errorf("expected %d handler calls, got %d", tt.expectedCalls, calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+)
+
+// captureWriter はレスポンスを透過しつつステータス・ハンドラーが設定したヘッダー・ボディを記録する
+// 記録したレスポンスは冪等キーの再送やレスポンスキャッシュで後から返す
+type captureWriter struct {
+	http.ResponseWriter
+	before     http.Header // ハンドラー実行前のヘッダー（外側のミドルウェアが設定したもの）
+	statusCode int
+	header     http.Header
+	body       bytes.Buffer
+}
+
+func newCaptureWriter(w http.ResponseWriter) *captureWriter {
+	return &captureWriter{
+		ResponseWriter: w,
+		before:         w.Header().Clone(),
+		statusCode:     http.StatusOK,
+	}
+}
+
+func (cw *captureWriter) WriteHeader(code int) {
+	if cw.header == nil {
+		cw.statusCode = code
+		// 外側のミドルウェアのヘッダー（X-Request-IDなど）は返すときに付け直されるため記録しない
+		cw.header = make(http.Header)
+		for k, v := range cw.Header() {
+			if !slices.Equal(cw.before[k], v) {
+				cw.header[k] = slices.Clone(v)
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if cw.header == nil {
+		cw.WriteHeader(http.StatusOK)
+	}
+	cw.body.Write(b)
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *captureWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -23,10 +23,15 @@ func (c *Chain) Use(mw Middleware) *Chain {
 
 // Then はハンドラーにミドルウェアチェーンを適用
 // ミドルウェアは追加順（左から右）に適用される
+// TraceMiddlewares(true) の場合は各ミドルウェアを子スパンで囲む（入れ子のチェーンは中身だけ）
 func (c *Chain) Then(handler http.Handler) http.Handler {
+	traced := chainSpans.Load()
 	// 逆順に適用してネストを構築
 	for i := len(c.middlewares) - 1; i >= 0; i-- {
 		handler = c.middlewares[i](handler)
+		if name := middlewareName(c.middlewares[i]); traced && name != nestedChainName {
+			handler = traceMiddleware(name, handler)
+		}
 	}
 	return handler
 }
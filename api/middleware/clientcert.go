@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"k6-practice/api/models"
+)
+
+// ClientCert はmTLSで検証済みのクライアント証明書をユーザーに対応付けるミドルウェア
+// 証明書のメールアドレス（SAN、なければSubjectのCN）でユーザーを検索し、
+// 見つかった場合はJWTと同じClaimsをコンテキストに設定する（AuthはAuthorizationヘッダーなしで通す）
+func ClientCert(store *models.UserStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// VerifiedChainsはClientCAで検証できた場合のみ設定される
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			email := certificateEmail(r.TLS.VerifiedChains[0][0])
+			user := store.FindByEmail(email)
+			if user == nil {
+				LogSecurityEvent(EventAuthFailure, r, "client certificate does not match any user: "+email)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims := &Claims{UserID: user.ID, Email: user.Email, AuthMethod: AuthMethodClientCert}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+		})
+	}
+}
+
+// certificateEmail は証明書に記載されたメールアドレスを返す
+func certificateEmail(cert *x509.Certificate) string {
+	if len(cert.EmailAddresses) > 0 {
+		return cert.EmailAddresses[0]
+	}
+	return cert.Subject.CommonName
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k6-practice/api/models"
+)
+
+func TestClientCert(t *testing.T) {
+	store := models.NewUserStore()
+
+	var got *Claims
+	handler := ClientCert(store)(Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetUserFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name           string
+		cert           *x509.Certificate
+		expectedStatus int
+		expectedEmail  string
+	}{
+		{"email SAN maps to user", &x509.Certificate{EmailAddresses: []string{"alice@example.com"}}, http.StatusOK, "alice@example.com"},
+		{"common name maps to user", &x509.Certificate{Subject: pkix.Name{CommonName: "bob@example.com"}}, http.StatusOK, "bob@example.com"},
+		{"unknown user falls back to bearer auth", &x509.Certificate{EmailAddresses: []string{"mallory@example.com"}}, http.StatusUnauthorized, ""},
+		{"no client certificate requires bearer auth", nil, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+			req.TLS = &tls.ConnectionState{}
+			if tt.cert != nil {
+				req.TLS.VerifiedChains = [][]*x509.Certificate{{tt.cert}}
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedEmail != "" && (got == nil || got.Email != tt.expectedEmail) {
+				t.Errorf("expected user %s, got %+v", tt.expectedEmail, got)
+			}
+		})
+	}
+}
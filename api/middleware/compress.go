@@ -0,0 +1,362 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"expvar"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"k6-practice/api/metrics"
+)
+
+// 対応するContent-Encoding
+const (
+	EncodingBrotli  = "br"
+	EncodingZstd    = "zstd"
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate" // HTTPのdeflateはzlib形式（RFC 1950）
+)
+
+// CompressionConfig はレスポンス圧縮の設定
+type CompressionConfig struct {
+	// Encodings: サーバー側の優先順（クライアントのq値が同じ場合は先頭を選ぶ）
+	Encodings []string
+	// MinSize: これより小さいレスポンスは圧縮しない（バイト）
+	MinSize int
+	// ContentTypes: 圧縮するContent-Type（パラメータは無視、"text/*" のようなワイルドカード可）
+	ContentTypes []string
+}
+
+// encoder は各圧縮方式のWriterが共通で持つメソッド
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoderPools は圧縮方式ごとのWriterプール（Writerの確保はコストが大きい）
+var encoderPools = map[string]*sync.Pool{
+	EncodingBrotli: {New: func() interface{} {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}},
+	EncodingZstd: {New: func() interface{} {
+		// レスポンスごとに使うため並列度は1にする（既定はGOMAXPROCS個のgoroutine）
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}},
+	EncodingGzip: {New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}},
+	EncodingDeflate: {New: func() interface{} {
+		return zlib.NewWriter(nil)
+	}},
+}
+
+// 圧縮方式ごとの統計（CPU時間と帯域のトレードオフの計測用）
+var (
+	compressedResponses = new(expvar.Map).Init()
+	compressedBytesIn   = new(expvar.Map).Init()
+	compressedBytesOut  = new(expvar.Map).Init()
+	compressionDuration = new(expvar.Map).Init()
+)
+
+func init() {
+	m := new(expvar.Map).Init()
+	m.Set("responses", compressedResponses)
+	m.Set("bytes_in", compressedBytesIn)
+	m.Set("bytes_out", compressedBytesOut)
+	m.Set("duration_ms_total", compressionDuration)
+	metrics.Set("compression", m)
+}
+
+// Compress はAccept-Encodingに応じてレスポンスを圧縮するミドルウェア
+// MinSize未満のレスポンス、対象外のContent-Type、既にContent-Encodingが付いたレスポンスは圧縮しない
+func Compress(cfg CompressionConfig) func(http.Handler) http.Handler {
+	encodings := make([]string, 0, len(cfg.Encodings))
+	for _, e := range cfg.Encodings {
+		if _, ok := encoderPools[e]; ok {
+			encodings = append(encodings, e)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// プロトコルのアップグレード（WebSocketなど）は対象外
+			if r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				cfg:            &cfg,
+				encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding"), encodings),
+				head:           r.Method == http.MethodHead,
+			}
+			defer cw.Close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding はAccept-Encodingから使用する圧縮方式を選ぶ（""は無圧縮）
+// q値が最大のものを選び、同じq値ならsupportedの順を優先する
+func negotiateEncoding(header string, supported []string) string {
+	if header == "" {
+		return ""
+	}
+
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "q") {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		weights[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range supported {
+		q, ok := weights[enc]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// compressWriter はMinSizeに達するまでボディをバッファし、圧縮するかを決めてから送信する
+type compressWriter struct {
+	http.ResponseWriter
+	cfg      *CompressionConfig
+	encoding string
+	head     bool
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+	out     *countingWriter
+	elapsed time.Duration
+	written int64
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	// 1xx（103 Early Hintsなど）はそのまま送る
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	cw.status = code
+
+	// ボディを持たない、または部分的なレスポンスは圧縮しない
+	if cw.head || code == http.StatusNoContent || code == http.StatusNotModified ||
+		code == http.StatusPartialContent || code == http.StatusSwitchingProtocols {
+		cw.start(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.cfg.MinSize {
+			return len(b), nil
+		}
+		cw.start(cw.compressible())
+		return len(b), cw.flushBuffer()
+	}
+	if cw.enc == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.encode(b)
+}
+
+// Flush はストリーミングレスポンスのため、MinSize未満でも圧縮を開始して送信する
+func (cw *compressWriter) Flush() {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.start(cw.compressible())
+		cw.flushBuffer()
+	}
+	if cw.enc != nil {
+		start := time.Now()
+		cw.enc.Flush()
+		cw.elapsed += time.Since(start)
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Hijack はWebSocketなどでコネクションを引き渡す（圧縮は行わない）
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	cw.decided = true
+	return http.NewResponseController(cw.ResponseWriter).Hijack()
+}
+
+// Unwrap は http.ResponseController がラップ先のインターフェースを使えるようにする
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close はバッファ・圧縮器に残ったデータを送信し、統計を記録する
+func (cw *compressWriter) Close() {
+	if !cw.decided {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			// ハンドラーが何も書いていない（net/httpが200を返す）
+			addVary(cw.Header(), "Accept-Encoding")
+			return
+		}
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.start(len(cw.buf) >= cw.cfg.MinSize && cw.compressible())
+		cw.flushBuffer()
+	}
+	if cw.enc == nil {
+		return
+	}
+
+	start := time.Now()
+	cw.enc.Close()
+	cw.elapsed += time.Since(start)
+	cw.enc.Reset(nil)
+	encoderPools[cw.encoding].Put(cw.enc)
+	cw.enc = nil
+
+	compressedResponses.Add(cw.encoding, 1)
+	compressedBytesIn.Add(cw.encoding, cw.written)
+	compressedBytesOut.Add(cw.encoding, cw.out.n)
+	compressionDuration.AddFloat(cw.encoding, float64(cw.elapsed)/float64(time.Millisecond))
+}
+
+// compressible はレスポンスヘッダーから圧縮してよいかを判定する
+func (cw *compressWriter) compressible() bool {
+	if cw.encoding == "" {
+		return false
+	}
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	return matchContentType(h.Get("Content-Type"), cw.cfg.ContentTypes)
+}
+
+// start はヘッダーを確定してステータスを送信する
+func (cw *compressWriter) start(compress bool) {
+	cw.decided = true
+	h := cw.Header()
+	if h.Get("Content-Encoding") == "" {
+		addVary(h, "Accept-Encoding")
+	}
+
+	if compress {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		// 表現が変わるため強いETagは弱いETagにする
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		cw.out = &countingWriter{w: cw.ResponseWriter}
+		cw.enc = encoderPools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.out)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+// flushBuffer は判定までバッファしていたボディを送信する
+func (cw *compressWriter) flushBuffer() error {
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	buf := cw.buf
+	cw.buf = nil
+	if cw.enc == nil {
+		_, err := cw.ResponseWriter.Write(buf)
+		return err
+	}
+	_, err := cw.encode(buf)
+	return err
+}
+
+func (cw *compressWriter) encode(b []byte) (int, error) {
+	start := time.Now()
+	n, err := cw.enc.Write(b)
+	cw.elapsed += time.Since(start)
+	cw.written += int64(n)
+	return n, err
+}
+
+// countingWriter は圧縮後に送信したバイト数を数える
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// matchContentType はContent-Typeが許可リストに含まれるか判定する
+func matchContentType(contentType string, allowed []string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, pattern := range allowed {
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// addVary はVaryヘッダーに値がなければ追加する
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
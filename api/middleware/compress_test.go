@@ -0,0 +1,242 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var testCompressionConfig = CompressionConfig{
+	Encodings:    []string{EncodingBrotli, EncodingZstd, EncodingGzip, EncodingDeflate},
+	MinSize:      256,
+	ContentTypes: []string{"application/json", "text/*"},
+}
+
+func decodeBody(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var r io.Reader
+	var err error
+	switch encoding {
+	case EncodingBrotli:
+		r = brotli.NewReader(bytes.NewReader(body))
+	case EncodingZstd:
+		var dec *zstd.Decoder
+		dec, err = zstd.NewReader(bytes.NewReader(body))
+		if err == nil {
+			defer dec.Close()
+			r = dec
+		}
+	case EncodingGzip:
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case EncodingDeflate:
+		r, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		return string(body)
+	}
+	if err != nil {
+		t.Fatalf("failed to create %s reader: %v", encoding, err)
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to decode %s body: %v", encoding, err)
+	}
+	return string(decoded)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{EncodingBrotli, EncodingZstd, EncodingGzip, EncodingDeflate}
+
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"gzip;q=1.0, br;q=0.5", "gzip"},
+		{"zstd, gzip", "zstd"},
+		{"br;q=0, gzip", "gzip"},
+		{"*", "br"},
+		{"*;q=0.5, deflate", "deflate"},
+		{"identity", ""},
+		{"compress", ""},
+		{"GZIP", "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := negotiateEncoding(tt.header, supported); got != tt.expected {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := `{"data":"` + strings.Repeat("k6 ", 200) + `"}`
+	small := `{"ok":true}`
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		preEncoded     bool
+		expected       string
+	}{
+		{"brotli", "br", "application/json", large, false, EncodingBrotli},
+		{"zstd", "zstd", "application/json", large, false, EncodingZstd},
+		{"gzip", "gzip", "application/json", large, false, EncodingGzip},
+		{"deflate", "deflate", "application/json", large, false, EncodingDeflate},
+		{"no Accept-Encoding", "", "application/json", large, false, ""},
+		{"below minimum size", "gzip", "application/json", small, false, ""},
+		{"content type with parameters", "gzip", "text/plain; charset=utf-8", large, false, EncodingGzip},
+		{"content type not allowed", "gzip", "image/png", large, false, ""},
+		{"already encoded", "gzip", "application/json", large, true, EncodingBrotli},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Compress(testCompressionConfig)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Header().Set("Content-Length", "1")
+				if tt.preEncoded {
+					w.Header().Set("Content-Encoding", EncodingBrotli)
+				}
+				// 小さい単位で書いてバッファリングを確認する
+				for i := 0; i < len(tt.body); i += 100 {
+					end := min(i+100, len(tt.body))
+					w.Write([]byte(tt.body[i:end]))
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Encoding"); got != tt.expected {
+				t.Fatalf("expected Content-Encoding %q, got %q", tt.expected, got)
+			}
+			if tt.preEncoded {
+				if rec.Body.String() != tt.body {
+					t.Error("expected pre-encoded body to pass through unchanged")
+				}
+				return
+			}
+			if got := decodeBody(t, tt.expected, rec.Body.Bytes()); got != tt.body {
+				t.Errorf("decoded body does not match original (len %d vs %d)", len(got), len(tt.body))
+			}
+			if tt.expected != "" {
+				if rec.Header().Get("Content-Length") != "" {
+					t.Error("expected Content-Length to be removed")
+				}
+				if rec.Body.Len() >= len(tt.body) {
+					t.Errorf("expected compressed body to be smaller, got %d >= %d", rec.Body.Len(), len(tt.body))
+				}
+			}
+			if got := rec.Header().Get("Vary"); !tt.preEncoded && got != "Accept-Encoding" {
+				t.Errorf("expected Vary Accept-Encoding, got %q", got)
+			}
+		})
+	}
+}
+
+func TestCompress_Headers(t *testing.T) {
+	large := strings.Repeat("a", 1024)
+
+	t.Run("keeps existing Vary and weakens ETag", func(t *testing.T) {
+		handler := Compress(testCompressionConfig)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Vary", "Accept")
+			w.Header().Set("ETag", `"abc"`)
+			w.Write([]byte(large))
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if got := rec.Header().Values("Vary"); len(got) != 2 || got[1] != "Accept-Encoding" {
+			t.Errorf("expected Vary [Accept Accept-Encoding], got %v", got)
+		}
+		if got := rec.Header().Get("ETag"); got != `W/"abc"` {
+			t.Errorf("expected weak ETag, got %q", got)
+		}
+	})
+
+	t.Run("status code without body is not compressed", func(t *testing.T) {
+		handler := Compress(testCompressionConfig)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("expected status %d, got %d", http.StatusNoContent, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("expected no Content-Encoding, got %q", got)
+		}
+	})
+
+	t.Run("status code is preserved", func(t *testing.T) {
+		handler := Compress(testCompressionConfig)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(large))
+		}))
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusCreated {
+			t.Errorf("expected status %d, got %d", http.StatusCreated, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Encoding"); got != EncodingGzip {
+			t.Errorf("expected gzip, got %q", got)
+		}
+	})
+
+	t.Run("flush starts compression before minimum size", func(t *testing.T) {
+		handler := Compress(testCompressionConfig)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("chunk 1\n"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("chunk 2\n"))
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if !rec.Flushed {
+			t.Error("expected response to be flushed")
+		}
+		if got := decodeBody(t, rec.Header().Get("Content-Encoding"), rec.Body.Bytes()); got != "chunk 1\nchunk 2\n" {
+			t.Errorf("unexpected body %q", got)
+		}
+	})
+}
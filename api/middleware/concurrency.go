@@ -0,0 +1,356 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"expvar"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k6-practice/api/metrics"
+	"k6-practice/api/problem"
+)
+
+// Priority は負荷制限での優先度（大きいほど後まで処理する）
+type Priority int
+
+const (
+	// PriorityDefault は匿名のリクエスト（最初に制限する）
+	PriorityDefault Priority = iota
+	// PriorityAuthenticated は認証済みのリクエスト
+	PriorityAuthenticated
+	// PriorityCritical はヘルスチェック・メトリクス（最後まで処理する）
+	PriorityCritical
+
+	numPriorities
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityAuthenticated:
+		return "authenticated"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return "default"
+	}
+}
+
+// ConcurrencyConfig は同時実行数の制限の設定
+type ConcurrencyConfig struct {
+	// Name: メトリクスでの名前
+	Name string
+	// Limit: 同時に処理するリクエスト数（LatencyTargetがあれば初期値）
+	Limit int
+	// MinLimit, MaxLimit: レイテンシに応じて上限を変える範囲
+	MinLimit int
+	MaxLimit int
+	// LatencyTarget: これより遅いレスポンスが出たら上限を下げる（0は固定の上限）
+	LatencyTarget time.Duration
+	// QueueSize: 上限に達したときに待たせるリクエスト数（0は待たせずに503）
+	QueueSize int
+	// QueueTimeout: 待ち行列で待つ最大時間
+	QueueTimeout time.Duration
+}
+
+// 上限の下げ幅（AIMDの乗算的減少）
+const concurrencyBackoff = 0.9
+
+// 作成した制限（メトリクスで現在の上限・処理中・待ちの数を出す）
+var concurrencyLimiters sync.Map // name -> *ConcurrencyLimiter
+
+func init() {
+	metrics.Set("concurrency", expvar.Func(concurrencySnapshot))
+}
+
+// ConcurrencyLimiter は同時に処理するリクエスト数を制限し、超えた分を優先度順の待ち行列に入れる
+// 待ち行列も一杯の場合は優先度の低いリクエストから503で断る（負荷制限）
+// LatencyTarget を設定するとAIMDで上限を調整する（遅くなったら下げ、余裕があれば少しずつ上げる）
+// A04:2021 - Insecure Design 対策（過負荷でも全リクエストにgoroutineを割り当てて共倒れしない）
+type ConcurrencyLimiter struct {
+	mu           sync.Mutex
+	cfg          ConcurrencyConfig
+	limit        float64
+	inFlight     int
+	queues       [numPriorities]*list.List
+	queued       int
+	lastDecrease time.Time
+	shed         [numPriorities]int64
+}
+
+type concurrencyWaiter struct {
+	ready    chan bool // true: 処理してよい、false: 追い出された
+	priority Priority
+	el       *list.Element // 待ち行列から外れたらnil
+}
+
+func NewConcurrencyLimiter(cfg ConcurrencyConfig) *ConcurrencyLimiter {
+	if cfg.Limit <= 0 {
+		cfg.Limit = 1
+	}
+	if cfg.MinLimit <= 0 || cfg.MinLimit > cfg.Limit {
+		cfg.MinLimit = 1
+	}
+	if cfg.MaxLimit < cfg.Limit {
+		cfg.MaxLimit = cfg.Limit
+	}
+	l := &ConcurrencyLimiter{cfg: cfg, limit: float64(cfg.Limit)}
+	for i := range l.queues {
+		l.queues[i] = list.New()
+	}
+	if cfg.Name != "" {
+		concurrencyLimiters.Store(cfg.Name, l)
+	}
+	return l
+}
+
+// Middleware は優先度 p でリクエストを制限する（資格情報を持つリクエストは PriorityAuthenticated に上げる）
+func (l *ConcurrencyLimiter) Middleware(p Priority) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l.serve(w, r, p, next)
+		})
+	}
+}
+
+func (l *ConcurrencyLimiter) serve(w http.ResponseWriter, r *http.Request, p Priority, next http.Handler) {
+	p = requestPriority(r, p)
+	if !l.acquire(r.Context(), p) {
+		w.Header().Set("Retry-After", "1")
+		problem.Write(w, r, problem.CodeOverloaded, "server is overloaded, retry later")
+		return
+	}
+
+	start := time.Now()
+	rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	// パニックした場合も枠を返す
+	defer func() {
+		l.release(time.Since(start), rw.statusCode)
+	}()
+	next.ServeHTTP(rw, r)
+}
+
+// acquire は処理枠を確保する。確保できなければ（追い出し・待ち時間切れ・切断）false
+func (l *ConcurrencyLimiter) acquire(ctx context.Context, p Priority) bool {
+	l.mu.Lock()
+	if l.inFlight < int(l.limit) {
+		l.inFlight++
+		l.mu.Unlock()
+		return true
+	}
+
+	if l.queued >= l.cfg.QueueSize {
+		// 待ち行列が一杯なら、より優先度の低い待ちを追い出して入る
+		victim := l.lowestWaiter(p)
+		if victim == nil {
+			l.shed[p]++
+			l.mu.Unlock()
+			return false
+		}
+		l.dequeue(victim)
+		l.shed[victim.priority]++
+		victim.ready <- false
+	}
+
+	waiter := &concurrencyWaiter{ready: make(chan bool, 1), priority: p}
+	waiter.el = l.queues[p].PushBack(waiter)
+	l.queued++
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.cfg.QueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case ok := <-waiter.ready:
+		return ok
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	if waiter.el != nil {
+		l.dequeue(waiter)
+		l.shed[p]++
+		l.mu.Unlock()
+		return false
+	}
+	l.mu.Unlock()
+	// 待ち時間切れと同時に割り当て（または追い出し）が決まっていた
+	return <-waiter.ready
+}
+
+// release は処理枠を返し、空いた枠を優先度の高い待ちから順に割り当てる
+func (l *ConcurrencyLimiter) release(latency time.Duration, status int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	saturated := l.inFlight >= int(l.limit) || l.queued > 0
+	l.inFlight--
+	l.adapt(latency, status, saturated)
+
+	for l.inFlight < int(l.limit) {
+		waiter := l.nextWaiter()
+		if waiter == nil {
+			break
+		}
+		l.dequeue(waiter)
+		l.inFlight++
+		waiter.ready <- true
+	}
+}
+
+// adapt はレイテンシを見て上限を調整する（AIMD）
+func (l *ConcurrencyLimiter) adapt(latency time.Duration, status int, saturated bool) {
+	if l.cfg.LatencyTarget <= 0 {
+		return
+	}
+
+	if latency > l.cfg.LatencyTarget || status == http.StatusServiceUnavailable {
+		// 同じ混雑で続けて下げすぎないよう、前回から LatencyTarget 経過してから下げる
+		now := time.Now()
+		if now.Sub(l.lastDecrease) >= l.cfg.LatencyTarget {
+			l.limit = max(float64(l.cfg.MinLimit), l.limit*concurrencyBackoff)
+			l.lastDecrease = now
+		}
+		return
+	}
+
+	// 上限まで使っているときだけ上げる（上限と同じ数の成功で+1）
+	if saturated {
+		l.limit = min(float64(l.cfg.MaxLimit), l.limit+1/l.limit)
+	}
+}
+
+// nextWaiter は優先度の高い待ちのうち最も古いもの
+func (l *ConcurrencyLimiter) nextWaiter() *concurrencyWaiter {
+	for p := numPriorities - 1; p >= 0; p-- {
+		if el := l.queues[p].Front(); el != nil {
+			return el.Value.(*concurrencyWaiter)
+		}
+	}
+	return nil
+}
+
+// lowestWaiter は p より優先度の低い待ちのうち最も新しいもの（なければnil）
+func (l *ConcurrencyLimiter) lowestWaiter(p Priority) *concurrencyWaiter {
+	for q := Priority(0); q < p; q++ {
+		if el := l.queues[q].Back(); el != nil {
+			return el.Value.(*concurrencyWaiter)
+		}
+	}
+	return nil
+}
+
+func (l *ConcurrencyLimiter) dequeue(waiter *concurrencyWaiter) {
+	l.queues[waiter.priority].Remove(waiter.el)
+	waiter.el = nil
+	l.queued--
+}
+
+// Limit は現在の上限
+func (l *ConcurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *ConcurrencyLimiter) stats() map[string]interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	shed := make(map[string]int64, numPriorities)
+	for p := Priority(0); p < numPriorities; p++ {
+		shed[p.String()] = l.shed[p]
+	}
+	return map[string]interface{}{
+		"limit":     int(l.limit),
+		"in_flight": l.inFlight,
+		"queued":    l.queued,
+		"shed":      shed,
+	}
+}
+
+func concurrencySnapshot() interface{} {
+	snapshot := make(map[string]interface{})
+	concurrencyLimiters.Range(func(name, l interface{}) bool {
+		snapshot[name.(string)] = l.(*ConcurrencyLimiter).stats()
+		return true
+	})
+	return snapshot
+}
+
+// RouteConcurrencyLimiter はルートごとに別の ConcurrencyLimiter で制限する
+// 遅いルートの混雑が他のルートの上限を下げないようにする
+type RouteConcurrencyLimiter struct {
+	mu       sync.Mutex
+	cfg      ConcurrencyConfig
+	limiters map[string]*ConcurrencyLimiter
+}
+
+// NewRouteConcurrencyLimiter は cfg を各ルートの初期設定として使う（Nameはルート名で上書き）
+func NewRouteConcurrencyLimiter(cfg ConcurrencyConfig) *RouteConcurrencyLimiter {
+	return &RouteConcurrencyLimiter{
+		cfg:      cfg,
+		limiters: make(map[string]*ConcurrencyLimiter),
+	}
+}
+
+// Middleware はルート名（NameRoute）ごとの制限を優先度 p で適用する
+func (rl *RouteConcurrencyLimiter) Middleware(p Priority) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rl.limiter(RouteName(r.Context())).serve(w, r, p, next)
+		})
+	}
+}
+
+func (rl *RouteConcurrencyLimiter) limiter(route string) *ConcurrencyLimiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	l, ok := rl.limiters[route]
+	if !ok {
+		cfg := rl.cfg
+		cfg.Name = "route:" + route
+		l = NewConcurrencyLimiter(cfg)
+		rl.limiters[route] = l
+	}
+	return l
+}
+
+// requestPriority は資格情報を持つリクエスト（またはクライアント証明書で認証済み）の優先度を上げる
+// 制限する側のリクエストに署名の検証などのコストをかけないよう、ここでは資格情報の有無と形だけを見る
+// 検証は処理枠を確保した後の認証ミドルウェアが行い、無効な資格情報はそこで401を返す
+// 先に認証した結果（レート制限の preauthenticate）があればそれを使う
+func requestPriority(r *http.Request, p Priority) Priority {
+	if p >= PriorityAuthenticated {
+		return p
+	}
+	if GetUserFromContext(r.Context()) != nil {
+		return PriorityAuthenticated
+	}
+	if res, ok := r.Context().Value(authResultKey).(*authResult); ok {
+		if res.claims != nil {
+			return PriorityAuthenticated
+		}
+		return p
+	}
+	if hasCredentials(r) {
+		return PriorityAuthenticated
+	}
+	return p
+}
+
+// hasCredentials は JWTの形の Bearer トークンか、APIキー（Authorization: ApiKey・X-API-Key）があるか（検証はしない）
+func hasCredentials(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+		return strings.Count(token, ".") == 2
+	}
+	if key, ok := strings.CutPrefix(auth, "ApiKey "); ok {
+		return key != ""
+	}
+	return r.Header.Get("X-API-Key") != ""
+}
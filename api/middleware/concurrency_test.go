@@ -0,0 +1,241 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// blockingHandler はreleaseが閉じられるまで応答しない
+func blockingHandler(release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// serveAsync はリクエストを別goroutineで処理し、レスポンスを返すチャネルを返す
+func serveAsync(handler http.Handler, req *http.Request) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		done <- rec
+	}()
+	return done
+}
+
+// waitFor は制限の処理中・待ちの数が期待値になるまで待つ
+func waitFor(t *testing.T, l *ConcurrencyLimiter, inFlight, queued int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		ok := l.inFlight == inFlight && l.queued == queued
+		l.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d in flight and %d queued", inFlight, queued)
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	tests := []struct {
+		name           string
+		queueSize      int
+		queueTimeout   time.Duration
+		expectedStatus int
+	}{
+		{"shed without queue", 0, time.Second, http.StatusServiceUnavailable},
+		{"queued until a slot frees", 1, time.Second, http.StatusOK},
+		{"queue timeout", 1, 10 * time.Millisecond, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewConcurrencyLimiter(ConcurrencyConfig{Limit: 1, QueueSize: tt.queueSize, QueueTimeout: tt.queueTimeout})
+			release := make(chan struct{})
+			handler := l.Middleware(PriorityDefault)(blockingHandler(release))
+
+			first := serveAsync(handler, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+			waitFor(t, l, 1, 0)
+
+			second := serveAsync(handler, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+			var rec *httptest.ResponseRecorder
+			if tt.expectedStatus == http.StatusOK {
+				waitFor(t, l, 1, 1)
+				close(release)
+				rec = <-second
+			} else {
+				rec = <-second
+				close(release)
+			}
+			<-first
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if rec.Code == http.StatusServiceUnavailable {
+				if rec.Header().Get("Retry-After") == "" {
+					t.Error("expected Retry-After header")
+				}
+				var body struct{ Code string }
+				json.NewDecoder(rec.Body).Decode(&body)
+				if body.Code != "overloaded" {
+					t.Errorf("expected overloaded problem, got %q", body.Code)
+				}
+			}
+			waitFor(t, l, 0, 0)
+		})
+	}
+}
+
+func TestConcurrencyLimiter_Priority(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{Limit: 1, QueueSize: 1, QueueTimeout: time.Second})
+	release := make(chan struct{})
+	handler := blockingHandler(release)
+
+	first := serveAsync(l.Middleware(PriorityDefault)(handler), httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+	waitFor(t, l, 1, 0)
+
+	anonymous := serveAsync(l.Middleware(PriorityDefault)(handler), httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+	waitFor(t, l, 1, 1)
+
+	// 待ち行列が一杯でも、優先度の高いリクエストは匿名の待ちを追い出して入る
+	health := serveAsync(l.Middleware(PriorityCritical)(handler), httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec := <-anonymous; rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected anonymous request to be shed, got %d", rec.Code)
+	}
+	waitFor(t, l, 1, 1)
+
+	// 優先度の低いリクエストは一杯の待ち行列に入れない
+	rec := httptest.NewRecorder()
+	l.Middleware(PriorityDefault)(handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected anonymous request to be shed, got %d", rec.Code)
+	}
+
+	close(release)
+	<-first
+	if rec := <-health; rec.Code != http.StatusOK {
+		t.Errorf("expected health check to be served, got %d", rec.Code)
+	}
+
+	stats := l.stats()
+	if shed := stats["shed"].(map[string]int64); shed["default"] != 2 || shed["critical"] != 0 {
+		t.Errorf("unexpected shed counts: %v", shed)
+	}
+}
+
+func TestConcurrencyLimiter_Adaptive(t *testing.T) {
+	tests := []struct {
+		name     string
+		latency  time.Duration
+		status   int
+		releases int
+		expected int
+	}{
+		{"slow responses decrease the limit", time.Hour, http.StatusOK, 1, 9},
+		{"decrease at most once per target", time.Hour, http.StatusOK, 5, 9},
+		{"overload decreases the limit", 0, http.StatusServiceUnavailable, 1, 9},
+		{"fast responses at the limit increase it", 0, http.StatusOK, 15, 11},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewConcurrencyLimiter(ConcurrencyConfig{
+				Limit: 10, MinLimit: 5, MaxLimit: 20,
+				LatencyTarget: time.Minute,
+			})
+			for i := 0; i < tt.releases; i++ {
+				// 上限まで使ってから1件返す
+				for l.acquire(context.Background(), PriorityDefault) {
+				}
+				l.release(tt.latency, tt.status)
+				l.mu.Lock()
+				l.inFlight = 0
+				l.mu.Unlock()
+			}
+
+			if got := l.Limit(); got != tt.expected {
+				t.Errorf("expected limit %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRequestPriority(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     Priority
+		header   string
+		apiKey   string
+		expected Priority
+	}{
+		{"anonymous", PriorityDefault, "", "", PriorityDefault},
+		{"bearer token", PriorityDefault, "Bearer " + generateTestToken(1, "alice@example.com", false), "", PriorityAuthenticated},
+		// 署名・有効期限は検証しない（処理枠を確保した後の認証が401を返す）
+		{"expired token is not verified", PriorityDefault, "Bearer " + generateTestToken(1, "alice@example.com", true), "", PriorityAuthenticated},
+		{"bearer that is not a JWT", PriorityDefault, "Bearer abc", "", PriorityDefault},
+		{"malformed header", PriorityDefault, "Token abc", "", PriorityDefault},
+		{"api key in authorization", PriorityDefault, "ApiKey k6_abc", "", PriorityAuthenticated},
+		{"empty api key", PriorityDefault, "ApiKey ", "", PriorityDefault},
+		{"api key header", PriorityDefault, "", "k6_abc", PriorityAuthenticated},
+		{"critical stays critical", PriorityCritical, "", "", PriorityCritical},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+
+			if got := requestPriority(req, tt.base); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRequestPriority_DoesNotAuthenticate(t *testing.T) {
+	calls := 0
+	counting := AuthenticatorFunc(func(r *http.Request) (*Claims, error) {
+		calls++
+		return JWTAuthenticator(r)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(1, "alice@example.com", false))
+
+	// 負荷制限は認証しない
+	l := NewConcurrencyLimiter(ConcurrencyConfig{Limit: 1})
+	var claims *Claims
+	handler := l.Middleware(PriorityDefault)(NewAuth(counting)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims = GetUserFromContext(r.Context())
+	})))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if calls != 1 || claims == nil || claims.UserID != 1 {
+		t.Errorf("expected a single authentication after acquiring a slot, got %+v after %d calls", claims, calls)
+	}
+
+	// 先に認証した結果（レート制限）があれば、それで優先度を決める
+	rejected := req.Clone(req.Context())
+	rejected.Header.Set("Authorization", "Bearer "+generateTestToken(1, "alice@example.com", true))
+	rejected, _ = preauthenticate(rejected, []Authenticator{JWTAuthenticator})
+	if got := requestPriority(rejected, PriorityDefault); got != PriorityDefault {
+		t.Errorf("expected a failed earlier authentication to stay %s, got %s", PriorityDefault, got)
+	}
+	accepted, _ := preauthenticate(req, []Authenticator{JWTAuthenticator})
+	if got := requestPriority(accepted, PriorityDefault); got != PriorityAuthenticated {
+		t.Errorf("expected a successful earlier authentication to be %s, got %s", PriorityAuthenticated, got)
+	}
+}
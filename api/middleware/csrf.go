@@ -3,6 +3,8 @@ package middleware
 import (
 	"net/http"
 	"strings"
+
+	"k6-practice/api/problem"
 )
 
 type CSRFConfig struct {
@@ -31,7 +33,8 @@ func CSRFProtection(config CSRFConfig) func(http.Handler) http.Handler {
 
 			if origin == "" && referer == "" {
 				if config.StrictMode {
-					http.Error(w, `{"error": "CSRF validation failed: missing origin/referer"}`, http.StatusForbidden)
+					LogSecurityEvent(EventCSRFBlocked, r, "missing origin/referer")
+					problem.Write(w, r, problem.CodeCSRFFailed, "missing origin/referer")
 					return
 				}
 				// 非StrictMode: ヘッダーがない場合は許可（curl, k6等のテストツール用）
@@ -40,12 +43,14 @@ func CSRFProtection(config CSRFConfig) func(http.Handler) http.Handler {
 			}
 
 			if origin != "" && !isAllowedOrigin(origin, config.AllowedOrigins) {
-				http.Error(w, `{"error": "CSRF validation failed: invalid origin"}`, http.StatusForbidden)
+				LogSecurityEvent(EventCSRFBlocked, r, "invalid origin: "+origin)
+				problem.Write(w, r, problem.CodeCSRFFailed, "invalid origin")
 				return
 			}
 
 			if origin == "" && referer != "" && !isAllowedReferer(referer, config.AllowedOrigins) {
-				http.Error(w, `{"error": "CSRF validation failed: invalid referer"}`, http.StatusForbidden)
+				LogSecurityEvent(EventCSRFBlocked, r, "invalid referer: "+referer)
+				problem.Write(w, r, problem.CodeCSRFFailed, "invalid referer")
 				return
 			}
 
@@ -54,7 +59,8 @@ func CSRFProtection(config CSRFConfig) func(http.Handler) http.Handler {
 			if origin != "" || referer != "" {
 				xRequestedWith := r.Header.Get("X-Requested-With")
 				if xRequestedWith == "" {
-					http.Error(w, `{"error": "CSRF validation failed: missing X-Requested-With header"}`, http.StatusForbidden)
+					LogSecurityEvent(EventCSRFBlocked, r, "missing X-Requested-With header")
+					problem.Write(w, r, problem.CodeCSRFFailed, "missing X-Requested-With header")
 					return
 				}
 			}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"k6-practice/api/problem"
+)
+
+// decoders は対応するリクエストのContent-Encoding
+var decoders = map[string]func(io.Reader, int64) (io.ReadCloser, error){
+	EncodingBrotli: func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return io.NopCloser(brotli.NewReader(r)), nil
+	},
+	EncodingZstd: func(r io.Reader, maxBytes int64) (io.ReadCloser, error) {
+		dec, err := zstd.NewReader(r,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(maxBytes)),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	},
+	EncodingGzip: func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	EncodingDeflate: func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return zlib.NewReader(r)
+	},
+}
+
+// Decompress はContent-Encoding付きのリクエストボディを展開するミドルウェア
+// BodyLimitは受信した（圧縮された）サイズ、こちらは展開後のサイズをmaxBytesに制限する
+// A04:2021 - Insecure Design 対策（圧縮爆弾によるDoS防止）
+func Decompress(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Content-Encoding")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// 複数の圧縮は適用された順に列挙されるため逆順に展開する
+			codings := strings.Split(header, ",")
+			body := r.Body
+			for i := len(codings) - 1; i >= 0; i-- {
+				coding := strings.ToLower(strings.TrimSpace(codings[i]))
+				if coding == "identity" {
+					continue
+				}
+				decode, ok := decoders[coding]
+				if !ok {
+					LogSecurityEvent(EventInvalidInput, r, "unsupported content encoding: "+coding)
+					w.Header().Set("Accept-Encoding", strings.Join(supportedDecodings, ", "))
+					problem.Write(w, r, problem.CodeUnknownEncoding, "unsupported content encoding: "+coding)
+					return
+				}
+				decoded, err := decode(body, maxBytes)
+				if err != nil {
+					LogSecurityEvent(EventInvalidInput, r, "malformed "+coding+" body")
+					problem.Write(w, r, problem.CodeInvalidBody, "malformed "+coding+" body")
+					return
+				}
+				body = &decodedBody{ReadCloser: decoded, raw: r.Body}
+			}
+
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			// 超過時は *http.MaxBytesError を返す（BodyLimitと同じく413になる）
+			r.Body = http.MaxBytesReader(w, body, maxBytes)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// supportedDecodings は415レスポンスのAccept-Encodingに列挙する
+var supportedDecodings = []string{EncodingBrotli, EncodingZstd, EncodingGzip, EncodingDeflate}
+
+// decodedBody は展開器と元のボディの両方を閉じる
+type decodedBody struct {
+	io.ReadCloser
+	raw io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.raw.Close()
+}
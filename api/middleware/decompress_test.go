@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func encodeBody(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case EncodingBrotli:
+		w = brotli.NewWriter(&buf)
+	case EncodingZstd:
+		enc, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatalf("failed to create zstd writer: %v", err)
+		}
+		w = enc
+	case EncodingGzip:
+		w = gzip.NewWriter(&buf)
+	case EncodingDeflate:
+		w = zlib.NewWriter(&buf)
+	}
+	w.Write(body)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	const maxBytes = 1024
+	payload := []byte(`{"name":"Test User","email":"test@example.com"}`)
+	bomb := bytes.Repeat([]byte("a"), 64*1024)
+
+	tests := []struct {
+		name            string
+		contentEncoding string
+		body            []byte
+		expectedStatus  int
+		expectedBody    string
+	}{
+		{"no encoding", "", payload, http.StatusOK, string(payload)},
+		{"brotli", "br", encodeBody(t, EncodingBrotli, payload), http.StatusOK, string(payload)},
+		{"zstd", "zstd", encodeBody(t, EncodingZstd, payload), http.StatusOK, string(payload)},
+		{"gzip", "gzip", encodeBody(t, EncodingGzip, payload), http.StatusOK, string(payload)},
+		{"deflate", "deflate", encodeBody(t, EncodingDeflate, payload), http.StatusOK, string(payload)},
+		{"identity", "identity", payload, http.StatusOK, string(payload)},
+		{"multiple codings", "gzip, br", encodeBody(t, EncodingBrotli, encodeBody(t, EncodingGzip, payload)), http.StatusOK, string(payload)},
+		{"unsupported encoding", "compress", payload, http.StatusUnsupportedMediaType, ""},
+		{"malformed gzip", "gzip", payload, http.StatusBadRequest, ""},
+		{"decompressed size over limit", "gzip", encodeBody(t, EncodingGzip, bomb), http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Decompress(maxBytes)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Encoding") != "" {
+					t.Error("expected Content-Encoding to be removed")
+				}
+				body, err := io.ReadAll(r.Body)
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					return
+				}
+				w.Write(body)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			if tt.contentEncoding != "" {
+				req.Header.Set("Content-Encoding", tt.contentEncoding)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedBody != "" && rec.Body.String() != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, rec.Body.String())
+			}
+			if tt.expectedStatus == http.StatusUnsupportedMediaType && !strings.Contains(rec.Header().Get("Accept-Encoding"), "gzip") {
+				t.Errorf("expected Accept-Encoding listing supported codings, got %q", rec.Header().Get("Accept-Encoding"))
+			}
+		})
+	}
+}
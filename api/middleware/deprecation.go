@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeprecationConfig は非推奨APIバージョンの告知設定
+type DeprecationConfig struct {
+	// DeprecatedAt: 非推奨になった日時（RFC 9745 Deprecation ヘッダー）
+	DeprecatedAt time.Time
+	// Sunset: 提供終了予定日時（RFC 8594 Sunset ヘッダー）
+	Sunset time.Time
+	// Successor: 移行先のURLプレフィックス（例: /v2）。Linkヘッダーで案内する
+	Successor string
+}
+
+// Deprecation は非推奨バージョンのレスポンスに Deprecation / Sunset / Link ヘッダーを付与するミドルウェア
+func Deprecation(cfg DeprecationConfig) func(http.Handler) http.Handler {
+	deprecation := "@" + strconv.FormatInt(cfg.DeprecatedAt.Unix(), 10)
+	sunset := cfg.Sunset.UTC().Format(http.TimeFormat)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecation)
+			if !cfg.Sunset.IsZero() {
+				w.Header().Set("Sunset", sunset)
+			}
+			if cfg.Successor != "" {
+				w.Header().Add("Link", "<"+cfg.Successor+">; rel=\"successor-version\"")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeprecation(t *testing.T) {
+	handler := Deprecation(DeprecationConfig{
+		DeprecatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Sunset:       time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		Successor:    "/v2",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"Deprecation", "@1767225600"},
+		{"Sunset", "Fri, 01 Jan 2027 00:00:00 GMT"},
+		{"Link", `</v2>; rel="successor-version"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := rec.Header().Get(tt.header); got != tt.expected {
+				t.Errorf("header %s = %q, want %q", tt.header, got, tt.expected)
+			}
+		})
+	}
+}
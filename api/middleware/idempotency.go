@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"expvar"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"k6-practice/api/metrics"
+	"k6-practice/api/problem"
+)
+
+// IdempotencyKeyHeader はリトライを同一リクエストとして扱うためのヘッダー
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// MaxIdempotencyKeyLength は Idempotency-Key の最大長
+const MaxIdempotencyKeyLength = 255
+
+// IdempotencyConfig は冪等キーの設定
+type IdempotencyConfig struct {
+	// TTL: 最初のリクエストからレスポンスを再送する期間
+	TTL time.Duration
+	// MaxKeys: 保存するキーの上限（超えた場合は古いものから破棄、0は無制限）
+	MaxKeys int
+}
+
+// 冪等キーの統計（リトライストームのテストで再送・衝突の件数を確認する）
+var idempotencyStats = new(expvar.Map).Init()
+
+func init() {
+	metrics.Set("idempotency", idempotencyStats)
+}
+
+// IdempotencyStore は Idempotency-Key ごとに最初のレスポンスを保存し、リトライに再送する
+// 決済APIと同じく、同じキーで異なるボディは422、処理中の重複は409を返す
+// キーはクライアント（認証済みならユーザー、それ以外はIPアドレス）ごとに区別する
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // 作成順（TTLは一定なので先頭から期限切れになる）
+	ttl     time.Duration
+	maxKeys int
+}
+
+type idempotencyEntry struct {
+	key         string
+	fingerprint [sha256.Size]byte
+	created     time.Time
+	done        bool
+	status      int
+	header      http.Header
+	body        []byte
+}
+
+type idempotencyState int
+
+const (
+	idempotencyNew idempotencyState = iota
+	idempotencyReplay
+	idempotencyInFlight
+	idempotencyConflict
+)
+
+func NewIdempotencyStore(cfg IdempotencyConfig) *IdempotencyStore {
+	return &IdempotencyStore{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		ttl:     cfg.TTL,
+		maxKeys: cfg.MaxKeys,
+	}
+}
+
+// Middleware は Idempotency-Key 付きのリクエストを1回だけ処理する（キーがなければそのまま処理）
+func (s *IdempotencyStore) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !validIdempotencyKey(key) {
+			problem.Write(w, r, problem.CodeInvalidParameter,
+				"Idempotency-Key must be 1-"+strconv.Itoa(MaxIdempotencyKeyLength)+" printable ASCII characters")
+			return
+		}
+
+		// ボディの指紋を取るため先に読み込む（ハンドラーには読み直せるボディを渡す）
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				problem.Write(w, r, problem.CodeBodyTooLarge, "request body too large")
+				return
+			}
+			problem.Write(w, r, problem.CodeInvalidBody, "failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		entry, state := s.begin(idempotencyScope(r)+" "+key, requestFingerprint(r, body))
+		switch state {
+		case idempotencyReplay:
+			idempotencyStats.Add("replayed", 1)
+			for k, v := range entry.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(entry.status)
+			w.Write(entry.body)
+			return
+		case idempotencyConflict:
+			idempotencyStats.Add("conflicts", 1)
+			problem.Write(w, r, problem.CodeIdempotencyKeyReused,
+				"Idempotency-Key was already used for a different request")
+			return
+		case idempotencyInFlight:
+			idempotencyStats.Add("in_flight", 1)
+			w.Header().Set("Retry-After", "1")
+			problem.Write(w, r, problem.CodeIdempotencyKeyInUse,
+				"a request with the same Idempotency-Key is still being processed")
+			return
+		}
+
+		rec := newCaptureWriter(w)
+		// パニックした場合もキーを解放してリトライできるようにする
+		completed := false
+		defer func() {
+			if !completed {
+				s.release(entry)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+		completed = true
+
+		// 5xxは一時的な失敗として保存せず、リトライで再実行する
+		if rec.statusCode >= http.StatusInternalServerError {
+			s.release(entry)
+			return
+		}
+		s.complete(entry, rec)
+	})
+}
+
+// begin はキーの状態を返す。未使用のキーは処理中として登録する
+func (s *IdempotencyStore) begin(key string, fingerprint [sha256.Size]byte) (*idempotencyEntry, idempotencyState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	// 期限切れのキーを先頭から削除
+	for el := s.order.Front(); el != nil; el = s.order.Front() {
+		if now.Sub(el.Value.(*idempotencyEntry).created) <= s.ttl {
+			break
+		}
+		s.remove(el)
+	}
+
+	if el, ok := s.entries[key]; ok {
+		entry := el.Value.(*idempotencyEntry)
+		switch {
+		case entry.fingerprint != fingerprint:
+			return entry, idempotencyConflict
+		case !entry.done:
+			return entry, idempotencyInFlight
+		default:
+			return entry, idempotencyReplay
+		}
+	}
+
+	for s.maxKeys > 0 && len(s.entries) >= s.maxKeys {
+		idempotencyStats.Add("evicted", 1)
+		s.remove(s.order.Front())
+	}
+	entry := &idempotencyEntry{key: key, fingerprint: fingerprint, created: now}
+	s.entries[key] = s.order.PushBack(entry)
+	return entry, idempotencyNew
+}
+
+// complete は処理済みのレスポンスを保存する
+func (s *IdempotencyStore) complete(entry *idempotencyEntry, rec *captureWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idempotencyStats.Add("stored", 1)
+	entry.status = rec.statusCode
+	entry.header = rec.header
+	entry.body = rec.body.Bytes()
+	entry.done = true
+}
+
+// release は処理中のキーを削除する（破棄済み・再登録済みの場合は何もしない）
+func (s *IdempotencyStore) release(entry *idempotencyEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[entry.key]; ok && el.Value == entry {
+		s.remove(el)
+	}
+}
+
+func (s *IdempotencyStore) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.entries, el.Value.(*idempotencyEntry).key)
+}
+
+// validIdempotencyKey は印字可能なASCII文字だけのキーを許可する
+func validIdempotencyKey(key string) bool {
+	if len(key) > MaxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// idempotencyScope はキーを区別するクライアント（ポートは接続ごとに変わるため除く）
+func idempotencyScope(r *http.Request) string {
+	if claims := GetUserFromContext(r.Context()); claims != nil {
+		return "user:" + strconv.Itoa(claims.UserID)
+	}
+	ip := getClientIP(r)
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return "ip:" + ip
+}
+
+// requestFingerprint はメソッド・URL・ボディのハッシュ（別のエンドポイントでのキーの使い回しも検出する）
+func requestFingerprint(r *http.Request, body []byte) [sha256.Size]byte {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
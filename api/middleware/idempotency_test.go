@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// idempotencyRequest はキーとボディ付きのPOSTリクエストを作る
+func idempotencyRequest(key, body, remoteAddr string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	req.RemoteAddr = remoteAddr
+	return req
+}
+
+// countingHandler は呼び出し回数を数え、回数をボディに書く
+func countingHandler(calls *int32, status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/v1/users/4")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"call":` + strconv.Itoa(int(n)) + `}`))
+	})
+}
+
+func TestIdempotency(t *testing.T) {
+	type step struct {
+		key, body, remoteAddr string
+		expectedStatus        int
+		expectedBody          string
+		expectedReplayed      bool
+	}
+
+	tests := []struct {
+		name          string
+		status        int
+		steps         []step
+		expectedCalls int32
+	}{
+		{
+			name:   "without key every request is processed",
+			status: http.StatusCreated,
+			steps: []step{
+				{"", `{}`, "192.0.2.1:1000", http.StatusCreated, `{"call":1}`, false},
+				{"", `{}`, "192.0.2.1:1000", http.StatusCreated, `{"call":2}`, false},
+			},
+			expectedCalls: 2,
+		},
+		{
+			name:   "retry with same key is replayed",
+			status: http.StatusCreated,
+			steps: []step{
+				{"key-1", `{"name":"a"}`, "192.0.2.1:1000", http.StatusCreated, `{"call":1}`, false},
+				// 新しい接続（別のポート）からのリトライも同じクライアント
+				{"key-1", `{"name":"a"}`, "192.0.2.1:2000", http.StatusCreated, `{"call":1}`, true},
+			},
+			expectedCalls: 1,
+		},
+		{
+			name:   "same key with different body is rejected",
+			status: http.StatusCreated,
+			steps: []step{
+				{"key-1", `{"name":"a"}`, "192.0.2.1:1000", http.StatusCreated, `{"call":1}`, false},
+				{"key-1", `{"name":"b"}`, "192.0.2.1:1000", http.StatusUnprocessableEntity, "", false},
+			},
+			expectedCalls: 1,
+		},
+		{
+			name:   "keys are scoped to the client",
+			status: http.StatusCreated,
+			steps: []step{
+				{"key-1", `{}`, "192.0.2.1:1000", http.StatusCreated, `{"call":1}`, false},
+				{"key-1", `{}`, "192.0.2.2:1000", http.StatusCreated, `{"call":2}`, false},
+			},
+			expectedCalls: 2,
+		},
+		{
+			name:   "client errors are replayed",
+			status: http.StatusBadRequest,
+			steps: []step{
+				{"key-1", `{}`, "192.0.2.1:1000", http.StatusBadRequest, `{"call":1}`, false},
+				{"key-1", `{}`, "192.0.2.1:1000", http.StatusBadRequest, `{"call":1}`, true},
+			},
+			expectedCalls: 1,
+		},
+		{
+			name:   "server errors are retried",
+			status: http.StatusInternalServerError,
+			steps: []step{
+				{"key-1", `{}`, "192.0.2.1:1000", http.StatusInternalServerError, `{"call":1}`, false},
+				{"key-1", `{}`, "192.0.2.1:1000", http.StatusInternalServerError, `{"call":2}`, false},
+			},
+			expectedCalls: 2,
+		},
+		{
+			name:   "invalid key",
+			status: http.StatusCreated,
+			steps: []step{
+				{strings.Repeat("k", MaxIdempotencyKeyLength+1), `{}`, "192.0.2.1:1000", http.StatusBadRequest, "", false},
+				{"key\x7f", `{}`, "192.0.2.1:1000", http.StatusBadRequest, "", false},
+			},
+			expectedCalls: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			store := NewIdempotencyStore(IdempotencyConfig{TTL: time.Hour})
+			handler := store.Middleware(countingHandler(&calls, tt.status))
+
+			for i, s := range tt.steps {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, idempotencyRequest(s.key, s.body, s.remoteAddr))
+
+				if rec.Code != s.expectedStatus {
+					t.Fatalf("step %d: expected status %d, got %d", i, s.expectedStatus, rec.Code)
+				}
+				if s.expectedBody != "" && rec.Body.String() != s.expectedBody {
+					t.Errorf("step %d: expected body %s, got %s", i, s.expectedBody, rec.Body.String())
+				}
+				if replayed := rec.Header().Get("Idempotent-Replayed") == "true"; replayed != s.expectedReplayed {
+					t.Errorf("step %d: expected replayed %v, got %v", i, s.expectedReplayed, replayed)
+				}
+				if s.expectedReplayed && rec.Header().Get("Location") != "/v1/users/4" {
+					t.Errorf("step %d: expected handler headers to be replayed, got %v", i, rec.Header())
+				}
+			}
+
+			if calls != tt.expectedCalls {
+				t.Errorf("expected %d handler calls, got %d", tt.expectedCalls, calls)
+			}
+		})
+	}
+}
+
+func TestIdempotency_InFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	store := NewIdempotencyStore(IdempotencyConfig{TTL: time.Hour})
+	handler := store.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, idempotencyRequest("key-1", `{}`, "192.0.2.1:1000"))
+		done <- rec.Code
+	}()
+	<-started
+
+	// 最初のリクエストの処理中は409
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, idempotencyRequest("key-1", `{}`, "192.0.2.1:2000"))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected status %d while in flight, got %d", http.StatusConflict, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusCreated {
+		t.Errorf("expected first request to succeed, got %d", code)
+	}
+
+	// 完了後は再送
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, idempotencyRequest("key-1", `{}`, "192.0.2.1:2000"))
+	if rec.Code != http.StatusCreated || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("expected replayed %d, got %d (%v)", http.StatusCreated, rec.Code, rec.Header())
+	}
+}
+
+func TestIdempotency_Expiry(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           IdempotencyConfig
+		wait          time.Duration
+		keys          []string
+		expectedCalls int32
+	}{
+		{"within ttl", IdempotencyConfig{TTL: time.Hour}, 0, []string{"a", "a"}, 1},
+		{"after ttl", IdempotencyConfig{TTL: time.Millisecond}, 10 * time.Millisecond, []string{"a", "a"}, 2},
+		{"oldest key evicted", IdempotencyConfig{TTL: time.Hour, MaxKeys: 1}, 0, []string{"a", "b", "a"}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			handler := NewIdempotencyStore(tt.cfg).Middleware(countingHandler(&calls, http.StatusCreated))
+
+			for _, key := range tt.keys {
+				handler.ServeHTTP(httptest.NewRecorder(), idempotencyRequest(key, `{}`, "192.0.2.1:1000"))
+				time.Sleep(tt.wait)
+			}
+
+			if calls != tt.expectedCalls {
+				t.Errorf("expected %d handler calls, got %d", tt.expectedCalls, calls)
+			}
+		})
+	}
+}
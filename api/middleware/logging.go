@@ -1,11 +1,21 @@
 package middleware
 
 import (
+	"bufio"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"time"
+
+	"k6-practice/api/logging"
+	"k6-practice/api/metrics"
+	"k6-practice/api/requestid"
 )
 
+// ルートにマッチしなかったリクエストのルート名
+const unmatchedRoute = "unmatched"
+
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
@@ -16,23 +26,55 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Flush はストリーミングレスポンスのためにラップ先へ転送する
+func (rw *responseWriter) Flush() {
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Hijack はWebSocketなどのアップグレードでコネクションを引き渡す
+// （gorilla/websocketはResponseControllerではなく型アサーションで取得する）
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	rw.statusCode = http.StatusSwitchingProtocols
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+// Unwrap は http.ResponseController がラップ先のインターフェース（Hijackerなど）を使えるようにする
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func Logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		done := metrics.StartRequest()
+		defer done()
 
 		wrapped := &responseWriter{
 			ResponseWriter: w,
 			statusCode:     http.StatusOK,
 		}
 
+		// ルーティング後に NameRoute がルート名を書き込めるようにする
+		r, info := withRouteInfo(r)
+
 		next.ServeHTTP(wrapped, r)
 
+		duration := time.Since(start)
+		metrics.ObserveRequest(info.name, wrapped.statusCode, duration)
+
+		if !logging.Enabled(slog.LevelInfo) {
+			return
+		}
 		log.Printf(
-			"%s %s %d %s",
+			"%s %s %d %s route=%s proto=%s request_id=%s trace_id=%s",
 			r.Method,
 			r.URL.Path,
 			wrapped.statusCode,
-			time.Since(start),
+			duration,
+			info.name,
+			r.Proto,
+			requestid.FromContext(r.Context()),
+			TraceID(r),
 		)
 	})
 }
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"k6-practice/api/openapi"
+	"k6-practice/api/problem"
+)
+
+// OpenAPIValidationConfig はスキーマ検証ミドルウェアの設定
+type OpenAPIValidationConfig struct {
+	// Doc: スキーマの参照（$ref）を解決するドキュメント
+	Doc *openapi.Document
+	// Operation: ルートのオペレーション（ルートの登録時に決まるので、リクエストごとにパスを照合しない）
+	Operation *openapi.Operation
+	// ValidateResponses: trueの場合、レスポンスもスキーマ検証して違反をログに出す（デバッグ用）
+	ValidateResponses bool
+}
+
+// OpenAPIValidation はルートのオペレーションのスキーマでリクエストを検証するミドルウェア
+// A03:2021 - Injection 対策: パスパラメータ・クエリ・JSONボディの型と制約を検証し、
+// 未定義のフィールドを拒否する
+// パスパラメータは ServeMux のパターンで取り出した値（r.PathValue）を使う
+func OpenAPIValidation(cfg OpenAPIValidationConfig) func(http.Handler) http.Handler {
+	v := &openapi.Validator{
+		Doc:     cfg.Doc,
+		Formats: map[string]func(string) bool{"email": ValidateEmail},
+	}
+	op := cfg.Operation
+	var pathParams []string
+	if op != nil {
+		for _, p := range op.Parameters {
+			if p.In == "path" {
+				pathParams = append(pathParams, p.Name)
+			}
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		if op == nil {
+			// ドキュメントにないルートはハンドラーに任せる
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var params map[string]string
+			if len(pathParams) > 0 {
+				params = make(map[string]string, len(pathParams))
+				for _, name := range pathParams {
+					params[name] = r.PathValue(name)
+				}
+			}
+
+			violations := v.ValidateParams(op, params, r.URL.Query())
+
+			if op.RequestBody != nil {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					var maxErr *http.MaxBytesError
+					if errors.As(err, &maxErr) {
+						problem.Write(w, r, problem.CodeBodyTooLarge, "request body too large")
+						return
+					}
+					body = nil
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+
+				if len(bytes.TrimSpace(body)) == 0 {
+					if op.RequestBody.Required {
+						violations = append(violations, openapi.Violation{In: "body", Reason: "is required"})
+					}
+				} else if mt, ok := op.RequestBody.Content["application/json"]; ok {
+					violations = append(violations, v.ValidateBody("body", mt.Schema, body)...)
+				}
+			}
+
+			if len(violations) > 0 {
+				LogSecurityEvent(EventInvalidInput, r, fmt.Sprintf("schema validation failed: %d violation(s)", len(violations)))
+				p := problem.New(problem.CodeValidationFailed, fmt.Sprintf("%d violation(s) of the API schema", len(violations)))
+				p.Errors = violations
+				problem.WriteProblem(w, r, p)
+				return
+			}
+
+			if !cfg.ValidateResponses {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &bodyRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			for _, violation := range validateResponse(v, op, rec.statusCode, rec.body.Bytes()) {
+				log.Printf("[CONTRACT] method=%s path=%s status=%d field=%q reason=%q",
+					r.Method, r.URL.Path, rec.statusCode, violation.Field, violation.Reason)
+			}
+		})
+	}
+}
+
+// validateResponse はレスポンスがドキュメントと一致するか検証
+func validateResponse(v *openapi.Validator, op *openapi.Operation, status int, body []byte) []openapi.Violation {
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		return []openapi.Violation{{In: "response", Reason: "undocumented status code"}}
+	}
+	for _, mt := range resp.Content {
+		if mt.Schema != nil {
+			return v.ValidateBody("response", mt.Schema, body)
+		}
+	}
+	return nil
+}
+
+// bodyRecorder はレスポンスを透過しつつステータスとボディを記録する
+type bodyRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (br *bodyRecorder) WriteHeader(code int) {
+	br.statusCode = code
+	br.ResponseWriter.WriteHeader(code)
+}
+
+func (br *bodyRecorder) Write(b []byte) (int, error) {
+	br.body.Write(b)
+	return br.ResponseWriter.Write(b)
+}
+
+func (br *bodyRecorder) Flush() {
+	http.NewResponseController(br.ResponseWriter).Flush()
+}
+
+func (br *bodyRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	br.statusCode = http.StatusSwitchingProtocols
+	return http.NewResponseController(br.ResponseWriter).Hijack()
+}
+
+func (br *bodyRecorder) Unwrap() http.ResponseWriter {
+	return br.ResponseWriter
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k6-practice/api/openapi"
+	"k6-practice/api/problem"
+)
+
+type testUserRequest struct {
+	Name  string `json:"name" openapi:"required,minLength=1,maxLength=100"`
+	Email string `json:"email" openapi:"required,format=email"`
+}
+
+func setupValidationDoc() *openapi.Document {
+	doc := openapi.New("test", "1.0.0")
+	doc.Components.Schemas["UserRequest"] = openapi.SchemaOf(testUserRequest{})
+	doc.AddOperation(http.MethodPost, "/users", &openapi.Operation{
+		OperationID: "createUser",
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]*openapi.MediaType{"application/json": {Schema: openapi.Ref("UserRequest")}},
+		},
+		Responses: map[string]*openapi.Response{"201": {Description: "Created"}},
+	})
+	doc.AddOperation(http.MethodGet, "/users/{id}", &openapi.Operation{
+		OperationID: "getUser",
+		Parameters: []*openapi.Parameter{
+			{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: "integer", Minimum: openapi.Float(1)}},
+			{Name: "verbose", In: "query", Schema: &openapi.Schema{Type: "boolean"}},
+		},
+		Responses: map[string]*openapi.Response{"200": {Description: "OK"}},
+	})
+	return doc
+}
+
+// validationHandler はルーターと同じく、ドキュメントのオペレーションごとに検証ミドルウェアを付けて ServeMux に登録する
+func validationHandler(doc *openapi.Document, next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	for path, item := range doc.Paths {
+		for method, op := range item.Operations() {
+			mux.Handle(method+" "+path, OpenAPIValidation(OpenAPIValidationConfig{Doc: doc, Operation: op})(next))
+		}
+	}
+	// ドキュメントにないルートはオペレーションなし
+	mux.Handle("/", OpenAPIValidation(OpenAPIValidationConfig{Doc: doc})(next))
+	return mux
+}
+
+func TestOpenAPIValidation(t *testing.T) {
+	called := false
+	handler := validationHandler(setupValidationDoc(),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedErrors int
+	}{
+		{"valid body passes", http.MethodPost, "/users", `{"name":"Test","email":"test@example.com"}`, http.StatusOK, 0},
+		{"unknown field is rejected", http.MethodPost, "/users", `{"name":"Test","email":"test@example.com","admin":true}`, http.StatusBadRequest, 1},
+		{"wrong type is rejected", http.MethodPost, "/users", `{"name":123,"email":"test@example.com"}`, http.StatusBadRequest, 1},
+		{"every violation is listed", http.MethodPost, "/users", `{"name":"","email":"invalid","extra":1}`, http.StatusBadRequest, 3},
+		{"missing body is rejected", http.MethodPost, "/users", ``, http.StatusBadRequest, 1},
+		{"invalid JSON is rejected", http.MethodPost, "/users", `{invalid`, http.StatusBadRequest, 1},
+		{"valid path param passes", http.MethodGet, "/users/1", ``, http.StatusOK, 0},
+		{"non-integer path param is rejected", http.MethodGet, "/users/abc", ``, http.StatusBadRequest, 1},
+		{"out of range path param is rejected", http.MethodGet, "/users/0", ``, http.StatusBadRequest, 1},
+		{"invalid query param is rejected", http.MethodGet, "/users/1?verbose=maybe", ``, http.StatusBadRequest, 1},
+		{"undocumented path passes through", http.MethodGet, "/unknown", ``, http.StatusOK, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = false
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader([]byte(tt.body)))
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedStatus == http.StatusOK {
+				if !called {
+					t.Error("expected next handler to be called")
+				}
+				return
+			}
+
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("expected Content-Type application/problem+json, got %q", ct)
+			}
+			var p problem.Problem
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if p.Code != problem.CodeValidationFailed {
+				t.Errorf("expected code %s, got %s", problem.CodeValidationFailed, p.Code)
+			}
+			if len(p.Errors) != tt.expectedErrors {
+				t.Errorf("expected %d violations, got %d: %+v", tt.expectedErrors, len(p.Errors), p.Errors)
+			}
+		})
+	}
+}
+
+func TestOpenAPIValidation_BodyIsRestored(t *testing.T) {
+	var received testUserRequest
+	handler := validationHandler(setupValidationDoc(),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&received)
+		}),
+	)
+
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader([]byte(`{"name":"Test","email":"test@example.com"}`)))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if received.Name != "Test" {
+		t.Errorf("expected handler to read name 'Test', got %q", received.Name)
+	}
+}
@@ -1,9 +1,13 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
+
+	"k6-practice/api/problem"
 )
 
 // RateLimiter はIPアドレスベースのレート制限を実装
@@ -13,6 +17,8 @@ type RateLimiter struct {
 	requests map[string]*clientInfo
 	limit    int           // 許可するリクエスト数
 	window   time.Duration // 時間窓
+	// APIキーを確認する認証方式（ExemptAPIKeys）
+	authenticators []Authenticator
 }
 
 type clientInfo struct {
@@ -31,6 +37,13 @@ func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
 	return rl
 }
 
+// ExemptAPIKeys はAPIキーで認証できたリクエストをIPごとの制限から外し、キーごとの上限に任せる
+// authenticators はルートの NewAuth と同じものを渡す（認証の結果は後段で再利用する）
+// 無効なキーはIPごとに制限する。サーバーを起動する前に呼ぶ
+func (rl *RateLimiter) ExemptAPIKeys(authenticators ...Authenticator) {
+	rl.authenticators = authenticators
+}
+
 func (rl *RateLimiter) cleanup() {
 	ticker := time.NewTicker(rl.window)
 	for range ticker.C {
@@ -73,15 +86,100 @@ func (rl *RateLimiter) Allow(ip string) bool {
 	return true
 }
 
+// RateLimitBucket はクライアントごとの時間窓の状態（管理用APIで参照・変更する）
+type RateLimitBucket struct {
+	Client    string    `json:"client"`
+	Count     int       `json:"count"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+func (rl *RateLimiter) bucket(client string, info *clientInfo) RateLimitBucket {
+	return RateLimitBucket{
+		Client:    client,
+		Count:     info.count,
+		Limit:     rl.limit,
+		Remaining: max(rl.limit-info.count, 0),
+		ResetAt:   info.firstSeen.Add(rl.window),
+	}
+}
+
+// Buckets は時間窓が有効なクライアントの一覧
+// クライアントはレート制限のキー（X-Forwarded-For、X-Real-IP、またはRemoteAddr）
+func (rl *RateLimiter) Buckets() []RateLimitBucket {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	now := time.Now()
+	buckets := make([]RateLimitBucket, 0, len(rl.requests))
+	for client, info := range rl.requests {
+		if now.Sub(info.firstSeen) <= rl.window {
+			buckets = append(buckets, rl.bucket(client, info))
+		}
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Client < buckets[j].Client })
+	return buckets
+}
+
+// Bucket はクライアントの状態（時間窓が過ぎていれば false）
+func (rl *RateLimiter) Bucket(client string) (RateLimitBucket, bool) {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	info, exists := rl.requests[client]
+	if !exists || time.Since(info.firstSeen) > rl.window {
+		return RateLimitBucket{}, false
+	}
+	return rl.bucket(client, info), true
+}
+
+// SetCount はクライアントのリクエスト数を設定し、時間窓を今から始める
+// limit 以上にすると時間窓が終わるまで拒否し、0にすると制限をリセットする
+func (rl *RateLimiter) SetCount(client string, count int) RateLimitBucket {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	info := &clientInfo{count: count, firstSeen: time.Now()}
+	rl.requests[client] = info
+	return rl.bucket(client, info)
+}
+
+// Reset はクライアントの時間窓を削除する（次のリクエストから数え直す）
+func (rl *RateLimiter) Reset(client string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	_, exists := rl.requests[client]
+	delete(rl.requests, client)
+	return exists
+}
+
+// ResetAll はすべてのクライアントの時間窓を削除する
+func (rl *RateLimiter) ResetAll() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.requests = make(map[string]*clientInfo)
+}
+
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(rl.authenticators) > 0 {
+			var claims *Claims
+			r, claims = preauthenticate(r, rl.authenticators)
+			if claims != nil && claims.AuthMethod == AuthMethodAPIKey {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
 		ip := getClientIP(r)
 
 		if !rl.Allow(ip) {
-			w.Header().Set("Content-Type", "application/json")
+			LogSecurityEvent(EventRateLimitHit, r, fmt.Sprintf("limit %d per %s exceeded", rl.limit, rl.window))
 			w.Header().Set("Retry-After", "60")
-			w.WriteHeader(http.StatusTooManyRequests)
-			w.Write([]byte(`{"error": "rate limit exceeded", "retry_after": 60}`))
+			problem.Write(w, r, problem.CodeRateLimited, "rate limit exceeded, retry after 60 seconds")
 			return
 		}
 
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Buckets(t *testing.T) {
+	rl := NewRateLimiter(3, time.Minute)
+	rl.Allow("192.0.2.1")
+	rl.Allow("192.0.2.1")
+	rl.Allow("192.0.2.2")
+
+	buckets := rl.Buckets()
+	if len(buckets) != 2 || buckets[0].Client != "192.0.2.1" || buckets[0].Count != 2 || buckets[0].Remaining != 1 {
+		t.Fatalf("unexpected buckets %+v", buckets)
+	}
+
+	tests := []struct {
+		name     string
+		apply    func()
+		expected bool
+	}{
+		{"within the limit", func() {}, true},
+		{"count set to the limit blocks", func() { rl.SetCount("192.0.2.1", 3) }, false},
+		{"reset allows again", func() { rl.Reset("192.0.2.1") }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.apply()
+			if got := rl.Allow("192.0.2.1"); got != tt.expected {
+				t.Errorf("expected allow %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	if _, ok := rl.Bucket("198.51.100.1"); ok {
+		t.Error("expected no bucket for an unseen client")
+	}
+}
+
+func TestRateLimiter_ExemptAPIKeys(t *testing.T) {
+	apiKey := AuthenticatorFunc(func(r *http.Request) (*Claims, error) {
+		switch r.Header.Get("X-API-Key") {
+		case "":
+			return nil, ErrNoCredentials
+		case "good":
+			return &Claims{UserID: 1, AuthMethod: AuthMethodAPIKey}, nil
+		default:
+			return nil, ErrInvalidAPIKey
+		}
+	})
+	rl := NewRateLimiter(1, time.Minute)
+	rl.ExemptAPIKeys(JWTAuthenticator, apiKey)
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		key            string
+		expectedStatus int
+	}{
+		{"first anonymous request", "", http.StatusOK},
+		{"valid key is limited per key instead", "good", http.StatusOK},
+		{"valid key again", "good", http.StatusOK},
+		{"invalid key is limited per IP", "bad", http.StatusTooManyRequests},
+		{"anonymous over the limit", "", http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v2/users", nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
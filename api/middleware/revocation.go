@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTokenRevoked は失効させたトークン
+var ErrTokenRevoked = errors.New("token revoked")
+
+// TokenRevocations は失効させたトークンの一覧
+// トークン単位（jti）と、ユーザー単位（指定時刻以前に発行したトークンすべて）、世代単位（RevokeAll 以前に発行したトークンすべて）で失効させる
+type TokenRevocations struct {
+	mu sync.RWMutex
+	// epoch は RevokeAll のたびに増やす世代（発行時の世代が古いトークンは失効）
+	epoch int64
+	// tokens は jti → トークンの有効期限（期限を過ぎれば署名の検証で拒否されるので一覧から消す）
+	tokens map[string]time.Time
+	// users はユーザーID → この時刻以前に発行したトークンを失効
+	users map[int]time.Time
+}
+
+func NewTokenRevocations() *TokenRevocations {
+	return &TokenRevocations{
+		tokens: make(map[string]time.Time),
+		users:  make(map[int]time.Time),
+	}
+}
+
+// Revocations はトークンの検証（ParseToken）で参照する失効の一覧
+var Revocations = NewTokenRevocations()
+
+// RevokeToken は jti のトークンを有効期限まで失効させる
+func (rv *TokenRevocations) RevokeToken(jti string, expiresAt time.Time) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range rv.tokens {
+		if now.After(exp) {
+			delete(rv.tokens, id)
+		}
+	}
+	rv.tokens[jti] = expiresAt
+}
+
+// RevokeUser はユーザーが at 以前に発行したトークンを失効させる
+// 発行時刻は秒単位のため、at と同じ秒に発行したトークンも失効する
+func (rv *TokenRevocations) RevokeUser(userID int, at time.Time) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.users[userID] = at
+}
+
+// Epoch は発行するトークンに含める世代
+func (rv *TokenRevocations) Epoch() int64 {
+	rv.mu.RLock()
+	defer rv.mu.RUnlock()
+	return rv.epoch
+}
+
+// RevokeAll はこれまでに発行したトークンをすべて失効させる（ストアの初期化でユーザーIDを振り直す場合）
+// 発行時刻ではなく世代で比べるため、直後に同じ秒で発行したトークンは失効しない
+func (rv *TokenRevocations) RevokeAll() {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+
+	rv.epoch++
+	// 以前の世代のトークンはすべて失効するので、トークン単位・ユーザー単位の一覧は不要になる
+	rv.tokens = make(map[string]time.Time)
+	rv.users = make(map[int]time.Time)
+}
+
+// Revoked は claims のトークンが失効しているか
+func (rv *TokenRevocations) Revoked(claims *Claims) bool {
+	rv.mu.RLock()
+	defer rv.mu.RUnlock()
+
+	if claims.Epoch < rv.epoch {
+		return true
+	}
+	if claims.ID != "" {
+		if _, ok := rv.tokens[claims.ID]; ok {
+			return true
+		}
+	}
+	if at, ok := rv.users[claims.UserID]; ok {
+		return claims.IssuedAt == nil || !claims.IssuedAt.Time.After(at.Truncate(time.Second))
+	}
+	return false
+}
+
+// RevocationSummary は失効の一覧の概要
+type RevocationSummary struct {
+	Epoch  int64             `json:"epoch"`
+	Tokens int               `json:"tokens"`
+	Users  map[int]time.Time `json:"users"`
+}
+
+// Summary は失効させたトークン数とユーザーごとの失効時刻
+func (rv *TokenRevocations) Summary() RevocationSummary {
+	rv.mu.RLock()
+	defer rv.mu.RUnlock()
+
+	users := make(map[int]time.Time, len(rv.users))
+	for id, at := range rv.users {
+		users[id] = at
+	}
+	return RevocationSummary{Epoch: rv.epoch, Tokens: len(rv.tokens), Users: users}
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokenRevocations_Revoked(t *testing.T) {
+	issued := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	claims := func(jti string, userID int, iat time.Time) *Claims {
+		return &Claims{UserID: userID, RegisteredClaims: jwt.RegisteredClaims{ID: jti, IssuedAt: jwt.NewNumericDate(iat)}}
+	}
+
+	rv := NewTokenRevocations()
+	rv.RevokeToken("revoked-jti", time.Now().Add(time.Hour))
+	rv.RevokeUser(2, issued.Add(500*time.Millisecond))
+
+	tests := []struct {
+		name     string
+		claims   *Claims
+		expected bool
+	}{
+		{"other token", claims("other-jti", 1, issued), false},
+		{"revoked jti", claims("revoked-jti", 1, issued), true},
+		{"issued before user revocation", claims("a", 2, issued.Add(-time.Minute)), true},
+		{"issued in the same second", claims("b", 2, issued), true},
+		{"issued after user revocation", claims("c", 2, issued.Add(time.Second)), false},
+		{"other user", claims("d", 3, issued.Add(-time.Minute)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rv.Revoked(tt.claims); got != tt.expected {
+				t.Errorf("expected revoked %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTokenRevocations_RevokeAll(t *testing.T) {
+	rv := NewTokenRevocations()
+	rv.RevokeToken("revoked-jti", time.Now().Add(time.Hour))
+	before := &Claims{UserID: 1, Epoch: rv.Epoch(), RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(time.Now())}}
+
+	rv.RevokeAll()
+	// 同じ秒に発行したトークンでも、世代が新しければ失効しない
+	after := &Claims{UserID: 1, Epoch: rv.Epoch(), RegisteredClaims: jwt.RegisteredClaims{IssuedAt: before.IssuedAt}}
+
+	if !rv.Revoked(before) {
+		t.Error("expected a token from the previous epoch to be revoked")
+	}
+	if rv.Revoked(after) {
+		t.Error("expected a token from the current epoch to stay valid")
+	}
+	if s := rv.Summary(); s.Epoch != 1 || s.Tokens != 0 {
+		t.Errorf("expected the per-token revocations to be replaced by the epoch, got %+v", s)
+	}
+}
+
+func TestTokenRevocations_DropsExpiredTokens(t *testing.T) {
+	rv := NewTokenRevocations()
+	rv.RevokeToken("expired", time.Now().Add(-time.Minute))
+	rv.RevokeToken("active", time.Now().Add(time.Hour))
+
+	if got := rv.Summary().Tokens; got != 1 {
+		t.Errorf("expected expired revocations to be dropped, got %d tokens", got)
+	}
+}
+
+func TestAuth_RevokedToken(t *testing.T) {
+	// 他のテストに影響しないよう、専用のユーザーIDで失効させる
+	const userID = 9001
+	token := generateTestToken(userID, "revoked@example.com", false)
+	Revocations.RevokeUser(userID, time.Now())
+
+	if _, err := ParseToken(token); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected ErrTokenRevoked, got %v", err)
+	}
+
+	handler := Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+const routeContextKey contextKey = "route"
+
+// routeInfo はマッチしたルートの情報
+// Tracing・Logging が外側で作成し、ルーティング後に NameRoute が名前を書き込む
+type routeInfo struct {
+	name string
+}
+
+// NameRoute はリクエストにルート名を記録するミドルウェアを返す
+// ルート名はアクセスログとメトリクスのラベルに使われる
+func NameRoute(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if info, ok := r.Context().Value(routeContextKey).(*routeInfo); ok {
+				info.name = name
+			} else {
+				r = r.WithContext(context.WithValue(r.Context(), routeContextKey, &routeInfo{name: name}))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// withRouteInfo はルート情報をコンテキストに用意する（外側のミドルウェアが用意済みならそれを使う）
+func withRouteInfo(r *http.Request) (*http.Request, *routeInfo) {
+	if info, ok := r.Context().Value(routeContextKey).(*routeInfo); ok {
+		return r, info
+	}
+	info := &routeInfo{name: unmatchedRoute}
+	return r.WithContext(context.WithValue(r.Context(), routeContextKey, info)), info
+}
+
+// RouteName はマッチしたルート名を返す（ルーティング前や未マッチの場合は空文字）
+func RouteName(ctx context.Context) string {
+	if info, ok := ctx.Value(routeContextKey).(*routeInfo); ok {
+		return info.name
+	}
+	return ""
+}
@@ -27,8 +27,10 @@ func SecurityHeaders(next http.Handler) http.Handler {
 		w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, private")
 		w.Header().Set("Pragma", "no-cache")
 
-		// HTTPS強制（本番環境用）
-		// w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		// HTTPS強制（TLS接続時のみ。平文のレスポンスに付けてもブラウザは無視する）
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		}
 
 		// サーバー情報の隠蔽
 		w.Header().Set("X-Powered-By", "")
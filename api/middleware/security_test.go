@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"crypto/tls"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -39,3 +40,34 @@ func TestSecurityHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestSecurityHeaders_HSTS(t *testing.T) {
+	handler := SecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		tls      bool
+		expected string
+	}{
+		{"plaintext request has no HSTS", false, ""},
+		{"TLS request has HSTS", true, "max-age=31536000; includeSubDomains"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Strict-Transport-Security"); got != tt.expected {
+				t.Errorf("Strict-Transport-Security = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -1,9 +1,14 @@
 package middleware
 
 import (
-	"log"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
 	"time"
+
+	"k6-practice/api/requestid"
+	"k6-practice/api/security"
 )
 
 // SecurityEvent はセキュリティイベントの種類
@@ -17,39 +22,109 @@ const (
 	EventInvalidInput    SecurityEvent = "INVALID_INPUT"
 	EventUnauthorized    SecurityEvent = "UNAUTHORIZED"
 	EventSuspiciousInput SecurityEvent = "SUSPICIOUS_INPUT"
+	EventAccountLocked   SecurityEvent = "ACCOUNT_LOCKED"
+	EventMFAEnabled      SecurityEvent = "MFA_ENABLED"
+	EventAPIKeyCreated   SecurityEvent = "API_KEY_CREATED"
+	EventAPIKeyRevoked   SecurityEvent = "API_KEY_REVOKED"
 )
 
-// SecurityLogger はセキュリティイベントをログに記録
+// SecurityLogger はセキュリティイベントを security.Monitor に記録
 // A09:2021 - Security Logging and Monitoring Failures 対策
 type SecurityLogger struct {
 	enabled bool
+	monitor *security.Monitor
 }
 
-func NewSecurityLogger(enabled bool) *SecurityLogger {
-	return &SecurityLogger{enabled: enabled}
+func NewSecurityLogger(enabled bool, monitor *security.Monitor) *SecurityLogger {
+	return &SecurityLogger{enabled: enabled, monitor: monitor}
 }
 
+// Log はHTTPリクエストのセキュリティイベントを記録する
 func (sl *SecurityLogger) Log(event SecurityEvent, r *http.Request, details string) {
 	if !sl.enabled {
 		return
 	}
 
+	e := security.Event{
+		Time:      time.Now(),
+		Type:      string(event),
+		IP:        ClientIP(r),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		UserAgent: r.Header.Get("User-Agent"),
+		RequestID: requestid.FromContext(r.Context()),
+		Details:   details,
+	}
+	if claims := GetUserFromContext(r.Context()); claims != nil {
+		e.UserID = claims.UserID
+	}
+	sl.monitor.Record(e)
+}
+
+// Record はHTTP以外（gRPCなど）のセキュリティイベントを記録する
+func (sl *SecurityLogger) Record(e security.Event) {
+	if !sl.enabled {
+		return
+	}
+	sl.monitor.Record(e)
+}
+
+// Monitor は記録先の security.Monitor
+func (sl *SecurityLogger) Monitor() *security.Monitor {
+	return sl.monitor
+}
+
+// ClientIP はクライアントのIPアドレス（IPごとに集計できるようポートを除く）
+func ClientIP(r *http.Request) string {
 	ip := getClientIP(r)
-	userAgent := r.Header.Get("User-Agent")
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		return host
+	}
+	return ip
+}
+
+// TrustedClientIP はRemoteAddrのIPアドレス（ポートを除く）
+// RemoteAddrが trusted のプロキシの場合だけ X-Forwarded-For を右から見て、trusted でない最初のアドレスを使う
+// （クライアントが付けた X-Forwarded-For で偽装できないようにする）
+func TrustedClientIP(r *http.Request, trusted []netip.Prefix) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if !trustedProxy(ip, trusted) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !trustedProxy(hop, trusted) {
+			return hop
+		}
+		ip = hop
+	}
+	return ip
+}
 
-	log.Printf("[SECURITY] event=%s ip=%s method=%s path=%s user_agent=%q details=%q timestamp=%s",
-		event,
-		ip,
-		r.Method,
-		r.URL.Path,
-		userAgent,
-		details,
-		time.Now().Format(time.RFC3339),
-	)
+func trustedProxy(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
 }
 
 // Global security logger instance
-var SecLogger = NewSecurityLogger(true)
+// 既定は標準のログだけに出力する（server がSECURITY_*の設定で出力先を追加した Monitor に置き換える）
+var SecLogger = NewSecurityLogger(true, security.NewMonitor(security.Config{}, security.LogSink{}))
 
 // LogSecurityEvent はセキュリティイベントをログに記録するヘルパー
 func LogSecurityEvent(event SecurityEvent, r *http.Request, details string) {
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k6-practice/api/models"
+	"k6-practice/api/requestid"
+	"k6-practice/api/security"
+)
+
+// recordSecurityEvents はテストの間だけ SecLogger をメモリに保持する Monitor に差し替える
+func recordSecurityEvents(t *testing.T) *security.Monitor {
+	t.Helper()
+	monitor := security.NewMonitor(security.Config{Buffer: 100})
+	prev := SecLogger
+	SecLogger = NewSecurityLogger(true, monitor)
+	t.Cleanup(func() { SecLogger = prev })
+	return monitor
+}
+
+func TestSecurityLogger_Log(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		userID     int
+		expectedIP string
+	}{
+		{"remote addr without port", "192.0.2.1:54321", "", 0, "192.0.2.1"},
+		{"ipv6 remote addr", "[2001:db8::1]:443", "", 0, "2001:db8::1"},
+		{"forwarded for", "192.0.2.1:54321", "198.51.100.7", 0, "198.51.100.7"},
+		{"authenticated user", "192.0.2.1:54321", "", 42, "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := recordSecurityEvents(t)
+			req := httptest.NewRequest(http.MethodPost, "/users", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("User-Agent", "k6/0.50")
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			ctx := requestid.NewContext(req.Context(), "req-1")
+			if tt.userID != 0 {
+				ctx = NewContext(ctx, &models.Claims{UserID: tt.userID})
+			}
+
+			LogSecurityEvent(EventInvalidInput, req.WithContext(ctx), "invalid name format")
+
+			events := monitor.Query(security.Query{})
+			if len(events) != 1 {
+				t.Fatalf("expected 1 event, got %d", len(events))
+			}
+			e := events[0]
+			if e.Type != "INVALID_INPUT" || e.IP != tt.expectedIP || e.Method != http.MethodPost || e.Path != "/users" {
+				t.Errorf("unexpected event %+v", e)
+			}
+			if e.UserAgent != "k6/0.50" || e.RequestID != "req-1" || e.UserID != tt.userID || e.Details != "invalid name format" {
+				t.Errorf("unexpected event %+v", e)
+			}
+		})
+	}
+}
+
+func TestSecurityLogger_Disabled(t *testing.T) {
+	monitor := security.NewMonitor(security.Config{Buffer: 10})
+	sl := NewSecurityLogger(false, monitor)
+
+	sl.Log(EventAuthFailure, httptest.NewRequest(http.MethodGet, "/", nil), "")
+	sl.Record(security.Event{Type: string(EventAuthFailure)})
+
+	if got := len(monitor.Query(security.Query{})); got != 0 {
+		t.Errorf("expected no events, got %d", got)
+	}
+}
+
+func TestSecurityEvents_Emitted(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		requests int
+		setup    func(r *http.Request)
+		expected SecurityEvent
+	}{
+		{
+			name:     "rate limit hit",
+			handler:  NewRateLimiter(1, time.Minute).Middleware(ok),
+			requests: 2,
+			expected: EventRateLimitHit,
+		},
+		{
+			name:     "csrf invalid origin",
+			handler:  CSRFProtectionSimple([]string{"http://localhost:8080"})(ok),
+			requests: 1,
+			setup:    func(r *http.Request) { r.Header.Set("Origin", "http://evil.example") },
+			expected: EventCSRFBlocked,
+		},
+		{
+			name:     "csrf missing X-Requested-With",
+			handler:  CSRFProtectionSimple([]string{"http://localhost:8080"})(ok),
+			requests: 1,
+			setup:    func(r *http.Request) { r.Header.Set("Origin", "http://localhost:8080") },
+			expected: EventCSRFBlocked,
+		},
+		{
+			name:     "missing authorization",
+			handler:  Auth(ok),
+			requests: 1,
+			expected: EventUnauthorized,
+		},
+		{
+			name:     "invalid token",
+			handler:  Auth(ok),
+			requests: 1,
+			setup:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer invalid") },
+			expected: EventAuthFailure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := recordSecurityEvents(t)
+			for i := 0; i < tt.requests; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/users", nil)
+				if tt.setup != nil {
+					tt.setup(req)
+				}
+				tt.handler.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			events := monitor.Query(security.Query{})
+			if len(events) != 1 || events[0].Type != string(tt.expected) {
+				t.Errorf("expected one %s event, got %+v", tt.expected, events)
+			}
+		})
+	}
+}
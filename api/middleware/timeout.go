@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"time"
+
+	"k6-practice/api/metrics"
+	"k6-practice/api/problem"
+)
+
+// タイムアウトの統計（ルート名ごと）
+var (
+	timedOutRequests  = new(expvar.Map).Init()
+	abandonedRequests = new(expvar.Map).Init()
+)
+
+func init() {
+	m := new(expvar.Map).Init()
+	m.Set("timed_out", timedOutRequests)
+	m.Set("abandoned", abandonedRequests)
+	metrics.Set("timeouts", m)
+}
+
+// Timeout はルートごとの処理時間の上限を設定するミドルウェア
+// ハンドラーは r.Context() の終了を見て処理を打ち切る（強制的には止めない）
+// 期限切れでハンドラーが何も書かずに戻った場合は503を返す
+// A04:2021 - Insecure Design 対策（クライアントが待っていない処理でgoroutineを占有しない）
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if d <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{ResponseWriter: w}
+			next.ServeHTTP(tw, r.WithContext(ctx))
+
+			switch {
+			case r.Context().Err() != nil:
+				// クライアントが先に切断した（k6のタイムアウトなど）
+				abandonedRequests.Add(RouteName(r.Context()), 1)
+			case errors.Is(ctx.Err(), context.DeadlineExceeded):
+				timedOutRequests.Add(RouteName(r.Context()), 1)
+				if !tw.wroteHeader {
+					problem.Write(w, r, problem.CodeTimeout, "request did not complete within "+d.String())
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter はハンドラーがレスポンスを書き始めたかを記録する
+type timeoutWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.wroteHeader = true
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.wroteHeader = true
+	return tw.ResponseWriter.Write(b)
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.wroteHeader = true
+	http.NewResponseController(tw.ResponseWriter).Flush()
+}
+
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k6-practice/api/problem"
+)
+
+// waitHandler はdの間待つ（先にコンテキストが終了したら何も書かずに戻る）
+func waitHandler(d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(d):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name           string
+		timeout        time.Duration
+		handler        http.Handler
+		expectedStatus int
+	}{
+		{"completes in time", time.Second, waitHandler(0), http.StatusOK},
+		{"deadline exceeded", 10 * time.Millisecond, waitHandler(time.Minute), http.StatusServiceUnavailable},
+		{"handler response is kept", 10 * time.Millisecond, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			problem.Write(w, r, problem.CodeUpstreamTimeout, "upstream timed out")
+		}), http.StatusGatewayTimeout},
+		{"zero disables the timeout", 0, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.Context().Deadline(); ok {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+			rec := httptest.NewRecorder()
+
+			start := time.Now()
+			Timeout(tt.timeout)(tt.handler).ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("expected handler to stop at the deadline, took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestTimeout_Abandoned(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/v1/users", nil).WithContext(ctx)
+	req = req.WithContext(context.WithValue(req.Context(), routeContextKey, &routeInfo{name: "test.abandoned"}))
+	rec := httptest.NewRecorder()
+	before := abandonedCount("test.abandoned")
+
+	// クライアントの切断
+	time.AfterFunc(10*time.Millisecond, cancel)
+	Timeout(time.Minute)(waitHandler(time.Minute)).ServeHTTP(rec, req)
+
+	if rec.Body.Len() != 0 {
+		t.Errorf("expected no response for an abandoned request, got %q", rec.Body.String())
+	}
+	if got := abandonedCount("test.abandoned"); got != before+1 {
+		t.Errorf("expected abandoned count %d, got %d", before+1, got)
+	}
+}
+
+func abandonedCount(route string) int64 {
+	if v, ok := abandonedRequests.Get(route).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"k6-practice/api/requestid"
+)
+
+var tracer = otel.Tracer("k6-practice/api/middleware")
+
+// Tracing はリクエストごとにサーバースパンを作成するミドルウェア
+// k6などが送った W3C traceparent を親として引き継ぐ。スパン名はルーティング後に「メソッド ルート名」にする
+// アクセスログにトレースIDを出すため、Logging より外側に置く
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		r, info := withRouteInfo(r.WithContext(ctx))
+
+		ctx, span := tracer.Start(r.Context(), r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("network.protocol.name", "http"),
+				attribute.String("network.protocol.version", strings.TrimPrefix(r.Proto, "HTTP/")),
+				attribute.String("user_agent.original", r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		r = r.WithContext(ctx)
+		next.ServeHTTP(wrapped, r)
+
+		span.SetName(r.Method + " " + info.name)
+		span.SetAttributes(
+			attribute.String("route.name", info.name),
+			attribute.Int("http.response.status_code", wrapped.statusCode),
+			attribute.String("request.id", wrapped.Header().Get(requestid.Header)),
+		)
+		if wrapped.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(wrapped.statusCode))
+		}
+	})
+}
+
+// TraceID はコンテキストのスパンのトレースID（スパンがなければ空文字）
+func TraceID(r *http.Request) string {
+	sc := trace.SpanContextFromContext(r.Context())
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// chainSpans はチェーンの各ミドルウェアに子スパンを作るか
+var chainSpans atomic.Bool
+
+// TraceMiddlewares はこれ以降に構築するチェーンで、ミドルウェアごとに子スパンを作るかを設定する
+// 子スパンの時間は内側のミドルウェアとハンドラーを含む（差分がそのミドルウェアの処理時間）
+func TraceMiddlewares(enabled bool) {
+	chainSpans.Store(enabled)
+}
+
+// traceMiddleware はミドルウェアを適用したハンドラーを子スパンで囲む
+func traceMiddleware(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), name, trace.WithAttributes(attribute.String("middleware.name", name)))
+		defer span.End()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// nestedChainName はミドルウェアとして渡されたチェーン（Chain.Then）の名前
+const nestedChainName = "middleware.(*Chain).Then"
+
+// middlewareName はミドルウェアの関数名（例: middleware.Timeout、requestid.Middleware）
+func middlewareName(mw Middleware) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(mw).Pointer())
+	if fn == nil {
+		return "middleware"
+	}
+	name := fn.Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.TrimSuffix(name, "-fm")
+	// クロージャの .func1 などを除く
+	for {
+		i := strings.LastIndex(name, ".func")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return name
+}
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"k6-practice/api/requestid"
+)
+
+var (
+	spanRecorderOnce sync.Once
+	spanRecorder     *tracetest.SpanRecorder
+)
+
+// recordSpans はテスト用のTracerProviderを設定する
+// パッケージの tracer は最初に設定したプロバイダーに固定されるため、全テストで共有する
+func recordSpans() *tracetest.SpanRecorder {
+	spanRecorderOnce.Do(func() {
+		spanRecorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	return spanRecorder
+}
+
+// spansOf は traceID のトレースの終了済みスパン
+func spansOf(rec *tracetest.SpanRecorder, traceID string) []sdktrace.ReadOnlySpan {
+	var spans []sdktrace.ReadOnlySpan
+	for _, s := range rec.Ended() {
+		if s.SpanContext().TraceID().String() == traceID {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func TestTracing(t *testing.T) {
+	rec := recordSpans()
+
+	tests := []struct {
+		name          string
+		traceID       string
+		status        int
+		expectedName  string
+		expectedError bool
+	}{
+		{"continues traceparent", "4bf92f3577b34da6a3ce929d0e0e4736", http.StatusOK, "GET v2.getUser", false},
+		{"server errors mark the span", "5bf92f3577b34da6a3ce929d0e0e4736", http.StatusInternalServerError, "GET v2.getUser", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var traceID string
+			handler := Tracing(NameRoute("v2.getUser")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				traceID = TraceID(r)
+				w.WriteHeader(tt.status)
+			})))
+
+			req := httptest.NewRequest(http.MethodGet, "/v2/users/1", nil)
+			req.Header.Set("traceparent", "00-"+tt.traceID+"-00f067aa0ba902b7-01")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if traceID != tt.traceID {
+				t.Errorf("expected trace ID %s in the handler, got %s", tt.traceID, traceID)
+			}
+			spans := spansOf(rec, tt.traceID)
+			if len(spans) != 1 {
+				t.Fatalf("expected 1 span, got %d", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != tt.expectedName {
+				t.Errorf("expected span name %q, got %q", tt.expectedName, span.Name())
+			}
+			if span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+				t.Errorf("expected remote parent span, got %s", span.Parent().SpanID())
+			}
+			if got := span.Status().Code == codes.Error; got != tt.expectedError {
+				t.Errorf("expected error status %v, got %v", tt.expectedError, span.Status())
+			}
+		})
+	}
+}
+
+func TestTracing_AccessLog(t *testing.T) {
+	recordSpans()
+
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(out)
+
+	handler := Tracing(requestid.Middleware(Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))))
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("traceparent", "00-6bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.Contains(buf.String(), "trace_id=6bf92f3577b34da6a3ce929d0e0e4736") {
+		t.Errorf("expected trace ID in the access log, got %q", buf.String())
+	}
+}
+
+func TestTraceMiddlewares(t *testing.T) {
+	rec := recordSpans()
+	TraceMiddlewares(true)
+	defer TraceMiddlewares(false)
+
+	handler := Tracing(NewChain(Timeout(time.Second), CacheControl("no-cache")).ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/v2/users", nil)
+	req.Header.Set("traceparent", "00-7bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := spansOf(rec, "7bf92f3577b34da6a3ce929d0e0e4736")
+	names := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		names[s.Name()] = s
+	}
+	timeout, cache := names["middleware.Timeout"], names["middleware.CacheControl"]
+	if timeout == nil || cache == nil {
+		t.Fatalf("expected a span per middleware, got %v", names)
+	}
+	if cache.Parent().SpanID() != timeout.SpanContext().SpanID() {
+		t.Error("expected middleware spans to nest in chain order")
+	}
+}
+
+func TestMiddlewareName(t *testing.T) {
+	limiter := NewRateLimiter(1, time.Minute)
+
+	tests := []struct {
+		name     string
+		mw       Middleware
+		expected string
+	}{
+		{"function", Logging, "middleware.Logging"},
+		{"closure", Timeout(time.Second), "middleware.Timeout"},
+		{"method value", limiter.Middleware, "middleware.(*RateLimiter).Middleware"},
+		{"other package", requestid.Middleware, "requestid.Middleware"},
+		{"nested chain", NewChain(Logging).Then, nestedChainName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := middlewareName(tt.mw); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"k6-practice/api/problem"
+	"k6-practice/api/upstream"
+)
+
+// UpstreamStatusHeader は上流の呼び出し結果（ok / fallback）を返すヘッダー
+const UpstreamStatusHeader = "X-Upstream-Status"
+
+// EnrichConfig は上流を呼び出すルートの設定
+type EnrichConfig struct {
+	Client *upstream.Client
+	// Path: 呼び出す上流のパス（例: /v2/delay/50、/v2/error-rate/20）
+	Path string
+	// Required: 上流が失敗したらエラーを返す（falseなら上流なしでレスポンスを返す）
+	Required bool
+}
+
+// Enrich はハンドラーの前に上流を呼び出すミドルウェア（ユーザー詳細の付加情報の取得を模擬する）
+// 上流の障害を呼び出し側に波及させるか（Required）、縮退して応答するかを切り替えてk6で比較する
+func Enrich(cfg EnrichConfig) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := cfg.Client.Get(r.Context(), cfg.Path)
+			if err == nil {
+				w.Header().Set(UpstreamStatusHeader, "ok")
+				next.ServeHTTP(w, r)
+				return
+			}
+			// ルートのタイムアウト・切断はTimeoutミドルウェアに任せる
+			if r.Context().Err() != nil {
+				return
+			}
+			if !cfg.Required {
+				w.Header().Set(UpstreamStatusHeader, "fallback")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			switch {
+			case errors.Is(err, upstream.ErrCircuitOpen):
+				retryAfter := int(cfg.Client.Breaker().RetryAfter().Seconds()) + 1
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				problem.Write(w, r, problem.CodeUpstreamUnavailable, "upstream circuit breaker is open")
+			case errors.Is(err, upstream.ErrBulkheadFull):
+				w.Header().Set("Retry-After", "1")
+				problem.Write(w, r, problem.CodeUpstreamUnavailable, "too many concurrent upstream calls")
+			case errors.Is(err, context.DeadlineExceeded):
+				problem.Write(w, r, problem.CodeUpstreamTimeout, "upstream did not respond in time")
+			default:
+				problem.Write(w, r, problem.CodeBadGateway, "upstream request failed")
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k6-practice/api/upstream"
+)
+
+func TestEnrich(t *testing.T) {
+	tests := []struct {
+		name           string
+		upstreamStatus int
+		upstreamDelay  time.Duration
+		required       bool
+		expectedStatus int
+		expectedHeader string
+	}{
+		{"upstream ok", http.StatusOK, 0, true, http.StatusOK, "ok"},
+		{"fallback when optional", http.StatusInternalServerError, 0, false, http.StatusOK, "fallback"},
+		{"bad gateway when required", http.StatusInternalServerError, 0, true, http.StatusBadGateway, ""},
+		{"gateway timeout when required", http.StatusOK, time.Second, true, http.StatusGatewayTimeout, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-time.After(tt.upstreamDelay):
+				case <-r.Context().Done():
+					return
+				}
+				w.WriteHeader(tt.upstreamStatus)
+			}))
+			defer srv.Close()
+
+			client := upstream.NewClient(upstream.Config{BaseURL: srv.URL, Timeout: 20 * time.Millisecond})
+			handler := Enrich(EnrichConfig{Client: client, Path: "/", Required: tt.required})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/users/1", nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if got := rec.Header().Get(UpstreamStatusHeader); got != tt.expectedHeader {
+				t.Errorf("expected %s %q, got %q", UpstreamStatusHeader, tt.expectedHeader, got)
+			}
+		})
+	}
+}
+
+func TestEnrich_CircuitOpen(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	client := upstream.NewClient(upstream.Config{
+		BaseURL: srv.URL,
+		Breaker: upstream.BreakerConfig{Threshold: 1, Cooldown: time.Minute},
+	})
+	handler := Enrich(EnrichConfig{Client: client, Path: "/", Required: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, expected := range []int{http.StatusBadGateway, http.StatusServiceUnavailable} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/users/1", nil))
+		if rec.Code != expected {
+			t.Fatalf("expected status %d, got %d", expected, rec.Code)
+		}
+		if expected == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") != "60" {
+			t.Errorf("expected Retry-After until the breaker half-opens, got %q", rec.Header().Get("Retry-After"))
+		}
+	}
+}
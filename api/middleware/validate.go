@@ -16,6 +16,20 @@ var (
 	controlCharRegex = regexp.MustCompile(`[\x00-\x08\x0B\x0C\x0E-\x1F\x7F]`)
 )
 
+// suspiciousRegex はスクリプトの埋め込みやSQLインジェクションでよく使われるパターン
+var suspiciousRegex = regexp.MustCompile(`(?i)<\s*script|javascript:|\bon[a-z]+\s*=|'\s*or\s+'?\w+'?\s*=|\bunion\s+(all\s+)?select\b|;\s*drop\s+table\b`)
+
+// IsSuspicious は攻撃の試行とみられる入力かを判定（拒否はせず、SUSPICIOUS_INPUTの記録に使う）
+// サニタイズで除去されるHTMLタグも記録するため、サニタイズ前の値で判定する
+func IsSuspicious(values ...string) bool {
+	for _, s := range values {
+		if htmlTagRegex.MatchString(s) || suspiciousRegex.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
 // ValidateEmail はメールアドレスの形式を検証
 func ValidateEmail(email string) bool {
 	if len(email) > 254 {
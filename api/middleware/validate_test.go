@@ -80,6 +80,32 @@ func TestSanitizeString(t *testing.T) {
 	}
 }
 
+func TestIsSuspicious(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{"normal name", "O'Brien", false},
+		{"normal email", "or@example.com", false},
+		{"script tag", "<script>alert('xss')</script>", true},
+		{"html tag", "<b>bold</b>", true},
+		{"event handler", "x\" onerror=\"alert(1)", true},
+		{"javascript url", "JavaScript:alert(1)", true},
+		{"sql tautology", "' OR '1'='1", true},
+		{"union select", "1 UNION SELECT password FROM users", true},
+		{"drop table", "x'; DROP TABLE users", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := IsSuspicious(tt.input); result != tt.expected {
+				t.Errorf("IsSuspicious(%q) = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestValidatePassword(t *testing.T) {
 	tests := []struct {
 		name        string
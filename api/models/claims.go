@@ -1,10 +1,28 @@
 package models
 
-import "github.com/golang-jwt/jwt/v5"
+import (
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
 
 // Claims はJWTトークンに含まれるユーザー情報
+// 認証済みのユーザー（プリンシパル）として、JWT以外の認証方式（APIキー・クライアント証明書）でも同じ型を使う
 type Claims struct {
 	UserID int    `json:"user_id"`
 	Email  string `json:"email"`
+	// AuthMethod: 認証方式（jwt・api_key・client_cert、トークンには含めない）
+	AuthMethod string `json:"-"`
+	// Scopes: 許可された操作（nilの場合は制限なし。APIキーだけが設定する）
+	Scopes []string `json:"-"`
+	// KeyID: 認証に使ったAPIキーのID
+	KeyID string `json:"-"`
+	// Epoch: 発行時の失効の世代（TokenRevocations.RevokeAll で以前の世代をすべて失効させる）
+	Epoch int64 `json:"epoch,omitempty"`
 	jwt.RegisteredClaims
 }
+
+// HasScope はプリンシパルが scope の操作を許可されているか
+func (c *Claims) HasScope(scope string) bool {
+	return c.Scopes == nil || slices.Contains(c.Scopes, scope)
+}
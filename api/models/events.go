@@ -0,0 +1,100 @@
+package models
+
+import "time"
+
+// EventType はユーザーの変更の種類
+type EventType string
+
+const (
+	EventUserCreated EventType = "user.created"
+	EventUserUpdated EventType = "user.updated"
+	EventUserDeleted EventType = "user.deleted"
+)
+
+// Event はUserStoreの変更通知
+// IDはストア内で単調増加する（購読者が順序と欠落を判断できる）
+type Event struct {
+	ID   uint64    `json:"id"`
+	Type EventType `json:"type"`
+	User User      `json:"user"`
+	Time time.Time `json:"time"`
+}
+
+// ReplayBufferSize は再送のために保持する直近の変更通知の数
+const ReplayBufferSize = 256
+
+// Subscribe は変更通知の購読を開始する
+// bufferが溢れた（購読者の処理が追いつかない）場合、ストアは購読を解除してチャネルを閉じる
+// cancelは購読を解除する（複数回呼んでもよい）
+func (s *UserStore) Subscribe(buffer int) (events <-chan Event, cancel func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscribe(buffer)
+}
+
+// SubscribeFrom はlastEventIDより後の変更を再送用に返してから購読を開始する
+// 再送と購読の間に変更が入り込まないよう、同じロックの中で行う
+// completeがfalseの場合、lastEventIDの直後の変更が既にバッファから消えている（全件の再取得が必要）
+func (s *UserStore) SubscribeFrom(lastEventID uint64, buffer int) (replay []Event, complete bool, events <-chan Event, cancel func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	complete = lastEventID <= s.lastEventID
+	if complete && lastEventID < s.lastEventID {
+		oldest := s.lastEventID - uint64(len(s.history)) + 1
+		complete = lastEventID+1 >= oldest
+	}
+	for _, ev := range s.history {
+		if ev.ID > lastEventID {
+			replay = append(replay, ev)
+		}
+	}
+
+	events, cancel = s.subscribe(buffer)
+	return replay, complete, events, cancel
+}
+
+// subscribe は購読者を登録する（s.muのロック中に呼ぶ）
+func (s *UserStore) subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	if s.subscribers == nil {
+		s.subscribers = make(map[chan Event]struct{})
+	}
+	s.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.unsubscribe(ch)
+	}
+}
+
+// publish は変更を記録して購読者に通知する（s.muのロック中に呼ぶ）
+func (s *UserStore) publish(eventType EventType, user *User) {
+	s.lastEventID++
+	event := Event{ID: s.lastEventID, Type: eventType, User: *user, Time: time.Now()}
+	s.modified = event.Time
+
+	if len(s.history) == ReplayBufferSize {
+		copy(s.history, s.history[1:])
+		s.history = s.history[:ReplayBufferSize-1]
+	}
+	s.history = append(s.history, event)
+
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// 遅い購読者のためにストアの更新を止めない
+			s.unsubscribe(ch)
+		}
+	}
+}
+
+// unsubscribe は購読者を削除してチャネルを閉じる（s.muのロック中に呼ぶ）
+func (s *UserStore) unsubscribe(ch chan Event) {
+	if _, ok := s.subscribers[ch]; ok {
+		delete(s.subscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("k6-practice/api/models")
+
+// startSpan はストア操作のスパンを開始する（ロック待ちの時間も含める）
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	return span
+}
+
+// spanError はエラーをスパンに記録してそのまま返す
+func spanError(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
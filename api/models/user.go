@@ -1,22 +1,39 @@
 package models
 
 import (
+	"context"
+	"sort"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type User struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        int       `json:"id" openapi:"required"`
+	Name      string    `json:"name" openapi:"required"`
+	Email     string    `json:"email" openapi:"required"`
+	CreatedAt time.Time `json:"created_at" openapi:"required"`
+	UpdatedAt time.Time `json:"updated_at" openapi:"required"`
 }
 
 type UserStore struct {
 	mu     sync.RWMutex
 	users  map[int]*User
 	nextID int
+
+	// 変更通知（events.go）
+	subscribers map[chan Event]struct{}
+	lastEventID uint64
+	history     []Event   // 直近の変更（再送用、最大ReplayBufferSize件）
+	modified    time.Time // 最後に変更した日時（削除を含む）
+}
+
+// seedUsers は初期データ（名前とメールアドレス）
+var seedUsers = [][2]string{
+	{"Alice", "alice@example.com"},
+	{"Bob", "bob@example.com"},
+	{"Charlie", "charlie@example.com"},
 }
 
 func NewUserStore() *UserStore {
@@ -25,13 +42,61 @@ func NewUserStore() *UserStore {
 		nextID: 1,
 	}
 	// 初期データを追加
-	store.Create("Alice", "alice@example.com")
-	store.Create("Bob", "bob@example.com")
-	store.Create("Charlie", "charlie@example.com")
+	for _, seed := range seedUsers {
+		store.Create(seed[0], seed[1])
+	}
 	return store
 }
 
+// Reset は初期データだけの状態に戻す（IDも1から振り直す）
+// 版数と変更通知のIDは続きから増やし、購読者には全件の削除と初期データの作成を通知する
+func (s *UserStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int, 0, len(s.users))
+	for id := range s.users {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		user := s.users[id]
+		delete(s.users, id)
+		s.publish(EventUserDeleted, user)
+	}
+
+	s.nextID = 1
+	for _, seed := range seedUsers {
+		s.create(seed[0], seed[1])
+	}
+}
+
+// 〜Context のメソッドは、リクエストが終了（クライアントの切断・タイムアウト）していれば処理せずにctxのエラーを返す
+// 変更系はロックを取得した後にも確認し、終了したリクエストではストアを変更しない
+// ctxのないメソッドは context.Background() で呼び出す（初期データ・テスト用）
+
 func (s *UserStore) List() []*User {
+	users, _ := s.ListContext(context.Background())
+	return users
+}
+
+func (s *UserStore) ListContext(ctx context.Context) ([]*User, error) {
+	users, _, _, err := s.SnapshotContext(ctx)
+	return users, err
+}
+
+// Snapshot は一覧と、その時点の版数・最終更新日時を返す（一覧のETagとLast-Modifiedに使う）
+func (s *UserStore) Snapshot() ([]*User, uint64, time.Time) {
+	users, version, modified, _ := s.SnapshotContext(context.Background())
+	return users, version, modified
+}
+
+func (s *UserStore) SnapshotContext(ctx context.Context) ([]*User, uint64, time.Time, error) {
+	span := startSpan(ctx, "UserStore.Snapshot")
+	defer span.End()
+	if err := ctx.Err(); err != nil {
+		return nil, 0, time.Time{}, spanError(span, err)
+	}
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -39,19 +104,74 @@ func (s *UserStore) List() []*User {
 	for _, u := range s.users {
 		users = append(users, u)
 	}
-	return users
+	return users, s.lastEventID, s.modified, nil
+}
+
+// Version は変更のたびに増える版数（変更通知のIDと同じ）
+func (s *UserStore) Version() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastEventID
 }
 
 func (s *UserStore) Get(id int) *User {
+	user, _ := s.GetContext(context.Background(), id)
+	return user
+}
+
+func (s *UserStore) GetContext(ctx context.Context, id int) (*User, error) {
+	span := startSpan(ctx, "UserStore.Get", attribute.Int("user.id", id))
+	defer span.End()
+	if err := ctx.Err(); err != nil {
+		return nil, spanError(span, err)
+	}
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.users[id]
+	return s.users[id], nil
+}
+
+// FindByEmail はメールアドレスでユーザーを検索する
+func (s *UserStore) FindByEmail(email string) *User {
+	user, _ := s.FindByEmailContext(context.Background(), email)
+	return user
+}
+
+func (s *UserStore) FindByEmailContext(ctx context.Context, email string) (*User, error) {
+	span := startSpan(ctx, "UserStore.FindByEmail")
+	defer span.End()
+	if err := ctx.Err(); err != nil {
+		return nil, spanError(span, err)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, nil
 }
 
 func (s *UserStore) Create(name, email string) *User {
+	user, _ := s.CreateContext(context.Background(), name, email)
+	return user
+}
+
+func (s *UserStore) CreateContext(ctx context.Context, name, email string) (*User, error) {
+	span := startSpan(ctx, "UserStore.Create")
+	defer span.End()
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return s.create(name, email), nil
+}
 
+// create はユーザーを追加して通知する（s.muのロック中に呼ぶ）
+func (s *UserStore) create(name, email string) *User {
 	now := time.Now()
 	user := &User{
 		ID:        s.nextID,
@@ -62,31 +182,56 @@ func (s *UserStore) Create(name, email string) *User {
 	}
 	s.users[s.nextID] = user
 	s.nextID++
+	s.publish(EventUserCreated, user)
 	return user
 }
 
 func (s *UserStore) Update(id int, name, email string) *User {
+	user, _ := s.UpdateContext(context.Background(), id, name, email)
+	return user
+}
+
+// UpdateContext は存在しないユーザーの場合 nil, nil を返す
+func (s *UserStore) UpdateContext(ctx context.Context, id int, name, email string) (*User, error) {
+	span := startSpan(ctx, "UserStore.Update", attribute.Int("user.id", id))
+	defer span.End()
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, spanError(span, err)
+	}
 
 	user, exists := s.users[id]
 	if !exists {
-		return nil
+		return nil, nil
 	}
 
 	user.Name = name
 	user.Email = email
 	user.UpdatedAt = time.Now()
-	return user
+	s.publish(EventUserUpdated, user)
+	return user, nil
 }
 
 func (s *UserStore) Delete(id int) bool {
+	deleted, _ := s.DeleteContext(context.Background(), id)
+	return deleted
+}
+
+func (s *UserStore) DeleteContext(ctx context.Context, id int) (bool, error) {
+	span := startSpan(ctx, "UserStore.Delete", attribute.Int("user.id", id))
+	defer span.End()
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return false, spanError(span, err)
+	}
 
-	if _, exists := s.users[id]; !exists {
-		return false
+	user, exists := s.users[id]
+	if !exists {
+		return false, nil
 	}
 	delete(s.users, id)
-	return true
+	s.publish(EventUserDeleted, user)
+	return true, nil
 }
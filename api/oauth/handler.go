@@ -0,0 +1,373 @@
+package oauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k6-practice/api/middleware"
+)
+
+// Error はトークン・イントロスペクション・失効のエンドポイントのエラー（RFC 6749 5.2）
+type Error struct {
+	Error       string `json:"error" openapi:"required"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// TokenRequest はトークンエンドポイントのリクエスト（application/x-www-form-urlencoded）
+type TokenRequest struct {
+	GrantType    string `json:"grant_type" openapi:"required,enum=authorization_code|client_credentials|refresh_token"`
+	Code         string `json:"code,omitempty"`
+	RedirectURI  string `json:"redirect_uri,omitempty"`
+	CodeVerifier string `json:"code_verifier,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// TokenActionRequest はイントロスペクション・失効のリクエスト（application/x-www-form-urlencoded）
+type TokenActionRequest struct {
+	Token         string `json:"token" openapi:"required"`
+	TokenTypeHint string `json:"token_type_hint,omitempty"`
+	ClientID      string `json:"client_id,omitempty"`
+	ClientSecret  string `json:"client_secret,omitempty"`
+}
+
+// Discovery はOpenID Providerのメタデータ（OpenID Connect Discovery 1.0 3、RFC 8414）
+type Discovery struct {
+	Issuer                            string   `json:"issuer" openapi:"required"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint" openapi:"required"`
+	TokenEndpoint                     string   `json:"token_endpoint" openapi:"required"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint" openapi:"required"`
+	JWKSURI                           string   `json:"jwks_uri" openapi:"required"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint" openapi:"required"`
+	RevocationEndpoint                string   `json:"revocation_endpoint" openapi:"required"`
+	ScopesSupported                   []string `json:"scopes_supported" openapi:"required"`
+	ResponseTypesSupported            []string `json:"response_types_supported" openapi:"required"`
+	GrantTypesSupported               []string `json:"grant_types_supported" openapi:"required"`
+	SubjectTypesSupported             []string `json:"subject_types_supported" openapi:"required"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported" openapi:"required"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported" openapi:"required"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported" openapi:"required"`
+	ClaimsSupported                   []string `json:"claims_supported" openapi:"required"`
+}
+
+// JWK はトークンの検証に使う公開鍵（RFC 7517）
+type JWK struct {
+	Kty string `json:"kty" openapi:"required"`
+	Use string `json:"use" openapi:"required"`
+	Alg string `json:"alg" openapi:"required"`
+	Kid string `json:"kid" openapi:"required"`
+	N   string `json:"n" openapi:"required"`
+	E   string `json:"e" openapi:"required"`
+}
+
+// JWKS はJWK Setのレスポンス
+type JWKS struct {
+	Keys []JWK `json:"keys" openapi:"required"`
+}
+
+// UserInfo はUserInfoエンドポイントのレスポンス（スコープに応じたクレーム）
+type UserInfo struct {
+	Sub           string `json:"sub" openapi:"required"`
+	Name          string `json:"name,omitempty"`
+	UpdatedAt     int64  `json:"updated_at,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// Handler はOAuth 2.0 / OpenID Connect のエンドポイント
+type Handler struct {
+	provider *Provider
+}
+
+func NewHandler(provider *Provider) *Handler {
+	return &Handler{provider: provider}
+}
+
+// Discovery は GET /.well-known/openid-configuration
+func (h *Handler) Discovery(w http.ResponseWriter, r *http.Request) {
+	p := h.provider
+	writeJSON(w, http.StatusOK, Discovery{
+		Issuer:                            p.cfg.Issuer,
+		AuthorizationEndpoint:             p.cfg.Issuer + "/oauth/authorize",
+		TokenEndpoint:                     p.cfg.Issuer + "/oauth/token",
+		UserInfoEndpoint:                  p.cfg.Issuer + "/oauth/userinfo",
+		JWKSURI:                           p.cfg.Issuer + "/oauth/jwks",
+		IntrospectionEndpoint:             p.cfg.Issuer + "/oauth/introspect",
+		RevocationEndpoint:                p.cfg.Issuer + "/oauth/revoke",
+		ScopesSupported:                   p.cfg.Scopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{GrantAuthorizationCode, GrantClientCredentials, GrantRefreshToken},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "name", "email", "email_verified", "updated_at"},
+	})
+}
+
+// JWKS は GET /oauth/jwks
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	pub := &h.provider.key.PublicKey
+	writeJSON(w, http.StatusOK, JWKS{Keys: []JWK{{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: h.provider.keyID,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   encodeInt(pub.E),
+	}}})
+}
+
+// Authorize は GET /oauth/authorize（認可コード + PKCE）
+// ログイン画面は持たないため、ユーザーは POST /auth/login のアクセストークン（Authorization: Bearer）で示す
+// トークンがない場合は error=login_required でリダイレクトする（OpenID Connect の prompt=none と同じ）
+func (h *Handler) Authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	// クライアントとリダイレクトURIが確認できない場合はリダイレクトしない（RFC 6749 4.1.2.1）
+	client, ok := h.provider.Client(q.Get("client_id"))
+	if !ok {
+		h.fail(w, http.StatusBadRequest, ErrInvalidClient, "unknown client_id")
+		return
+	}
+	redirectURI := q.Get("redirect_uri")
+	if len(client.RedirectURIs) == 0 {
+		h.fail(w, http.StatusBadRequest, ErrUnauthorizedClient, "client has no redirect URI")
+		return
+	}
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		h.fail(w, http.StatusBadRequest, errors.New("invalid_request"), "redirect_uri is not registered")
+		return
+	}
+
+	state := q.Get("state")
+	redirect := func(params url.Values) {
+		if state != "" {
+			params.Set("state", state)
+		}
+		params.Set("iss", h.provider.cfg.Issuer)
+		http.Redirect(w, r, withQuery(redirectURI, params), http.StatusFound)
+	}
+	redirectError := func(code, description string) {
+		oauthErrors.Add(code, 1)
+		redirect(url.Values{"error": {code}, "error_description": {description}})
+	}
+
+	switch {
+	case q.Get("response_type") != "code":
+		redirectError("unsupported_response_type", "response_type must be code")
+		return
+	case q.Get("code_challenge") == "":
+		redirectError("invalid_request", "code_challenge is required")
+		return
+	case q.Get("code_challenge_method") != "S256":
+		redirectError("invalid_request", "code_challenge_method must be S256")
+		return
+	}
+
+	// APIキーでは他のクライアントにユーザーの権限を渡せない
+	user := middleware.GetUserFromContext(r.Context())
+	if user == nil || user.AuthMethod == middleware.AuthMethodAPIKey {
+		redirectError("login_required", "authenticate with a bearer access token")
+		return
+	}
+
+	code, err := h.provider.Authorize(client, redirectURI, user.UserID, q.Get("scope"), q.Get("nonce"), q.Get("code_challenge"))
+	if errors.Is(err, ErrInvalidScope) {
+		redirectError(ErrInvalidScope.Error(), "unknown scope")
+		return
+	}
+	if err != nil {
+		redirectError("server_error", "failed to issue authorization code")
+		return
+	}
+	redirect(url.Values{"code": {code}})
+}
+
+func withQuery(uri string, params url.Values) string {
+	if strings.Contains(uri, "?") {
+		return uri + "&" + params.Encode()
+	}
+	return uri + "?" + params.Encode()
+}
+
+// Token は POST /oauth/token
+func (h *Handler) Token(w http.ResponseWriter, r *http.Request) {
+	if !parseForm(w, r) {
+		return
+	}
+	client, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var token *Token
+	var err error
+	switch grant := r.PostForm.Get("grant_type"); grant {
+	case GrantClientCredentials:
+		token, err = h.provider.ClientCredentials(client, r.PostForm.Get("scope"))
+	case GrantAuthorizationCode:
+		token, err = h.provider.ExchangeCode(client, r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"), r.PostForm.Get("code_verifier"))
+	case GrantRefreshToken:
+		token, err = h.provider.Refresh(client, r.PostForm.Get("refresh_token"), r.PostForm.Get("scope"))
+	default:
+		err = ErrUnsupportedGrantType
+	}
+
+	switch {
+	case err == nil:
+		middleware.LogSecurityEvent(middleware.EventAuthSuccess, r, "oauth token issued to "+client.ID)
+		writeJSON(w, http.StatusOK, token)
+	case errors.Is(err, ErrInvalidGrant):
+		middleware.LogSecurityEvent(middleware.EventAuthFailure, r, "oauth invalid grant for "+client.ID)
+		h.fail(w, http.StatusBadRequest, err, "authorization code or refresh token is invalid, expired or was issued to another client")
+	case errors.Is(err, ErrInvalidScope), errors.Is(err, ErrUnauthorizedClient), errors.Is(err, ErrUnsupportedGrantType):
+		h.fail(w, http.StatusBadRequest, err, "")
+	default:
+		h.fail(w, http.StatusInternalServerError, errors.New("server_error"), "failed to issue token")
+	}
+}
+
+// Introspect は POST /oauth/introspect（機密クライアントだけ）
+func (h *Handler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if !parseForm(w, r) {
+		return
+	}
+	client, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if client.Public() {
+		h.fail(w, http.StatusUnauthorized, ErrInvalidClient, "introspection requires client authentication")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.provider.Introspect(r.PostForm.Get("token")))
+}
+
+// Revoke は POST /oauth/revoke（無効なトークンも200を返す、RFC 7009 2.2）
+func (h *Handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if !parseForm(w, r) {
+		return
+	}
+	client, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if r.PostForm.Get("token") == "" {
+		h.fail(w, http.StatusBadRequest, errors.New("invalid_request"), "token is required")
+		return
+	}
+	h.provider.Revoke(client, r.PostForm.Get("token"))
+	w.WriteHeader(http.StatusOK)
+}
+
+// UserInfo は GET/POST /oauth/userinfo（openid スコープのアクセストークン）
+// エラーはボディを持たず WWW-Authenticate ヘッダーで示す（RFC 6750 3）
+func (h *Handler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		middleware.LogSecurityEvent(middleware.EventUnauthorized, r, "oauth userinfo without bearer token")
+		h.challenge(w, http.StatusUnauthorized, "")
+		return
+	}
+	claims, err := h.provider.ParseAccessToken(token)
+	if err != nil {
+		middleware.LogSecurityEvent(middleware.EventAuthFailure, r, "oauth userinfo with invalid token")
+		h.challenge(w, http.StatusUnauthorized, "invalid_token")
+		return
+	}
+	// クライアントクレデンシャルのトークンにはユーザーがいない
+	user := h.provider.users.Get(claims.userID())
+	if !claims.HasScope("openid") || user == nil {
+		h.challenge(w, http.StatusForbidden, "insufficient_scope")
+		return
+	}
+
+	info := UserInfo{Sub: strconv.Itoa(user.ID)}
+	if claims.HasScope("profile") {
+		info.Name = user.Name
+		info.UpdatedAt = user.UpdatedAt.Unix()
+	}
+	if claims.HasScope("email") {
+		// ユーザーはメールアドレスの確認を行わない
+		verified := false
+		info.Email = user.Email
+		info.EmailVerified = &verified
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// authenticate はクライアントを認証する（client_secret_basic、client_secret_post、公開クライアントは client_id だけ）
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) (Client, bool) {
+	id, secret, basic := r.BasicAuth()
+	if basic {
+		// Basic認証のIDとシークレットはフォームエンコードされている（RFC 6749 2.3.1）
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	client, err := h.provider.AuthenticateClient(id, secret)
+	if err != nil {
+		middleware.LogSecurityEvent(middleware.EventAuthFailure, r, "oauth client authentication failed")
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+h.provider.cfg.Issuer+`"`)
+		}
+		h.fail(w, http.StatusUnauthorized, ErrInvalidClient, "client authentication failed")
+		return Client{}, false
+	}
+	return client, true
+}
+
+// challenge はBearerトークンのエラーをヘッダーだけで返す
+// トークンがない場合は code を空にする
+func (h *Handler) challenge(w http.ResponseWriter, status int, code string) {
+	value := `Bearer realm="` + h.provider.cfg.Issuer + `"`
+	if code != "" {
+		value += `, error="` + code + `"`
+		if code == "insufficient_scope" {
+			value += `, scope="openid"`
+		}
+		oauthErrors.Add(code, 1)
+	}
+	w.Header().Set("WWW-Authenticate", value)
+	w.WriteHeader(status)
+}
+
+// fail はRFC 6749形式のエラーを返す
+func (h *Handler) fail(w http.ResponseWriter, status int, err error, description string) {
+	oauthErrors.Add(err.Error(), 1)
+	writeJSON(w, status, Error{Error: err.Error(), Description: description})
+}
+
+// parseForm はフォームのボディを読み込む（ボディのサイズ制限を超えた場合は413）
+func parseForm(w http.ResponseWriter, r *http.Request) bool {
+	if err := r.ParseForm(); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, Error{Error: "invalid_request", Description: "request body too large"})
+			return false
+		}
+		writeJSON(w, http.StatusBadRequest, Error{Error: "invalid_request", Description: "malformed form body"})
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,289 @@
+package oauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"k6-practice/api/middleware"
+)
+
+func postForm(h http.HandlerFunc, values url.Values, setup func(*http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if setup != nil {
+		setup(req)
+	}
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func basicAuth(id, secret string) func(*http.Request) {
+	return func(r *http.Request) { r.SetBasicAuth(id, secret) }
+}
+
+func TestHandler_Token(t *testing.T) {
+	h := NewHandler(newTestProvider(t))
+
+	tests := []struct {
+		name           string
+		values         url.Values
+		setup          func(*http.Request)
+		expectedStatus int
+		expectedError  string
+	}{
+		{"client_secret_basic", url.Values{"grant_type": {"client_credentials"}}, basicAuth("service", "service-secret"), http.StatusOK, ""},
+		{"client_secret_post", url.Values{"grant_type": {"client_credentials"}, "client_id": {"service"}, "client_secret": {"service-secret"}}, nil, http.StatusOK, ""},
+		{"wrong secret", url.Values{"grant_type": {"client_credentials"}}, basicAuth("service", "wrong"), http.StatusUnauthorized, "invalid_client"},
+		{"unknown client", url.Values{"grant_type": {"client_credentials"}, "client_id": {"nobody"}}, nil, http.StatusUnauthorized, "invalid_client"},
+		{"public client with a secret", url.Values{"grant_type": {"client_credentials"}, "client_id": {"web"}, "client_secret": {"x"}}, nil, http.StatusUnauthorized, "invalid_client"},
+		{"public client credentials", url.Values{"grant_type": {"client_credentials"}, "client_id": {"web"}}, nil, http.StatusBadRequest, "unauthorized_client"},
+		{"unsupported grant", url.Values{"grant_type": {"password"}}, basicAuth("service", "service-secret"), http.StatusBadRequest, "unsupported_grant_type"},
+		{"invalid code", url.Values{"grant_type": {"authorization_code"}, "client_id": {"web"}, "code": {"nope"}}, nil, http.StatusBadRequest, "invalid_grant"},
+		{"invalid scope", url.Values{"grant_type": {"client_credentials"}, "scope": {"admin"}}, basicAuth("service", "service-secret"), http.StatusBadRequest, "invalid_scope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postForm(h.Token, tt.values, tt.setup)
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedError == "" {
+				var token Token
+				json.NewDecoder(rec.Body).Decode(&token)
+				if token.AccessToken == "" || token.TokenType != "Bearer" || token.ExpiresIn != 60 {
+					t.Errorf("unexpected token response %+v", token)
+				}
+				return
+			}
+			var e Error
+			json.NewDecoder(rec.Body).Decode(&e)
+			if e.Error != tt.expectedError {
+				t.Errorf("expected error %q, got %q", tt.expectedError, e.Error)
+			}
+		})
+	}
+
+	rec := postForm(h.Token, url.Values{"grant_type": {"client_credentials"}}, basicAuth("service", "wrong"))
+	if !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Basic ") {
+		t.Errorf("expected a Basic challenge, got %q", rec.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestHandler_Authorize(t *testing.T) {
+	h := NewHandler(newTestProvider(t))
+	alice := &middleware.Claims{UserID: 1, Email: "alice@example.com"}
+
+	valid := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"web"},
+		"scope":                 {"openid"},
+		"state":                 {"abc"},
+		"code_challenge":        {S256("verifier")},
+		"code_challenge_method": {"S256"},
+	}
+	with := func(key, value string) url.Values {
+		v := url.Values{}
+		for k, vs := range valid {
+			v[k] = vs
+		}
+		v.Set(key, value)
+		return v
+	}
+
+	tests := []struct {
+		name           string
+		query          url.Values
+		user           *middleware.Claims
+		expectedStatus int
+		expectedParam  string
+		expectedValue  string
+	}{
+		{"issues a code", valid, alice, http.StatusFound, "state", "abc"},
+		{"without a user", valid, nil, http.StatusFound, "error", "login_required"},
+		{"api key user", valid, &middleware.Claims{UserID: 1, AuthMethod: middleware.AuthMethodAPIKey}, http.StatusFound, "error", "login_required"},
+		{"plain PKCE", with("code_challenge_method", "plain"), alice, http.StatusFound, "error", "invalid_request"},
+		{"token response type", with("response_type", "token"), alice, http.StatusFound, "error", "unsupported_response_type"},
+		{"unknown scope", with("scope", "admin"), alice, http.StatusFound, "error", "invalid_scope"},
+		{"unknown client", with("client_id", "nobody"), alice, http.StatusBadRequest, "", ""},
+		{"unregistered redirect URI", with("redirect_uri", "https://evil.example.com/cb"), alice, http.StatusBadRequest, "", ""},
+		{"client without redirect URIs", with("client_id", "service"), alice, http.StatusBadRequest, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+tt.query.Encode(), nil)
+			if tt.user != nil {
+				req = req.WithContext(middleware.NewContext(req.Context(), tt.user))
+			}
+			rec := httptest.NewRecorder()
+			h.Authorize(rec, req)
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedParam == "" {
+				if rec.Header().Get("Location") != "" {
+					t.Errorf("expected no redirect, got %s", rec.Header().Get("Location"))
+				}
+				return
+			}
+			location, _ := url.Parse(rec.Header().Get("Location"))
+			if !strings.HasPrefix(location.String(), "http://localhost:3000/callback?") {
+				t.Errorf("unexpected redirect %s", location)
+			}
+			if got := location.Query().Get(tt.expectedParam); got != tt.expectedValue {
+				t.Errorf("expected %s=%s, got %q", tt.expectedParam, tt.expectedValue, got)
+			}
+			if location.Query().Get("iss") != "http://localhost:8080" {
+				t.Errorf("expected the issuer in the redirect, got %s", location)
+			}
+		})
+	}
+}
+
+func TestHandler_UserInfo(t *testing.T) {
+	p := newTestProvider(t)
+	h := NewHandler(p)
+	web, _ := p.Client("web")
+	service, _ := p.Client("service")
+
+	userToken := func(scope string) string {
+		code, _ := p.Authorize(web, web.RedirectURIs[0], 1, scope, "", S256("verifier"))
+		token, err := p.ExchangeCode(web, code, web.RedirectURIs[0], "verifier")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token.AccessToken
+	}
+	serviceToken, _ := p.ClientCredentials(service, "users:read")
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+		expected       []string
+		unexpected     []string
+	}{
+		{"openid only", userToken("openid"), http.StatusOK, []string{`"sub":"1"`}, []string{"email", "name"}},
+		{"profile and email", userToken("openid profile email"), http.StatusOK, []string{`"name":"Alice"`, `"email":"alice@example.com"`, `"email_verified":false`, `"updated_at"`}, nil},
+		{"without openid", userToken("users:read"), http.StatusForbidden, nil, nil},
+		{"client credentials", serviceToken.AccessToken, http.StatusForbidden, nil, nil},
+		{"invalid token", "invalid", http.StatusUnauthorized, nil, nil},
+		{"no token", "", http.StatusUnauthorized, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			h.UserInfo(rec, req)
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if rec.Code != http.StatusOK && !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Bearer ") {
+				t.Errorf("expected a Bearer challenge, got %q", rec.Header().Get("WWW-Authenticate"))
+			}
+			for _, s := range tt.expected {
+				if !strings.Contains(rec.Body.String(), s) {
+					t.Errorf("expected %s in %s", s, rec.Body.String())
+				}
+			}
+			for _, s := range tt.unexpected {
+				if strings.Contains(rec.Body.String(), s) {
+					t.Errorf("expected no %s in %s", s, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_IntrospectAndRevoke(t *testing.T) {
+	p := newTestProvider(t)
+	h := NewHandler(p)
+	service, _ := p.Client("service")
+	token, _ := p.ClientCredentials(service, "users:read")
+
+	rec := postForm(h.Introspect, url.Values{"token": {token.AccessToken}, "client_id": {"web"}}, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected public clients to be rejected, got %d", rec.Code)
+	}
+
+	introspect := func() Introspection {
+		var info Introspection
+		rec := postForm(h.Introspect, url.Values{"token": {token.AccessToken}}, basicAuth("service", "service-secret"))
+		json.NewDecoder(rec.Body).Decode(&info)
+		return info
+	}
+	if info := introspect(); !info.Active || info.Sub != "service" || info.Username != "" {
+		t.Errorf("unexpected introspection %+v", info)
+	}
+
+	if rec := postForm(h.Revoke, url.Values{"token": {"unknown"}}, basicAuth("service", "service-secret")); rec.Code != http.StatusOK {
+		t.Errorf("expected unknown tokens to be accepted, got %d", rec.Code)
+	}
+	if rec := postForm(h.Revoke, url.Values{"token": {token.AccessToken}}, basicAuth("service", "service-secret")); rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+	if info := introspect(); info.Active {
+		t.Errorf("expected the revoked token to be inactive, got %+v", info)
+	}
+}
+
+func TestHandler_DiscoveryAndJWKS(t *testing.T) {
+	p := newTestProvider(t)
+	h := NewHandler(p)
+
+	rec := httptest.NewRecorder()
+	h.Discovery(rec, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	var doc Discovery
+	json.NewDecoder(rec.Body).Decode(&doc)
+	if doc.Issuer != "http://localhost:8080" || doc.JWKSURI != "http://localhost:8080/oauth/jwks" || doc.CodeChallengeMethodsSupported[0] != "S256" {
+		t.Errorf("unexpected discovery document %+v", doc)
+	}
+
+	rec = httptest.NewRecorder()
+	h.JWKS(rec, httptest.NewRequest(http.MethodGet, "/oauth/jwks", nil))
+	var set JWKS
+	json.NewDecoder(rec.Body).Decode(&set)
+	if len(set.Keys) != 1 || set.Keys[0].E != "AQAB" {
+		t.Fatalf("unexpected JWKS %+v", set)
+	}
+
+	// トークンのkidでJWKSの鍵を選べる
+	service, _ := p.Client("service")
+	token, _ := p.ClientCredentials(service, "")
+	parsed, _, err := jwt.NewParser().ParseUnverified(token.AccessToken, &AccessClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header["kid"] != set.Keys[0].Kid || parsed.Header["typ"] != "at+jwt" {
+		t.Errorf("unexpected token header %v", parsed.Header)
+	}
+}
+
+// 削除されたユーザーのリフレッシュトークンは使えない
+func TestHandler_DeletedUser(t *testing.T) {
+	p := newTestProvider(t)
+	web, _ := p.Client("web")
+	code, _ := p.Authorize(web, web.RedirectURIs[0], 2, "openid", "", S256("verifier"))
+	token, err := p.ExchangeCode(web, code, web.RedirectURIs[0], "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.users.Delete(2)
+
+	rec := postForm(NewHandler(p).Token, url.Values{"grant_type": {"refresh_token"}, "client_id": {"web"}, "refresh_token": {token.RefreshToken}}, nil)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid_grant") {
+		t.Errorf("expected invalid_grant, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,608 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"k6-practice/api/metrics"
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+)
+
+// Client は登録済みのクライアント
+type Client struct {
+	ID string
+	// Secret: 空の場合は公開クライアント（認可コード + PKCE だけを使える）
+	Secret       string
+	RedirectURIs []string
+}
+
+// Public はシークレットを持たないクライアント（SPA・ネイティブアプリ）
+func (c Client) Public() bool {
+	return c.Secret == ""
+}
+
+// ParseClients は "ID:シークレット:リダイレクトURI|リダイレクトURI" 形式のクライアントを読み込む
+// シークレットが空の場合は公開クライアント、リダイレクトURIがない場合はクライアントクレデンシャルだけを使える
+func ParseClients(specs []string) ([]Client, error) {
+	var clients []Client
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, ":", 3)
+		if len(parts) < 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid OAuth client %q (want ID:SECRET[:REDIRECT_URI|...])", spec)
+		}
+		if seen[parts[0]] {
+			return nil, fmt.Errorf("duplicate OAuth client %q", parts[0])
+		}
+		seen[parts[0]] = true
+
+		c := Client{ID: parts[0], Secret: parts[1]}
+		if len(parts) == 3 && parts[2] != "" {
+			c.RedirectURIs = strings.Split(parts[2], "|")
+		}
+		if c.Public() && len(c.RedirectURIs) == 0 {
+			return nil, fmt.Errorf("public OAuth client %q needs a redirect URI", c.ID)
+		}
+		clients = append(clients, c)
+	}
+	return clients, nil
+}
+
+// LoadKey はPEM形式（PKCS#1 または PKCS#8）のRSA秘密鍵を読み込む
+func LoadKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA private key", path)
+	}
+	return key, nil
+}
+
+// Config はOAuth 2.0 認可サーバーの設定
+type Config struct {
+	// Issuer: トークンの iss とディスカバリーの各エンドポイントのベースURL
+	Issuer  string
+	Clients []Client
+	// Scopes: 要求できるスコープ（openid・profile・email はユーザーの情報に対応する）
+	Scopes []string
+	// Key: トークンの署名鍵（nilの場合は起動ごとに生成する）
+	Key             *rsa.PrivateKey
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	CodeTTL         time.Duration
+	// Revocations: アクセストークンの失効の一覧（nilの場合はプロバイダーごとに持つ）
+	Revocations *middleware.TokenRevocations
+}
+
+// 付与方式
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// accessTokenType はアクセストークンのJWTヘッダーの typ（RFC 9068、IDトークンと区別する）
+const accessTokenType = "at+jwt"
+
+// AccessClaims はアクセストークンのクレーム（RFC 9068）
+// sub はユーザーID、クライアントクレデンシャルではクライアントID
+type AccessClaims struct {
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope,omitempty"`
+	// Epoch: 発行時の失効の世代（middleware.Claims.Epoch と同じ）
+	Epoch int64 `json:"epoch,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// userID はユーザーのトークンのユーザーID（クライアントクレデンシャルでは0）
+func (c *AccessClaims) userID() int {
+	if c.Subject == c.ClientID {
+		return 0
+	}
+	id, _ := strconv.Atoi(c.Subject)
+	return id
+}
+
+// HasScope はトークンが scope を持つか
+func (c *AccessClaims) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(c.Scope), scope)
+}
+
+// IDClaims はIDトークンのクレーム（OpenID Connect Core 2）
+type IDClaims struct {
+	Nonce    string `json:"nonce,omitempty"`
+	AuthTime int64  `json:"auth_time,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Name     string `json:"name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// 付与の失敗（RFC 6749 5.2 のエラーコード）
+var (
+	ErrInvalidClient        = errors.New("invalid_client")
+	ErrInvalidGrant         = errors.New("invalid_grant")
+	ErrInvalidScope         = errors.New("invalid_scope")
+	ErrUnauthorizedClient   = errors.New("unauthorized_client")
+	ErrUnsupportedGrantType = errors.New("unsupported_grant_type")
+)
+
+// authCode は発行した認可コード（1回だけ交換できる）
+type authCode struct {
+	clientID    string
+	redirectURI string
+	userID      int
+	scope       string
+	nonce       string
+	challenge   string
+	authTime    time.Time
+	expiresAt   time.Time
+	epoch       int64
+}
+
+// refreshGrant はリフレッシュトークン（不透明な文字列、使うたびに発行し直す）
+type refreshGrant struct {
+	clientID  string
+	userID    int
+	scope     string
+	expiresAt time.Time
+	// epoch: 発行時の失効の世代（RevokeAll 以前のものは使えない）
+	epoch int64
+}
+
+// OAuthの統計
+var (
+	oauthStats          = new(expvar.Map).Init()
+	oauthTokens         = new(expvar.Map).Init()
+	oauthAuthorizations = new(expvar.Int)
+	oauthIntrospections = new(expvar.Int)
+	oauthRevocations    = new(expvar.Int)
+	oauthErrors         = new(expvar.Map).Init()
+)
+
+func init() {
+	oauthStats.Set("tokens", oauthTokens)
+	oauthStats.Set("authorizations", oauthAuthorizations)
+	oauthStats.Set("introspections", oauthIntrospections)
+	oauthStats.Set("revocations", oauthRevocations)
+	oauthStats.Set("errors", oauthErrors)
+	metrics.Set("oauth", oauthStats)
+}
+
+// Provider は models.UserStore のユーザーでトークンを発行する最小限のOAuth 2.0 認可サーバー（OpenID Provider）
+// 負荷テストでOIDCに依存するサービスの代わりのIDプロバイダーとして使う
+type Provider struct {
+	cfg         Config
+	users       *models.UserStore
+	key         *rsa.PrivateKey
+	keyID       string
+	clients     map[string]Client
+	revocations *middleware.TokenRevocations
+
+	mu        sync.Mutex
+	codes     map[string]*authCode
+	refresh   map[string]*refreshGrant
+	lastSweep time.Time
+}
+
+func NewProvider(cfg Config, users *models.UserStore) (*Provider, error) {
+	key := cfg.Key
+	if key == nil {
+		var err error
+		if key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			return nil, err
+		}
+	}
+	revocations := cfg.Revocations
+	if revocations == nil {
+		revocations = middleware.NewTokenRevocations()
+	}
+
+	p := &Provider{
+		cfg:         cfg,
+		users:       users,
+		key:         key,
+		keyID:       keyID(&key.PublicKey),
+		clients:     make(map[string]Client, len(cfg.Clients)),
+		revocations: revocations,
+		codes:       make(map[string]*authCode),
+		refresh:     make(map[string]*refreshGrant),
+	}
+	for _, c := range cfg.Clients {
+		p.clients[c.ID] = c
+	}
+	return p, nil
+}
+
+// keyID は公開鍵のkid（RFC 7638 のJWK Thumbprint）
+func keyID(pub *rsa.PublicKey) string {
+	thumbprint := fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, encodeInt(pub.E), base64.RawURLEncoding.EncodeToString(pub.N.Bytes()))
+	sum := sha256.Sum256([]byte(thumbprint))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func encodeInt(e int) string {
+	b := []byte{byte(e >> 24), byte(e >> 16), byte(e >> 8), byte(e)}
+	for len(b) > 1 && b[0] == 0 {
+		b = b[1:]
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Issuer はトークンの iss
+func (p *Provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+// Client は登録済みのクライアント
+func (p *Provider) Client(id string) (Client, bool) {
+	c, ok := p.clients[id]
+	return c, ok
+}
+
+// AuthenticateClient はクライアントを認証する（公開クライアントはシークレットなし）
+func (p *Provider) AuthenticateClient(id, secret string) (Client, error) {
+	c, ok := p.clients[id]
+	if !ok {
+		return Client{}, ErrInvalidClient
+	}
+	if c.Public() {
+		if secret != "" {
+			return Client{}, ErrInvalidClient
+		}
+		return c, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Secret), []byte(secret)) != 1 {
+		return Client{}, ErrInvalidClient
+	}
+	return c, nil
+}
+
+// validScope は要求されたスコープがすべて登録済みか
+func (p *Provider) validScope(scope string) bool {
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(p.cfg.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Authorize は認可コードを発行する（クライアント・リダイレクトURI・PKCEは呼び出し側で検証済み）
+func (p *Provider) Authorize(client Client, redirectURI string, userID int, scope, nonce, challenge string) (string, error) {
+	if !p.validScope(scope) {
+		return "", ErrInvalidScope
+	}
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sweep(now)
+	p.codes[code] = &authCode{
+		clientID:    client.ID,
+		redirectURI: redirectURI,
+		userID:      userID,
+		scope:       scope,
+		nonce:       nonce,
+		challenge:   challenge,
+		authTime:    now,
+		expiresAt:   now.Add(p.cfg.CodeTTL),
+		epoch:       p.revocations.Epoch(),
+	}
+	oauthAuthorizations.Add(1)
+	return code, nil
+}
+
+// Token はトークンエンドポイントのレスポンス（RFC 6749 5.1）
+type Token struct {
+	AccessToken  string `json:"access_token" openapi:"required"`
+	TokenType    string `json:"token_type" openapi:"required"`
+	ExpiresIn    int    `json:"expires_in" openapi:"required"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// ClientCredentials はクライアント自身のアクセストークンを発行する（機密クライアントだけ）
+func (p *Provider) ClientCredentials(client Client, scope string) (*Token, error) {
+	if client.Public() {
+		return nil, ErrUnauthorizedClient
+	}
+	// ユーザーのいないトークンにはユーザー情報のスコープを付けない
+	if !p.validScope(scope) || slices.ContainsFunc(strings.Fields(scope), isUserScope) {
+		return nil, ErrInvalidScope
+	}
+	return p.issue(GrantClientCredentials, client, 0, scope, "", time.Time{})
+}
+
+func isUserScope(scope string) bool {
+	return scope == "openid" || scope == "profile" || scope == "email"
+}
+
+// ExchangeCode は認可コードをトークンに交換する（RFC 7636 のPKCE、S256）
+func (p *Provider) ExchangeCode(client Client, code, redirectURI, verifier string) (*Token, error) {
+	p.mu.Lock()
+	c, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	if !ok || !p.current(c.expiresAt, c.epoch) || c.clientID != client.ID || c.redirectURI != redirectURI {
+		return nil, ErrInvalidGrant
+	}
+	if subtle.ConstantTimeCompare([]byte(S256(verifier)), []byte(c.challenge)) != 1 {
+		return nil, ErrInvalidGrant
+	}
+	return p.issue(GrantAuthorizationCode, client, c.userID, c.scope, c.nonce, c.authTime)
+}
+
+// S256 はPKCEのコードチャレンジ（BASE64URL(SHA256(code_verifier))）
+func S256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Refresh はリフレッシュトークンを新しいトークンに交換する（古いリフレッシュトークンは使えなくなる）
+// scope を指定した場合は元のスコープの範囲内に限る
+func (p *Provider) Refresh(client Client, refreshToken, scope string) (*Token, error) {
+	p.mu.Lock()
+	g, ok := p.refresh[refreshToken]
+	if !ok || g.clientID != client.ID || !p.current(g.expiresAt, g.epoch) {
+		p.mu.Unlock()
+		return nil, ErrInvalidGrant
+	}
+	if scope == "" {
+		scope = g.scope
+	}
+	granted := strings.Fields(g.scope)
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(granted, s) {
+			p.mu.Unlock()
+			return nil, ErrInvalidScope
+		}
+	}
+	delete(p.refresh, refreshToken)
+	p.mu.Unlock()
+
+	return p.issue(GrantRefreshToken, client, g.userID, scope, "", time.Time{})
+}
+
+// issue はアクセストークンと、ユーザーのトークンではリフレッシュトークン・IDトークン（openid）を発行する
+func (p *Provider) issue(grant string, client Client, userID int, scope, nonce string, authTime time.Time) (*Token, error) {
+	now := time.Now()
+	subject := client.ID
+	var user *models.User
+	if userID != 0 {
+		if user = p.users.Get(userID); user == nil {
+			// 認可の後にユーザーが削除された
+			return nil, ErrInvalidGrant
+		}
+		subject = strconv.Itoa(userID)
+	}
+
+	jti, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	epoch := p.revocations.Epoch()
+	access := jwt.NewWithClaims(jwt.SigningMethodRS256, &AccessClaims{
+		ClientID: client.ID,
+		Scope:    scope,
+		Epoch:    epoch,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.cfg.Issuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{client.ID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(p.cfg.AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
+	})
+	access.Header["typ"] = accessTokenType
+	access.Header["kid"] = p.keyID
+	token := &Token{TokenType: "Bearer", ExpiresIn: int(p.cfg.AccessTokenTTL.Seconds()), Scope: scope}
+	if token.AccessToken, err = access.SignedString(p.key); err != nil {
+		return nil, err
+	}
+
+	if user != nil {
+		if token.RefreshToken, err = randomToken(); err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		p.refresh[token.RefreshToken] = &refreshGrant{
+			clientID:  client.ID,
+			userID:    userID,
+			scope:     scope,
+			expiresAt: now.Add(p.cfg.RefreshTokenTTL),
+			epoch:     epoch,
+		}
+		p.mu.Unlock()
+	}
+
+	if user != nil && slices.Contains(strings.Fields(scope), "openid") {
+		claims := &IDClaims{
+			Nonce: nonce,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    p.cfg.Issuer,
+				Subject:   subject,
+				Audience:  jwt.ClaimStrings{client.ID},
+				ExpiresAt: jwt.NewNumericDate(now.Add(p.cfg.AccessTokenTTL)),
+				IssuedAt:  jwt.NewNumericDate(now),
+			},
+		}
+		if !authTime.IsZero() {
+			claims.AuthTime = authTime.Unix()
+		}
+		if slices.Contains(strings.Fields(scope), "email") {
+			claims.Email = user.Email
+		}
+		if slices.Contains(strings.Fields(scope), "profile") {
+			claims.Name = user.Name
+		}
+		id := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		id.Header["kid"] = p.keyID
+		if token.IDToken, err = id.SignedString(p.key); err != nil {
+			return nil, err
+		}
+	}
+
+	oauthTokens.Add(grant, 1)
+	return token, nil
+}
+
+// ParseAccessToken はこのプロバイダーが発行した、失効していないアクセストークンを検証する
+func (p *Provider) ParseAccessToken(token string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Header["typ"] != accessTokenType {
+			return nil, errors.New("not an access token")
+		}
+		return &p.key.PublicKey, nil
+	}, jwt.WithIssuer(p.cfg.Issuer), jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if !parsed.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	if p.revocations.Revoked(&middleware.Claims{UserID: claims.userID(), Epoch: claims.Epoch, RegisteredClaims: claims.RegisteredClaims}) {
+		return nil, middleware.ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// Introspection はトークンの状態（RFC 7662 2.2）
+type Introspection struct {
+	Active    bool   `json:"active" openapi:"required"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Aud       string `json:"aud,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
+
+// Introspect はアクセストークンまたはリフレッシュトークンの状態を返す
+// 無効・期限切れ・失効したトークンは active: false だけを返す
+func (p *Provider) Introspect(token string) Introspection {
+	oauthIntrospections.Add(1)
+
+	p.mu.Lock()
+	g, ok := p.refresh[token]
+	p.mu.Unlock()
+	if ok {
+		if !p.current(g.expiresAt, g.epoch) {
+			return Introspection{}
+		}
+		result := Introspection{Active: true, Scope: g.scope, ClientID: g.clientID, TokenType: GrantRefreshToken,
+			Exp: g.expiresAt.Unix(), Sub: strconv.Itoa(g.userID), Aud: g.clientID, Iss: p.cfg.Issuer}
+		if user := p.users.Get(g.userID); user != nil {
+			result.Username = user.Email
+		}
+		return result
+	}
+
+	claims, err := p.ParseAccessToken(token)
+	if err != nil {
+		return Introspection{}
+	}
+	result := Introspection{Active: true, Scope: claims.Scope, ClientID: claims.ClientID, TokenType: "Bearer",
+		Exp: claims.ExpiresAt.Unix(), Iat: claims.IssuedAt.Unix(), Sub: claims.Subject, Aud: claims.ClientID,
+		Iss: claims.Issuer, Jti: claims.ID}
+	if id := claims.userID(); id != 0 {
+		if user := p.users.Get(id); user != nil {
+			result.Username = user.Email
+		}
+	}
+	return result
+}
+
+// Revoke はクライアントに発行したトークンを失効させる（RFC 7009）
+// 無効なトークン・他のクライアントのトークンは何もしない
+func (p *Provider) Revoke(client Client, token string) {
+	oauthRevocations.Add(1)
+
+	p.mu.Lock()
+	if g, ok := p.refresh[token]; ok {
+		if g.clientID == client.ID {
+			delete(p.refresh, token)
+		}
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+
+	if claims, err := p.ParseAccessToken(token); err == nil && claims.ClientID == client.ID {
+		p.revocations.RevokeToken(claims.ID, claims.ExpiresAt.Time)
+	}
+}
+
+// sweep は期限切れの認可コードとリフレッシュトークンを削除する（CodeTTL に1回まで、p.mu を保持して呼ぶ）
+func (p *Provider) sweep(now time.Time) {
+	if now.Sub(p.lastSweep) < p.cfg.CodeTTL {
+		return
+	}
+	p.lastSweep = now
+	for code, c := range p.codes {
+		if now.After(c.expiresAt) {
+			delete(p.codes, code)
+		}
+	}
+	for token, g := range p.refresh {
+		if now.After(g.expiresAt) {
+			delete(p.refresh, token)
+		}
+	}
+}
+
+// current は認可コード・リフレッシュトークンが期限内で、失効した世代（RevokeAll 以前）のものでないか
+func (p *Provider) current(expiresAt time.Time, epoch int64) bool {
+	return time.Now().Before(expiresAt) && epoch >= p.revocations.Epoch()
+}
+
+// randomToken は認可コード・リフレッシュトークン・jti に使う256ビットのランダムな文字列
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,307 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"k6-practice/api/models"
+)
+
+var (
+	testKeyOnce sync.Once
+	testKey     *rsa.PrivateKey
+)
+
+// newTestProvider は鍵の生成を1回にまとめたプロバイダー（ユーザーはalice=1, bob=2）
+func newTestProvider(t *testing.T) *Provider {
+	t.Helper()
+	testKeyOnce.Do(func() {
+		testKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	})
+	users := models.NewUserStore()
+	p, err := NewProvider(Config{
+		Issuer: "http://localhost:8080",
+		Clients: []Client{
+			{ID: "service", Secret: "service-secret"},
+			{ID: "web", RedirectURIs: []string{"http://localhost:3000/callback"}},
+			{ID: "other", Secret: "other-secret", RedirectURIs: []string{"http://localhost:4000/callback"}},
+		},
+		Scopes:          []string{"openid", "profile", "email", "users:read"},
+		Key:             testKey,
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+		CodeTTL:         time.Minute,
+	}, users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParseClients(t *testing.T) {
+	tests := []struct {
+		name      string
+		specs     []string
+		expected  []Client
+		expectErr bool
+	}{
+		{"confidential", []string{"svc:secret"}, []Client{{ID: "svc", Secret: "secret"}}, false},
+		{"public with redirect URIs", []string{"spa::http://localhost/a|http://localhost/b"},
+			[]Client{{ID: "spa", RedirectURIs: []string{"http://localhost/a", "http://localhost/b"}}}, false},
+		{"confidential with redirect URI", []string{"app:s:https://app.example.com/cb"},
+			[]Client{{ID: "app", Secret: "s", RedirectURIs: []string{"https://app.example.com/cb"}}}, false},
+		{"public without redirect URI", []string{"spa:"}, nil, true},
+		{"missing secret separator", []string{"svc"}, nil, true},
+		{"duplicate", []string{"svc:a", "svc:b"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients, err := ParseClients(tt.specs)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error=%v, got %v", tt.expectErr, err)
+			}
+			if len(clients) != len(tt.expected) {
+				t.Fatalf("expected %+v, got %+v", tt.expected, clients)
+			}
+			for i := range clients {
+				if clients[i].ID != tt.expected[i].ID || clients[i].Secret != tt.expected[i].Secret ||
+					strings.Join(clients[i].RedirectURIs, " ") != strings.Join(tt.expected[i].RedirectURIs, " ") {
+					t.Errorf("expected %+v, got %+v", tt.expected[i], clients[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	dir := t.TempDir()
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	files := map[string][]byte{
+		"pkcs1.pem": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		"pkcs8.pem": pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+		"bad.pem":   []byte("not a key"),
+	}
+	for name, data := range files {
+		os.WriteFile(filepath.Join(dir, name), data, 0o600)
+	}
+
+	for _, name := range []string{"pkcs1.pem", "pkcs8.pem"} {
+		loaded, err := LoadKey(filepath.Join(dir, name))
+		if err != nil || !loaded.Equal(key) {
+			t.Errorf("%s: expected the key to load, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"bad.pem", "missing.pem"} {
+		if _, err := LoadKey(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestProvider_ClientCredentials(t *testing.T) {
+	p := newTestProvider(t)
+	service, _ := p.Client("service")
+	web, _ := p.Client("web")
+
+	tests := []struct {
+		name        string
+		client      Client
+		scope       string
+		expectedErr error
+	}{
+		{"service token", service, "users:read", nil},
+		{"public client", web, "users:read", ErrUnauthorizedClient},
+		{"unknown scope", service, "users:delete", ErrInvalidScope},
+		{"user scope without a user", service, "openid", ErrInvalidScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := p.ClientCredentials(tt.client, tt.scope)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected %v, got %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if token.RefreshToken != "" || token.IDToken != "" {
+				t.Error("expected only an access token for client credentials")
+			}
+			claims, err := p.ParseAccessToken(token.AccessToken)
+			if err != nil || claims.Subject != "service" || claims.Scope != "users:read" {
+				t.Errorf("unexpected claims %+v (%v)", claims, err)
+			}
+		})
+	}
+}
+
+func TestProvider_AuthorizationCode(t *testing.T) {
+	p := newTestProvider(t)
+	web, _ := p.Client("web")
+	other, _ := p.Client("other")
+	redirect := web.RedirectURIs[0]
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	authorize := func(t *testing.T) string {
+		t.Helper()
+		code, err := p.Authorize(web, redirect, 1, "openid profile email", "n-0S6_WzA2Mj", S256(verifier))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	// RFC 7636 付録Bの例
+	if got := S256(verifier); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("unexpected code challenge %s", got)
+	}
+
+	tests := []struct {
+		name     string
+		client   Client
+		redirect string
+		verifier string
+	}{
+		{"wrong verifier", web, redirect, "wrong-verifier"},
+		{"wrong redirect URI", web, "http://localhost:3000/other", verifier},
+		{"another client", other, redirect, verifier},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := p.ExchangeCode(tt.client, authorize(t), tt.redirect, tt.verifier); !errors.Is(err, ErrInvalidGrant) {
+				t.Errorf("expected ErrInvalidGrant, got %v", err)
+			}
+		})
+	}
+
+	code := authorize(t)
+	token, err := p.ExchangeCode(web, code, redirect, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.ExchangeCode(web, code, redirect, verifier); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("expected the code to be usable only once, got %v", err)
+	}
+
+	id := &IDClaims{}
+	if _, err := jwt.ParseWithClaims(token.IDToken, id, func(*jwt.Token) (interface{}, error) {
+		return &testKey.PublicKey, nil
+	}, jwt.WithAudience("web"), jwt.WithIssuer("http://localhost:8080")); err != nil {
+		t.Fatal(err)
+	}
+	if id.Subject != "1" || id.Nonce != "n-0S6_WzA2Mj" || id.Email != "alice@example.com" || id.Name == "" {
+		t.Errorf("unexpected ID token claims %+v", id)
+	}
+	// IDトークンはアクセストークンとして使えない
+	if _, err := p.ParseAccessToken(token.IDToken); err == nil {
+		t.Error("expected the ID token to be rejected as an access token")
+	}
+
+	if _, err := p.Authorize(web, redirect, 1, "admin", "", S256(verifier)); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("expected ErrInvalidScope, got %v", err)
+	}
+}
+
+func TestProvider_RefreshIntrospectRevoke(t *testing.T) {
+	p := newTestProvider(t)
+	web, _ := p.Client("web")
+	other, _ := p.Client("other")
+	code, _ := p.Authorize(web, web.RedirectURIs[0], 2, "openid users:read", "", S256("verifier"))
+	token, err := p.ExchangeCode(web, code, web.RedirectURIs[0], "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Refresh(web, token.RefreshToken, "openid email"); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("expected widening the scope to fail, got %v", err)
+	}
+	if _, err := p.Refresh(other, token.RefreshToken, ""); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("expected another client's refresh to fail, got %v", err)
+	}
+	refreshed, err := p.Refresh(web, token.RefreshToken, "users:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.Scope != "users:read" || refreshed.IDToken != "" {
+		t.Errorf("expected a narrowed token without an ID token, got %+v", refreshed)
+	}
+	if _, err := p.Refresh(web, token.RefreshToken, ""); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("expected the rotated refresh token to be rejected, got %v", err)
+	}
+
+	info := p.Introspect(refreshed.AccessToken)
+	if !info.Active || info.Sub != "2" || info.ClientID != "web" || info.Username != "bob@example.com" || info.Scope != "users:read" {
+		t.Errorf("unexpected introspection %+v", info)
+	}
+	if info := p.Introspect(refreshed.RefreshToken); !info.Active || info.TokenType != GrantRefreshToken {
+		t.Errorf("expected an active refresh token, got %+v", info)
+	}
+	if info := p.Introspect("garbage"); info.Active {
+		t.Errorf("expected an inactive token, got %+v", info)
+	}
+
+	// 他のクライアントは失効させられない
+	p.Revoke(other, refreshed.AccessToken)
+	if !p.Introspect(refreshed.AccessToken).Active {
+		t.Error("expected another client's revocation to be ignored")
+	}
+	p.Revoke(web, refreshed.AccessToken)
+	p.Revoke(web, refreshed.RefreshToken)
+	if p.Introspect(refreshed.AccessToken).Active || p.Introspect(refreshed.RefreshToken).Active {
+		t.Error("expected revoked tokens to be inactive")
+	}
+	if _, err := p.Refresh(web, refreshed.RefreshToken, ""); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("expected a revoked refresh token to be rejected, got %v", err)
+	}
+}
+
+func TestProvider_RevokeAll(t *testing.T) {
+	p := newTestProvider(t)
+	web, _ := p.Client("web")
+	redirect := web.RedirectURIs[0]
+	code, _ := p.Authorize(web, redirect, 1, "openid", "", S256("verifier"))
+	pending, _ := p.Authorize(web, redirect, 1, "openid", "", S256("verifier"))
+	token, err := p.ExchangeCode(web, code, redirect, "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ストアの初期化で振り直したユーザーIDに、以前のトークンや認可コードが使われないようにする
+	p.revocations.RevokeAll()
+
+	if info := p.Introspect(token.AccessToken); info.Active {
+		t.Errorf("expected the access token to be revoked, got %+v", info)
+	}
+	if info := p.Introspect(token.RefreshToken); info.Active {
+		t.Errorf("expected the refresh token to be revoked, got %+v", info)
+	}
+	if _, err := p.Refresh(web, token.RefreshToken, ""); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("expected the refresh token to be rejected, got %v", err)
+	}
+	if _, err := p.ExchangeCode(web, pending, redirect, "verifier"); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("expected the authorization code to be rejected, got %v", err)
+	}
+
+	code, _ = p.Authorize(web, redirect, 1, "openid", "", S256("verifier"))
+	token, err = p.ExchangeCode(web, code, redirect, "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Introspect(token.AccessToken).Active || !p.Introspect(token.RefreshToken).Active {
+		t.Error("expected tokens issued after the revocation to be active")
+	}
+}
@@ -0,0 +1,162 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema はJSON Schema (OpenAPI 3.1 dialect) のサブセット
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf はGoの値の型からスキーマを生成する
+//
+// 構造体フィールドはjsonタグの名前で出力され、openapiタグで制約を付与できる:
+//
+//	Name string `json:"name" openapi:"required,minLength=1,maxLength=100"`
+//
+// 構造体は additionalProperties: false として扱う（未知のフィールドを許可しない）
+func SchemaOf(v interface{}) *Schema {
+	return schemaOfType(reflect.TypeOf(v))
+}
+
+func schemaOfType(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaOfType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object"}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return &Schema{}
+}
+
+func structSchema(t reflect.Type) *Schema {
+	closed := false
+	s := &Schema{
+		Type:                 "object",
+		Properties:           make(map[string]*Schema),
+		AdditionalProperties: &closed,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		// 埋め込み構造体はフィールドを展開する
+		if f.Anonymous && name == "" {
+			embedded := schemaOfType(f.Type)
+			for k, v := range embedded.Properties {
+				s.Properties[k] = v
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := schemaOfType(f.Type)
+		if applyTag(prop, f.Tag.Get("openapi")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = prop
+	}
+	return s
+}
+
+// applyTag はopenapiタグの制約をスキーマに反映し、requiredかどうかを返す
+func applyTag(s *Schema, tag string) bool {
+	required := false
+	if tag == "" {
+		return required
+	}
+
+	for _, part := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "required":
+			required = true
+		case "format":
+			s.Format = value
+		case "description":
+			s.Description = value
+		case "minLength":
+			s.MinLength = intPtr(value)
+		case "maxLength":
+			s.MaxLength = intPtr(value)
+		case "minimum":
+			s.Minimum = floatPtr(value)
+		case "maximum":
+			s.Maximum = floatPtr(value)
+		case "enum":
+			for _, e := range strings.Split(value, "|") {
+				s.Enum = append(s.Enum, e)
+			}
+		}
+	}
+	return required
+}
+
+func intPtr(v string) *int {
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return nil
+	}
+	return &i
+}
+
+func floatPtr(v string) *float64 {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+// Int はスキーマ制約用のintポインタを返すヘルパー
+func Int(v int) *int {
+	return &v
+}
+
+// Float はスキーマ制約用のfloat64ポインタを返すヘルパー
+func Float(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,89 @@
+package openapi
+
+import (
+	"testing"
+	"time"
+)
+
+type testEmbedded struct {
+	CreatedAt time.Time `json:"created_at" openapi:"required"`
+}
+
+type testRequest struct {
+	testEmbedded
+	Name    string   `json:"name" openapi:"required,minLength=1,maxLength=100"`
+	Email   string   `json:"email,omitempty" openapi:"format=email"`
+	Age     int      `json:"age" openapi:"minimum=0,maximum=150"`
+	Tags    []string `json:"tags"`
+	Role    string   `json:"role" openapi:"enum=admin|member"`
+	Ignored string   `json:"-"`
+	private string
+}
+
+func TestSchemaOf(t *testing.T) {
+	s := SchemaOf(testRequest{})
+
+	if s.Type != "object" {
+		t.Fatalf("expected type object, got %q", s.Type)
+	}
+	if s.AdditionalProperties == nil || *s.AdditionalProperties {
+		t.Error("expected additionalProperties to be false")
+	}
+
+	t.Run("properties", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			typ    string
+			format string
+		}{
+			{"created_at", "string", "date-time"},
+			{"name", "string", ""},
+			{"email", "string", "email"},
+			{"age", "integer", ""},
+			{"tags", "array", ""},
+			{"role", "string", ""},
+		}
+		for _, tt := range tests {
+			prop, ok := s.Properties[tt.name]
+			if !ok {
+				t.Errorf("expected property %q", tt.name)
+				continue
+			}
+			if prop.Type != tt.typ || prop.Format != tt.format {
+				t.Errorf("property %q = %s/%s, want %s/%s", tt.name, prop.Type, prop.Format, tt.typ, tt.format)
+			}
+		}
+		if len(s.Properties) != len(tests) {
+			t.Errorf("expected %d properties, got %d", len(tests), len(s.Properties))
+		}
+	})
+
+	t.Run("constraints", func(t *testing.T) {
+		name := s.Properties["name"]
+		if name.MinLength == nil || *name.MinLength != 1 || name.MaxLength == nil || *name.MaxLength != 100 {
+			t.Error("expected name length constraints 1..100")
+		}
+		age := s.Properties["age"]
+		if age.Minimum == nil || *age.Minimum != 0 || age.Maximum == nil || *age.Maximum != 150 {
+			t.Error("expected age range 0..150")
+		}
+		if len(s.Properties["role"].Enum) != 2 {
+			t.Error("expected role enum with 2 values")
+		}
+		if s.Properties["tags"].Items.Type != "string" {
+			t.Error("expected tags items to be string")
+		}
+	})
+
+	t.Run("required", func(t *testing.T) {
+		want := map[string]bool{"created_at": true, "name": true}
+		if len(s.Required) != len(want) {
+			t.Fatalf("expected required %v, got %v", want, s.Required)
+		}
+		for _, r := range s.Required {
+			if !want[r] {
+				t.Errorf("unexpected required field %q", r)
+			}
+		}
+	})
+}
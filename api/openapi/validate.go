@@ -0,0 +1,221 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Violation はスキーマ違反1件
+type Violation struct {
+	In     string `json:"in"`    // "path" | "query" | "body" | "response"
+	Field  string `json:"field"` // パラメータ名、またはボディ内のJSON Pointer
+	Reason string `json:"reason"`
+}
+
+// Validator はドキュメントのスキーマに基づいて値を検証する
+type Validator struct {
+	Doc *Document
+	// Formats は format キーワードの検証関数（未登録のformatは検証しない）
+	Formats map[string]func(string) bool
+}
+
+// ValidateParams はパス・クエリパラメータを検証
+func (v *Validator) ValidateParams(op *Operation, pathParams map[string]string, query map[string][]string) []Violation {
+	var violations []Violation
+	for _, p := range op.Parameters {
+		var raw string
+		var present bool
+		switch p.In {
+		case "path":
+			raw, present = pathParams[p.Name]
+		case "query":
+			if values, ok := query[p.Name]; ok && len(values) > 0 {
+				raw, present = values[0], true
+			}
+		default:
+			continue
+		}
+
+		if !present {
+			if p.Required {
+				violations = append(violations, Violation{In: p.In, Field: p.Name, Reason: "is required"})
+			}
+			continue
+		}
+
+		value, ok := coerce(raw, v.Doc.Resolve(p.Schema))
+		if !ok {
+			violations = append(violations, Violation{In: p.In, Field: p.Name, Reason: "must be " + v.Doc.Resolve(p.Schema).Type})
+			continue
+		}
+		violations = append(violations, v.ValidateValue(p.In, p.Name, p.Schema, value)...)
+	}
+	return violations
+}
+
+// coerce は文字列パラメータをスキーマの型に変換
+func coerce(raw string, s *Schema) (interface{}, bool) {
+	if s == nil {
+		return raw, true
+	}
+	switch s.Type {
+	case "integer":
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			return nil, false
+		}
+		return json.Number(raw), true
+	case "number":
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return nil, false
+		}
+		return json.Number(raw), true
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, false
+		}
+		return b, true
+	}
+	return raw, true
+}
+
+// ValidateBody はJSONボディを検証
+func (v *Validator) ValidateBody(in string, s *Schema, body []byte) []Violation {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return []Violation{{In: in, Field: "", Reason: "must be valid JSON"}}
+	}
+	if dec.More() {
+		return []Violation{{In: in, Field: "", Reason: "must contain a single JSON value"}}
+	}
+	return v.ValidateValue(in, "", s, value)
+}
+
+// ValidateValue はデコード済みのJSON値をスキーマで検証
+// 数値はjson.Numberとしてデコードされている前提
+func (v *Validator) ValidateValue(in, field string, s *Schema, value interface{}) []Violation {
+	s = v.Doc.Resolve(s)
+	if s == nil {
+		return nil
+	}
+
+	fail := func(format string, args ...interface{}) []Violation {
+		return []Violation{{In: in, Field: field, Reason: fmt.Sprintf(format, args...)}}
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fail("must be object")
+		}
+		return v.validateObject(in, field, s, obj)
+
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fail("must be array")
+		}
+		var violations []Violation
+		for i, item := range arr {
+			violations = append(violations, v.ValidateValue(in, field+"/"+strconv.Itoa(i), s.Items, item)...)
+		}
+		return violations
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fail("must be string")
+		}
+		return v.validateString(in, field, s, str)
+
+	case "integer", "number":
+		num, ok := value.(json.Number)
+		if !ok {
+			return fail("must be %s", s.Type)
+		}
+		f, err := num.Float64()
+		if err != nil || (s.Type == "integer" && f != math.Trunc(f)) {
+			return fail("must be %s", s.Type)
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return fail("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			return fail("must be <= %v", *s.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fail("must be boolean")
+		}
+	}
+	return nil
+}
+
+func (v *Validator) validateObject(in, field string, s *Schema, obj map[string]interface{}) []Violation {
+	var violations []Violation
+
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			violations = append(violations, Violation{In: in, Field: field + "/" + name, Reason: "is required"})
+		}
+	}
+
+	// 違反の順序を安定させるためキーをソート
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, name := range keys {
+		prop, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				violations = append(violations, Violation{In: in, Field: field + "/" + name, Reason: "is not allowed"})
+			}
+			continue
+		}
+		violations = append(violations, v.ValidateValue(in, field+"/"+name, prop, obj[name])...)
+	}
+	return violations
+}
+
+func (v *Validator) validateString(in, field string, s *Schema, str string) []Violation {
+	fail := func(format string, args ...interface{}) []Violation {
+		return []Violation{{In: in, Field: field, Reason: fmt.Sprintf(format, args...)}}
+	}
+
+	length := utf8.RuneCountInString(str)
+	if s.MinLength != nil && length < *s.MinLength {
+		return fail("must be at least %d characters", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		return fail("must be at most %d characters", *s.MaxLength)
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if e == str {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fail("must be one of %v", s.Enum)
+		}
+	}
+	if check, ok := v.Formats[s.Format]; ok && s.Format != "" && !check(str) {
+		return fail("must be a valid %s", s.Format)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package openapi
+
+import "testing"
+
+func TestValidator_ValidateBody(t *testing.T) {
+	doc := New("test", "1.0.0")
+	doc.Components.Schemas["Req"] = SchemaOf(testRequest{})
+	v := &Validator{Doc: doc, Formats: map[string]func(string) bool{
+		"email": func(s string) bool { return s == "ok@example.com" },
+	}}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"valid", `{"created_at":"2024-01-01T00:00:00Z","name":"a","email":"ok@example.com","age":30,"role":"admin"}`, 0},
+		{"missing required", `{"name":"a"}`, 1},
+		{"unknown field", `{"created_at":"x","name":"a","nope":1}`, 1},
+		{"integer with fraction", `{"created_at":"x","name":"a","age":1.5}`, 1},
+		{"out of range", `{"created_at":"x","name":"a","age":200}`, 1},
+		{"enum mismatch", `{"created_at":"x","name":"a","role":"root"}`, 1},
+		{"format mismatch", `{"created_at":"x","name":"a","email":"bad"}`, 1},
+		{"array item type", `{"created_at":"x","name":"a","tags":["ok",1]}`, 1},
+		{"not an object", `[]`, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := v.ValidateBody("body", Ref("Req"), []byte(tt.body))
+			if len(got) != tt.want {
+				t.Errorf("expected %d violations, got %d: %+v", tt.want, len(got), got)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"k6-practice/api/openapi"
+	"k6-practice/api/requestid"
+)
+
+// ContentType はRFC 7807のメディアタイプ
+const ContentType = "application/problem+json"
+
+// Code はクライアントが分岐に使う機械可読なエラーコード
+// 一度公開したコードは変更しない
+type Code string
+
+const (
+	CodeBadRequest           Code = "bad_request"
+	CodeInvalidBody          Code = "invalid_body"
+	CodeInvalidParameter     Code = "invalid_parameter"
+	CodeValidationFailed     Code = "validation_failed"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeInvalidCredentials   Code = "invalid_credentials"
+	CodeInvalidToken         Code = "invalid_token"
+	CodeInvalidMFACode       Code = "invalid_mfa_code"
+	CodeInsufficientScope    Code = "insufficient_scope"
+	CodeCSRFFailed           Code = "csrf_failed"
+	CodeNotFound             Code = "not_found"
+	CodeUserNotFound         Code = "user_not_found"
+	CodeMethodNotAllowed     Code = "method_not_allowed"
+	CodeNotAcceptable        Code = "not_acceptable"
+	CodeBodyTooLarge         Code = "body_too_large"
+	CodeUnknownEncoding      Code = "unknown_encoding"
+	CodeRateLimited          Code = "rate_limited"
+	CodeLoginLocked          Code = "login_locked"
+	CodeIdempotencyKeyInUse  Code = "idempotency_key_in_use"
+	CodeIdempotencyKeyReused Code = "idempotency_key_reused"
+	CodeTimeout              Code = "timeout"
+	CodeUpstreamTimeout      Code = "upstream_timeout"
+	CodeOverloaded           Code = "overloaded"
+	CodeBadGateway           Code = "bad_gateway"
+	CodeUpstreamUnavailable  Code = "upstream_unavailable"
+	CodeConflict             Code = "conflict"
+	CodeInternal             Code = "internal_error"
+)
+
+type definition struct {
+	status int
+	title  string
+}
+
+// definitions はコードごとのHTTPステータスとタイトル
+var definitions = map[Code]definition{
+	CodeBadRequest:           {http.StatusBadRequest, "Bad request"},
+	CodeInvalidBody:          {http.StatusBadRequest, "Invalid request body"},
+	CodeInvalidParameter:     {http.StatusBadRequest, "Invalid parameter"},
+	CodeValidationFailed:     {http.StatusBadRequest, "Request validation failed"},
+	CodeUnauthorized:         {http.StatusUnauthorized, "Unauthorized"},
+	CodeInvalidCredentials:   {http.StatusUnauthorized, "Invalid credentials"},
+	CodeInvalidToken:         {http.StatusUnauthorized, "Invalid token"},
+	CodeInvalidMFACode:       {http.StatusUnauthorized, "Invalid MFA code"},
+	CodeInsufficientScope:    {http.StatusForbidden, "Insufficient scope"},
+	CodeCSRFFailed:           {http.StatusForbidden, "CSRF validation failed"},
+	CodeNotFound:             {http.StatusNotFound, "Not found"},
+	CodeUserNotFound:         {http.StatusNotFound, "User not found"},
+	CodeMethodNotAllowed:     {http.StatusMethodNotAllowed, "Method not allowed"},
+	CodeNotAcceptable:        {http.StatusNotAcceptable, "Not acceptable"},
+	CodeBodyTooLarge:         {http.StatusRequestEntityTooLarge, "Request body too large"},
+	CodeUnknownEncoding:      {http.StatusUnsupportedMediaType, "Unsupported content encoding"},
+	CodeRateLimited:          {http.StatusTooManyRequests, "Rate limit exceeded"},
+	CodeLoginLocked:          {http.StatusTooManyRequests, "Too many failed login attempts"},
+	CodeIdempotencyKeyInUse:  {http.StatusConflict, "Idempotency key in use"},
+	CodeIdempotencyKeyReused: {http.StatusUnprocessableEntity, "Idempotency key reused"},
+	CodeTimeout:              {http.StatusServiceUnavailable, "Request timed out"},
+	CodeUpstreamTimeout:      {http.StatusGatewayTimeout, "Upstream timed out"},
+	CodeOverloaded:           {http.StatusServiceUnavailable, "Server overloaded"},
+	CodeBadGateway:           {http.StatusBadGateway, "Bad gateway"},
+	CodeUpstreamUnavailable:  {http.StatusServiceUnavailable, "Upstream unavailable"},
+	CodeConflict:             {http.StatusConflict, "Conflict"},
+	CodeInternal:             {http.StatusInternalServerError, "Internal server error"},
+}
+
+// Problem はRFC 7807 Problem Details
+type Problem struct {
+	Type      string              `json:"type" openapi:"required"`
+	Title     string              `json:"title" openapi:"required"`
+	Status    int                 `json:"status" openapi:"required"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      Code                `json:"code" openapi:"required"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []openapi.Violation `json:"errors,omitempty"`
+}
+
+// Codes は定義済みのエラーコード一覧を昇順で返す
+func Codes() []string {
+	codes := make([]string, 0, len(definitions))
+	for code := range definitions {
+		codes = append(codes, string(code))
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// New はコードに対応するProblemを作成
+func New(code Code, detail string) *Problem {
+	def, ok := definitions[code]
+	if !ok {
+		def = definitions[CodeInternal]
+	}
+	return &Problem{
+		Type:   TypeURI(code),
+		Title:  def.title,
+		Status: def.status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// TypeURI はコードに対応するtype URIを返す（例: /problems/user-not-found）
+func TypeURI(code Code) string {
+	return "/problems/" + strings.ReplaceAll(string(code), "_", "-")
+}
+
+// Status はコードに対応するHTTPステータスを返す
+func Status(code Code) int {
+	if def, ok := definitions[code]; ok {
+		return def.status
+	}
+	return http.StatusInternalServerError
+}
+
+// Write はProblemをレスポンスとして送信する
+// instanceにはリクエストパス、request_idにはリクエストIDを設定する
+func Write(w http.ResponseWriter, r *http.Request, code Code, detail string) {
+	WriteProblem(w, r, New(code, detail))
+}
+
+// WriteProblem は組み立て済みのProblemを送信する
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = requestid.FromContext(r.Context())
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// MethodNotAllowed はAllowヘッダー付きの405を送信する
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	Write(w, r, CodeMethodNotAllowed, r.Method+" is not allowed on this resource")
+}
@@ -0,0 +1,72 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k6-practice/api/requestid"
+)
+
+func TestWrite(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users/999", nil)
+	req = req.WithContext(requestid.NewContext(req.Context(), "req-123"))
+	rec := httptest.NewRecorder()
+
+	Write(rec, req, CodeUserNotFound, "user not found")
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("expected Content-Type %s, got %q", ContentType, ct)
+	}
+
+	var p Problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	tests := []struct {
+		field    string
+		got      interface{}
+		expected interface{}
+	}{
+		{"type", p.Type, "/problems/user-not-found"},
+		{"title", p.Title, "User not found"},
+		{"status", p.Status, http.StatusNotFound},
+		{"detail", p.Detail, "user not found"},
+		{"instance", p.Instance, "/users/999"},
+		{"code", p.Code, CodeUserNotFound},
+		{"request_id", p.RequestID, "req-123"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("%s = %v, want %v", tt.field, tt.got, tt.expected)
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPatch, "/users", nil)
+	rec := httptest.NewRecorder()
+
+	MethodNotAllowed(rec, req, http.MethodGet, http.MethodPost)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow != "GET, POST" {
+		t.Errorf("expected Allow 'GET, POST', got %q", allow)
+	}
+}
+
+func TestCodesHaveDefinitions(t *testing.T) {
+	for _, code := range Codes() {
+		p := New(Code(code), "")
+		if p.Status < 400 || p.Title == "" {
+			t.Errorf("code %s has no valid definition", code)
+		}
+	}
+}
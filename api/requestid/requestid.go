@@ -0,0 +1,71 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header はリクエストIDを受け渡すHTTPヘッダー
+const Header = "X-Request-ID"
+
+// 受け付けるリクエストIDの最大長（ログ汚染防止）
+const maxLength = 128
+
+type contextKey struct{}
+
+// NewContext はリクエストIDを持つコンテキストを返す
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext はコンテキストからリクエストIDを取得（未設定なら空文字）
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Middleware はリクエストIDを払い出してコンテキストとレスポンスヘッダーに設定する
+// クライアント（k6等）が X-Request-ID を送った場合は妥当な値であればそれを引き継ぐ
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := Resolve(r.Header.Get(Header))
+
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// Resolve はクライアントが送ったIDが妥当ならそのまま、そうでなければ新しいIDを返す
+// （HTTPヘッダー以外、gRPCのメタデータなどから受け取る場合に使う）
+func Resolve(id string) string {
+	if !valid(id) {
+		return generate()
+	}
+	return id
+}
+
+func generate() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// valid は英数字と - _ . のみで構成される適切な長さのIDかを判定
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-' || c == '_' || c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"generates id when missing", "", false},
+		{"keeps valid incoming id", "k6-vu1-iter42", true},
+		{"replaces id with invalid characters", "bad id\n", false},
+		{"replaces overly long id", strings.Repeat("a", maxLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(Header, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(Header)
+			if got == "" || got != seen {
+				t.Fatalf("expected response header to match context id, got %q and %q", got, seen)
+			}
+			if tt.keep && got != tt.incoming {
+				t.Errorf("expected incoming id %q to be kept, got %q", tt.incoming, got)
+			}
+			if !tt.keep && got == tt.incoming {
+				t.Errorf("expected incoming id %q to be replaced", tt.incoming)
+			}
+		})
+	}
+}
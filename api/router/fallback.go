@@ -0,0 +1,46 @@
+package router
+
+import (
+	"net/http"
+
+	"k6-practice/api/problem"
+)
+
+// problemFallback はServeMuxが自動生成する404/405をProblem形式に置き換える
+// 405のAllowヘッダーはServeMuxが登録済みパターンから設定したものをそのまま使う
+func problemFallback(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(&fallbackWriter{ResponseWriter: w, r: r}, r)
+	})
+}
+
+// fallbackWriter は404/405のステータスを検出するとボディをProblemに差し替える
+type fallbackWriter struct {
+	http.ResponseWriter
+	r        *http.Request
+	replaced bool
+}
+
+func (fw *fallbackWriter) WriteHeader(code int) {
+	switch code {
+	case http.StatusNotFound:
+		fw.replaced = true
+		problem.Write(fw.ResponseWriter, fw.r, problem.CodeNotFound, "no route matches "+fw.r.URL.Path)
+	case http.StatusMethodNotAllowed:
+		fw.replaced = true
+		problem.Write(fw.ResponseWriter, fw.r, problem.CodeMethodNotAllowed, fw.r.Method+" is not allowed on this resource")
+	default:
+		fw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (fw *fallbackWriter) Write(b []byte) (int, error) {
+	if fw.replaced {
+		return len(b), nil
+	}
+	return fw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,69 @@
+package router
+
+import (
+	"net/http"
+
+	"k6-practice/api/middleware"
+)
+
+// route はServeMuxに登録する1ルート（メソッド + パス）
+type route struct {
+	op      operation
+	prefix  string // グループのプレフィックス（例: /v1）
+	chain   *middleware.Chain
+	handler http.Handler
+}
+
+// path はプレフィックス込みのパス（OpenAPI・ServeMuxの両方で同じ書式）
+func (rt *route) path() string {
+	return rt.prefix + rt.op.path
+}
+
+// pattern はServeMuxに登録するパターン（例: GET /users/{id}）
+func (rt *route) pattern() string {
+	return rt.op.method + " " + rt.path()
+}
+
+// name はログ・メトリクス用のルート名（operationId、プレフィックスがあれば付与）
+func (rt *route) name() string {
+	if rt.prefix == "" {
+		return rt.op.id
+	}
+	return rt.prefix[1:] + "." + rt.op.id
+}
+
+// group は共通のプレフィックスとミドルウェアを持つルートの集まり
+type group struct {
+	prefix string
+	chain  *middleware.Chain
+	routes *[]*route
+}
+
+func newGroup() *group {
+	return &group{chain: middleware.NewChain(), routes: &[]*route{}}
+}
+
+// Group はプレフィックスとミドルウェアを追加したサブグループを返す
+// 親グループのミドルウェアが先に適用される
+func (g *group) Group(prefix string, mws ...middleware.Middleware) *group {
+	return &group{
+		prefix: g.prefix + prefix,
+		chain:  g.chain.Append(mws...),
+		routes: g.routes,
+	}
+}
+
+// Handle はルートを登録する。mwsはこのルートだけに適用するミドルウェア
+func (g *group) Handle(op operation, handler http.Handler, mws ...middleware.Middleware) {
+	*g.routes = append(*g.routes, &route{
+		op:      op,
+		prefix:  g.prefix,
+		chain:   g.chain.Append(mws...),
+		handler: handler,
+	})
+}
+
+// HandleFunc はHandlerFuncを登録する
+func (g *group) HandleFunc(op operation, fn http.HandlerFunc, mws ...middleware.Middleware) {
+	g.Handle(op, fn, mws...)
+}
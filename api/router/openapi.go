@@ -0,0 +1,667 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	"k6-practice/api/graph"
+	"k6-practice/api/handlers"
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+	"k6-practice/api/oauth"
+	"k6-practice/api/openapi"
+	"k6-practice/api/problem"
+)
+
+// operation はルートテーブルに付随するドキュメント定義
+type operation struct {
+	id        string
+	method    string
+	path      string // OpenAPI形式のパス（例: /users/{id}）
+	summary   string
+	tag       string
+	params    []*openapi.Parameter
+	body      string         // リクエストボディのスキーマ名
+	form      string         // フォーム（application/x-www-form-urlencoded）のリクエストボディのスキーマ名
+	responses map[int]string // ステータスコード → スキーマ名（""はボディなし）
+	auth      bool
+	// scope: 匿名でも呼べるが、資格情報がある場合は検証し、APIキーにはこのスコープを求める
+	scope string
+}
+
+// schemas はcomponents/schemasに登録する型
+var schemas = map[string]interface{}{
+	"User":                 models.User{},
+	"CreateUserRequest":    handlers.CreateUserRequest{},
+	"LoginRequest":         handlers.LoginRequest{},
+	"RefreshRequest":       handlers.RefreshRequest{},
+	"TokenResponse":        handlers.TokenResponse{},
+	"MeResponse":           handlers.MeResponse{},
+	"MFAChallengeResponse": handlers.MFAChallengeResponse{},
+	"MFAChallengeRequest":  handlers.MFAChallengeRequest{},
+	"MFAEnrollResponse":    handlers.MFAEnrollResponse{},
+	"MFAVerifyRequest":     handlers.MFAVerifyRequest{},
+	"MFAVerifyResponse":    handlers.MFAVerifyResponse{},
+	"APIKey":               handlers.APIKey{},
+	"CreateAPIKeyRequest":  handlers.CreateAPIKeyRequest{},
+	"CreateAPIKeyResponse": handlers.CreateAPIKeyResponse{},
+	"HealthResponse":       handlers.HealthResponse{},
+	"ReadinessResponse":    handlers.ReadinessResponse{},
+	"DelayResponse":        handlers.DelayResponse{},
+	"ErrorRateResponse":    handlers.ErrorRateResponse{},
+	"UserV2":               handlers.UserV2{},
+	"UserV2List":           handlers.UserV2List{},
+	"CreateUserV2Request":  handlers.CreateUserV2Request{},
+	"GraphQLRequest":       graph.Request{},
+	"GraphQLResponse":      graph.Response{},
+	"Problem":              problem.Problem{},
+	"OIDCDiscovery":        oauth.Discovery{},
+	"JWKS":                 oauth.JWKS{},
+	"OAuthTokenRequest":    oauth.TokenRequest{},
+	"OAuthTokenAction":     oauth.TokenActionRequest{},
+	"OAuthToken":           oauth.Token{},
+	"OAuthIntrospection":   oauth.Introspection{},
+	"OAuthError":           oauth.Error{},
+	"UserInfo":             oauth.UserInfo{},
+}
+
+// 全ルートに共通するエラー（グローバルミドルウェア由来）
+var commonErrors = []int{http.StatusMethodNotAllowed, http.StatusTooManyRequests}
+
+func pathParam(name, description string, min, max float64) *openapi.Parameter {
+	return &openapi.Parameter{
+		Name:        name,
+		In:          "path",
+		Description: description,
+		Required:    true,
+		Schema:      &openapi.Schema{Type: "integer", Minimum: openapi.Float(min), Maximum: openapi.Float(max)},
+	}
+}
+
+var userIDParam = pathParam("id", "ユーザーID", 1, 1<<31-1)
+
+func queryParam(name, description string, min, max float64) *openapi.Parameter {
+	return &openapi.Parameter{
+		Name:        name,
+		In:          "query",
+		Description: description,
+		Schema:      &openapi.Schema{Type: "integer", Minimum: openapi.Float(min), Maximum: openapi.Float(max)},
+	}
+}
+
+// authorizeParams は認可リクエストのパラメーター（誤りはハンドラーがリダイレクトで返すため、ここでは必須にしない）
+var authorizeParams = []*openapi.Parameter{
+	stringParam("response_type", "code のみ"),
+	stringParam("client_id", "登録済みのクライアントID"),
+	stringParam("redirect_uri", "登録済みのリダイレクトURI（1つだけ登録されている場合は省略できる）"),
+	stringParam("scope", "スペース区切りのスコープ"),
+	stringParam("state", "リダイレクトにそのまま付ける値"),
+	stringParam("nonce", "IDトークンにそのまま付ける値"),
+	stringParam("code_challenge", "PKCEのコードチャレンジ（BASE64URL(SHA256(code_verifier))）"),
+	stringParam("code_challenge_method", "S256 のみ"),
+}
+
+func stringParam(name, description string) *openapi.Parameter {
+	return &openapi.Parameter{
+		Name:        name,
+		In:          "query",
+		Description: description,
+		Schema:      &openapi.Schema{Type: "string"},
+	}
+}
+
+// idempotencyKeyParam はリトライを同一リクエストとして扱うためのキー（POST/PUTのユーザー操作）
+var idempotencyKeyParam = &openapi.Parameter{
+	Name:        middleware.IdempotencyKeyHeader,
+	In:          "header",
+	Description: "同じキーのリトライには最初のレスポンスを再送する（Idempotent-Replayed: true）",
+	Schema:      &openapi.Schema{Type: "string", MinLength: openapi.Int(1), MaxLength: openapi.Int(middleware.MaxIdempotencyKeyLength)},
+}
+
+// conditionalParams は条件付きGETのヘッダー（検証子が一致すれば304を返す）
+var conditionalParams = []*openapi.Parameter{
+	{
+		Name:        "If-None-Match",
+		In:          "header",
+		Description: "前回のレスポンスのETag",
+		Schema:      &openapi.Schema{Type: "string"},
+	},
+	{
+		Name:        "If-Modified-Since",
+		In:          "header",
+		Description: "前回のレスポンスのLast-Modified（If-None-Matchがあれば無視する）",
+		Schema:      &openapi.Schema{Type: "string"},
+	},
+}
+
+var (
+	opHealth = operation{
+		id: "healthCheck", method: http.MethodGet, path: "/health",
+		summary: "Health check", tag: "health",
+		responses: map[int]string{
+			http.StatusOK:                 "HealthResponse",
+			http.StatusServiceUnavailable: "Problem",
+		},
+	}
+	opReady = operation{
+		id: "readinessCheck", method: http.MethodGet, path: "/ready",
+		summary: "Readiness check", tag: "health",
+		responses: map[int]string{
+			http.StatusOK:                 "ReadinessResponse",
+			http.StatusServiceUnavailable: "ReadinessResponse",
+		},
+	}
+	opListUsers = operation{
+		id: "listUsers", method: http.MethodGet, path: "/users",
+		summary: "List users", tag: "users", scope: handlers.ScopeUsersRead, params: conditionalParams,
+		responses: map[int]string{
+			http.StatusOK:                 "[]User",
+			http.StatusNotModified:        "",
+			http.StatusServiceUnavailable: "Problem",
+		},
+	}
+	opCreateUser = operation{
+		id: "createUser", method: http.MethodPost, path: "/users",
+		summary: "Create user", tag: "users", scope: handlers.ScopeUsersWrite, params: []*openapi.Parameter{idempotencyKeyParam}, body: "CreateUserRequest",
+		responses: map[int]string{
+			http.StatusCreated:               "User",
+			http.StatusBadRequest:            "Problem",
+			http.StatusForbidden:             "Problem",
+			http.StatusConflict:              "Problem",
+			http.StatusRequestEntityTooLarge: "Problem",
+			http.StatusUnprocessableEntity:   "Problem",
+			http.StatusServiceUnavailable:    "Problem",
+		},
+	}
+	opGetUser = operation{
+		id: "getUser", method: http.MethodGet, path: "/users/{id}",
+		summary: "Get user", tag: "users", scope: handlers.ScopeUsersRead, params: append([]*openapi.Parameter{userIDParam}, conditionalParams...),
+		responses: map[int]string{
+			http.StatusOK:                 "User",
+			http.StatusNotModified:        "",
+			http.StatusBadRequest:         "Problem",
+			http.StatusNotFound:           "Problem",
+			http.StatusBadGateway:         "Problem",
+			http.StatusServiceUnavailable: "Problem",
+			http.StatusGatewayTimeout:     "Problem",
+		},
+	}
+	opUpdateUser = operation{
+		id: "updateUser", method: http.MethodPut, path: "/users/{id}",
+		summary: "Update user", tag: "users", scope: handlers.ScopeUsersWrite, params: []*openapi.Parameter{userIDParam, idempotencyKeyParam}, body: "CreateUserRequest",
+		responses: map[int]string{
+			http.StatusOK:                    "User",
+			http.StatusBadRequest:            "Problem",
+			http.StatusForbidden:             "Problem",
+			http.StatusNotFound:              "Problem",
+			http.StatusConflict:              "Problem",
+			http.StatusRequestEntityTooLarge: "Problem",
+			http.StatusUnprocessableEntity:   "Problem",
+			http.StatusServiceUnavailable:    "Problem",
+		},
+	}
+	opDeleteUser = operation{
+		id: "deleteUser", method: http.MethodDelete, path: "/users/{id}",
+		summary: "Delete user", tag: "users", scope: handlers.ScopeUsersWrite, params: []*openapi.Parameter{userIDParam},
+		responses: map[int]string{
+			http.StatusNoContent:          "",
+			http.StatusBadRequest:         "Problem",
+			http.StatusForbidden:          "Problem",
+			http.StatusNotFound:           "Problem",
+			http.StatusServiceUnavailable: "Problem",
+		},
+	}
+	opListUsersV2 = operation{
+		id: "listUsers", method: http.MethodGet, path: "/users",
+		summary: "List users", tag: "users", scope: handlers.ScopeUsersRead, params: conditionalParams,
+		responses: map[int]string{
+			http.StatusOK:                 "UserV2List",
+			http.StatusNotModified:        "",
+			http.StatusServiceUnavailable: "Problem",
+		},
+	}
+	opCreateUserV2 = operation{
+		id: "createUser", method: http.MethodPost, path: "/users",
+		summary: "Create user", tag: "users", scope: handlers.ScopeUsersWrite, params: []*openapi.Parameter{idempotencyKeyParam}, body: "CreateUserV2Request",
+		responses: map[int]string{
+			http.StatusCreated:               "UserV2",
+			http.StatusBadRequest:            "Problem",
+			http.StatusForbidden:             "Problem",
+			http.StatusConflict:              "Problem",
+			http.StatusRequestEntityTooLarge: "Problem",
+			http.StatusUnprocessableEntity:   "Problem",
+			http.StatusServiceUnavailable:    "Problem",
+		},
+	}
+	opGetUserV2 = operation{
+		id: "getUser", method: http.MethodGet, path: "/users/{id}",
+		summary: "Get user", tag: "users", scope: handlers.ScopeUsersRead, params: append([]*openapi.Parameter{userIDParam}, conditionalParams...),
+		responses: map[int]string{
+			http.StatusOK:                 "UserV2",
+			http.StatusNotModified:        "",
+			http.StatusBadRequest:         "Problem",
+			http.StatusNotFound:           "Problem",
+			http.StatusBadGateway:         "Problem",
+			http.StatusServiceUnavailable: "Problem",
+			http.StatusGatewayTimeout:     "Problem",
+		},
+	}
+	opUpdateUserV2 = operation{
+		id: "updateUser", method: http.MethodPut, path: "/users/{id}",
+		summary: "Update user", tag: "users", scope: handlers.ScopeUsersWrite, params: []*openapi.Parameter{userIDParam, idempotencyKeyParam}, body: "CreateUserV2Request",
+		responses: map[int]string{
+			http.StatusOK:                    "UserV2",
+			http.StatusBadRequest:            "Problem",
+			http.StatusForbidden:             "Problem",
+			http.StatusNotFound:              "Problem",
+			http.StatusConflict:              "Problem",
+			http.StatusRequestEntityTooLarge: "Problem",
+			http.StatusUnprocessableEntity:   "Problem",
+			http.StatusServiceUnavailable:    "Problem",
+		},
+	}
+	opLogin = operation{
+		id: "login", method: http.MethodPost, path: "/auth/login",
+		summary: "Login (get JWT)", tag: "auth", body: "LoginRequest",
+		responses: map[int]string{
+			http.StatusOK:                  "TokenResponse",
+			http.StatusAccepted:            "MFAChallengeResponse",
+			http.StatusBadRequest:          "Problem",
+			http.StatusUnauthorized:        "Problem",
+			http.StatusForbidden:           "Problem",
+			http.StatusTooManyRequests:     "Problem",
+			http.StatusInternalServerError: "Problem",
+			http.StatusServiceUnavailable:  "Problem",
+		},
+	}
+	opRefresh = operation{
+		id: "refreshToken", method: http.MethodPost, path: "/auth/refresh",
+		summary: "Refresh token", tag: "auth", body: "RefreshRequest",
+		responses: map[int]string{
+			http.StatusOK:                  "TokenResponse",
+			http.StatusBadRequest:          "Problem",
+			http.StatusUnauthorized:        "Problem",
+			http.StatusForbidden:           "Problem",
+			http.StatusInternalServerError: "Problem",
+			http.StatusServiceUnavailable:  "Problem",
+		},
+	}
+	opMFAChallenge = operation{
+		id: "challengeMFA", method: http.MethodPost, path: "/auth/mfa/challenge",
+		summary: "Complete login with TOTP or recovery code", tag: "auth", body: "MFAChallengeRequest",
+		responses: map[int]string{
+			http.StatusOK:                  "TokenResponse",
+			http.StatusBadRequest:          "Problem",
+			http.StatusUnauthorized:        "Problem",
+			http.StatusForbidden:           "Problem",
+			http.StatusTooManyRequests:     "Problem",
+			http.StatusInternalServerError: "Problem",
+			http.StatusServiceUnavailable:  "Problem",
+		},
+	}
+	opMFAEnroll = operation{
+		id: "enrollMFA", method: http.MethodPost, path: "/auth/mfa/enroll",
+		summary: "Start TOTP enrollment", tag: "auth", auth: true,
+		responses: map[int]string{
+			http.StatusOK:                  "MFAEnrollResponse",
+			http.StatusUnauthorized:        "Problem",
+			http.StatusForbidden:           "Problem",
+			http.StatusConflict:            "Problem",
+			http.StatusInternalServerError: "Problem",
+			http.StatusServiceUnavailable:  "Problem",
+		},
+	}
+	opMFAVerify = operation{
+		id: "verifyMFA", method: http.MethodPost, path: "/auth/mfa/verify",
+		summary: "Confirm TOTP enrollment (returns recovery codes)", tag: "auth", body: "MFAVerifyRequest", auth: true,
+		responses: map[int]string{
+			http.StatusOK:                  "MFAVerifyResponse",
+			http.StatusBadRequest:          "Problem",
+			http.StatusUnauthorized:        "Problem",
+			http.StatusForbidden:           "Problem",
+			http.StatusConflict:            "Problem",
+			http.StatusInternalServerError: "Problem",
+			http.StatusServiceUnavailable:  "Problem",
+		},
+	}
+	opAPIKeyCreate = operation{
+		id: "createAPIKey", method: http.MethodPost, path: "/auth/api-keys",
+		summary: "Create an API key (the key is returned only once)", tag: "auth", body: "CreateAPIKeyRequest", auth: true,
+		responses: map[int]string{
+			http.StatusCreated:             "CreateAPIKeyResponse",
+			http.StatusBadRequest:          "Problem",
+			http.StatusUnauthorized:        "Problem",
+			http.StatusForbidden:           "Problem",
+			http.StatusConflict:            "Problem",
+			http.StatusInternalServerError: "Problem",
+			http.StatusServiceUnavailable:  "Problem",
+		},
+	}
+	opAPIKeyList = operation{
+		id: "listAPIKeys", method: http.MethodGet, path: "/auth/api-keys",
+		summary: "List own API keys", tag: "auth", auth: true,
+		responses: map[int]string{
+			http.StatusOK:                 "[]APIKey",
+			http.StatusUnauthorized:       "Problem",
+			http.StatusForbidden:          "Problem",
+			http.StatusServiceUnavailable: "Problem",
+		},
+	}
+	opAPIKeyRevoke = operation{
+		id: "revokeAPIKey", method: http.MethodDelete, path: "/auth/api-keys/{id}",
+		summary: "Revoke an API key", tag: "auth", auth: true,
+		params: []*openapi.Parameter{{
+			Name:        "id",
+			In:          "path",
+			Description: "APIキーのID（prefix の k6_ の後の8文字）",
+			Required:    true,
+			Schema:      &openapi.Schema{Type: "string", MinLength: openapi.Int(8), MaxLength: openapi.Int(8)},
+		}},
+		responses: map[int]string{
+			http.StatusNoContent:          "",
+			http.StatusUnauthorized:       "Problem",
+			http.StatusForbidden:          "Problem",
+			http.StatusNotFound:           "Problem",
+			http.StatusServiceUnavailable: "Problem",
+		},
+	}
+	opMe = operation{
+		id: "getMe", method: http.MethodGet, path: "/auth/me",
+		summary: "Get current user", tag: "auth", auth: true,
+		responses: map[int]string{
+			http.StatusOK:                 "MeResponse",
+			http.StatusUnauthorized:       "Problem",
+			http.StatusServiceUnavailable: "Problem",
+		},
+	}
+	opDelay = operation{
+		id: "delay", method: http.MethodGet, path: "/delay/{ms}",
+		summary: "Delay response by ms", tag: "simulation",
+		params: []*openapi.Parameter{pathParam("ms", "遅延ミリ秒", 0, 10000)},
+		responses: map[int]string{
+			http.StatusOK:                 "DelayResponse",
+			http.StatusBadRequest:         "Problem",
+			http.StatusServiceUnavailable: "Problem",
+			http.StatusGatewayTimeout:     "Problem",
+		},
+	}
+	opRandomDelay = operation{
+		id: "randomDelay", method: http.MethodGet, path: "/random-delay",
+		summary: "Random delay (0-1000ms)", tag: "simulation",
+		responses: map[int]string{
+			http.StatusOK:                 "DelayResponse",
+			http.StatusServiceUnavailable: "Problem",
+			http.StatusGatewayTimeout:     "Problem",
+		},
+	}
+	opErrorRate = operation{
+		id: "errorRate", method: http.MethodGet, path: "/error-rate/{pct}",
+		summary: "Return error at given rate", tag: "simulation",
+		params: []*openapi.Parameter{pathParam("pct", "エラー率（%）", 0, 100)},
+		responses: map[int]string{
+			http.StatusOK:                  "ErrorRateResponse",
+			http.StatusBadRequest:          "Problem",
+			http.StatusInternalServerError: "ErrorRateResponse",
+			http.StatusServiceUnavailable:  "Problem",
+		},
+	}
+	opWSEcho = operation{
+		id: "wsEcho", method: http.MethodGet, path: "/ws/echo",
+		summary: "WebSocket echo and message generator", tag: "realtime",
+		params: []*openapi.Parameter{
+			queryParam("rate", "サーバーが生成するメッセージ数（件/秒、0は生成しない）", 0, handlers.MaxGeneratorRate),
+			queryParam("size", "生成するメッセージのペイロード（バイト）", 0, handlers.MaxGeneratorSize),
+		},
+		responses: map[int]string{
+			http.StatusSwitchingProtocols: "",
+			http.StatusBadRequest:         "Problem",
+			http.StatusForbidden:          "Problem",
+		},
+	}
+	opWSUsers = operation{
+		id: "wsUsers", method: http.MethodGet, path: "/ws/users",
+		summary: "WebSocket feed of user changes", tag: "realtime", auth: true,
+		responses: map[int]string{
+			http.StatusSwitchingProtocols: "",
+			http.StatusBadRequest:         "Problem",
+			http.StatusUnauthorized:       "Problem",
+			http.StatusForbidden:          "Problem",
+		},
+	}
+	opEventsUsers = operation{
+		id: "eventsUsers", method: http.MethodGet, path: "/events/users",
+		summary: "Server-Sent Events stream of user changes", tag: "realtime", auth: true,
+		params: []*openapi.Parameter{{
+			Name:        "Last-Event-ID",
+			In:          "header",
+			Description: "最後に受信したイベントID（以降の変更を再送する）",
+			Schema:      &openapi.Schema{Type: "string"},
+		}},
+		responses: map[int]string{
+			http.StatusOK:           "",
+			http.StatusBadRequest:   "Problem",
+			http.StatusUnauthorized: "Problem",
+		},
+	}
+	opGraphQL = operation{
+		id: "graphql", method: http.MethodPost, path: "/graphql",
+		summary: "GraphQL queries and mutations", tag: "graphql", body: "GraphQLRequest",
+		responses: map[int]string{
+			http.StatusOK:                  "GraphQLResponse",
+			http.StatusBadRequest:          "GraphQLResponse",
+			http.StatusUnauthorized:        "Problem",
+			http.StatusForbidden:           "Problem",
+			http.StatusUnprocessableEntity: "GraphQLResponse",
+			http.StatusServiceUnavailable:  "Problem",
+		},
+	}
+	opMetrics = operation{
+		id: "getMetrics", method: http.MethodGet, path: "/metrics",
+		summary: "Request metrics by route", tag: "meta",
+		responses: map[int]string{
+			http.StatusOK:                 "",
+			http.StatusServiceUnavailable: "Problem",
+		},
+	}
+	opOIDCDiscovery = operation{
+		id: "getOpenIDConfiguration", method: http.MethodGet, path: "/.well-known/openid-configuration",
+		summary: "OpenID Provider metadata", tag: "oauth",
+		responses: map[int]string{
+			http.StatusOK:                 "OIDCDiscovery",
+			http.StatusServiceUnavailable: "Problem",
+		},
+	}
+	opOAuthJWKS = operation{
+		id: "getJWKS", method: http.MethodGet, path: "/oauth/jwks",
+		summary: "Token signing keys", tag: "oauth",
+		responses: map[int]string{
+			http.StatusOK:                 "JWKS",
+			http.StatusServiceUnavailable: "Problem",
+		},
+	}
+	opOAuthAuthorize = operation{
+		id: "oauthAuthorize", method: http.MethodGet, path: "/oauth/authorize",
+		summary: "Authorization code with PKCE (user from bearer token)", tag: "oauth", params: authorizeParams, auth: true,
+		responses: map[int]string{
+			http.StatusFound:              "",
+			http.StatusBadRequest:         "OAuthError",
+			http.StatusUnauthorized:       "Problem",
+			http.StatusServiceUnavailable: "Problem",
+		},
+	}
+	opOAuthToken = operation{
+		id: "oauthToken", method: http.MethodPost, path: "/oauth/token",
+		summary: "Issue tokens (client_credentials, authorization_code, refresh_token)", tag: "oauth", form: "OAuthTokenRequest",
+		responses: map[int]string{
+			http.StatusOK:                    "OAuthToken",
+			http.StatusBadRequest:            "OAuthError",
+			http.StatusUnauthorized:          "OAuthError",
+			http.StatusRequestEntityTooLarge: "OAuthError",
+			http.StatusInternalServerError:   "OAuthError",
+			http.StatusServiceUnavailable:    "Problem",
+		},
+	}
+	opOAuthIntrospect = operation{
+		id: "oauthIntrospect", method: http.MethodPost, path: "/oauth/introspect",
+		summary: "Token introspection (RFC 7662)", tag: "oauth", form: "OAuthTokenAction",
+		responses: map[int]string{
+			http.StatusOK:                    "OAuthIntrospection",
+			http.StatusBadRequest:            "OAuthError",
+			http.StatusUnauthorized:          "OAuthError",
+			http.StatusRequestEntityTooLarge: "OAuthError",
+			http.StatusServiceUnavailable:    "Problem",
+		},
+	}
+	opOAuthRevoke = operation{
+		id: "oauthRevoke", method: http.MethodPost, path: "/oauth/revoke",
+		summary: "Token revocation (RFC 7009)", tag: "oauth", form: "OAuthTokenAction",
+		responses: map[int]string{
+			http.StatusOK:                    "",
+			http.StatusBadRequest:            "OAuthError",
+			http.StatusUnauthorized:          "OAuthError",
+			http.StatusRequestEntityTooLarge: "OAuthError",
+			http.StatusServiceUnavailable:    "Problem",
+		},
+	}
+	opOAuthUserInfo = operation{
+		id: "oauthUserInfo", method: http.MethodGet, path: "/oauth/userinfo",
+		summary: "Claims of the user (OAuth access token with openid scope)", tag: "oauth",
+		responses: map[int]string{
+			http.StatusOK:                 "UserInfo",
+			http.StatusUnauthorized:       "",
+			http.StatusForbidden:          "",
+			http.StatusServiceUnavailable: "Problem",
+		},
+	}
+	opOAuthUserInfoPost = operation{
+		id: "oauthUserInfoPost", method: http.MethodPost, path: "/oauth/userinfo",
+		summary: "Claims of the user (OAuth access token with openid scope)", tag: "oauth",
+		responses: opOAuthUserInfo.responses,
+	}
+	opOpenAPI = operation{
+		id: "getOpenAPI", method: http.MethodGet, path: "/openapi.json",
+		summary: "OpenAPI document", tag: "meta", params: conditionalParams,
+		responses: map[int]string{
+			http.StatusOK:                 "",
+			http.StatusNotModified:        "",
+			http.StatusServiceUnavailable: "Problem",
+		},
+	}
+)
+
+// userOperations はバージョンごとのユーザーCRUDのドキュメント定義
+type userOperations struct {
+	list, create, get, update, delete operation
+}
+
+var (
+	userOperationsV1 = userOperations{opListUsers, opCreateUser, opGetUser, opUpdateUser, opDeleteUser}
+	// 削除はレスポンスボディがないためv1と同じ定義を使う
+	userOperationsV2 = userOperations{opListUsersV2, opCreateUserV2, opGetUserV2, opUpdateUserV2, opDeleteUser}
+)
+
+// buildSpec はルート定義からOpenAPIドキュメントを生成
+func buildSpec(routes []*route) *openapi.Document {
+	doc := openapi.New("k6 practice API", "1.0.0")
+	doc.Info.Description = "k6負荷テスト練習用API"
+
+	for name, v := range schemas {
+		doc.Components.Schemas[name] = openapi.SchemaOf(v)
+	}
+	for _, code := range problem.Codes() {
+		doc.Components.Schemas["Problem"].Properties["code"].Enum = append(
+			doc.Components.Schemas["Problem"].Properties["code"].Enum, code)
+	}
+	doc.Components.SecuritySchemes["bearerAuth"] = &openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description:  "POST /auth/login で取得したアクセストークン",
+	}
+	doc.Components.SecuritySchemes["apiKeyAuth"] = &openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        "X-API-Key",
+		Description: "POST /auth/api-keys で作成したAPIキー（Authorization: ApiKey <key> でもよい）",
+	}
+
+	for _, rt := range routes {
+		op := rt.op.build()
+		// operationIdはドキュメント全体で一意にする（例: v2.getUser）
+		op.OperationID = rt.name()
+		doc.AddOperation(rt.op.method, rt.path(), op)
+	}
+	return doc
+}
+
+// build はOpenAPIのOperationに変換
+func (o operation) build() *openapi.Operation {
+	op := &openapi.Operation{
+		OperationID: o.id,
+		Summary:     o.summary,
+		Tags:        []string{o.tag},
+		Parameters:  o.params,
+		Responses:   make(map[string]*openapi.Response),
+	}
+
+	if o.body != "" {
+		op.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content:  jsonContent(o.body),
+		}
+		// Content-Encodingが未対応の場合
+		op.Responses[strconv.Itoa(http.StatusUnsupportedMediaType)] = response(http.StatusUnsupportedMediaType, "Problem")
+	}
+	if o.form != "" {
+		op.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]*openapi.MediaType{"application/x-www-form-urlencoded": {Schema: openapi.Ref(o.form)}},
+		}
+	}
+	if o.auth {
+		// どちらか一方で認証する
+		op.Security = []openapi.SecurityRequirement{{"bearerAuth": {}}, {"apiKeyAuth": {}}}
+	}
+	if o.scope != "" {
+		// 資格情報は任意（空の要件 {} は匿名を表す）
+		op.Security = []openapi.SecurityRequirement{{"bearerAuth": {}}, {"apiKeyAuth": {}}, {}}
+		op.Description = "匿名でも呼べる。トークンやAPIキーを送った場合は検証し、APIキーには " + o.scope + " のスコープが必要"
+		for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+			if _, ok := o.responses[status]; !ok {
+				op.Responses[strconv.Itoa(status)] = response(status, "Problem")
+			}
+		}
+	}
+
+	for status, schema := range o.responses {
+		op.Responses[strconv.Itoa(status)] = response(status, schema)
+	}
+	for _, status := range commonErrors {
+		if _, ok := o.responses[status]; !ok {
+			op.Responses[strconv.Itoa(status)] = response(status, "Problem")
+		}
+	}
+	return op
+}
+
+func response(status int, schema string) *openapi.Response {
+	resp := &openapi.Response{Description: http.StatusText(status)}
+	if schema != "" {
+		resp.Content = jsonContent(schema)
+	}
+	return resp
+}
+
+// jsonContent はスキーマ名からJSONのコンテンツ定義を作る
+// "[]User" のように先頭に[]を付けると配列になる。Problemは application/problem+json
+func jsonContent(schema string) map[string]*openapi.MediaType {
+	s := openapi.Ref(schema)
+	if len(schema) > 2 && schema[:2] == "[]" {
+		s = &openapi.Schema{Type: "array", Items: openapi.Ref(schema[2:])}
+	}
+	contentType := "application/json"
+	if schema == "Problem" {
+		contentType = problem.ContentType
+	}
+	return map[string]*openapi.MediaType{contentType: {Schema: s}}
+}
@@ -1,48 +1,225 @@
 package router
 
 import (
+	"crypto/rsa"
+	"fmt"
 	"net/http"
 
 	"k6-practice/api/config"
+	"k6-practice/api/graph"
 	"k6-practice/api/handlers"
+	"k6-practice/api/metrics"
 	"k6-practice/api/middleware"
 	"k6-practice/api/models"
+	"k6-practice/api/oauth"
+	"k6-practice/api/openapi"
+	"k6-practice/api/requestid"
+	"k6-practice/api/upstream"
 )
 
 // Router はアプリケーションのルーターを構築
 type Router struct {
-	cfg       *config.Config
-	userStore *models.UserStore
+	cfg         *config.Config
+	userStore   *models.UserStore
+	readiness   *handlers.Readiness
+	spec        *openapi.Document
+	patterns    []string
+	rateLimiter *middleware.RateLimiter
+	upstream    *upstream.Client
+	loginGuard  *handlers.LoginGuard
+	mfa         *handlers.MFAStore
+	oauth       *oauth.Provider
+	apiKeys     *handlers.APIKeyStore
+	// err: 設定の誤り（Server.Run が起動前に返す）
+	err error
 }
 
 // New は新しいRouterを作成
 func New(cfg *config.Config, userStore *models.UserStore) *Router {
-	return &Router{
+	r := &Router{
 		cfg:       cfg,
 		userStore: userStore,
+		readiness: handlers.NewReadiness(),
+		loginGuard: handlers.NewLoginGuard(handlers.LockoutConfig{
+			AccountThreshold: cfg.Lockout.AccountThreshold,
+			IPThreshold:      cfg.Lockout.IPThreshold,
+			Window:           cfg.Lockout.Window,
+			Duration:         cfg.Lockout.Duration,
+			MaxDuration:      cfg.Lockout.MaxDuration,
+			DelayBase:        cfg.Lockout.DelayBase,
+			DelayMax:         cfg.Lockout.DelayMax,
+			TrustedProxies:   cfg.Lockout.TrustedProxies,
+		}),
+		mfa: handlers.NewMFAStore(handlers.MFAConfig{
+			Issuer:        cfg.MFA.Issuer,
+			ChallengeTTL:  cfg.MFA.ChallengeTTL,
+			Skew:          cfg.MFA.Skew,
+			RecoveryCodes: cfg.MFA.RecoveryCodes,
+		}),
 	}
+	if cfg.APIKeys.Enabled {
+		r.apiKeys = handlers.NewAPIKeyStore(handlers.APIKeyConfig{
+			RateLimit:  cfg.APIKeys.RateLimit,
+			Window:     cfg.APIKeys.Window,
+			MaxPerUser: cfg.APIKeys.MaxPerUser,
+		}, userStore)
+	}
+	if cfg.OAuth.Enabled {
+		r.oauth, r.err = newOAuthProvider(cfg.OAuth, userStore)
+	}
+	return r
+}
+
+// newOAuthProvider は OAUTH_* の設定から認可サーバーを作る
+// アクセストークンの失効は通常のJWTと同じ一覧（管理用APIのユーザー単位の失効が両方に効く）
+func newOAuthProvider(cfg config.OAuthConfig, userStore *models.UserStore) (*oauth.Provider, error) {
+	clients, err := oauth.ParseClients(cfg.Clients)
+	if err != nil {
+		return nil, err
+	}
+	var key *rsa.PrivateKey
+	if cfg.SigningKeyFile != "" {
+		if key, err = oauth.LoadKey(cfg.SigningKeyFile); err != nil {
+			return nil, fmt.Errorf("OAUTH_SIGNING_KEY_FILE: %w", err)
+		}
+	}
+	return oauth.NewProvider(oauth.Config{
+		Issuer:          cfg.Issuer,
+		Clients:         clients,
+		Scopes:          cfg.Scopes,
+		Key:             key,
+		AccessTokenTTL:  cfg.AccessTokenTTL,
+		RefreshTokenTTL: cfg.RefreshTokenTTL,
+		CodeTTL:         cfg.CodeTTL,
+		Revocations:     middleware.Revocations,
+	}, userStore)
 }
 
 // Build はHTTPハンドラーを構築
 func (r *Router) Build() http.Handler {
-	mux := http.NewServeMux()
-
 	// ハンドラー初期化
 	usersHandler := handlers.NewUsersHandler(r.userStore)
-	authHandler := handlers.NewAuthHandler(r.userStore)
+	usersV2Handler := handlers.NewUsersV2Handler(r.userStore)
+	authHandler := handlers.NewAuthHandler(r.userStore, r.loginGuard, r.mfa)
+	var apiKeysHandler *handlers.APIKeysHandler
+	if r.apiKeys != nil {
+		apiKeysHandler = handlers.NewAPIKeysHandler(r.apiKeys)
+	}
+	wsHandler := handlers.NewWebSocketHandler(r.userStore, handlers.WebSocketConfig{
+		PingInterval:   r.cfg.WebSocket.PingInterval,
+		ReadLimit:      r.cfg.WebSocket.ReadLimit,
+		WriteTimeout:   r.cfg.WebSocket.WriteTimeout,
+		AllowedOrigins: r.cfg.CSRF.AllowedOrigins,
+	})
+	eventsHandler := handlers.NewEventsHandler(r.userStore, handlers.EventsConfig{
+		Heartbeat:    r.cfg.SSE.Heartbeat,
+		WriteTimeout: r.cfg.SSE.WriteTimeout,
+		Buffer:       r.cfg.SSE.Buffer,
+	})
+
+	graphqlHandler := graph.NewHandler(r.userStore, graph.HandlerConfig{
+		MaxDepth:      r.cfg.GraphQL.MaxDepth,
+		MaxComplexity: r.cfg.GraphQL.MaxComplexity,
+		Introspection: r.cfg.GraphQL.Introspection,
+	})
+
+	// ミドルウェアごとの子スパン（以降に構築するチェーンに適用される）
+	middleware.TraceMiddlewares(r.cfg.Tracing.MiddlewareSpans)
+
+	// 認証（JWT、有効な場合はAPIキーの順に試す。レート制限も同じ認証方式でAPIキーを見分ける）
+	authenticators := []middleware.Authenticator{middleware.JWTAuthenticator}
+	if r.apiKeys != nil {
+		authenticators = append(authenticators, r.apiKeys)
+	}
 
 	// ミドルウェア
 	rateLimiter := middleware.NewRateLimiter(
 		r.cfg.RateLimit.Requests,
 		r.cfg.RateLimit.Window,
 	)
+	r.rateLimiter = rateLimiter
+	if r.apiKeys != nil {
+		// APIキーのリクエストはIPごとではなくキーごとの上限（APIKEY_RATE_LIMIT）で制限する
+		rateLimiter.ExemptAPIKeys(authenticators...)
+	}
 
 	csrfProtect := middleware.CSRFProtection(middleware.CSRFConfig{
 		AllowedOrigins: r.cfg.CSRF.AllowedOrigins,
 		StrictMode:     r.cfg.CSRF.StrictMode,
 	})
 
+	// POST/PUTのリトライで同じ処理が重複しないようにする
+	idempotency := middleware.NewIdempotencyStore(middleware.IdempotencyConfig{
+		TTL:     r.cfg.Idempotency.TTL,
+		MaxKeys: r.cfg.Idempotency.MaxKeys,
+	}).Middleware
+
+	// 読み取り系のキャッシュ（SecurityHeadersの no-store をルートごとに上書き）
+	usersCache := []middleware.Middleware{middleware.CacheControl(r.cfg.Cache.UsersPolicy)}
+	if r.cfg.Cache.ResponseCache {
+		usersCache = append(usersCache, middleware.NewResponseCache(middleware.ResponseCacheConfig{
+			TTL:        r.cfg.Cache.ResponseCacheTTL,
+			MaxEntries: r.cfg.Cache.ResponseCacheMaxEntries,
+			Version:    r.userStore.Version,
+		}).Middleware)
+	}
+
+	// 処理時間の上限（WebSocket・SSEの長時間接続には付けない）
+	timeout := middleware.Timeout(r.cfg.Timeout.Request)
+	delayTimeout := middleware.Timeout(r.cfg.Timeout.Delay)
+
+	// 同時実行数の制限と負荷制限（WebSocket・SSEの長時間接続は数えない）
+	// 遅延シミュレーションはレイテンシが意図的に長いため、適応的なルートごとの制限は付けない
+	noop := func(next http.Handler) http.Handler { return next }
+	shed, shedCritical, shedAdaptive := noop, noop, noop
+	if c := r.cfg.Concurrency; c.Enabled {
+		globalLimiter := middleware.NewConcurrencyLimiter(middleware.ConcurrencyConfig{
+			Name:         "global",
+			Limit:        c.GlobalLimit,
+			QueueSize:    c.QueueSize,
+			QueueTimeout: c.QueueTimeout,
+		})
+		routeLimiter := middleware.NewRouteConcurrencyLimiter(middleware.ConcurrencyConfig{
+			Limit:         c.RouteLimit,
+			MinLimit:      c.RouteMinLimit,
+			MaxLimit:      c.RouteMaxLimit,
+			LatencyTarget: c.LatencyTarget,
+			QueueSize:     c.QueueSize,
+			QueueTimeout:  c.QueueTimeout,
+		})
+		shed = globalLimiter.Middleware(middleware.PriorityDefault)
+		shedCritical = globalLimiter.Middleware(middleware.PriorityCritical)
+		shedAdaptive = middleware.NewChain(shed, routeLimiter.Middleware(middleware.PriorityDefault)).Then
+	}
+
+	// 上流の呼び出し（ユーザー詳細の付加情報を模擬。UPSTREAM_URL を設定したときだけ）
+	var upstreamClient *upstream.Client
+	r.upstream = nil
+	usersGet := usersCache
+	if c := r.cfg.Upstream; c.URL != "" {
+		upstreamClient = upstream.NewClient(upstream.Config{
+			BaseURL:       c.URL,
+			Timeout:       c.Timeout,
+			Retries:       c.Retries,
+			BackoffBase:   c.BackoffBase,
+			BackoffMax:    c.BackoffMax,
+			MaxConcurrent: c.MaxConcurrent,
+			Breaker: upstream.BreakerConfig{
+				Threshold:        c.BreakerThreshold,
+				Cooldown:         c.BreakerCooldown,
+				HalfOpenRequests: c.BreakerHalfOpenRequests,
+			},
+		})
+		r.upstream = upstreamClient
+		usersGet = append(usersCache[:len(usersCache):len(usersCache)], middleware.Enrich(middleware.EnrichConfig{
+			Client:   upstreamClient,
+			Path:     c.Path,
+			Required: c.Required,
+		}))
+	}
+
 	bodyLimit := middleware.BodyLimit(r.cfg.BodyLimit)
+	decompress := middleware.Decompress(r.cfg.Compression.MaxDecompressedBytes)
 
 	cors := middleware.CORS(middleware.CORSConfig{
 		AllowedOrigins: r.cfg.CORS.AllowedOrigins,
@@ -50,37 +227,199 @@ func (r *Router) Build() http.Handler {
 		AllowedHeaders: r.cfg.CORS.AllowedHeaders,
 	})
 
-	// ミドルウェアチェーン定義
-	// 保護付きエンドポイント用
-	protected := middleware.NewChain(bodyLimit, csrfProtect)
-	// 認証必須エンドポイント用
-	authenticated := middleware.NewChain(middleware.Auth, csrfProtect)
+	auth := middleware.NewAuth(authenticators...)
+	optionalAuth := middleware.NewOptionalAuth(authenticators...)
+	readScope := middleware.RequireScope(handlers.ScopeUsersRead)
+	// scoped は匿名でも呼べるルートで、資格情報がある場合だけ検証してスコープを確認する
+	scoped := func(op operation, mw ...middleware.Middleware) []middleware.Middleware {
+		return append([]middleware.Middleware{optionalAuth, middleware.RequireScope(op.scope)}, mw...)
+	}
 
-	// ルート登録
-	// ヘルスチェック（ミドルウェアなし）
-	mux.HandleFunc("/health", handlers.HealthCheck)
+	// ルート定義（ドキュメントもここから生成する）
+	root := newGroup()
+
+	// ヘルスチェック・メタ情報（過負荷でも最後まで応答する）
+	root.HandleFunc(opHealth, handlers.HealthCheck, shedCritical)
+	root.HandleFunc(opReady, r.readiness.Ready, shedCritical)
+	root.Handle(opMetrics, metrics.Handler(), shedCritical)
+
+	// 長時間接続（バージョンなし。認証はアップグレード時に行う）
+	root.HandleFunc(opWSEcho, wsHandler.Echo)
+	root.HandleFunc(opWSUsers, wsHandler.Users, auth, readScope)
+	root.HandleFunc(opEventsUsers, eventsHandler.Users, auth, readScope)
+
+	// GraphQL（バージョンなし。認証が必要なのは me だけなので、トークンは任意）
+	root.Handle(opGraphQL, graphqlHandler, shedAdaptive, timeout, bodyLimit, decompress, csrfProtect, optionalAuth)
+
+	// OAuth 2.0 / OpenID Connect（バージョンなし。フォームのPOSTはクライアント認証で保護するためCSRF保護不要）
+	if r.oauth != nil {
+		oauthHandler := oauth.NewHandler(r.oauth)
+		docsCache := middleware.CacheControl(r.cfg.Cache.DocsPolicy)
+		root.HandleFunc(opOIDCDiscovery, oauthHandler.Discovery, shed, docsCache)
+		root.HandleFunc(opOAuthJWKS, oauthHandler.JWKS, shed, docsCache)
+		// 認可はユーザー自身のログインだけで行う（APIキーはハンドラーが拒否する）
+		root.HandleFunc(opOAuthAuthorize, oauthHandler.Authorize, shedAdaptive, timeout, optionalAuth)
+		root.HandleFunc(opOAuthToken, oauthHandler.Token, shedAdaptive, timeout, bodyLimit)
+		root.HandleFunc(opOAuthIntrospect, oauthHandler.Introspect, shedAdaptive, timeout, bodyLimit)
+		root.HandleFunc(opOAuthRevoke, oauthHandler.Revoke, shedAdaptive, timeout, bodyLimit)
+		root.HandleFunc(opOAuthUserInfo, oauthHandler.UserInfo, shedAdaptive, timeout)
+		root.HandleFunc(opOAuthUserInfoPost, oauthHandler.UserInfo, shedAdaptive, timeout, bodyLimit)
+	}
+
+	// バージョンごとのAPI（ユーザーの表現だけがバージョンで異なる）
+	mount := func(api *group, users userResource, ops userOperations) {
+		// 保護付きエンドポイント（ボディサイズ制限 + 展開後のサイズ制限 + CSRF）
+		protected := api.Group("", shedAdaptive, timeout, bodyLimit, decompress, csrfProtect)
+
+		// ユーザーCRUD（匿名でも呼べる。APIキーは users:read / users:write のスコープで制限する）
+		protected.HandleFunc(ops.list, users.List, scoped(ops.list, usersCache...)...)
+		protected.HandleFunc(ops.create, users.Create, scoped(ops.create, idempotency)...)
+		protected.HandleFunc(ops.get, users.Get, scoped(ops.get, usersGet...)...)
+		protected.HandleFunc(ops.update, users.Update, scoped(ops.update, idempotency)...)
+		protected.HandleFunc(ops.delete, users.Delete, scoped(ops.delete)...)
 
-	// ユーザーCRUD
-	mux.Handle("/users", protected.Then(usersHandler))
-	mux.Handle("/users/", protected.Then(usersHandler))
+		// 認証エンドポイント
+		protected.HandleFunc(opLogin, authHandler.Login)
+		protected.HandleFunc(opRefresh, authHandler.Refresh)
+		protected.HandleFunc(opMFAChallenge, authHandler.ChallengeMFA)
+		// 多要素認証の登録はAPIキーではできない（ハンドラーが403を返す）
+		protected.HandleFunc(opMFAEnroll, authHandler.EnrollMFA, auth)
+		protected.HandleFunc(opMFAVerify, authHandler.VerifyMFA, auth)
+		api.HandleFunc(opMe, authHandler.Me, shedAdaptive, timeout, auth, readScope, csrfProtect)
 
-	// 認証エンドポイント
-	mux.Handle("/auth/login", protected.Then(authHandler))
-	mux.Handle("/auth/refresh", protected.Then(authHandler))
-	mux.Handle("/auth/me", authenticated.Then(authHandler))
+		// APIキーの管理（APIキー自身では管理できない）
+		if apiKeysHandler != nil {
+			protected.HandleFunc(opAPIKeyCreate, apiKeysHandler.Create, auth)
+			protected.HandleFunc(opAPIKeyList, apiKeysHandler.List, auth)
+			protected.HandleFunc(opAPIKeyRevoke, apiKeysHandler.Revoke, auth)
+		}
 
-	// 遅延・エラーシミュレーション（CSRF保護不要）
-	mux.HandleFunc("/delay/", handlers.DelayHandler)
-	mux.HandleFunc("/random-delay", handlers.RandomDelayHandler)
-	mux.HandleFunc("/error-rate/", handlers.ErrorRateHandler)
+		// 遅延・エラーシミュレーション（CSRF保護不要）
+		api.HandleFunc(opDelay, handlers.DelayHandler, shed, delayTimeout)
+		api.HandleFunc(opRandomDelay, handlers.RandomDelayHandler, shed, delayTimeout)
+		api.HandleFunc(opErrorRate, handlers.ErrorRateHandler, shed, timeout)
+	}
+
+	// v1は非推奨（Deprecation/Sunsetヘッダーでv2への移行を案内）
+	mount(root.Group("/v1", middleware.Deprecation(middleware.DeprecationConfig{
+		DeprecatedAt: r.cfg.API.V1DeprecatedAt,
+		Sunset:       r.cfg.API.V1Sunset,
+		Successor:    "/v2",
+	})), usersHandler, userOperationsV1)
+	mount(root.Group("/v2"), usersV2Handler, userOperationsV2)
+
+	// ドキュメント自身も記載してから配信ハンドラーを作る
+	docRoute := &route{op: opOpenAPI, chain: middleware.NewChain(shed, middleware.CacheControl(r.cfg.Cache.DocsPolicy))}
+	routes := append(*root.routes, docRoute)
+	r.spec = buildSpec(routes)
+	docRoute.handler = handlers.NewOpenAPIHandler(r.spec)
+
+	// スキーマ検証は各ルートのミドルウェアの最後（ボディ制限・CSRF・認証の後）に、ルートのオペレーションで適用
+	validate := func(rt *route) middleware.Middleware {
+		return middleware.OpenAPIValidation(middleware.OpenAPIValidationConfig{
+			Doc:               r.spec,
+			Operation:         r.spec.Paths[rt.path()].Operations()[rt.op.method],
+			ValidateResponses: r.cfg.OpenAPI.ValidateResponses,
+		})
+	}
+
+	// ルート登録
+	mux := http.NewServeMux()
+	r.patterns = r.patterns[:0]
+	unversioned := make(map[string]bool)
+	for _, rt := range routes {
+		if rt.prefix == "" {
+			unversioned[rt.path()] = true
+		}
+		handler := rt.chain.Append(validate(rt)).Then(rt.handler)
+		mux.Handle(rt.pattern(), middleware.NameRoute(rt.name())(handler))
+		r.patterns = append(r.patterns, rt.pattern())
+	}
 
 	// グローバルミドルウェアチェーン
 	global := middleware.NewChain(
+		requestid.Middleware,
 		middleware.Logging,
 		middleware.SecurityHeaders,
 		rateLimiter.Middleware,
 		cors,
 	)
+	// mTLS: 検証済みのクライアント証明書をユーザーに対応付ける
+	if r.cfg.Server.TLS.ClientCAFile != "" {
+		global.Use(middleware.ClientCert(r.userStore))
+	}
+	if r.cfg.Compression.Enabled {
+		global.Use(middleware.Compress(middleware.CompressionConfig{
+			Encodings:    r.cfg.Compression.Encodings,
+			MinSize:      r.cfg.Compression.MinSize,
+			ContentTypes: r.cfg.Compression.ContentTypes,
+		}))
+	}
+
+	versions := negotiateVersion(unversioned, apiVersions, r.cfg.API.DefaultVersion)
+
+	// トレースはアクセスログにトレースIDを出すためグローバルチェーンの外側に置く
+	return middleware.Tracing(global.Then(versions(problemFallback(mux))))
+}
+
+// apiVersions はホストしているAPIバージョン
+var apiVersions = []string{"v1", "v2"}
+
+// userResource はバージョンごとのユーザーハンドラーが実装するメソッド
+type userResource interface {
+	List(w http.ResponseWriter, r *http.Request)
+	Create(w http.ResponseWriter, r *http.Request)
+	Get(w http.ResponseWriter, r *http.Request)
+	Update(w http.ResponseWriter, r *http.Request)
+	Delete(w http.ResponseWriter, r *http.Request)
+}
+
+// OpenAPI はBuildで生成したOpenAPIドキュメントを返す
+func (r *Router) OpenAPI() *openapi.Document {
+	return r.spec
+}
+
+// Patterns はBuildでServeMuxに登録したパターン一覧を返す（例: GET /users/{id}）
+func (r *Router) Patterns() []string {
+	return r.patterns
+}
+
+// Readiness は GET /ready の状態
+func (r *Router) Readiness() *handlers.Readiness {
+	return r.readiness
+}
+
+// RateLimiter はBuildで生成したレート制限（管理用APIで参照する）
+func (r *Router) RateLimiter() *middleware.RateLimiter {
+	return r.rateLimiter
+}
+
+// LoginGuard はログインの失敗回数とロック（gRPCと共有し、管理用APIで解除する）
+func (r *Router) LoginGuard() *handlers.LoginGuard {
+	return r.loginGuard
+}
+
+// MFA は多要素認証の登録（gRPCと共有し、管理用APIのストアの初期化で消す）
+func (r *Router) MFA() *handlers.MFAStore {
+	return r.mfa
+}
+
+// APIKeys はAPIキー（APIKEY_ENABLED=false の場合はnil、管理用APIのストアの初期化で消す）
+func (r *Router) APIKeys() *handlers.APIKeyStore {
+	return r.apiKeys
+}
+
+// Upstream はBuildで生成した上流のクライアント（UPSTREAM_URL が空の場合はnil、管理用APIでブレーカーを確認・リセットする）
+func (r *Router) Upstream() *upstream.Client {
+	return r.upstream
+}
+
+// OAuth はOAuth 2.0 の認可サーバー（OAUTH_ENABLED=false の場合はnil）
+func (r *Router) OAuth() *oauth.Provider {
+	return r.oauth
+}
 
-	return global.Then(mux)
+// Err はNewで検出した設定の誤り
+func (r *Router) Err() error {
+	return r.err
 }
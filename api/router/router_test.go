@@ -0,0 +1,942 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"k6-practice/api/config"
+	"k6-practice/api/handlers"
+	"k6-practice/api/middleware"
+	"k6-practice/api/models"
+	"k6-practice/api/oauth"
+	"k6-practice/api/openapi"
+	"k6-practice/api/problem"
+	"k6-practice/api/totp"
+)
+
+func setupRouter() (*Router, http.Handler) {
+	r := New(config.Load(), models.NewUserStore())
+	return r, r.Build()
+}
+
+func TestRouter_EveryPatternIsDocumented(t *testing.T) {
+	r, _ := setupRouter()
+	spec := r.OpenAPI()
+
+	for _, pattern := range r.Patterns() {
+		t.Run(pattern, func(t *testing.T) {
+			method, path, _ := strings.Cut(pattern, " ")
+			item, ok := spec.Paths[path]
+			if !ok || item.Operations()[method] == nil {
+				t.Errorf("pattern %q is registered but not documented", pattern)
+			}
+		})
+	}
+}
+
+func TestRouter_EveryDocumentedOperationIsRegistered(t *testing.T) {
+	r, _ := setupRouter()
+
+	registered := make(map[string]bool)
+	for _, pattern := range r.Patterns() {
+		registered[pattern] = true
+	}
+
+	for _, ep := range r.OpenAPI().Endpoints() {
+		if !registered[ep.Method+" "+ep.Path] {
+			t.Errorf("%s %s is documented but not registered", ep.Method, ep.Path)
+		}
+	}
+}
+
+func TestRouter_SchemaReferencesResolve(t *testing.T) {
+	r, _ := setupRouter()
+	spec := r.OpenAPI()
+
+	check := func(where string, s *openapi.Schema) {
+		if s == nil {
+			return
+		}
+		if s.Items != nil {
+			s = s.Items
+		}
+		if s.Ref != "" && spec.Resolve(s) == nil {
+			t.Errorf("%s: unresolved reference %q", where, s.Ref)
+		}
+	}
+
+	for _, ep := range spec.Endpoints() {
+		op := spec.Paths[ep.Path].Operations()[ep.Method]
+		where := ep.Method + " " + ep.Path
+		if op.RequestBody != nil {
+			for _, mt := range op.RequestBody.Content {
+				check(where, mt.Schema)
+			}
+		}
+		for status, resp := range op.Responses {
+			for _, mt := range resp.Content {
+				check(where+" "+status, mt.Schema)
+			}
+		}
+	}
+}
+
+func TestRouter_ServesOpenAPIDocument(t *testing.T) {
+	_, handler := setupRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var doc openapi.Document
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if doc.OpenAPI != openapi.Version {
+		t.Errorf("expected openapi %s, got %s", openapi.Version, doc.OpenAPI)
+	}
+	for _, name := range []string{"CreateUserRequest", "TokenResponse", "DelayResponse", "Problem"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("expected schema %s to be documented", name)
+		}
+	}
+	if me := doc.Paths["/v1/auth/me"]; me == nil || me.Get == nil || len(me.Get.Security) == 0 {
+		t.Error("expected GET /v1/auth/me to require bearerAuth")
+	}
+}
+
+func TestRouter_ValidatesRequestsAgainstSpec(t *testing.T) {
+	_, handler := setupRouter()
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"Test","email":"test@example.com","role":"admin"}`))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("expected Content-Type application/problem+json, got %q", ct)
+	}
+}
+
+func TestRouter_MethodNotAllowed(t *testing.T) {
+	_, handler := setupRouter()
+
+	tests := []struct {
+		method string
+		path   string
+		allow  []string
+	}{
+		{http.MethodPatch, "/users", []string{"GET", "HEAD", "POST"}},
+		{http.MethodPatch, "/users/1", []string{"DELETE", "GET", "HEAD", "PUT"}},
+		{http.MethodGet, "/auth/login", []string{"POST"}},
+		{http.MethodPost, "/auth/me", []string{"GET", "HEAD"}},
+		{http.MethodPost, "/health", []string{"GET", "HEAD"}},
+		{http.MethodPost, "/delay/10", []string{"GET", "HEAD"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+			}
+			for _, m := range tt.allow {
+				if !strings.Contains(rec.Header().Get("Allow"), m) {
+					t.Errorf("expected Allow to contain %s, got %q", m, rec.Header().Get("Allow"))
+				}
+			}
+			assertProblem(t, rec, problem.CodeMethodNotAllowed)
+		})
+	}
+}
+
+func TestRouter_NotFound(t *testing.T) {
+	_, handler := setupRouter()
+
+	for _, path := range []string{"/users/1/extra", "/auth/me/x", "/auth/unknown", "/nope"} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+			}
+			assertProblem(t, rec, problem.CodeNotFound)
+		})
+	}
+}
+
+func TestRouter_HandlerErrorsAreNotReplaced(t *testing.T) {
+	_, handler := setupRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/users/999", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+	assertProblem(t, rec, problem.CodeUserNotFound)
+}
+
+func TestRouter_RecordsRouteName(t *testing.T) {
+	var seen string
+	rt := &route{op: opGetUser, chain: middleware.NewChain()}
+	mux := http.NewServeMux()
+	mux.Handle(rt.pattern(), middleware.NameRoute(rt.name())(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		seen = middleware.RouteName(req.Context())
+	})))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	if seen != "getUser" {
+		t.Errorf("expected route name getUser, got %q", seen)
+	}
+}
+
+func assertProblem(t *testing.T, rec *httptest.ResponseRecorder, code problem.Code) {
+	t.Helper()
+
+	if ct := rec.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("expected Content-Type %s, got %q", problem.ContentType, ct)
+	}
+	var p problem.Problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if p.Code != code {
+		t.Errorf("expected code %s, got %s", code, p.Code)
+	}
+}
+
+func TestRouter_Compression(t *testing.T) {
+	_, handler := setupRouter()
+
+	t.Run("large response is compressed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("expected Content-Encoding gzip, got %q", got)
+		}
+		gz, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatalf("failed to create gzip reader: %v", err)
+		}
+		var doc openapi.Document
+		if err := json.NewDecoder(gz).Decode(&doc); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	})
+
+	t.Run("compressed request body is accepted", func(t *testing.T) {
+		var body bytes.Buffer
+		gz := gzip.NewWriter(&body)
+		gz.Write([]byte(`{"first_name":"Test","last_name":"User","email":"test@example.com"}`))
+		gz.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/v2/users", &body)
+		req.Header.Set("Content-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusCreated {
+			t.Errorf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("decompressed body over limit is rejected", func(t *testing.T) {
+		var body bytes.Buffer
+		gz := gzip.NewWriter(&body)
+		gz.Write([]byte(`{"name":"` + strings.Repeat("a", 8*1024*1024) + `"}`))
+		gz.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/users", &body)
+		req.Header.Set("Content-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+		}
+		assertProblem(t, rec, problem.CodeBodyTooLarge)
+	})
+}
+
+func TestRouter_WebSocket(t *testing.T) {
+	_, handler := setupRouter()
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	t.Run("echo upgrades through the middleware chain", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL+"/ws/echo", http.Header{"Accept-Encoding": {"gzip"}})
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte("ping"))
+		if _, data, err := conn.ReadMessage(); err != nil || string(data) != "ping" {
+			t.Errorf("expected echo, got %q (%v)", data, err)
+		}
+	})
+
+	t.Run("users feed requires a token", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL+"/ws/users", nil)
+		if err == nil {
+			t.Fatal("expected dial to fail")
+		}
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+		}
+	})
+
+	t.Run("users feed accepts a bearer token", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/auth/login", "application/json",
+			strings.NewReader(`{"email":"alice@example.com","password":"password"}`))
+		if err != nil {
+			t.Fatalf("login failed: %v", err)
+		}
+		var tokens handlers.TokenResponse
+		json.NewDecoder(resp.Body).Decode(&tokens)
+		resp.Body.Close()
+
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL+"/ws/users",
+			http.Header{"Authorization": {"Bearer " + tokens.AccessToken}})
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		conn.Close()
+	})
+}
+
+func TestRouter_Events(t *testing.T) {
+	_, handler := setupRouter()
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/auth/login", "application/json",
+		strings.NewReader(`{"email":"alice@example.com","password":"password"}`))
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	var tokens handlers.TokenResponse
+	json.NewDecoder(resp.Body).Decode(&tokens)
+	resp.Body.Close()
+
+	// 圧縮・ログのミドルウェアを通ってもイベントが逐次届く
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/events/users", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if ce := resp.Header.Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("expected Content-Encoding gzip, got %q", ce)
+	}
+
+	// 圧縮器もフラッシュされるため、MinSize未満のイベントもすぐに展開できる
+	done := make(chan string, 1)
+	go func() {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			done <- ""
+			return
+		}
+		line, _ := bufio.NewReader(zr).ReadString('\n')
+		done <- line
+	}()
+	select {
+	case line := <-done:
+		if !strings.HasPrefix(line, "retry:") {
+			t.Errorf("expected retry preamble, got %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the preamble to be flushed")
+	}
+}
+
+func TestRouter_GraphQL(t *testing.T) {
+	_, handler := setupRouter()
+
+	login := httptest.NewRecorder()
+	handler.ServeHTTP(login, httptest.NewRequest(http.MethodPost, "/v2/auth/login",
+		strings.NewReader(`{"email":"alice@example.com","password":"password"}`)))
+	var tokens handlers.TokenResponse
+	json.NewDecoder(login.Body).Decode(&tokens)
+
+	tests := []struct {
+		name           string
+		authorization  string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"query without token", "", `{"query":"{ user(id: 1) { name } }"}`, http.StatusOK, `{"data":{"user":{"name":"Alice"}}}`},
+		{"me with token", "Bearer " + tokens.AccessToken, `{"query":"{ me { email } }"}`, http.StatusOK, `{"data":{"me":{"email":"alice@example.com"}}}`},
+		{"invalid token is rejected before execution", "Bearer invalid", `{"query":"{ me { email } }"}`, http.StatusUnauthorized, ""},
+		{"body is validated against the spec", "", `{"variables":{}}`, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedBody != "" && strings.TrimSpace(rec.Body.String()) != tt.expectedBody {
+				t.Errorf("expected body %s, got %s", tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_Idempotency(t *testing.T) {
+	r, handler := setupRouter()
+
+	tests := []struct {
+		name             string
+		body             string
+		expectedStatus   int
+		expectedReplayed bool
+	}{
+		{"first request creates the user", `{"name":"Dave","email":"dave@example.com"}`, http.StatusCreated, false},
+		{"retry is replayed", `{"name":"Dave","email":"dave@example.com"}`, http.StatusCreated, true},
+		{"different body is rejected", `{"name":"Eve","email":"eve@example.com"}`, http.StatusUnprocessableEntity, false},
+	}
+
+	var first string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(middleware.IdempotencyKeyHeader, "create-dave")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if replayed := rec.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.expectedReplayed {
+				t.Errorf("expected replayed %v, got %v", tt.expectedReplayed, replayed)
+			}
+			if rec.Code != http.StatusCreated {
+				return
+			}
+			if first == "" {
+				first = rec.Body.String()
+			} else if rec.Body.String() != first {
+				t.Errorf("expected replayed body %s, got %s", first, rec.Body.String())
+			}
+		})
+	}
+
+	if n := len(r.userStore.List()); n != 4 {
+		t.Errorf("expected exactly one user to be created, got %d users", n)
+	}
+}
+
+func TestRouter_Caching(t *testing.T) {
+	cfg := config.Load()
+	cfg.Cache.ResponseCache = true
+	handler := New(cfg, models.NewUserStore()).Build()
+
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("/v2/users/1", "")
+	etag := first.Header().Get("ETag")
+
+	tests := []struct {
+		name                 string
+		rec                  *httptest.ResponseRecorder
+		expectedStatus       int
+		expectedCacheControl string
+		expectedCache        string
+	}{
+		{"users use the route policy", first, http.StatusOK, "private, no-cache", "MISS"},
+		{"response cache hit", get("/v2/users/1", ""), http.StatusOK, "private, no-cache", "HIT"},
+		{"conditional get", get("/v2/users/1", etag), http.StatusNotModified, "private, no-cache", "HIT"},
+		{"missing user stays no-store", get("/v2/users/999", ""), http.StatusNotFound, "no-store, no-cache, must-revalidate, private", "MISS"},
+		{"openapi document is cacheable", get("/openapi.json", ""), http.StatusOK, "public, max-age=300", ""},
+		{"health is not cached", get("/health", ""), http.StatusOK, "no-store, no-cache, must-revalidate, private", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, tt.rec.Code)
+			}
+			if got := tt.rec.Header().Get("Cache-Control"); got != tt.expectedCacheControl {
+				t.Errorf("expected Cache-Control %q, got %q", tt.expectedCacheControl, got)
+			}
+			if got := tt.rec.Header().Get("X-Cache"); got != tt.expectedCache {
+				t.Errorf("expected X-Cache %q, got %q", tt.expectedCache, got)
+			}
+		})
+	}
+
+	// 更新するとキャッシュも検証子も無効になる
+	req := httptest.NewRequest(http.MethodPut, "/v2/users/1", strings.NewReader(`{"first_name":"Alicia","email":"alice@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	rec := get("/v2/users/1", etag)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("expected fresh response after update, got %d (X-Cache %q)", rec.Code, rec.Header().Get("X-Cache"))
+	}
+	if !strings.Contains(rec.Body.String(), "Alicia") {
+		t.Errorf("expected updated user, got %s", rec.Body.String())
+	}
+}
+
+func TestRouter_Timeouts(t *testing.T) {
+	cfg := config.Load()
+	cfg.Timeout.Delay = 20 * time.Millisecond
+	handler := New(cfg, models.NewUserStore()).Build()
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{"delay within the timeout", "/v2/delay/0", http.StatusOK},
+		{"delay beyond the timeout", "/v2/delay/5000", http.StatusGatewayTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			start := time.Now()
+
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("expected response at the deadline, took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestRouter_LoadShedding(t *testing.T) {
+	cfg := config.Load()
+	cfg.Concurrency.Enabled = true
+	cfg.Concurrency.GlobalLimit = 1
+	cfg.Concurrency.QueueSize = 1
+	cfg.Concurrency.QueueTimeout = 5 * time.Second
+	handler := New(cfg, models.NewUserStore()).Build()
+
+	serve := func(path string) <-chan *httptest.ResponseRecorder {
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			done <- rec
+		}()
+		return done
+	}
+
+	// 遅延リクエストで唯一の枠を使い、ヘルスチェックを待ち行列に入れる
+	delay := serve("/v2/delay/500")
+	time.Sleep(100 * time.Millisecond)
+	health := serve("/health")
+	time.Sleep(100 * time.Millisecond)
+
+	// 待ち行列が一杯なので、優先度の低いリクエストはすぐに503
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/users", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+	var p problem.Problem
+	json.NewDecoder(rec.Body).Decode(&p)
+	if p.Code != problem.CodeOverloaded {
+		t.Errorf("expected code %q, got %q", problem.CodeOverloaded, p.Code)
+	}
+
+	if rec := <-delay; rec.Code != http.StatusOK {
+		t.Errorf("expected delay to complete, got %d", rec.Code)
+	}
+	if rec := <-health; rec.Code != http.StatusOK {
+		t.Errorf("expected queued health check to be served, got %d", rec.Code)
+	}
+}
+
+func TestRouter_Upstream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	cfg := config.Load()
+	cfg.Upstream.URL = srv.URL
+	cfg.Upstream.Required = true
+	cfg.Upstream.Retries = 0
+	cfg.Upstream.BreakerThreshold = 2
+	cfg.Upstream.BreakerCooldown = time.Minute
+	r := New(cfg, models.NewUserStore())
+	handler := r.Build()
+
+	// ブレーカーの状態は管理用API（GET /admin/upstream）で返し、公開側には出さない
+	if item := r.OpenAPI().Paths["/upstream"]; item != nil {
+		t.Error("expected /upstream not to be documented on the public listener")
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{"upstream failure", "/v2/users/1", http.StatusBadGateway},
+		{"breaker opens", "/v2/users/1", http.StatusBadGateway},
+		{"open breaker fails fast", "/v2/users/1", http.StatusServiceUnavailable},
+		{"other routes are unaffected", "/v2/users", http.StatusOK},
+		{"breaker state is not public", "/upstream", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.expectedStatus {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.expectedStatus, rec.Code, rec.Body.String())
+		}
+	}
+	if state := r.Upstream().Breaker().Status().State; state != "open" {
+		t.Errorf("expected the breaker shared with the admin API to be open, got %s", state)
+	}
+}
+
+func TestRouter_Tracing(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	cfg := config.Load()
+	cfg.Tracing.MiddlewareSpans = true
+	defer middleware.TraceMiddlewares(false)
+	handler := New(cfg, models.NewUserStore()).Build()
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/users/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	names := make(map[string]bool)
+	for _, s := range spans.Ended() {
+		if s.SpanContext().TraceID().String() == "4bf92f3577b34da6a3ce929d0e0e4736" {
+			names[s.Name()] = true
+		}
+	}
+	for _, name := range []string{"GET v2.getUser", "UserStore.Get", "middleware.Timeout"} {
+		if !names[name] {
+			t.Errorf("expected span %q, got %v", name, names)
+		}
+	}
+}
+
+func TestRouter_NoAdminRoutes(t *testing.T) {
+	r, handler := setupRouter()
+
+	// 管理用APIとpprofは管理用リスナーだけで提供する
+	for _, pattern := range r.Patterns() {
+		if strings.Contains(pattern, " /admin") || strings.Contains(pattern, " /debug") {
+			t.Errorf("admin pattern %q is registered on the public router", pattern)
+		}
+	}
+	for _, path := range []string{"/debug/pprof/", "/admin/config"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status 404, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestRouter_Readiness(t *testing.T) {
+	r, handler := setupRouter()
+
+	tests := []struct {
+		name           string
+		ready          bool
+		expectedStatus int
+	}{
+		{"ready", true, http.StatusOK},
+		{"not ready", false, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r.Readiness().Set(tt.ready, "test")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_MFA(t *testing.T) {
+	r, handler := setupRouter()
+	secret, _, _ := r.MFA().Enroll(1, "alice@example.com")
+	code, _ := totp.Code(secret, time.Now())
+	if _, err := r.MFA().Activate(1, code); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{"login with mfa returns a challenge", "/v2/auth/login", `{"email":"alice@example.com","password":"password"}`, http.StatusAccepted},
+		{"login without mfa returns tokens", "/v2/auth/login", `{"email":"bob@example.com","password":"password"}`, http.StatusOK},
+		{"enroll requires a token", "/v2/auth/mfa/enroll", "", http.StatusUnauthorized},
+		{"verify requires a token", "/v2/auth/mfa/verify", `{"code":"123456"}`, http.StatusUnauthorized},
+		{"challenge validates the body", "/v2/auth/mfa/challenge", `{"code":"123456"}`, http.StatusBadRequest},
+		{"challenge rejects an invalid token", "/v2/auth/mfa/challenge", `{"mfa_token":"invalid","code":"123456"}`, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_OAuth(t *testing.T) {
+	cfg := config.Load()
+	cfg.OAuth.Enabled = true
+	r := New(cfg, models.NewUserStore())
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	handler := r.Build()
+
+	spec := r.OpenAPI()
+	for _, path := range []string{"/.well-known/openid-configuration", "/oauth/authorize", "/oauth/token", "/oauth/userinfo"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("expected %s to be documented", path)
+		}
+	}
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	form := func(path string, values url.Values) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	t.Run("discovery", func(t *testing.T) {
+		rec := serve(httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+		var doc oauth.Discovery
+		json.NewDecoder(rec.Body).Decode(&doc)
+		if rec.Code != http.StatusOK || doc.TokenEndpoint != cfg.OAuth.Issuer+"/oauth/token" {
+			t.Errorf("unexpected discovery %d %+v", rec.Code, doc)
+		}
+	})
+
+	t.Run("client credentials", func(t *testing.T) {
+		req := form("/oauth/token", url.Values{"grant_type": {"client_credentials"}, "scope": {"users:read"}})
+		req.SetBasicAuth("k6-service", "k6-service-secret")
+		rec := serve(req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("authorization code with PKCE", func(t *testing.T) {
+		login := httptest.NewRequest(http.MethodPost, "/v2/auth/login", strings.NewReader(`{"email":"alice@example.com","password":"password"}`))
+		login.Header.Set("Content-Type", "application/json")
+		var session handlers.TokenResponse
+		json.NewDecoder(serve(login).Body).Decode(&session)
+
+		verifier := "k6-practice-code-verifier-0123456789-abcdefghijkl"
+		authorize := httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+url.Values{
+			"response_type":         {"code"},
+			"client_id":             {"k6-web"},
+			"scope":                 {"openid email"},
+			"state":                 {"xyz"},
+			"code_challenge":        {oauth.S256(verifier)},
+			"code_challenge_method": {"S256"},
+		}.Encode(), nil)
+		authorize.Header.Set("Authorization", "Bearer "+session.AccessToken)
+		rec := serve(authorize)
+		location, _ := url.Parse(rec.Header().Get("Location"))
+		if rec.Code != http.StatusFound || location.Query().Get("code") == "" || location.Query().Get("state") != "xyz" {
+			t.Fatalf("expected a redirect with a code, got %d %s", rec.Code, location)
+		}
+
+		rec = serve(form("/oauth/token", url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {"k6-web"},
+			"code":          {location.Query().Get("code")},
+			"redirect_uri":  {"http://localhost:3000/callback"},
+			"code_verifier": {verifier},
+		}))
+		var token oauth.Token
+		json.NewDecoder(rec.Body).Decode(&token)
+		if rec.Code != http.StatusOK || token.IDToken == "" || token.RefreshToken == "" {
+			t.Fatalf("expected tokens with an ID token, got %d %+v", rec.Code, token)
+		}
+
+		userinfo := httptest.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+		userinfo.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		rec = serve(userinfo)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"email":"alice@example.com"`) {
+			t.Fatalf("unexpected userinfo %d %s", rec.Code, rec.Body.String())
+		}
+
+		// 失効させたアクセストークンはUserInfoで使えない
+		rec = serve(form("/oauth/revoke", url.Values{"client_id": {"k6-web"}, "token": {token.AccessToken}}))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected revoke to return 200, got %d", rec.Code)
+		}
+		if rec = serve(userinfo); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected a revoked token to be rejected, got %d", rec.Code)
+		}
+	})
+}
+
+func TestRouter_APIKeys(t *testing.T) {
+	_, handler := setupRouter()
+	serve := func(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header = header
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var tokens handlers.TokenResponse
+	json.NewDecoder(serve(http.MethodPost, "/v2/auth/login", `{"email":"alice@example.com","password":"password"}`, http.Header{}).Body).Decode(&tokens)
+	bearer := http.Header{"Authorization": {"Bearer " + tokens.AccessToken}}
+
+	rec := serve(http.MethodPost, "/v2/auth/api-keys", `{"name":"ci","rate_limit":4}`, bearer)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created handlers.CreateAPIKeyResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+	var writer, reader handlers.CreateAPIKeyResponse
+	json.NewDecoder(serve(http.MethodPost, "/v2/auth/api-keys", `{"name":"reader"}`, bearer).Body).Decode(&reader)
+	json.NewDecoder(serve(http.MethodPost, "/v2/auth/api-keys", `{"name":"writer","scopes":["users:write"]}`, bearer).Body).Decode(&writer)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		header         http.Header
+		expectedStatus int
+	}{
+		{"me with X-API-Key", http.MethodGet, "/v2/auth/me", "", http.Header{"X-Api-Key": {created.Key}}, http.StatusOK},
+		{"me with Authorization ApiKey", http.MethodGet, "/v2/auth/me", "", http.Header{"Authorization": {"ApiKey " + created.Key}}, http.StatusOK},
+		{"invalid key", http.MethodGet, "/v2/auth/me", "", http.Header{"X-Api-Key": {created.Prefix + "_wrong"}}, http.StatusUnauthorized},
+		{"read-only key cannot enroll mfa", http.MethodPost, "/v2/auth/mfa/enroll", "", http.Header{"X-Api-Key": {created.Key}}, http.StatusForbidden},
+		// 書き込みのスコープがあっても多要素認証の登録はできない
+		{"write key cannot enroll mfa", http.MethodPost, "/v2/auth/mfa/enroll", "", http.Header{"X-Api-Key": {writer.Key}}, http.StatusForbidden},
+		{"write key cannot verify mfa", http.MethodPost, "/v2/auth/mfa/verify", `{"code":"000000"}`, http.Header{"Authorization": {"ApiKey " + writer.Key}}, http.StatusForbidden},
+		{"key cannot manage keys", http.MethodGet, "/v2/auth/api-keys", "", http.Header{"X-Api-Key": {created.Key}}, http.StatusForbidden},
+		// 認証に成功した4回（403を含む）で上限に達する
+		{"per-key rate limit", http.MethodGet, "/v2/auth/me", "", http.Header{"X-Api-Key": {created.Key}}, http.StatusTooManyRequests},
+		// ユーザーCRUDは匿名でも呼べるが、APIキーはスコープで制限する
+		{"anonymous users list", http.MethodGet, "/v2/users", "", http.Header{}, http.StatusOK},
+		{"anonymous delete", http.MethodDelete, "/v2/users/3", "", http.Header{}, http.StatusNoContent},
+		{"write key can update users", http.MethodPut, "/v2/users/2", `{"first_name":"Bob","email":"bob@example.com"}`, http.Header{"X-Api-Key": {writer.Key}}, http.StatusOK},
+		{"read-only key cannot delete users", http.MethodDelete, "/v2/users/2", "", http.Header{"Authorization": {"ApiKey " + reader.Key}}, http.StatusForbidden},
+		{"write key cannot read users", http.MethodGet, "/v2/users/2", "", http.Header{"X-Api-Key": {writer.Key}}, http.StatusForbidden},
+		{"invalid token on users", http.MethodGet, "/v2/users", "", http.Header{"Authorization": {"Bearer invalid"}}, http.StatusUnauthorized},
+		{"list with a token", http.MethodGet, "/v2/auth/api-keys", "", bearer, http.StatusOK},
+		{"revoke with a token", http.MethodDelete, "/v2/auth/api-keys/" + created.ID, "", bearer, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(tt.method, tt.path, tt.body, tt.header); rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package router
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"k6-practice/api/problem"
+)
+
+// VersionHeader はレスポンスに実際に使われたAPIバージョンを示すヘッダー
+const VersionHeader = "API-Version"
+
+// acceptVersion はAcceptヘッダーのバージョン付きメディアタイプを表す
+// application/vnd.k6practice.v2+json または application/vnd.k6practice+json; version=2
+var acceptVersion = regexp.MustCompile(`application/vnd\.k6practice(?:\.(v\d+))?\+json(?:\s*;\s*version=(\d+))?`)
+
+// negotiateVersion はバージョンなしのパスをバージョン付きのルートへ振り分ける
+//
+//   - /v1/... /v2/... のようにパスでバージョンを指定した場合はそのまま
+//   - バージョンなしで登録したパス（/health 等、unversionedに含まれるもの）はそのまま
+//   - それ以外は Accept ヘッダーで指定されたバージョン（なければデフォルト）のパスに書き換える
+func negotiateVersion(unversioned map[string]bool, versions []string, defaultVersion string) func(http.Handler) http.Handler {
+	known := make(map[string]bool, len(versions))
+	for _, v := range versions {
+		known[v] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if v := pathVersion(r.URL.Path); known[v] {
+				w.Header().Set(VersionHeader, v)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if unversioned[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			version := defaultVersion
+			if requested := requestedVersion(r.Header.Get("Accept")); requested != "" {
+				if !known[requested] {
+					problem.Write(w, r, problem.CodeNotAcceptable, "unsupported API version "+requested)
+					return
+				}
+				version = requested
+			}
+
+			w.Header().Add("Vary", "Accept")
+			w.Header().Set(VersionHeader, version)
+
+			rewritten := new(http.Request)
+			*rewritten = *r
+			u := *r.URL
+			u.Path = "/" + version + r.URL.Path
+			u.RawPath = ""
+			rewritten.URL = &u
+			next.ServeHTTP(w, rewritten)
+		})
+	}
+}
+
+// pathVersion はパス先頭のバージョン（/v2/users → v2）を返す
+func pathVersion(path string) string {
+	first, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if len(first) > 1 && first[0] == 'v' && strings.Trim(first[1:], "0123456789") == "" {
+		return first
+	}
+	return ""
+}
+
+// requestedVersion はAcceptヘッダーから要求バージョンを取り出す（指定なしは空文字）
+func requestedVersion(accept string) string {
+	m := acceptVersion.FindStringSubmatch(accept)
+	switch {
+	case m == nil:
+		return ""
+	case m[1] != "":
+		return m[1]
+	case m[2] != "":
+		return "v" + m[2]
+	}
+	return ""
+}
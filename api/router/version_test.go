@@ -0,0 +1,118 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k6-practice/api/handlers"
+	"k6-practice/api/problem"
+)
+
+func TestRequestedVersion(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", ""},
+		{"application/json", ""},
+		{"application/vnd.k6practice.v2+json", "v2"},
+		{"application/vnd.k6practice+json; version=2", "v2"},
+		{"text/html, application/vnd.k6practice.v1+json;q=0.9", "v1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := requestedVersion(tt.accept); got != tt.expected {
+				t.Errorf("requestedVersion(%q) = %q, want %q", tt.accept, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRouter_Versioning(t *testing.T) {
+	_, handler := setupRouter()
+
+	tests := []struct {
+		name       string
+		path       string
+		accept     string
+		version    string
+		deprecated bool
+		v2Shape    bool
+	}{
+		{"unversioned path defaults to v1", "/users", "", "v1", true, false},
+		{"v1 path", "/v1/users", "", "v1", true, false},
+		{"v2 path", "/v2/users", "", "v2", false, true},
+		{"Accept header selects v2", "/users", "application/vnd.k6practice.v2+json", "v2", false, true},
+		{"path wins over Accept header", "/v1/users", "application/vnd.k6practice.v2+json", "v1", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+			if got := rec.Header().Get(VersionHeader); got != tt.version {
+				t.Errorf("expected %s %s, got %q", VersionHeader, tt.version, got)
+			}
+			if got := rec.Header().Get("Deprecation") != ""; got != tt.deprecated {
+				t.Errorf("expected Deprecation header present=%v", tt.deprecated)
+			}
+			if tt.deprecated && rec.Header().Get("Sunset") == "" {
+				t.Error("expected Sunset header on v1")
+			}
+
+			if tt.v2Shape {
+				var list handlers.UserV2List
+				if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+					t.Fatalf("failed to decode v2 response: %v", err)
+				}
+				if list.Count != 3 || list.Data[0].Links.Self == "" {
+					t.Errorf("unexpected v2 response: %+v", list)
+				}
+			} else {
+				var users []map[string]interface{}
+				if err := json.NewDecoder(rec.Body).Decode(&users); err != nil {
+					t.Fatalf("failed to decode v1 response: %v", err)
+				}
+			}
+		})
+	}
+
+	t.Run("unsupported version returns not acceptable", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set("Accept", "application/vnd.k6practice.v9+json")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotAcceptable {
+			t.Errorf("expected status %d, got %d", http.StatusNotAcceptable, rec.Code)
+		}
+		assertProblem(t, rec, problem.CodeNotAcceptable)
+	})
+
+	t.Run("unversioned routes are not rewritten", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		if got := rec.Header().Get(VersionHeader); got != "" {
+			t.Errorf("expected no %s header, got %q", VersionHeader, got)
+		}
+	})
+}
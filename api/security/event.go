@@ -0,0 +1,46 @@
+package security
+
+import (
+	"fmt"
+	"time"
+)
+
+// TypeAlert はしきい値を超えたときに Monitor が記録するイベントの種類
+const TypeAlert = "SECURITY_ALERT"
+
+// Event はセキュリティイベント（種類は middleware.SecurityEvent の値）
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	IP        string    `json:"ip"`
+	Method    string    `json:"method,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	UserID    int       `json:"user_id,omitempty"`
+	Details   string    `json:"details,omitempty"`
+}
+
+// Alert はしきい値アラートか
+func (e Event) Alert() bool {
+	return e.Type == TypeAlert
+}
+
+// String は [SECURITY] のログと同じ key=value 形式
+func (e Event) String() string {
+	return fmt.Sprintf("event=%s ip=%s method=%s path=%s user_agent=%q details=%q timestamp=%s",
+		e.Type,
+		e.IP,
+		e.Method,
+		e.Path,
+		e.UserAgent,
+		e.Details,
+		e.Time.Format(time.RFC3339),
+	)
+}
+
+// Sink はセキュリティイベントの出力先
+// Write はリクエストの処理中に呼ばれるため、ネットワーク越しの送信はブロックしない
+type Sink interface {
+	Write(e Event) error
+}
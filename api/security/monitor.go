@@ -0,0 +1,277 @@
+package security
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k6-practice/api/metrics"
+)
+
+// Rule は同じIPから Window の間に Count 回の Type のイベントが起きたらアラートにする
+type Rule struct {
+	Type   string
+	Count  int
+	Window time.Duration
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s:%d/%s", r.Type, r.Count, r.Window)
+}
+
+// ParseRules は "AUTH_FAILURE:20/1m"（種類:回数/期間）の形式のルールを読み込む
+func ParseRules(specs []string) ([]Rule, error) {
+	var rules []Rule
+	for _, spec := range specs {
+		eventType, threshold, ok := strings.Cut(spec, ":")
+		count, window, ok2 := strings.Cut(threshold, "/")
+		if !ok || !ok2 || eventType == "" {
+			return nil, fmt.Errorf("security: invalid alert rule %q (want TYPE:COUNT/WINDOW)", spec)
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("security: invalid count in alert rule %q", spec)
+		}
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("security: invalid window in alert rule %q", spec)
+		}
+		rules = append(rules, Rule{Type: eventType, Count: n, Window: d})
+	}
+	return rules, nil
+}
+
+// Config は Monitor の設定
+type Config struct {
+	// Buffer: Query で照会できる直近のイベント数（0は保持しない）
+	Buffer int
+	// Rules: IPごとのしきい値アラート
+	Rules []Rule
+}
+
+// Query は Monitor.Query の条件（空の項目は絞り込まない）
+type Query struct {
+	Type  string
+	IP    string
+	Since time.Time
+	// Limit: 返す件数の上限（0は無制限）
+	Limit int
+}
+
+type windowKey struct {
+	eventType string
+	ip        string
+}
+
+// セキュリティイベントの統計（種類ごとの件数と出力先のエラー数）
+var (
+	eventCounts = new(expvar.Map).Init()
+	sinkErrors  = new(expvar.Int)
+)
+
+func init() {
+	stats := new(expvar.Map).Init()
+	stats.Set("events", eventCounts)
+	stats.Set("sink_errors", sinkErrors)
+	metrics.Set("security_events", stats)
+}
+
+// Monitor はセキュリティイベントを出力先に送り、直近のイベントの保持とIPごとの集計を行う
+type Monitor struct {
+	sinks []Sink
+	rules map[string]Rule
+
+	mu        sync.Mutex
+	events    []Event
+	next      int
+	counts    map[string]int64
+	windows   map[windowKey][]time.Time
+	lastSweep time.Time
+	failing   []bool
+}
+
+func NewMonitor(cfg Config, sinks ...Sink) *Monitor {
+	m := &Monitor{
+		sinks:   sinks,
+		rules:   make(map[string]Rule),
+		events:  make([]Event, 0, cfg.Buffer),
+		counts:  make(map[string]int64),
+		windows: make(map[windowKey][]time.Time),
+		failing: make([]bool, len(sinks)),
+	}
+	for _, r := range cfg.Rules {
+		m.rules[r.Type] = r
+	}
+	return m
+}
+
+// Record はイベントを記録し、しきい値に達した場合はアラートも記録する
+func (m *Monitor) Record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	m.mu.Lock()
+	m.store(e)
+	alert, ok := m.observe(e)
+	if ok {
+		m.store(alert)
+	}
+	m.mu.Unlock()
+
+	m.write(e)
+	if ok {
+		m.write(alert)
+	}
+}
+
+// store は直近のイベントをリングバッファに保持する（m.mu を保持して呼ぶ）
+func (m *Monitor) store(e Event) {
+	m.counts[e.Type]++
+	eventCounts.Add(e.Type, 1)
+
+	if cap(m.events) == 0 {
+		return
+	}
+	if len(m.events) < cap(m.events) {
+		m.events = append(m.events, e)
+	} else {
+		m.events[m.next] = e
+	}
+	m.next = (m.next + 1) % cap(m.events)
+}
+
+// observe はIPごとの時間窓で件数を数え、しきい値に達したらアラートを返す（m.mu を保持して呼ぶ）
+// アラート後は件数を数え直すため、攻撃が続く間は Count 回ごとにアラートになる
+func (m *Monitor) observe(e Event) (Event, bool) {
+	m.sweep(e.Time)
+
+	rule, ok := m.rules[e.Type]
+	if !ok || e.Alert() {
+		return Event{}, false
+	}
+
+	key := windowKey{eventType: e.Type, ip: e.IP}
+	times := m.windows[key]
+	cutoff := e.Time.Add(-rule.Window)
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	times = append(times[i:], e.Time)
+
+	if len(times) < rule.Count {
+		m.windows[key] = times
+		return Event{}, false
+	}
+	delete(m.windows, key)
+	return Event{
+		Time:    e.Time,
+		Type:    TypeAlert,
+		IP:      e.IP,
+		Method:  e.Method,
+		Path:    e.Path,
+		Details: fmt.Sprintf("%d %s events from %s within %s (rule %s)", len(times), e.Type, e.IP, rule.Window, rule),
+	}, true
+}
+
+// sweep は時間窓を過ぎたIPの集計を削除する（1分に1回まで、m.mu を保持して呼ぶ）
+func (m *Monitor) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for key, times := range m.windows {
+		if now.Sub(times[len(times)-1]) > m.rules[key.eventType].Window {
+			delete(m.windows, key)
+		}
+	}
+}
+
+// write はすべての出力先に送る（出力先が失敗し始めたときと回復したときだけログに出す）
+func (m *Monitor) write(e Event) {
+	for i, sink := range m.sinks {
+		err := sink.Write(e)
+		if err != nil {
+			sinkErrors.Add(1)
+		}
+
+		m.mu.Lock()
+		changed := m.failing[i] != (err != nil)
+		m.failing[i] = err != nil
+		m.mu.Unlock()
+
+		if changed && err != nil {
+			log.Printf("[SECURITY] sink %T failed: %v", sink, err)
+		} else if changed {
+			log.Printf("[SECURITY] sink %T recovered", sink)
+		}
+	}
+}
+
+// Query は条件に合う直近のイベントを新しい順に返す
+func (m *Monitor) Query(q Query) []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []Event{}
+	for i := 1; i <= len(m.events); i++ {
+		e := m.events[(m.next-i+len(m.events))%len(m.events)]
+		if q.Type != "" && e.Type != q.Type {
+			continue
+		}
+		if q.IP != "" && e.IP != q.IP {
+			continue
+		}
+		if !q.Since.IsZero() && e.Time.Before(q.Since) {
+			// 新しい順に見ているため、これより前はすべて対象外
+			break
+		}
+		events = append(events, e)
+		if q.Limit > 0 && len(events) == q.Limit {
+			break
+		}
+	}
+	return events
+}
+
+// Counts は起動後の種類ごとのイベント数
+func (m *Monitor) Counts() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[string]int64, len(m.counts))
+	for k, v := range m.counts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// Rules はしきい値アラートのルール（種類の順）
+func (m *Monitor) Rules() []Rule {
+	rules := make([]Rule, 0, len(m.rules))
+	for _, r := range m.rules {
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Type < rules[j].Type })
+	return rules
+}
+
+// Close は閉じる必要がある出力先（ファイル・UDP・Webhookの送信）を閉じる
+func (m *Monitor) Close() error {
+	var first error
+	for _, sink := range m.sinks {
+		if c, ok := sink.(io.Closer); ok {
+			if err := c.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
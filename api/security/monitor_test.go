@@ -0,0 +1,194 @@
+package security
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordSink は受け取ったイベントを保持する
+type recordSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (s *recordSink) Write(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *recordSink) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		specs     []string
+		expected  []Rule
+		expectErr bool
+	}{
+		{"empty", nil, nil, false},
+		{"valid", []string{"AUTH_FAILURE:20/1m", "CSRF_BLOCKED:5/30s"}, []Rule{
+			{Type: "AUTH_FAILURE", Count: 20, Window: time.Minute},
+			{Type: "CSRF_BLOCKED", Count: 5, Window: 30 * time.Second},
+		}, false},
+		{"missing window", []string{"AUTH_FAILURE:20"}, nil, true},
+		{"missing type", []string{":20/1m"}, nil, true},
+		{"zero count", []string{"AUTH_FAILURE:0/1m"}, nil, true},
+		{"invalid window", []string{"AUTH_FAILURE:20/soon"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseRules(tt.specs)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error %v, got %v", tt.expectErr, err)
+			}
+			if len(rules) != len(tt.expected) {
+				t.Fatalf("expected %d rules, got %d", len(tt.expected), len(rules))
+			}
+			for i := range rules {
+				if rules[i] != tt.expected[i] {
+					t.Errorf("expected %v, got %v", tt.expected[i], rules[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMonitor_Query(t *testing.T) {
+	m := NewMonitor(Config{Buffer: 3})
+	base := time.Now()
+	for i, e := range []Event{
+		{Type: "AUTH_FAILURE", IP: "192.0.2.1"},
+		{Type: "AUTH_FAILURE", IP: "192.0.2.2"},
+		{Type: "CSRF_BLOCKED", IP: "192.0.2.1"},
+		{Type: "AUTH_FAILURE", IP: "192.0.2.1"},
+	} {
+		e.Time = base.Add(time.Duration(i) * time.Second)
+		e.Details = string(rune('a' + i))
+		m.Record(e)
+	}
+
+	tests := []struct {
+		name     string
+		query    Query
+		expected string
+	}{
+		// 最も古い "a" はバッファから溢れている
+		{"all newest first", Query{}, "dcb"},
+		{"by type", Query{Type: "AUTH_FAILURE"}, "db"},
+		{"by ip", Query{IP: "192.0.2.1"}, "dc"},
+		{"since", Query{Since: base.Add(2 * time.Second)}, "dc"},
+		{"limit", Query{Limit: 1}, "d"},
+		{"no match", Query{Type: "RATE_LIMIT_HIT"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			for _, e := range m.Query(tt.query) {
+				got += e.Details
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	if counts := m.Counts(); counts["AUTH_FAILURE"] != 3 || counts["CSRF_BLOCKED"] != 1 {
+		t.Errorf("expected counts to include evicted events, got %v", counts)
+	}
+}
+
+func TestMonitor_Alerts(t *testing.T) {
+	rules := []Rule{{Type: "AUTH_FAILURE", Count: 3, Window: time.Minute}}
+	base := time.Now()
+
+	tests := []struct {
+		name           string
+		events         []Event
+		expectedAlerts int
+	}{
+		{
+			name: "threshold reached",
+			events: []Event{
+				{Type: "AUTH_FAILURE", IP: "192.0.2.1", Time: base},
+				{Type: "AUTH_FAILURE", IP: "192.0.2.1", Time: base.Add(time.Second)},
+				{Type: "AUTH_FAILURE", IP: "192.0.2.1", Time: base.Add(2 * time.Second)},
+			},
+			expectedAlerts: 1,
+		},
+		{
+			name: "counted per ip",
+			events: []Event{
+				{Type: "AUTH_FAILURE", IP: "192.0.2.1", Time: base},
+				{Type: "AUTH_FAILURE", IP: "192.0.2.2", Time: base},
+				{Type: "AUTH_FAILURE", IP: "192.0.2.1", Time: base},
+			},
+			expectedAlerts: 0,
+		},
+		{
+			name: "outside window",
+			events: []Event{
+				{Type: "AUTH_FAILURE", IP: "192.0.2.1", Time: base},
+				{Type: "AUTH_FAILURE", IP: "192.0.2.1", Time: base.Add(time.Minute)},
+				{Type: "AUTH_FAILURE", IP: "192.0.2.1", Time: base.Add(time.Minute + time.Second)},
+			},
+			expectedAlerts: 0,
+		},
+		{
+			name: "other types are not counted",
+			events: []Event{
+				{Type: "CSRF_BLOCKED", IP: "192.0.2.1", Time: base},
+				{Type: "CSRF_BLOCKED", IP: "192.0.2.1", Time: base},
+				{Type: "CSRF_BLOCKED", IP: "192.0.2.1", Time: base},
+			},
+			expectedAlerts: 0,
+		},
+		{
+			name:           "counted again after an alert",
+			events:         repeat(Event{Type: "AUTH_FAILURE", IP: "192.0.2.1", Time: base}, 7),
+			expectedAlerts: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordSink{}
+			m := NewMonitor(Config{Buffer: 100, Rules: rules}, sink)
+			for _, e := range tt.events {
+				m.Record(e)
+			}
+
+			var alerts int
+			for _, e := range sink.Events() {
+				if e.Alert() {
+					alerts++
+					if e.IP != "192.0.2.1" {
+						t.Errorf("expected alert for 192.0.2.1, got %q", e.IP)
+					}
+				}
+			}
+			if alerts != tt.expectedAlerts {
+				t.Errorf("expected %d alerts, got %d", tt.expectedAlerts, alerts)
+			}
+			if got := len(m.Query(Query{Type: TypeAlert})); got != tt.expectedAlerts {
+				t.Errorf("expected %d alerts to be queryable, got %d", tt.expectedAlerts, got)
+			}
+		})
+	}
+}
+
+func repeat(e Event, n int) []Event {
+	events := make([]Event, n)
+	for i := range events {
+		events[i] = e
+	}
+	return events
+}
@@ -0,0 +1,284 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k6-practice/api/logging"
+)
+
+// ErrDropped は送信待ちが溢れてイベントを破棄した
+var ErrDropped = errors.New("security: sink queue is full, event dropped")
+
+// LogSink は標準のロガーに [SECURITY] の行を出力する（LOG_LEVEL が warn 以下の場合）
+type LogSink struct{}
+
+func (LogSink) Write(e Event) error {
+	if !logging.Enabled(slog.LevelWarn) {
+		return nil
+	}
+	log.Printf("[SECURITY] %s", e)
+	return nil
+}
+
+// alertsOnly はしきい値アラートだけを渡す
+type alertsOnly struct {
+	Sink
+}
+
+// AlertsOnly はしきい値アラートだけを sink に送る（Webhookの通知先など）
+func AlertsOnly(sink Sink) Sink {
+	return alertsOnly{sink}
+}
+
+func (a alertsOnly) Write(e Event) error {
+	if !e.Alert() {
+		return nil
+	}
+	return a.Sink.Write(e)
+}
+
+func (a alertsOnly) Close() error {
+	if c, ok := a.Sink.(interface{ Close() error }); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// FileSink は1行1イベントのJSON（JSON Lines）をファイルに追記する
+// MaxBytes を超える前に path.1, path.2, ... にずらし、MaxBackups より古いものは削除する
+type FileSink struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewFileSink(path string, maxBytes int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileSink) Write(e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		// 前回のローテーションで開き直せなかった
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if s.maxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// rotate は現在のファイルを path.1 にずらして新しいファイルを開く（s.mu を保持して呼ぶ）
+func (s *FileSink) rotate() error {
+	s.file.Close()
+	s.file = nil
+
+	if s.maxBackups < 1 {
+		os.Remove(s.path)
+	} else {
+		os.Remove(s.backup(s.maxBackups))
+		for i := s.maxBackups - 1; i >= 1; i-- {
+			os.Rename(s.backup(i), s.backup(i+1))
+		}
+		if err := os.Rename(s.path, s.backup(1)); err != nil {
+			return err
+		}
+	}
+	return s.open()
+}
+
+func (s *FileSink) backup(n int) string {
+	return fmt.Sprintf("%s.%d", s.path, n)
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// WebhookSink はイベントを1件ずつJSONでPOSTする
+// 送信は別のゴルーチンで行い、送信待ちが溢れた場合は破棄する（リクエストの処理を遅らせない）
+type WebhookSink struct {
+	url    string
+	client *http.Client
+	queue  chan Event
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewWebhookSink(url string, timeout time.Duration, buffer int) *WebhookSink {
+	s := &WebhookSink{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+		queue:  make(chan Event, buffer),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *WebhookSink) Write(e Event) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return ErrDropped
+	}
+	select {
+	case s.queue <- e:
+		return nil
+	default:
+		return ErrDropped
+	}
+}
+
+func (s *WebhookSink) run() {
+	defer close(s.done)
+	for e := range s.queue {
+		if err := s.post(e); err != nil {
+			sinkErrors.Add(1)
+			log.Printf("[SECURITY] webhook delivery failed: event=%s ip=%s error=%v", e.Type, e.IP, err)
+		}
+	}
+}
+
+func (s *WebhookSink) post(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close は送信待ちのイベントを送り終えるまで待つ
+func (s *WebhookSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+	return nil
+}
+
+// syslogのファシリティ（authpriv）と重大度
+const (
+	syslogFacility = 10
+	severityAlert  = 1
+	severityWarn   = 4
+)
+
+// SyslogSink はRFC 5424形式のメッセージをUDPで送る（ローカルの rsyslog などの受信を想定）
+type SyslogSink struct {
+	conn     net.Conn
+	hostname string
+	appName  string
+}
+
+func NewSyslogSink(addr, appName string) (*SyslogSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &SyslogSink{conn: conn, hostname: hostname, appName: appName}, nil
+}
+
+func (s *SyslogSink) Write(e Event) error {
+	severity := severityWarn
+	if e.Alert() {
+		severity = severityAlert
+	}
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		syslogFacility*8+severity,
+		e.Time.UTC().Format(time.RFC3339Nano),
+		s.hostname,
+		strings.ReplaceAll(s.appName, " ", "_"),
+		os.Getpid(),
+		e.Type,
+		e,
+	)
+	_, err := s.conn.Write([]byte(msg))
+	return err
+}
+
+func (s *SyslogSink) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,207 @@
+package security
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"k6-practice/api/logging"
+)
+
+func testEvent(eventType string) Event {
+	return Event{
+		Time:    time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Type:    eventType,
+		IP:      "192.0.2.1",
+		Method:  http.MethodPost,
+		Path:    "/auth/login",
+		Details: "invalid credentials",
+	}
+}
+
+func TestLogSink(t *testing.T) {
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(out)
+	defer logging.SetLevel("info")
+
+	tests := []struct {
+		level    string
+		expected bool
+	}{
+		{"warn", true},
+		{"error", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			buf.Reset()
+			logging.SetLevel(tt.level)
+			LogSink{}.Write(testEvent("AUTH_FAILURE"))
+
+			got := buf.String()
+			if logged := strings.Contains(got, "[SECURITY] event=AUTH_FAILURE ip=192.0.2.1"); logged != tt.expected {
+				t.Errorf("expected logged=%v, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFileSink_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "security.jsonl")
+	line, _ := json.Marshal(testEvent("AUTH_FAILURE"))
+	// 2件で上限に達する
+	sink, err := NewFileSink(path, int64(2*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	for i := 0; i < 7; i++ {
+		if err := sink.Write(testEvent("AUTH_FAILURE")); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+
+	tests := []struct {
+		file     string
+		expected int
+	}{
+		{path, 1},
+		{path + ".1", 2},
+		{path + ".2", 2},
+	}
+	for _, tt := range tests {
+		if got := countLines(t, tt.file); got != tt.expected {
+			t.Errorf("%s: expected %d lines, got %d", filepath.Base(tt.file), tt.expected, got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected backups beyond the limit to be removed, got %v", err)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var n int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Errorf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		n++
+	}
+	return n
+}
+
+func TestWebhookSink(t *testing.T) {
+	received := make(chan Event, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+		received <- e
+	}))
+	defer srv.Close()
+
+	sink := AlertsOnly(NewWebhookSink(srv.URL, time.Second, 10))
+	sink.Write(testEvent("AUTH_FAILURE"))
+	sink.Write(testEvent(TypeAlert))
+	sink.(interface{ Close() error }).Close()
+
+	close(received)
+	var types []string
+	for e := range received {
+		types = append(types, e.Type)
+	}
+	if len(types) != 1 || types[0] != TypeAlert {
+		t.Errorf("expected only the alert to be posted, got %v", types)
+	}
+}
+
+func TestWebhookSink_Dropped(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(srv.URL, time.Second, 1)
+	var dropped int
+	for i := 0; i < 5; i++ {
+		if sink.Write(testEvent(TypeAlert)) == ErrDropped {
+			dropped++
+		}
+	}
+	close(block)
+	sink.Close()
+
+	// 1件は送信中、1件は送信待ち、残りは破棄
+	if dropped < 3 {
+		t.Errorf("expected events to be dropped instead of blocking, got %d dropped", dropped)
+	}
+	if err := sink.Write(testEvent(TypeAlert)); err != ErrDropped {
+		t.Errorf("expected writes after Close to be dropped, got %v", err)
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink, err := NewSyslogSink(conn.LocalAddr().String(), "k6-practice-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	tests := []struct {
+		eventType      string
+		expectedPrefix string
+	}{
+		{"AUTH_FAILURE", "<84>1 2026-01-02T03:04:05Z "},
+		{TypeAlert, "<81>1 2026-01-02T03:04:05Z "},
+	}
+
+	buf := make([]byte, 2048)
+	for _, tt := range tests {
+		t.Run(tt.eventType, func(t *testing.T) {
+			if err := sink.Write(testEvent(tt.eventType)); err != nil {
+				t.Fatal(err)
+			}
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := string(buf[:n])
+			if !strings.HasPrefix(msg, tt.expectedPrefix) {
+				t.Errorf("expected prefix %q, got %q", tt.expectedPrefix, msg)
+			}
+			if !strings.Contains(msg, " k6-practice-api ") || !strings.Contains(msg, " "+tt.eventType+" - event="+tt.eventType+" ip=192.0.2.1") {
+				t.Errorf("unexpected message %q", msg)
+			}
+		})
+	}
+}
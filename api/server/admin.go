@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"k6-practice/api/admin"
+	"k6-practice/api/middleware"
+)
+
+// newAdminServer は管理用リスナー（pprof・ランタイムの診断・管理用API）を作る
+// 公開側とは別のアドレスで待ち受け、router.Build のmuxには登録しない
+// 公開側のHTTPサーバー（s.http）を作った後に呼ぶ（コネクションの追跡を設定する）
+func (s *Server) newAdminServer() (*http.Server, error) {
+	cfg := s.cfg.Admin
+	if cfg.Token == "" {
+		return nil, errors.New("admin listener requires ADMIN_TOKEN")
+	}
+
+	var profiler *admin.Profiler
+	if p := cfg.Profiling; p.Enabled {
+		var err error
+		profiler, err = admin.NewProfiler(admin.ProfilerConfig{
+			Interval:          p.Interval,
+			LatencyThreshold:  p.LatencyThreshold,
+			InFlightThreshold: p.InFlightThreshold,
+			CPUDuration:       p.CPUDuration,
+			Cooldown:          p.Cooldown,
+			Dir:               p.Dir,
+			MaxProfiles:       p.MaxProfiles,
+		})
+		if err != nil {
+			return nil, err
+		}
+		go profiler.Run(context.Background())
+	}
+
+	conns := admin.NewConnTracker()
+	s.http.ConnState = conns.Track
+
+	return &http.Server{
+		Addr: cfg.Addr,
+		Handler: admin.Handler(admin.Config{
+			Token:       cfg.Token,
+			Profiler:    profiler,
+			Store:       s.userStore,
+			RateLimiter: s.router.RateLimiter(),
+			Readiness:   s.router.Readiness(),
+			Revocations: middleware.Revocations,
+			LoginGuard:  s.router.LoginGuard(),
+			MFA:         s.router.MFA(),
+			APIKeys:     s.router.APIKeys(),
+			Connections: conns,
+			Upstream:    s.router.Upstream(),
+			Security:    s.security,
+			Settings:    s.cfg,
+		}),
+		ReadHeaderTimeout: s.cfg.Server.ReadHeaderTimeout,
+	}, nil
+}
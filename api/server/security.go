@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+
+	"k6-practice/api/config"
+	"k6-practice/api/security"
+)
+
+// newSecurityMonitor はSECURITY_*の設定からセキュリティイベントの出力先としきい値アラートを組み立てる
+func newSecurityMonitor(cfg config.SecurityConfig, appName string) (*security.Monitor, error) {
+	rules, err := security.ParseRules(cfg.AlertRules)
+	if err != nil {
+		return nil, err
+	}
+
+	var sinks []security.Sink
+	if cfg.Log {
+		sinks = append(sinks, security.LogSink{})
+	}
+	if cfg.File != "" {
+		file, err := security.NewFileSink(cfg.File, cfg.FileMaxBytes, cfg.FileMaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("security events file: %w", err)
+		}
+		sinks = append(sinks, file)
+	}
+	if cfg.WebhookURL != "" {
+		var webhook security.Sink = security.NewWebhookSink(cfg.WebhookURL, cfg.WebhookTimeout, cfg.Buffer)
+		if cfg.WebhookAlertsOnly {
+			webhook = security.AlertsOnly(webhook)
+		}
+		sinks = append(sinks, webhook)
+	}
+	if cfg.SyslogAddr != "" {
+		syslog, err := security.NewSyslogSink(cfg.SyslogAddr, appName)
+		if err != nil {
+			return nil, fmt.Errorf("security events syslog: %w", err)
+		}
+		sinks = append(sinks, syslog)
+	}
+
+	return security.NewMonitor(security.Config{Buffer: cfg.Buffer, Rules: rules}, sinks...), nil
+}
+
+// securityOutputs はセキュリティイベントの出力先の一覧（起動時の表示用）
+func securityOutputs(cfg config.SecurityConfig) []string {
+	var outputs []string
+	if cfg.Log {
+		outputs = append(outputs, "log")
+	}
+	if cfg.File != "" {
+		outputs = append(outputs, "file "+cfg.File)
+	}
+	if cfg.WebhookURL != "" {
+		if cfg.WebhookAlertsOnly {
+			outputs = append(outputs, "webhook (alerts only)")
+		} else {
+			outputs = append(outputs, "webhook")
+		}
+	}
+	if cfg.SyslogAddr != "" {
+		outputs = append(outputs, "syslog udp://"+cfg.SyslogAddr)
+	}
+	if len(outputs) == 0 {
+		outputs = append(outputs, "admin API only")
+	}
+	return outputs
+}
@@ -1,12 +1,26 @@
 package server
 
 import (
+	"crypto/tls"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	"k6-practice/api/config"
+	"k6-practice/api/grpcserver"
+	"k6-practice/api/middleware"
 	"k6-practice/api/models"
 	"k6-practice/api/router"
+	"k6-practice/api/security"
 )
 
 // Server はHTTPサーバーを表す
@@ -14,6 +28,12 @@ type Server struct {
 	cfg       *config.Config
 	handler   http.Handler
 	userStore *models.UserStore
+	router    *router.Router
+	http      *http.Server
+	http3     *http3.Server
+	grpc      *grpc.Server
+	admin     *http.Server
+	security  *security.Monitor
 }
 
 // New は新しいServerを作成
@@ -27,13 +47,134 @@ func New(cfg *config.Config) *Server {
 		cfg:       cfg,
 		handler:   handler,
 		userStore: userStore,
+		router:    r,
 	}
 }
 
 // Run はサーバーを起動
+// TLS有効時はHTTP/1.1とHTTP/2（ALPN）、設定によりUDPでHTTP/3も待ち受ける
+// TLS無効時はHTTP/1.1と設定によりh2cで待ち受ける
+// gRPC・管理用リスナーは別ポートで待ち受け、いずれかのサーバーが終了した時点でそのエラーを返す
 func (s *Server) Run() error {
+	if err := s.router.Err(); err != nil {
+		return err
+	}
+	monitor, err := newSecurityMonitor(s.cfg.Security, s.cfg.Tracing.ServiceName)
+	if err != nil {
+		return err
+	}
+	s.security = monitor
+	middleware.SecLogger = middleware.NewSecurityLogger(true, monitor)
+
+	s.http = &http.Server{
+		Addr:              s.cfg.Server.Addr,
+		Handler:           s.handler,
+		ReadHeaderTimeout: s.cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       s.cfg.Server.ReadTimeout,
+		IdleTimeout:       s.cfg.Server.IdleTimeout,
+	}
+	if !s.cfg.Server.HTTP2 {
+		// nilでない（空の）TLSNextProtoを設定するとnet/httpはHTTP/2を有効にしない
+		s.http.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+
+	var serve []func() error
+	var grpcOpts []grpc.ServerOption
+	if !s.cfg.Server.TLS.Enabled() {
+		if s.cfg.Server.HTTP3.Enabled {
+			return errors.New("HTTP/3 requires TLS (set TLS_CERT_FILE and TLS_KEY_FILE, or TLS_SELF_SIGNED=true)")
+		}
+		if s.cfg.Server.HTTP2 && s.cfg.Server.H2C {
+			s.http.Handler = h2c.NewHandler(s.handler, &http2.Server{})
+		}
+		serve = append(serve, s.http.ListenAndServe)
+	} else {
+		tlsConfig, err := newTLSConfig(s.cfg.Server.TLS)
+		if err != nil {
+			return err
+		}
+		s.http.TLSConfig = tlsConfig
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+
+		if s.cfg.Server.HTTP3.Enabled {
+			// 同じハンドラーをHTTP/3でも提供し、TCP側のレスポンスでAlt-Svcを広告する
+			s.http3 = &http3.Server{
+				Addr:      s.cfg.Server.HTTP3.Addr,
+				Handler:   s.handler,
+				TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+			}
+			s.http.Handler = altSvc(s.http3, s.http.Handler)
+			serve = append(serve, s.http3.ListenAndServe)
+		}
+		serve = append(serve, func() error { return s.http.ListenAndServeTLS("", "") })
+	}
+
+	if s.cfg.Server.GRPC.Enabled {
+		// RESTと同じUserStore・トークン処理を使う
+		s.grpc = grpcserver.New(s.userStore, grpcserver.Config{
+			Reflection: s.cfg.Server.GRPC.Reflection,
+			LoginGuard: s.router.LoginGuard(),
+			MFA:        s.router.MFA(),
+		}, grpcOpts...)
+		serve = append(serve, s.serveGRPC)
+	}
+
+	if s.cfg.Admin.Enabled {
+		adminServer, err := s.newAdminServer()
+		if err != nil {
+			return err
+		}
+		s.admin = adminServer
+		serve = append(serve, s.admin.ListenAndServe)
+	}
+
 	s.printStartupInfo()
-	return http.ListenAndServe(s.cfg.Server.Addr, s.handler)
+	if s.cfg.Server.TLS.SelfSigned {
+		log.Printf("Self-signed certificate SHA-256: %s\n", fingerprint(s.http.TLSConfig.Certificates[0]))
+	}
+
+	errs := make(chan error, len(serve))
+	for _, fn := range serve {
+		go func() { errs <- fn() }()
+	}
+	err = <-errs
+	// 送信待ちのセキュリティイベントを送ってから終了する
+	s.security.Close()
+	return err
+}
+
+// serveGRPC はgRPCのTCPアドレスで待ち受ける
+func (s *Server) serveGRPC() error {
+	lis, err := net.Listen("tcp", s.cfg.Server.GRPC.Addr)
+	if err != nil {
+		return err
+	}
+	return s.grpc.Serve(lis)
+}
+
+// altSvc はHTTP/3で待ち受けているポートをAlt-Svcヘッダーで広告する
+func altSvc(h3 *http3.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// UDPの待ち受け開始前はエラーになる（広告しないだけ）
+		h3.SetQUICHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// protocols は待ち受けるプロトコルの一覧（起動時の表示用）
+func (s *Server) protocols() []string {
+	protocols := []string{"HTTP/1.1"}
+	switch {
+	case !s.cfg.Server.HTTP2:
+	case s.cfg.Server.TLS.Enabled():
+		protocols = append(protocols, "HTTP/2")
+	case s.cfg.Server.H2C:
+		protocols = append(protocols, "HTTP/2 (h2c)")
+	}
+	if s.cfg.Server.TLS.Enabled() && s.cfg.Server.HTTP3.Enabled {
+		protocols = append(protocols, "HTTP/3 (udp "+s.cfg.Server.HTTP3.Addr+")")
+	}
+	return protocols
 }
 
 func (s *Server) printStartupInfo() {
@@ -45,21 +186,55 @@ func (s *Server) printStartupInfo() {
 	log.Println("  - A04: Rate limiting (100 req/min), Body size limit (1MB)")
 	log.Println("  - A05: Security headers (XSS, Clickjacking, MIME sniffing)")
 	log.Println("  - A07: CSRF protection")
-	log.Println("  - A09: Security event logging")
+	if l := s.cfg.Lockout; l.AccountThreshold > 0 || l.IPThreshold > 0 {
+		log.Printf("  - A07: Login lockout (%d failures per account, %d per IP within %s)\n", l.AccountThreshold, l.IPThreshold, l.Window)
+	}
+	log.Printf("  - A07: Optional TOTP MFA (POST /auth/mfa/enroll, %d recovery codes)\n", s.cfg.MFA.RecoveryCodes)
+	if k := s.cfg.APIKeys; k.Enabled {
+		log.Printf("  - A07: API keys (POST /auth/api-keys, %d req/%s per key)\n", k.RateLimit, k.Window)
+	}
+	if s.cfg.OAuth.Enabled {
+		log.Printf("  - A07: OAuth 2.0 / OpenID Connect provider (%s/.well-known/openid-configuration, %d clients)\n", s.cfg.OAuth.Issuer, len(s.cfg.OAuth.Clients))
+	}
+	log.Printf("  - A09: Security event logging (%s)\n", strings.Join(securityOutputs(s.cfg.Security), ", "))
+	if rules := s.security.Rules(); len(rules) > 0 {
+		var specs []string
+		for _, r := range rules {
+			specs = append(specs, r.String())
+		}
+		log.Printf("  - A09: Security alerts per IP (%s)\n", strings.Join(specs, ", "))
+	}
+	if s.cfg.Server.TLS.Enabled() {
+		log.Println("  - A02: TLS with HSTS")
+		if s.cfg.Server.TLS.ClientCAFile != "" {
+			log.Printf("  - A07: mTLS client certificates (%s)\n", s.cfg.Server.TLS.ClientAuth)
+		}
+	}
 	log.Println("")
 	log.Println("Endpoints:")
-	log.Println("  GET  /health           - Health check")
-	log.Println("  GET  /users            - List users")
-	log.Println("  GET  /users/:id        - Get user")
-	log.Println("  POST /users            - Create user")
-	log.Println("  PUT  /users/:id        - Update user")
-	log.Println("  DELETE /users/:id      - Delete user")
-	log.Println("  POST /auth/login       - Login (get JWT)")
-	log.Println("  POST /auth/refresh     - Refresh token")
-	log.Println("  GET  /auth/me          - Get current user (requires auth)")
-	log.Println("  GET  /delay/:ms        - Delay response by ms")
-	log.Println("  GET  /random-delay     - Random delay (0-1000ms)")
-	log.Println("  GET  /error-rate/:pct  - Return error at given rate")
+	// ルーターが生成したOpenAPIドキュメントから一覧を出力（登録内容と常に一致する）
+	for _, ep := range s.router.OpenAPI().Endpoints() {
+		log.Printf("  %-6s %-18s - %s\n", ep.Method, ep.Path, ep.Summary)
+	}
 	log.Println("")
-	log.Printf("Listening on %s\n", s.cfg.Server.Addr)
+	scheme := "http"
+	if s.cfg.Server.TLS.Enabled() {
+		scheme = "https"
+	}
+	log.Printf("Listening on %s://%s (%s)\n", scheme, s.cfg.Server.Addr, strings.Join(s.protocols(), ", "))
+	if s.grpc != nil {
+		var services []string
+		for name := range s.grpc.GetServiceInfo() {
+			services = append(services, name)
+		}
+		sort.Strings(services)
+		log.Printf("gRPC listening on %s (%s)\n", s.cfg.Server.GRPC.Addr, strings.Join(services, ", "))
+	}
+	if s.admin != nil {
+		features := "pprof, runtime, admin API"
+		if s.cfg.Admin.Profiling.Enabled {
+			features += ", continuous profiling to " + s.cfg.Admin.Profiling.Dir
+		}
+		log.Printf("Admin listening on http://%s (%s)\n", s.cfg.Admin.Addr, features)
+	}
 }
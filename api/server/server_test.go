@@ -0,0 +1,131 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"k6-practice/api/config"
+)
+
+func TestHTTP3ServesSameHandler(t *testing.T) {
+	tlsConfig, err := newTLSConfig(config.TLSConfig{SelfSigned: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	h3 := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(tlsConfig)}
+	go h3.Serve(conn)
+	defer h3.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(tlsConfig.Certificates[0].Leaf)
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "localhost"}}
+	defer transport.Close()
+
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	resp, err := (&http.Client{Transport: transport}).Get("https://127.0.0.1:" + strconv.Itoa(port) + "/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.ProtoMajor != 3 {
+		t.Errorf("expected HTTP/3, got %s", resp.Proto)
+	}
+	if string(body) != "ok" {
+		t.Errorf("expected body ok, got %q", body)
+	}
+
+	t.Run("TCP responses advertise HTTP/3", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		altSvc(h3, handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		expected := `h3=":` + strconv.Itoa(port) + `"; ma=2592000`
+		if got := rec.Header().Get("Alt-Svc"); got != expected {
+			t.Errorf("expected Alt-Svc %q, got %q", expected, got)
+		}
+	})
+}
+
+func TestRunRequiresTLSForHTTP3(t *testing.T) {
+	cfg := config.Load()
+	cfg.Server.TLS = config.TLSConfig{}
+	cfg.Server.HTTP3 = config.HTTP3Config{Enabled: true, Addr: "127.0.0.1:0"}
+
+	if err := New(cfg).Run(); err == nil {
+		t.Error("expected error when HTTP/3 is enabled without TLS")
+	}
+}
+
+func TestRunRequiresAdminToken(t *testing.T) {
+	cfg := config.Load()
+	cfg.Server.GRPC.Enabled = false
+	cfg.Admin = config.AdminConfig{Enabled: true, Addr: "127.0.0.1:0"}
+
+	if err := New(cfg).Run(); err == nil {
+		t.Error("expected error when the admin listener is enabled without a token")
+	}
+}
+
+func TestRunRejectsInvalidOAuthClients(t *testing.T) {
+	cfg := config.Load()
+	cfg.Server.GRPC.Enabled = false
+	cfg.OAuth.Enabled = true
+	cfg.OAuth.Clients = []string{"spa:"}
+
+	if err := New(cfg).Run(); err == nil {
+		t.Error("expected error for a public OAuth client without a redirect URI")
+	}
+}
+
+func TestNewSecurityMonitor(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name            string
+		cfg             config.SecurityConfig
+		expectErr       bool
+		expectedOutputs string
+	}{
+		{"defaults", config.Load().Security, false, "log"},
+		{"file and syslog", config.SecurityConfig{File: filepath.Join(dir, "security.jsonl"), SyslogAddr: "127.0.0.1:514"}, false, "file " + filepath.Join(dir, "security.jsonl") + ", syslog udp://127.0.0.1:514"},
+		{"webhook alerts only", config.SecurityConfig{WebhookURL: "http://127.0.0.1:1/hook", WebhookAlertsOnly: true}, false, "webhook (alerts only)"},
+		{"no outputs", config.SecurityConfig{}, false, "admin API only"},
+		{"invalid rule", config.SecurityConfig{AlertRules: []string{"AUTH_FAILURE"}}, true, ""},
+		{"unwritable file", config.SecurityConfig{File: filepath.Join(dir, "missing", "security.jsonl")}, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor, err := newSecurityMonitor(tt.cfg, "test")
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error %v, got %v", tt.expectErr, err)
+			}
+			if err != nil {
+				return
+			}
+			defer monitor.Close()
+			if got := strings.Join(securityOutputs(tt.cfg), ", "); got != tt.expectedOutputs {
+				t.Errorf("expected outputs %q, got %q", tt.expectedOutputs, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k6-practice/api/config"
+)
+
+func TestSelfSignedCertificate(t *testing.T) {
+	cert, err := selfSignedCertificate(selfSignedHosts, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+
+	for _, host := range selfSignedHosts {
+		if err := cert.Leaf.VerifyHostname(host); err != nil {
+			t.Errorf("expected certificate to be valid for %s: %v", host, err)
+		}
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	ca, err := selfSignedCertificate([]string{"client-ca"}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0o600); err != nil {
+		t.Fatalf("failed to write CA: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		cfg        config.TLSConfig
+		clientAuth tls.ClientAuthType
+		wantErr    bool
+	}{
+		{"self-signed", config.TLSConfig{SelfSigned: true}, tls.NoClientCert, false},
+		{"request client certificate", config.TLSConfig{SelfSigned: true, ClientCAFile: caFile, ClientAuth: "request"}, tls.VerifyClientCertIfGiven, false},
+		{"require client certificate", config.TLSConfig{SelfSigned: true, ClientCAFile: caFile, ClientAuth: "require"}, tls.RequireAndVerifyClientCert, false},
+		{"unknown client auth mode", config.TLSConfig{SelfSigned: true, ClientCAFile: caFile, ClientAuth: "maybe"}, 0, true},
+		{"missing certificate file", config.TLSConfig{CertFile: "missing.pem", KeyFile: "missing.key"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := newTLSConfig(tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tlsConfig.ClientAuth != tt.clientAuth {
+				t.Errorf("expected client auth %v, got %v", tt.clientAuth, tlsConfig.ClientAuth)
+			}
+		})
+	}
+}
+
+func TestTLSServesHTTP2(t *testing.T) {
+	tlsConfig, err := newTLSConfig(config.TLSConfig{SelfSigned: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	ts.EnableHTTP2 = true
+	ts.TLS = tlsConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(tlsConfig.Certificates[0].Leaf)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool, ServerName: "localhost"},
+		ForceAttemptHTTP2: true,
+	}}
+
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2, got %s", resp.Proto)
+	}
+}
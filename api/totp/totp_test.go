@@ -0,0 +1,102 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret は RFC 6238 付録Bのテスト用の鍵 "12345678901234567890"（SHA1）
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 付録Bの8桁の値の下6桁
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(time.Unix(tt.unix, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+
+	tests := []struct {
+		name         string
+		secret       string
+		code         string
+		skew         int
+		expectedStep int64
+		expectedOK   bool
+	}{
+		{"current step", rfcSecret, "081804", 0, 37037036, true},
+		{"previous step within skew", rfcSecret, mustCode(t, now.Add(-Period)), 1, 37037035, true},
+		{"next step within skew", rfcSecret, mustCode(t, now.Add(Period)), 1, 37037037, true},
+		{"previous step without skew", rfcSecret, mustCode(t, now.Add(-Period)), 0, 0, false},
+		{"two steps ago", rfcSecret, mustCode(t, now.Add(-2*Period)), 1, 0, false},
+		{"lowercase secret with spaces", "gezd gnbv gy3t qojq gezd gnbv gy3t qojq", "081804", 0, 37037036, true},
+		{"wrong length", rfcSecret, "81804", 1, 0, false},
+		{"invalid secret", "not base32!", "081804", 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(tt.secret, tt.code, now, tt.skew)
+			if ok != tt.expectedOK || step != tt.expectedStep {
+				t.Errorf("expected (%d, %v), got (%d, %v)", tt.expectedStep, tt.expectedOK, step, ok)
+			}
+		})
+	}
+}
+
+func mustCode(t *testing.T, at time.Time) string {
+	t.Helper()
+	code, err := Code(rfcSecret, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestNewSecretAndURI(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("expected a 160-bit base32 secret, got %q", secret)
+	}
+	if _, err := Code(secret, time.Now()); err != nil {
+		t.Errorf("expected the generated secret to be usable, got %v", err)
+	}
+
+	u, err := url.Parse(URI("k6 practice", "alice@example.com", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/k6 practice:alice@example.com" {
+		t.Errorf("unexpected URI %s", u)
+	}
+	if q.Get("secret") != secret || q.Get("issuer") != "k6 practice" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("unexpected parameters %v", q)
+	}
+}
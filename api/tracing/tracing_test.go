@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetup_Stdout(t *testing.T) {
+	var buf bytes.Buffer
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterStdout, ServiceName: "test", SampleRatio: 1, Stdout: &buf})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "stdout-span")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), `"Name":"stdout-span"`) {
+		t.Errorf("expected the span to be written on shutdown, got %q", buf.String())
+	}
+}
+
+func TestSetup_OTLP(t *testing.T) {
+	var received atomic.Int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/traces" {
+			received.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterOTLP, Endpoint: collector.URL, ServiceName: "test", SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "otlp-span")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	if received.Load() == 0 {
+		t.Error("expected spans to be exported to /v1/traces")
+	}
+}
+
+func TestSetup_Exporters(t *testing.T) {
+	tests := []struct {
+		name        string
+		exporter    string
+		expectedErr bool
+	}{
+		{"none", ExporterNone, false},
+		{"empty means none", "", false},
+		{"unknown", "jaeger", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), Config{Exporter: tt.exporter})
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error %v, got %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if err := shutdown(context.Background()); err != nil {
+				t.Errorf("shutdown: %v", err)
+			}
+		})
+	}
+}
+
+func TestSetup_Propagator(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{Exporter: ExporterNone}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+
+	out := http.Header{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(out))
+	if out.Get("traceparent") != header.Get("traceparent") {
+		t.Errorf("expected traceparent to round-trip, got %q", out.Get("traceparent"))
+	}
+}
@@ -0,0 +1,188 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen はサーキットブレーカーが開いていて呼び出しを行わなかったことを表す
+var ErrCircuitOpen = errors.New("upstream: circuit breaker is open")
+
+// State はサーキットブレーカーの状態
+type State int
+
+const (
+	// StateClosed は通常どおり呼び出す
+	StateClosed State = iota
+	// StateOpen は呼び出さずにすぐ失敗する
+	StateOpen
+	// StateHalfOpen は少数の試行で回復したかを確認する
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerConfig はサーキットブレーカーの設定
+type BreakerConfig struct {
+	// Threshold: 連続した失敗がこの回数に達したら開く（0は無効）
+	Threshold int
+	// Cooldown: 開いてから半開にするまでの時間
+	Cooldown time.Duration
+	// HalfOpenRequests: 半開で試す呼び出し数（すべて成功したら閉じる）
+	HalfOpenRequests int
+}
+
+// BreakerStatus はサーキットブレーカーの状態（メトリクス・管理用エンドポイントで返す）
+type BreakerStatus struct {
+	State               string     `json:"state" openapi:"required,enum=closed|open|half_open"`
+	ConsecutiveFailures int        `json:"consecutive_failures" openapi:"required"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+// Breaker は連続した失敗で上流への呼び出しを止め、上流の障害が呼び出し側に波及するのを防ぐ
+type Breaker struct {
+	mu         sync.Mutex
+	cfg        BreakerConfig
+	state      State
+	failures   int
+	openedAt   time.Time
+	probes     int // 半開で実行中の試行
+	successes  int // 半開で成功した試行
+	generation uint64
+	now        func() time.Time
+}
+
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	return &Breaker{cfg: cfg, now: time.Now}
+}
+
+// Allow は呼び出してよいか判定する。呼び出した場合は結果を done に渡す
+// done(nil) は成功、context.Canceled は呼び出し側の中断として数えない、それ以外は失敗
+func (b *Breaker) Allow() (done func(error), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.cfg.Threshold <= 0 {
+		return func(error) {}, nil
+	}
+
+	if b.state == StateOpen {
+		if b.now().Sub(b.openedAt) < b.cfg.Cooldown {
+			return nil, ErrCircuitOpen
+		}
+		b.setState(StateHalfOpen)
+	}
+	if b.state == StateHalfOpen {
+		if b.probes+b.successes >= b.cfg.HalfOpenRequests {
+			return nil, ErrCircuitOpen
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	return func(err error) { b.done(generation, err) }, nil
+}
+
+func (b *Breaker) done(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// 呼び出し中に状態が変わっていたら結果を捨てる
+	if generation != b.generation {
+		return
+	}
+
+	halfOpen := b.state == StateHalfOpen
+	if halfOpen {
+		b.probes--
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+	case err != nil:
+		b.failures++
+		if halfOpen || b.failures >= b.cfg.Threshold {
+			b.setState(StateOpen)
+		}
+	case halfOpen:
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenRequests {
+			b.setState(StateClosed)
+		}
+	default:
+		b.failures = 0
+	}
+}
+
+// setState は状態を変え、実行中の呼び出しの結果を無効にする
+func (b *Breaker) setState(state State) {
+	if state == StateOpen {
+		b.openedAt = b.now()
+	}
+	if state != StateOpen {
+		b.failures = 0
+	}
+	b.state = state
+	b.probes = 0
+	b.successes = 0
+	b.generation++
+	stats.Add("state_changes", 1)
+}
+
+// Reset はブレーカーを閉じる
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateClosed {
+		b.setState(StateClosed)
+	}
+	b.failures = 0
+}
+
+// State は現在の状態（開いてからCooldownが過ぎていれば次の呼び出しで半開になる）
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Status は現在の状態と次に試す時刻
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{State: b.state.String(), ConsecutiveFailures: b.failures}
+	if b.state == StateOpen {
+		openedAt := b.openedAt
+		retryAt := openedAt.Add(b.cfg.Cooldown)
+		status.OpenedAt = &openedAt
+		status.RetryAt = &retryAt
+	}
+	return status
+}
+
+// RetryAfter は開いている場合に半開になるまでの残り時間
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateOpen {
+		return 0
+	}
+	return max(0, b.cfg.Cooldown-b.now().Sub(b.openedAt))
+}
@@ -0,0 +1,144 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errUpstream = errors.New("upstream failed")
+
+func TestBreaker(t *testing.T) {
+	// step は1回の呼び出し（advanceだけ時間を進めてから呼ぶ）
+	type step struct {
+		advance  time.Duration
+		result   error
+		expected State // 呼び出し後の状態
+		rejected bool
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"opens after consecutive failures", []step{
+			{0, errUpstream, StateClosed, false},
+			{0, errUpstream, StateClosed, false},
+			{0, errUpstream, StateOpen, false},
+			{0, nil, StateOpen, true},
+		}},
+		{"success resets the count", []step{
+			{0, errUpstream, StateClosed, false},
+			{0, errUpstream, StateClosed, false},
+			{0, nil, StateClosed, false},
+			{0, errUpstream, StateClosed, false},
+			{0, errUpstream, StateClosed, false},
+		}},
+		{"canceled calls are not failures", []step{
+			{0, errUpstream, StateClosed, false},
+			{0, errUpstream, StateClosed, false},
+			{0, context.Canceled, StateClosed, false},
+		}},
+		{"half open closes on success", []step{
+			{0, errUpstream, StateClosed, false},
+			{0, errUpstream, StateClosed, false},
+			{0, errUpstream, StateOpen, false},
+			{time.Second, nil, StateOpen, true},
+			{time.Minute, nil, StateClosed, false},
+		}},
+		{"half open reopens on failure", []step{
+			{0, errUpstream, StateClosed, false},
+			{0, errUpstream, StateClosed, false},
+			{0, errUpstream, StateOpen, false},
+			{time.Minute, errUpstream, StateOpen, false},
+			{time.Second, nil, StateOpen, true},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			b := NewBreaker(BreakerConfig{Threshold: 3, Cooldown: 10 * time.Second})
+			b.now = func() time.Time { return now }
+
+			for i, s := range tt.steps {
+				now = now.Add(s.advance)
+				done, err := b.Allow()
+				if s.rejected {
+					if !errors.Is(err, ErrCircuitOpen) {
+						t.Fatalf("step %d: expected ErrCircuitOpen, got %v", i, err)
+					}
+				} else {
+					if err != nil {
+						t.Fatalf("step %d: unexpected error %v", i, err)
+					}
+					done(s.result)
+				}
+				if got := b.State(); got != s.expected {
+					t.Fatalf("step %d: expected state %s, got %s", i, s.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestBreaker_HalfOpenLimitsProbes(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBreaker(BreakerConfig{Threshold: 1, Cooldown: time.Second, HalfOpenRequests: 1})
+	b.now = func() time.Time { return now }
+
+	done, _ := b.Allow()
+	done(errUpstream)
+	now = now.Add(time.Second)
+
+	probe, err := b.Allow()
+	if err != nil {
+		t.Fatalf("expected a probe in half open, got %v", err)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected other calls to be rejected while probing, got %v", err)
+	}
+	probe(nil)
+	if b.State() != StateClosed {
+		t.Errorf("expected breaker to close, got %s", b.State())
+	}
+}
+
+func TestBreaker_Status(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBreaker(BreakerConfig{Threshold: 1, Cooldown: 5 * time.Second})
+	b.now = func() time.Time { return now }
+
+	if s := b.Status(); s.State != "closed" || s.OpenedAt != nil {
+		t.Errorf("unexpected closed status: %+v", s)
+	}
+
+	done, _ := b.Allow()
+	done(errUpstream)
+	now = now.Add(2 * time.Second)
+
+	s := b.Status()
+	if s.State != "open" || s.RetryAt == nil || !s.RetryAt.Equal(now.Add(3*time.Second)) {
+		t.Errorf("unexpected open status: %+v", s)
+	}
+	if got := b.RetryAfter(); got != 3*time.Second {
+		t.Errorf("expected 3s until retry, got %s", got)
+	}
+
+	b.Reset()
+	if b.State() != StateClosed {
+		t.Errorf("expected reset to close the breaker, got %s", b.State())
+	}
+}
+
+func TestBreaker_Disabled(t *testing.T) {
+	b := NewBreaker(BreakerConfig{})
+	for i := 0; i < 10; i++ {
+		done, err := b.Allow()
+		if err != nil {
+			t.Fatalf("expected disabled breaker to allow calls, got %v", err)
+		}
+		done(errUpstream)
+	}
+}
@@ -0,0 +1,208 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"k6-practice/api/metrics"
+)
+
+// ErrBulkheadFull は同時呼び出し数の上限に達していて呼び出しを行わなかったことを表す
+var ErrBulkheadFull = errors.New("upstream: too many concurrent calls")
+
+// 読み込むレスポンスボディの上限
+const maxResponseBytes = 1 << 20
+
+// StatusError は上流が2xx以外を返したことを表す
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("upstream: unexpected status %d", e.StatusCode)
+}
+
+// Config は上流クライアントの設定
+type Config struct {
+	// BaseURL: 上流のURL（例: http://localhost:8080）
+	BaseURL string
+	// Timeout: 1回の呼び出しの上限（0は無制限）
+	Timeout time.Duration
+	// Retries: 失敗したときの再試行回数
+	Retries int
+	// BackoffBase, BackoffMax: 再試行までの待ち時間（BackoffBase×2^n を上限に0からランダム）
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// MaxConcurrent: 同時に呼び出す数の上限（0は無制限）
+	MaxConcurrent int
+	// Breaker: サーキットブレーカー
+	Breaker BreakerConfig
+}
+
+var tracer = otel.Tracer("k6-practice/api/upstream")
+
+// 上流呼び出しの統計
+var stats = new(expvar.Map).Init()
+
+func init() {
+	metrics.Set("upstream", stats)
+}
+
+// Client は障害対策のポリシーを付けて上流を呼び出す
+// バルクヘッド → リトライ（ジッター付きバックオフ）→ サーキットブレーカー → タイムアウト の順に適用する
+// 上流には自身の /delay や /error-rate を指定でき、カスケード障害をk6で再現できる
+type Client struct {
+	cfg     Config
+	http    *http.Client
+	breaker *Breaker
+	slots   chan struct{}
+}
+
+func NewClient(cfg Config) *Client {
+	c := &Client{
+		cfg:     cfg,
+		http:    &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()},
+		breaker: NewBreaker(cfg.Breaker),
+	}
+	if cfg.MaxConcurrent > 0 {
+		c.slots = make(chan struct{}, cfg.MaxConcurrent)
+	}
+	stats.Set("breaker", expvar.Func(func() interface{} { return c.breaker.Status() }))
+	return c
+}
+
+// Breaker はクライアントのサーキットブレーカー
+func (c *Client) Breaker() *Breaker {
+	return c.breaker
+}
+
+// Get は BaseURL+path を取得してボディを返す
+func (c *Client) Get(ctx context.Context, path string) ([]byte, error) {
+	stats.Add("calls", 1)
+
+	// バルクヘッド: 上流が遅いときに呼び出しでgoroutineを使い切らない
+	if c.slots != nil {
+		select {
+		case c.slots <- struct{}{}:
+			defer func() { <-c.slots }()
+		default:
+			stats.Add("rejected_bulkhead", 1)
+			return nil, ErrBulkheadFull
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		body, err := c.attempt(ctx, path)
+		if err == nil {
+			stats.Add("successes", 1)
+			return body, nil
+		}
+		if attempt >= c.cfg.Retries || !retryable(err) || ctx.Err() != nil {
+			stats.Add("failures", 1)
+			return nil, err
+		}
+
+		stats.Add("retries", 1)
+		timer := time.NewTimer(c.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			stats.Add("failures", 1)
+			return nil, err
+		}
+	}
+}
+
+// attempt はサーキットブレーカーとタイムアウトを適用して1回呼び出す
+func (c *Client) attempt(ctx context.Context, path string) ([]byte, error) {
+	done, err := c.breaker.Allow()
+	if err != nil {
+		stats.Add("rejected_open", 1)
+		return nil, err
+	}
+
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+
+	ctx, span := tracer.Start(ctx, "upstream GET", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("url.path", path)))
+	defer span.End()
+
+	body, err := c.fetch(ctx, path)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode < http.StatusInternalServerError {
+		// 4xxは上流の障害ではない
+		done(nil)
+	} else {
+		done(err)
+	}
+	return body, err
+}
+
+func (c *Client) fetch(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.cfg.BaseURL, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	// 上流（自身の /delay など）のスパンを同じトレースにつなげる
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+	return body, nil
+}
+
+// backoff は full jitter の待ち時間（再試行が同時に集中しないようにする）
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.cfg.BackoffMax
+	if attempt < 30 && c.cfg.BackoffBase<<attempt < d {
+		d = c.cfg.BackoffBase << attempt
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
+
+// retryable は再試行で回復しうる失敗か判定する（ブレーカーが開いている・4xxは再試行しない）
+func retryable(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newUpstream は statuses の順にステータスを返すテスト用の上流（使い切ったら最後を返し続ける）
+func newUpstream(t *testing.T, delay time.Duration, statuses ...int) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.WriteHeader(statuses[min(n, len(statuses))-1])
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestClient_Get(t *testing.T) {
+	tests := []struct {
+		name          string
+		statuses      []int
+		delay         time.Duration
+		cfg           Config
+		expectedErr   func(error) bool
+		expectedCalls int32
+	}{
+		{"success", []int{200}, 0, Config{Retries: 2}, nil, 1},
+		{"retries server errors", []int{500, 503, 200}, 0, Config{Retries: 2}, nil, 3},
+		{"gives up after retries", []int{500}, 0, Config{Retries: 2}, isStatus(500), 3},
+		{"client errors are not retried", []int{404}, 0, Config{Retries: 2}, isStatus(404), 1},
+		{"timeout per attempt", []int{200}, time.Second, Config{Timeout: 10 * time.Millisecond, Retries: 1}, func(err error) bool {
+			return errors.Is(err, context.DeadlineExceeded)
+		}, 2},
+		{"open breaker stops retries", []int{500}, 0, Config{Retries: 5, Breaker: BreakerConfig{Threshold: 2, Cooldown: time.Minute}}, func(err error) bool {
+			return errors.Is(err, ErrCircuitOpen)
+		}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := newUpstream(t, tt.delay, tt.statuses...)
+			tt.cfg.BaseURL = srv.URL
+			tt.cfg.BackoffBase = time.Millisecond
+			tt.cfg.BackoffMax = 5 * time.Millisecond
+			c := NewClient(tt.cfg)
+
+			body, err := c.Get(context.Background(), "/v2/delay/0")
+
+			if tt.expectedErr == nil {
+				if err != nil || string(body) != "ok" {
+					t.Errorf("expected body ok, got %q, %v", body, err)
+				}
+			} else if !tt.expectedErr(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if got := atomic.LoadInt32(calls); got != tt.expectedCalls {
+				t.Errorf("expected %d upstream calls, got %d", tt.expectedCalls, got)
+			}
+		})
+	}
+}
+
+func TestClient_Bulkhead(t *testing.T) {
+	srv, _ := newUpstream(t, 200*time.Millisecond, 200)
+	c := NewClient(Config{BaseURL: srv.URL, MaxConcurrent: 1})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Get(context.Background(), "/")
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := c.Get(context.Background(), "/"); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("expected ErrBulkheadFull, got %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected first call to succeed, got %v", err)
+	}
+	if _, err := c.Get(context.Background(), "/"); err != nil {
+		t.Errorf("expected slot to be released, got %v", err)
+	}
+}
+
+func TestClient_Backoff(t *testing.T) {
+	c := NewClient(Config{BackoffBase: 10 * time.Millisecond, BackoffMax: 50 * time.Millisecond})
+
+	for attempt, limit := range []time.Duration{10, 20, 40, 50, 50, 50} {
+		for i := 0; i < 100; i++ {
+			if d := c.backoff(attempt); d < 0 || d >= limit*time.Millisecond {
+				t.Fatalf("attempt %d: backoff %s out of [0, %s)", attempt, d, limit*time.Millisecond)
+			}
+		}
+	}
+	if d := c.backoff(100); d >= 50*time.Millisecond {
+		t.Errorf("expected large attempts to be capped, got %s", d)
+	}
+}
+
+func isStatus(code int) func(error) bool {
+	return func(err error) bool {
+		var statusErr *StatusError
+		return errors.As(err, &statusErr) && statusErr.StatusCode == code
+	}
+}
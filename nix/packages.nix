@@ -5,7 +5,7 @@
     pname = "k6-practice-api";
     version = "1.0.0";
     src = ../api;
-    vendorHash = "sha256-deZ8L5aju1JraGTnjIW3vR1zm5Jc15F6D+goi1pVLpU=";
+    vendorHash = "sha256-cGi2lk/1b03ZOoCrJ+hlmV5WgFZpl76XuatVV+Y8E4k=";
 
     meta = with pkgs.lib; {
       description = "k6 practice API server";
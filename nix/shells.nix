@@ -4,6 +4,9 @@
   api = pkgs.mkShell {
     buildInputs = with pkgs; [
       go
+      buf
+      protoc-gen-go
+      protoc-gen-go-grpc
     ];
 
     shellHook = ''
@@ -13,8 +16,9 @@
       echo "Commands:"
       echo "  cd api && go run .             - Start API server"
       echo "  cd api && go build -o api .    - Build API binary"
+      echo "  cd api && buf generate         - Regenerate gRPC code from proto/"
       echo ""
-      echo "API will listen on http://localhost:8080"
+      echo "API will listen on http://localhost:8080 (gRPC: localhost:9090 with GRPC_ENABLED=true)"
     '';
   };
 
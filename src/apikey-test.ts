@@ -0,0 +1,88 @@
+import http from 'k6/http';
+import { check } from 'k6';
+import { Options } from 'k6/options';
+
+// APIキー認証テスト: JWTでキーを作成し、キーだけで読み取りAPIを呼ぶ（CIやバッチからの呼び出し）
+//   キーごとのレート制限（APIKEY_RATE_LIMIT）を超えると429になることも確認する
+// 有効なキーのリクエストはIPごとの RATE_LIMIT ではなくキーごとの上限で制限される（キーを作るログインだけがIPごとに数えられる）
+// 1つのキーから大量に送るため、APIKEY_RATE_LIMIT=100000 などで起動する
+export const options: Options = {
+  scenarios: {
+    apiKey: {
+      executor: 'constant-arrival-rate',
+      rate: 50,
+      timeUnit: '1s',
+      duration: '1m',
+      preAllocatedVUs: 20,
+    },
+  },
+  thresholds: {
+    'http_req_duration{name:me}': ['p(95)<200'],
+    checks: ['rate>0.99'],
+  },
+};
+
+const BASE_URL = __ENV.API_URL || 'http://localhost:8080';
+const JSON_HEADERS = { 'Content-Type': 'application/json' };
+
+interface SetupData {
+  key: string;
+  limitedKey: string;
+  id: string;
+  token: string;
+}
+
+export function setup(): SetupData {
+  const login = http.post(
+    `${BASE_URL}/v2/auth/login`,
+    JSON.stringify({ email: 'alice@example.com', password: 'password' }),
+    { headers: JSON_HEADERS },
+  );
+  const token = login.json('access_token') as string;
+  const auth = { ...JSON_HEADERS, Authorization: `Bearer ${token}` };
+
+  const created = http.post(`${BASE_URL}/v2/auth/api-keys`, JSON.stringify({ name: 'k6 load test' }), { headers: auth });
+  const limited = http.post(`${BASE_URL}/v2/auth/api-keys`, JSON.stringify({ name: 'k6 limited', rate_limit: 1 }), {
+    headers: auth,
+  });
+  check(created, { 'setup: key is created': (r) => r.status === 201 });
+  check(limited, { 'setup: limited key is created': (r) => r.status === 201 });
+
+  return {
+    key: created.json('key') as string,
+    limitedKey: limited.json('key') as string,
+    id: created.json('id') as string,
+    token,
+  };
+}
+
+export default function (data: SetupData): void {
+  const me = http.get(`${BASE_URL}/v2/auth/me`, { headers: { 'X-API-Key': data.key }, tags: { name: 'me' } });
+  check(me, {
+    'me: status is 200': (r) => r.status === 200,
+    'me: user is the key owner': (r) => r.json('email') === 'alice@example.com',
+  });
+
+  // 読み取り専用のキーでは書き込みの操作はできない
+  const enroll = http.post(`${BASE_URL}/v2/auth/mfa/enroll`, null, {
+    headers: { Authorization: `ApiKey ${data.key}` },
+    tags: { name: 'enroll' },
+    responseCallback: http.expectedStatuses(403),
+  });
+  check(enroll, { 'enroll: read-only key is forbidden': (r) => r.status === 403 });
+
+  // 1回/分のキーは2回目以降が制限される
+  const limited = http.get(`${BASE_URL}/v2/auth/me`, {
+    headers: { 'X-API-Key': data.limitedKey },
+    tags: { name: 'limited' },
+    responseCallback: http.expectedStatuses(200, 429),
+  });
+  check(limited, { 'limited: 429 has Retry-After': (r) => r.status !== 429 || r.headers['Retry-After'] !== undefined });
+}
+
+export function teardown(data: SetupData): void {
+  const revoke = http.del(`${BASE_URL}/v2/auth/api-keys/${data.id}`, null, {
+    headers: { Authorization: `Bearer ${data.token}` },
+  });
+  check(revoke, { 'teardown: key is revoked': (r) => r.status === 204 });
+}
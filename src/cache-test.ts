@@ -0,0 +1,86 @@
+import http from 'k6/http';
+import { check, sleep } from 'k6';
+import { Counter } from 'k6/metrics';
+import { Options } from 'k6/options';
+
+// キャッシュテスト: 読み取りの多い負荷で、条件付きGET（304）とサーバー側のレスポンスキャッシュの効果を比較
+// plain は毎回全件を取得し、conditional は前回のETagで再検証する（scenarioタグで比較）
+// writer が時々ユーザーを更新し、キャッシュと検証子が無効化されることも確認する
+// レスポンスキャッシュの有無は RESPONSE_CACHE_ENABLED=true / false で起動し直して比較する
+// 同じIPから大量に送るため、サーバーは RATE_LIMIT=100000 などで起動する
+export const options: Options = {
+  scenarios: {
+    plain: {
+      executor: 'constant-vus',
+      vus: 20,
+      duration: '2m',
+      exec: 'plain',
+    },
+    conditional: {
+      executor: 'constant-vus',
+      vus: 20,
+      duration: '2m',
+      exec: 'conditional',
+    },
+    writer: {
+      executor: 'constant-arrival-rate',
+      rate: 1,
+      timeUnit: '1s',
+      duration: '2m',
+      preAllocatedVUs: 2,
+      exec: 'writer',
+    },
+  },
+  thresholds: {
+    'http_req_duration{scenario:plain}': ['p(95)<500'],
+    'http_req_duration{scenario:conditional}': ['p(95)<500'],
+    checks: ['rate>0.99'],
+  },
+};
+
+const BASE_URL = __ENV.API_URL || 'http://localhost:8080';
+
+const notModified = new Counter('cache_not_modified');
+const cacheHits = new Counter('cache_hits');
+
+function record(res: http.RefinedResponse<http.ResponseType | undefined>): void {
+  if (res.status === 304) {
+    notModified.add(1);
+  }
+  if (res.headers['X-Cache'] === 'HIT') {
+    cacheHits.add(1);
+  }
+}
+
+export function plain(): void {
+  const res = http.get(`${BASE_URL}/v2/users`, { tags: { name: 'listUsers' } });
+  record(res);
+  check(res, { 'plain: status is 200': (r) => r.status === 200 });
+  sleep(0.1);
+}
+
+// VUごとに前回のETagを覚えておく（ブラウザのキャッシュと同じ動き）
+let etag = '';
+
+export function conditional(): void {
+  const headers: Record<string, string> = {};
+  if (etag) {
+    headers['If-None-Match'] = etag;
+  }
+  const res = http.get(`${BASE_URL}/v2/users`, { headers, tags: { name: 'listUsers' } });
+  record(res);
+  check(res, { 'conditional: status is 200 or 304': (r) => r.status === 200 || r.status === 304 });
+  if (res.status === 200) {
+    etag = res.headers['Etag'] || '';
+  }
+  sleep(0.1);
+}
+
+export function writer(): void {
+  const res = http.put(
+    `${BASE_URL}/v2/users/1`,
+    JSON.stringify({ first_name: 'Alice', last_name: `Update${__ITER}`, email: 'alice@example.com' }),
+    { headers: { 'Content-Type': 'application/json' }, tags: { name: 'updateUser' } },
+  );
+  check(res, { 'writer: status is 200': (r) => r.status === 200 });
+}
@@ -0,0 +1,49 @@
+import http from 'k6/http';
+import { check, sleep } from 'k6';
+import { Options } from 'k6/options';
+
+// 圧縮比較テスト: 圧縮方式ごとのレイテンシと転送量（data_received）を比較
+// サーバー側のCPU時間・圧縮前後のバイト数は /metrics の compression で確認する
+const ENCODINGS = ['identity', 'gzip', 'deflate', 'br', 'zstd'];
+
+export const options: Options = {
+  scenarios: Object.fromEntries(
+    ENCODINGS.map((encoding, i) => [
+      encoding,
+      {
+        executor: 'constant-vus',
+        vus: 10,
+        duration: '1m',
+        startTime: `${i * 70}s`, // 方式ごとに順番に実行して干渉を避ける
+        env: { ENCODING: encoding },
+        tags: { encoding },
+      },
+    ]),
+  ),
+  thresholds: Object.fromEntries(
+    ENCODINGS.map((encoding) => [`http_req_duration{encoding:${encoding}}`, ['p(95)<500']]),
+  ),
+};
+
+const BASE_URL = __ENV.API_URL || 'http://localhost:8080';
+
+export default function (): void {
+  const encoding = __ENV.ENCODING;
+  const params = { headers: { 'Accept-Encoding': encoding } };
+
+  // 大きめのレスポンス（OpenAPIドキュメント）
+  const docRes = http.get(`${BASE_URL}/openapi.json`, params);
+  check(docRes, {
+    'openapi: status is 200': (r) => r.status === 200,
+    'openapi: negotiated encoding': (r) =>
+      encoding === 'identity' ? !r.headers['Content-Encoding'] : r.headers['Content-Encoding'] === encoding,
+  });
+
+  // 通常のAPIレスポンス
+  const usersRes = http.get(`${BASE_URL}/v2/users`, params);
+  check(usersRes, {
+    'users: status is 200': (r) => r.status === 200,
+  });
+
+  sleep(0.5);
+}
@@ -0,0 +1,99 @@
+import http from 'k6/http';
+import { check, sleep } from 'k6';
+import { Trend } from 'k6/metrics';
+import { Options } from 'k6/options';
+
+// GraphQLテスト: フロントエンドと同じ形のクエリ（一覧のページング・詳細・作成・me）で負荷をかける
+// 操作名ごとにタグを付け、/metrics の graphql（操作名ごとの件数・エラー・拒否数）と突き合わせる
+// GraphQLはエラーでもHTTP 200を返すため、errorsの有無もcheckする
+// 全リクエストが /graphql の1ルートに集まるため、サーバーは RATE_LIMIT=100000 などで起動する
+export const options: Options = {
+  stages: [
+    { duration: '30s', target: 20 },
+    { duration: '2m', target: 20 },
+    { duration: '30s', target: 0 },
+  ],
+  thresholds: {
+    http_req_duration: ['p(95)<500'],
+    graphql_errors: ['avg<0.01'],
+    checks: ['rate>0.99'],
+  },
+};
+
+const BASE_URL = __ENV.API_URL || 'http://localhost:8080';
+const PAGE_SIZE = Number(__ENV.GRAPHQL_PAGE_SIZE || '20');
+const MAX_PAGES = 3; // 作成したユーザーで一覧が伸び続けるため、1イテレーションで辿るページ数を制限する
+
+// レスポンス内のerrorsの件数（操作名ごと）
+const graphqlErrors = new Trend('graphql_errors');
+
+const USERS_PAGE = `query UsersPage($first: Int, $after: String) {
+  users(first: $first, after: $after) {
+    nodes { id name email }
+    pageInfo { endCursor hasNextPage }
+    totalCount
+  }
+}`;
+
+const USER_DETAIL = `query UserDetail($id: ID!) {
+  user(id: $id) { id name email createdAt updatedAt }
+}`;
+
+const CREATE_USER = `mutation CreateUser($input: UserInput!) {
+  createUser(input: $input) { id }
+}`;
+
+const ME = `query Me { me { userId email } }`;
+
+interface GraphQLResponse {
+  data?: Record<string, any>;
+  errors?: { message: string }[];
+}
+
+function gql(operationName: string, query: string, variables: object = {}, token?: string): GraphQLResponse {
+  const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+  if (token) {
+    headers.Authorization = `Bearer ${token}`;
+  }
+  const res = http.post(`${BASE_URL}/graphql`, JSON.stringify({ query, operationName, variables }), {
+    headers,
+    tags: { operation: operationName },
+  });
+
+  const body = (res.json() || {}) as GraphQLResponse;
+  const errors = body.errors ? body.errors.length : 0;
+  graphqlErrors.add(errors, { operation: operationName });
+  check(res, {
+    [`${operationName}: status is 200`]: (r) => r.status === 200,
+    [`${operationName}: no errors`]: () => errors === 0,
+  });
+  return body;
+}
+
+export function setup(): { token: string } {
+  const res = http.post(
+    `${BASE_URL}/v2/auth/login`,
+    JSON.stringify({ email: 'alice@example.com', password: 'password' }),
+    { headers: { 'Content-Type': 'application/json' } },
+  );
+  return { token: (res.json() as { access_token: string }).access_token };
+}
+
+export default function (data: { token: string }): void {
+  // 一覧をendCursorで辿る
+  let after: string | null = null;
+  for (let i = 0; i < MAX_PAGES; i++) {
+    const page = gql('UsersPage', USERS_PAGE, { first: PAGE_SIZE, after });
+    const users = page.data ? page.data.users : null;
+    if (!users || !users.pageInfo.hasNextPage) {
+      break;
+    }
+    after = users.pageInfo.endCursor;
+  }
+
+  gql('UserDetail', USER_DETAIL, { id: '1' });
+  gql('CreateUser', CREATE_USER, { input: { name: `User${__VU}`, email: `user${__VU}@example.com` } });
+  gql('Me', ME, {}, data.token);
+
+  sleep(1);
+}
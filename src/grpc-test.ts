@@ -0,0 +1,74 @@
+import http from 'k6/http';
+import grpc from 'k6/net/grpc';
+import { check, sleep } from 'k6';
+import { Options } from 'k6/options';
+
+// REST・gRPC比較テスト: 同じUserStore・同じ処理をRESTとgRPCで同じ負荷をかけて比較
+// 同じ操作（取得・一覧・作成）を2つのシナリオで並行して実行し、
+// http_req_duration{scenario:rest} と grpc_req_duration{scenario:grpc} を比べる
+// gRPCにはレート制限がないため、サーバーは GRPC_ENABLED=true RATE_LIMIT=100000 などで起動して条件を揃える
+// 例: API_URL=http://localhost:8080 GRPC_ADDR=localhost:9090 k6 run dist/grpc-test.js
+const workload = {
+  executor: 'constant-vus' as const,
+  vus: 20,
+  duration: '1m',
+};
+
+export const options: Options = {
+  scenarios: {
+    rest: { ...workload, exec: 'rest' },
+    grpc: { ...workload, exec: 'grpcCalls' },
+  },
+  thresholds: {
+    'http_req_duration{scenario:rest}': ['p(95)<500'],
+    'grpc_req_duration{scenario:grpc}': ['p(95)<500'],
+    checks: ['rate>0.99'],
+  },
+};
+
+const BASE_URL = __ENV.API_URL || 'http://localhost:8080';
+const GRPC_ADDR = __ENV.GRPC_ADDR || 'localhost:9090';
+const GRPC_TLS = __ENV.GRPC_TLS === 'true'; // TLS_SELF_SIGNED=true のサーバーに対して実行する場合
+
+// protoはdist/からの相対パス（サーバーのリフレクションは使わない）
+const client = new grpc.Client();
+client.load(['../api/proto'], 'user/v1/user.proto');
+
+// RESTはgRPCのUserと同じ表現のv1を使う
+export function rest(): void {
+  const params = { headers: { 'Content-Type': 'application/json' } };
+
+  const get = http.get(`${BASE_URL}/v1/users/1`);
+  const list = http.get(`${BASE_URL}/v1/users`);
+  const create = http.post(
+    `${BASE_URL}/v1/users`,
+    JSON.stringify({ name: `User${__VU}`, email: `user${__VU}@example.com` }),
+    params,
+  );
+
+  check(get, { 'rest: get is 200': (r) => r.status === 200 });
+  check(list, { 'rest: list is 200': (r) => r.status === 200 });
+  check(create, { 'rest: create is 201': (r) => r.status === 201 });
+
+  sleep(0.5);
+}
+
+export function grpcCalls(): void {
+  // 接続はVUごとに1回（HTTP/2の1接続上で多重化される）
+  if (__ITER === 0) {
+    client.connect(GRPC_ADDR, { plaintext: !GRPC_TLS });
+  }
+
+  const get = client.invoke('user.v1.UserService/GetUser', { id: 1 });
+  const list = client.invoke('user.v1.UserService/ListUsers', {});
+  const create = client.invoke('user.v1.UserService/CreateUser', {
+    name: `User${__VU}`,
+    email: `user${__VU}@example.com`,
+  });
+
+  check(get, { 'grpc: get is OK': (r) => r && r.status === grpc.StatusOK });
+  check(list, { 'grpc: list is OK': (r) => r && r.status === grpc.StatusOK });
+  check(create, { 'grpc: create is OK': (r) => r && r.status === grpc.StatusOK });
+
+  sleep(0.5);
+}
@@ -0,0 +1,91 @@
+import http from 'k6/http';
+import { check, sleep } from 'k6';
+import { Counter } from 'k6/metrics';
+import { Options } from 'k6/options';
+
+// 冪等キーテスト: 同じ Idempotency-Key でリトライが殺到してもユーザーが1件しか作られないことを確認
+// 各イテレーションで同じキーのPOSTを同時に送り（リトライストーム）、その後に順次リトライする
+// 処理中の重複は409（Retry-Afterの後にリトライ）、完了後のリトライは最初のレスポンスの再送になる
+// 同じIPから大量に送るため、サーバーは RATE_LIMIT=100000 などで起動する
+export const options: Options = {
+  stages: [
+    { duration: '30s', target: 20 },
+    { duration: '2m', target: 20 },
+    { duration: '30s', target: 0 },
+  ],
+  thresholds: {
+    idempotency_duplicates: ['count==0'], // 別のユーザーが作られたら失敗
+    checks: ['rate>0.99'],
+  },
+};
+
+const BASE_URL = __ENV.API_URL || 'http://localhost:8080';
+const STORM_SIZE = Number(__ENV.STORM_SIZE || '5'); // 同時に送るリトライ数
+const MAX_RETRIES = 5;
+
+const duplicates = new Counter('idempotency_duplicates');
+const inFlight = new Counter('idempotency_in_flight');
+const replayed = new Counter('idempotency_replayed');
+
+function createUser(key: string, body: string) {
+  return {
+    method: 'POST',
+    url: `${BASE_URL}/v1/users`,
+    body,
+    params: {
+      headers: { 'Content-Type': 'application/json', 'Idempotency-Key': key },
+      tags: { name: 'createUser' },
+    },
+  };
+}
+
+export default function (): void {
+  const key = `vu${__VU}-iter${__ITER}-${Date.now()}`;
+  const body = JSON.stringify({ name: `User${__VU}`, email: `user${__VU}.${__ITER}@example.com` });
+
+  // リトライストーム: 同じキーを同時に送る
+  const responses = http.batch(Array.from({ length: STORM_SIZE }, () => createUser(key, body)));
+
+  let id: number | null = null;
+  for (const res of responses) {
+    check(res, { 'storm: status is 201 or 409': (r) => r.status === 201 || r.status === 409 });
+    if (res.status === 409) {
+      inFlight.add(1);
+    }
+  }
+
+  // 409だったリクエストは完了後にリトライし、最初のレスポンスを受け取る
+  for (let i = 0; i < MAX_RETRIES; i++) {
+    const res = http.post(`${BASE_URL}/v1/users`, body, createUser(key, body).params);
+    if (res.status === 409) {
+      sleep(Number(res.headers['Retry-After'] || '1'));
+      continue;
+    }
+    check(res, {
+      'retry: status is 201': (r) => r.status === 201,
+      'retry: is replayed': (r) => r.headers['Idempotent-Replayed'] === 'true',
+    });
+    if (res.headers['Idempotent-Replayed'] === 'true') {
+      replayed.add(1);
+    }
+    id = (res.json() as { id: number }).id;
+    break;
+  }
+
+  // 同時に送ったうち201のものはすべて同じユーザー
+  for (const res of responses) {
+    if (res.status === 201 && (res.json() as { id: number }).id !== id) {
+      duplicates.add(1);
+    }
+  }
+
+  // 同じキーで別のボディは422
+  const conflict = http.post(
+    `${BASE_URL}/v1/users`,
+    JSON.stringify({ name: 'Other', email: 'other@example.com' }),
+    createUser(key, body).params,
+  );
+  check(conflict, { 'conflict: status is 422': (r) => r.status === 422 });
+
+  sleep(1);
+}
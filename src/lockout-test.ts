@@ -0,0 +1,130 @@
+import http from 'k6/http';
+import { check, sleep } from 'k6';
+import { Counter, Rate, Trend } from 'k6/metrics';
+import { Options } from 'k6/options';
+
+// ログインの総当たり対策テスト: 総当たり・クレデンシャルスタッフィングがロックされ、正規のユーザーは影響を受けないことを確認
+// X-Forwarded-For でクライアントのIPを切り替えて、複数のIPからの攻撃を再現する
+// X-Forwarded-For は信頼するプロキシからの場合だけ使うため、k6 のアドレスを LOCKOUT_TRUSTED_PROXIES に指定する
+// サーバーは管理用APIを有効にして起動する（例）
+//   RATE_LIMIT=100000 ADMIN_ENABLED=true ADMIN_TOKEN=secret LOCKOUT_DURATION=30s LOCKOUT_TRUSTED_PROXIES=127.0.0.1,::1
+// k6 は ADMIN_TOKEN=secret を渡すと、開始時にロックを解除し、終了時にロックとセキュリティイベントを表示する
+// 失敗回数・ロック数は /metrics の login_guard で確認する
+export const options: Options = {
+  scenarios: {
+    // 1つのIPから1つのアカウントのパスワードを試す（アカウントのロック）
+    brute_force: {
+      executor: 'per-vu-iterations',
+      vus: 1,
+      iterations: 20,
+      exec: 'bruteForce',
+    },
+    // 1つのIPから多数のアカウントを試す（IPのロック）
+    credential_stuffing: {
+      executor: 'per-vu-iterations',
+      vus: 1,
+      iterations: 40,
+      exec: 'credentialStuffing',
+    },
+    // 多数のIPから1つのアカウントを試す（IPを変えてもアカウントのロック）
+    distributed: {
+      executor: 'per-vu-iterations',
+      vus: 5,
+      iterations: 4,
+      exec: 'distributed',
+    },
+    // 正規のユーザーは攻撃の間もログインできる
+    legitimate: {
+      executor: 'constant-arrival-rate',
+      rate: 2,
+      timeUnit: '1s',
+      duration: '30s',
+      preAllocatedVUs: 2,
+      exec: 'legitimate',
+    },
+  },
+  thresholds: {
+    login_locked: ['count>0'],
+    legitimate_login_success: ['rate>0.99'],
+    checks: ['rate>0.99'],
+  },
+};
+
+const BASE_URL = __ENV.API_URL || 'http://localhost:8080';
+const ADMIN_URL = __ENV.ADMIN_URL || 'http://127.0.0.1:6060';
+const ADMIN_TOKEN = __ENV.ADMIN_TOKEN || '';
+
+const locked = new Counter('login_locked');
+const failedDuration = new Trend('failed_login_duration', true);
+const legitimateSuccess = new Rate('legitimate_login_success');
+
+function login(email: string, password: string, ip: string, name: string) {
+  return http.post(
+    `${BASE_URL}/v2/auth/login`,
+    JSON.stringify({ email, password }),
+    {
+      headers: { 'Content-Type': 'application/json', 'X-Forwarded-For': ip },
+      tags: { name },
+    },
+  );
+}
+
+// attack は失敗したログインを記録し、401（失敗）か429（ロック中）であることを確認する
+function attack(email: string, ip: string, name: string): void {
+  const res = login(email, 'wrong-password', ip, name);
+  if (res.status === 401) {
+    // 失敗を重ねるほど応答が遅くなる
+    failedDuration.add(res.timings.duration);
+  }
+  if (res.status === 429) {
+    locked.add(1, { scenario: name });
+  }
+  check(res, {
+    [`${name}: status is 401 or 429`]: (r) => r.status === 401 || r.status === 429,
+    [`${name}: locked response has Retry-After`]: (r) => r.status !== 429 || r.headers['Retry-After'] !== undefined,
+  });
+}
+
+export function setup(): void {
+  if (!ADMIN_TOKEN) {
+    return;
+  }
+  // 前回の実行で残ったロックを解除する
+  const params = { headers: { Authorization: `Bearer ${ADMIN_TOKEN}` } };
+  const res = http.get(`${ADMIN_URL}/admin/lockouts`, params);
+  for (const s of (res.json() as Array<{ scope: string; key: string }>) || []) {
+    http.del(`${ADMIN_URL}/admin/lockouts/${s.scope}/${encodeURIComponent(s.key)}`, null, params);
+  }
+}
+
+export function bruteForce(): void {
+  attack('alice@example.com', '203.0.113.10', 'bruteForce');
+}
+
+export function credentialStuffing(): void {
+  attack(`user${__ITER}@example.com`, '203.0.113.20', 'credentialStuffing');
+}
+
+export function distributed(): void {
+  attack('bob@example.com', `198.51.100.${__VU * 10 + __ITER}`, 'distributed');
+}
+
+export function legitimate(): void {
+  const res = login('charlie@example.com', 'password', `192.0.2.${(__ITER % 200) + 1}`, 'legitimate');
+  legitimateSuccess.add(res.status === 200);
+  check(res, { 'legitimate: status is 200': (r) => r.status === 200 });
+  sleep(0.1);
+}
+
+export function teardown(): void {
+  if (!ADMIN_TOKEN) {
+    return;
+  }
+  const params = { headers: { Authorization: `Bearer ${ADMIN_TOKEN}` } };
+  const lockouts = http.get(`${ADMIN_URL}/admin/lockouts`, params);
+  console.log(`lockouts: ${lockouts.body}`);
+  const events = http.get(`${ADMIN_URL}/admin/security-events?type=ACCOUNT_LOCKED`, params);
+  check(events, {
+    'security events: lockouts were recorded': (r) => r.status === 200 && (r.json('events') as unknown[]).length > 0,
+  });
+}
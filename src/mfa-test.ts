@@ -0,0 +1,183 @@
+import http from 'k6/http';
+import crypto from 'k6/crypto';
+import { check, sleep } from 'k6';
+import { Counter, Trend } from 'k6/metrics';
+import { Options } from 'k6/options';
+
+// 多要素認証テスト: 本番と同じ2段階のログイン（パスワード → TOTP）をモデル化する
+// setup でVUごとのユーザーを作ってTOTPを登録し、各イテレーションで
+//   POST /auth/login（202とmfa_token）→ 認証アプリのコードを入力 → POST /auth/mfa/challenge（200とトークン）
+// TOTPはk6の中でRFC 6238のとおりに計算する（サーバーと時計が合っていること）
+// 同じコードは1回しか使えないため、使用済みのステップでは次のステップ（最大30秒）まで待つ
+// 同じIPから大量に送るため、サーバーは RATE_LIMIT=100000 などで起動する
+// リプレイの確認はVUごとに1回だけ行う（誤ったコードはIPごとのログインの失敗として数えられ、LOCKOUT_IP_THRESHOLD でロックされる）
+export const options: Options = {
+  scenarios: {
+    mfa_login: {
+      executor: 'ramping-vus',
+      stages: [
+        { duration: '30s', target: 10 },
+        { duration: '2m', target: 10 },
+        { duration: '30s', target: 0 },
+      ],
+    },
+  },
+  thresholds: {
+    'http_req_duration{name:login}': ['p(95)<500'],
+    'http_req_duration{name:mfaChallenge}': ['p(95)<500'],
+    mfa_login_duration: ['p(95)<1000'],
+    checks: ['rate>0.99'],
+  },
+};
+
+const BASE_URL = __ENV.API_URL || 'http://localhost:8080';
+const USERS = Number(__ENV.MFA_USERS || '10'); // 登録するユーザー数（VUの最大数以上）
+const THINK_TIME = Number(__ENV.MFA_THINK_TIME || '2'); // コードを入力するまでの秒数
+const PERIOD = 30;
+
+const recoveryLogins = new Counter('mfa_recovery_logins');
+const loginDuration = new Trend('mfa_login_duration', true); // 2段階の合計（入力の待ち時間を除く）
+
+const JSON_HEADERS = { 'Content-Type': 'application/json' };
+
+interface MFAUser {
+  email: string;
+  secret: string;
+  recoveryCodes: string[];
+  // enrolledStep: 有効化に使った時間ステップ（使用済み）
+  enrolledStep: number;
+}
+
+// base32Decode はTOTPの共有鍵（RFC 4648、パディングなし）をバイト列にする
+function base32Decode(secret: string): ArrayBuffer {
+  const alphabet = 'ABCDEFGHIJKLMNOPQRSTUVWXYZ234567';
+  const bytes: number[] = [];
+  let bits = 0;
+  let value = 0;
+  for (const c of secret.replace(/=+$/, '').toUpperCase()) {
+    value = (value << 5) | alphabet.indexOf(c);
+    bits += 5;
+    if (bits >= 8) {
+      bytes.push((value >>> (bits - 8)) & 0xff);
+      bits -= 8;
+    }
+  }
+  return new Uint8Array(bytes).buffer;
+}
+
+// totp は時間ステップ step のコード（HMAC-SHA1、6桁）
+function totp(secret: string, step: number): string {
+  const counter = new Uint8Array(8);
+  let n = step;
+  for (let i = 7; i >= 0; i--) {
+    counter[i] = n & 0xff;
+    n = Math.floor(n / 256);
+  }
+  const hex = crypto.hmac('sha1', base32Decode(secret), counter.buffer, 'hex');
+  const offset = parseInt(hex.slice(-1), 16);
+  const value = parseInt(hex.slice(offset * 2, offset * 2 + 8), 16) & 0x7fffffff;
+  return String(value % 1000000).padStart(6, '0');
+}
+
+function currentStep(): number {
+  return Math.floor(Date.now() / 1000 / PERIOD);
+}
+
+function login(email: string) {
+  return http.post(`${BASE_URL}/v2/auth/login`, JSON.stringify({ email, password: 'password' }), {
+    headers: JSON_HEADERS,
+    tags: { name: 'login' },
+  });
+}
+
+function challenge(token: string, code: string) {
+  return http.post(`${BASE_URL}/v2/auth/mfa/challenge`, JSON.stringify({ mfa_token: token, code }), {
+    headers: JSON_HEADERS,
+    tags: { name: 'mfaChallenge' },
+  });
+}
+
+export function setup(): MFAUser[] {
+  const run = Date.now();
+  const users: MFAUser[] = [];
+  for (let i = 1; i <= USERS; i++) {
+    const email = `mfa${i}.${run}@example.com`;
+    const created = http.post(`${BASE_URL}/v2/users`, JSON.stringify({ first_name: `MFA${i}`, email }), {
+      headers: JSON_HEADERS,
+    });
+    check(created, { 'setup: user created': (r) => r.status === 201 });
+
+    const tokens = login(email).json() as { access_token: string };
+    const auth = { ...JSON_HEADERS, Authorization: `Bearer ${tokens.access_token}` };
+    const enrolled = http.post(`${BASE_URL}/v2/auth/mfa/enroll`, null, { headers: auth });
+    const secret = (enrolled.json() as { secret: string }).secret;
+
+    const step = currentStep();
+    const verified = http.post(`${BASE_URL}/v2/auth/mfa/verify`, JSON.stringify({ code: totp(secret, step) }), {
+      headers: auth,
+    });
+    check(verified, { 'setup: mfa enabled': (r) => r.status === 200 });
+    users.push({
+      email,
+      secret,
+      recoveryCodes: (verified.json() as { recovery_codes: string[] }).recovery_codes,
+      enrolledStep: step,
+    });
+  }
+  return users;
+}
+
+// lastStep はVUが最後に使った時間ステップ
+let lastStep = 0;
+
+export default function (users: MFAUser[]): void {
+  const user = users[(__VU - 1) % users.length];
+  lastStep = Math.max(lastStep, user.enrolledStep);
+
+  // 1段階目: パスワード
+  const start = Date.now();
+  const first = login(user.email);
+  check(first, {
+    'login: status is 202': (r) => r.status === 202,
+    'login: mfa required': (r) => r.json('mfa_required') === true,
+  });
+  if (first.status !== 202) {
+    return;
+  }
+  let elapsed = Date.now() - start;
+
+  // 2段階目: 最初のイテレーションだけリカバリーコードで、以降はTOTPでログインする
+  sleep(THINK_TIME);
+  const recovery = __ITER === 0 && user.recoveryCodes.length > 0;
+  let code: string;
+  if (recovery) {
+    code = user.recoveryCodes[0];
+    recoveryLogins.add(1);
+  } else {
+    // 使用済みのステップなら次のコードが表示されるまで待つ
+    while (currentStep() <= lastStep) {
+      sleep(PERIOD - ((Date.now() / 1000) % PERIOD) + 0.1);
+    }
+    lastStep = currentStep();
+    code = totp(user.secret, lastStep);
+  }
+  const second = challenge(first.json('mfa_token') as string, code);
+  elapsed += second.timings.duration;
+  check(second, {
+    'mfaChallenge: status is 200': (r) => r.status === 200,
+    'mfaChallenge: has access token': (r) => typeof r.json('access_token') === 'string',
+  });
+  loginDuration.add(elapsed);
+
+  // 同じコードは使えない（リプレイの拒否）
+  if (__ITER === 1) {
+    const replay = challenge(first.json('mfa_token') as string, code);
+    check(replay, { 'mfaChallenge: replayed code is rejected': (r) => r.status === 401 });
+  }
+
+  const me = http.get(`${BASE_URL}/v2/auth/me`, {
+    headers: { Authorization: `Bearer ${second.json('access_token')}` },
+    tags: { name: 'getMe' },
+  });
+  check(me, { 'getMe: status is 200': (r) => r.status === 200 });
+}
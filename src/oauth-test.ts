@@ -0,0 +1,191 @@
+import http from 'k6/http';
+import crypto from 'k6/crypto';
+import encoding from 'k6/encoding';
+import { check } from 'k6';
+import { Trend } from 'k6/metrics';
+import { Options } from 'k6/options';
+
+// OAuth 2.0 / OpenID Connect テスト: APIを負荷テスト用のIDプロバイダーとして使う
+//   service: クライアントクレデンシャルでトークンを取得し、イントロスペクションで検証する（サービス間の呼び出し）
+//   web: 認可コード + PKCE でログインし、UserInfo を呼んでからリフレッシュする（SPAのログイン）
+// サーバーは OAUTH_ENABLED=true で起動する（クライアントは OAUTH_CLIENTS の既定値）
+// 同じIPから大量に送るため、RATE_LIMIT=100000 などで起動する
+export const options: Options = {
+  scenarios: {
+    service: {
+      executor: 'constant-arrival-rate',
+      rate: 20,
+      timeUnit: '1s',
+      duration: '1m',
+      preAllocatedVUs: 10,
+      exec: 'service',
+    },
+    web: {
+      executor: 'ramping-vus',
+      stages: [
+        { duration: '15s', target: 10 },
+        { duration: '30s', target: 10 },
+        { duration: '15s', target: 0 },
+      ],
+      exec: 'web',
+    },
+  },
+  thresholds: {
+    'http_req_duration{name:token}': ['p(95)<500'],
+    'http_req_duration{name:introspect}': ['p(95)<300'],
+    'http_req_duration{name:userinfo}': ['p(95)<300'],
+    oauth_login_duration: ['p(95)<1000'],
+    checks: ['rate>0.99'],
+  },
+};
+
+const BASE_URL = __ENV.API_URL || 'http://localhost:8080';
+const SERVICE_ID = __ENV.OAUTH_SERVICE_ID || 'k6-service';
+const SERVICE_SECRET = __ENV.OAUTH_SERVICE_SECRET || 'k6-service-secret';
+const WEB_ID = __ENV.OAUTH_WEB_ID || 'k6-web';
+const REDIRECT_URI = __ENV.OAUTH_REDIRECT_URI || 'http://localhost:3000/callback';
+
+const loginDuration = new Trend('oauth_login_duration', true); // 認可からトークンの取得まで
+
+const FORM_HEADERS = { 'Content-Type': 'application/x-www-form-urlencoded' };
+const SERVICE_AUTH = { ...FORM_HEADERS, Authorization: `Basic ${encoding.b64encode(`${SERVICE_ID}:${SERVICE_SECRET}`)}` };
+
+function form(values: Record<string, string>): string {
+  return Object.entries(values)
+    .map(([k, v]) => `${encodeURIComponent(k)}=${encodeURIComponent(v)}`)
+    .join('&');
+}
+
+// queryParam はリダイレクト先（Location）のクエリパラメーター
+function queryParam(location: string, name: string): string {
+  const match = new RegExp(`[?&]${name}=([^&]*)`).exec(location);
+  return match ? decodeURIComponent(match[1].replace(/\+/g, ' ')) : '';
+}
+
+function randomString(length: number): string {
+  return encoding.b64encode(crypto.randomBytes(length), 'rawurl');
+}
+
+export function setup(): void {
+  const res = http.get(`${BASE_URL}/.well-known/openid-configuration`);
+  check(res, {
+    'setup: discovery is available': (r) => r.status === 200,
+    'setup: PKCE S256 is supported': (r) => (r.json('code_challenge_methods_supported') as string[]).includes('S256'),
+  });
+}
+
+export function service(): void {
+  const token = http.post(`${BASE_URL}/oauth/token`, form({ grant_type: 'client_credentials', scope: 'users:read' }), {
+    headers: SERVICE_AUTH,
+    tags: { name: 'token' },
+  });
+  check(token, {
+    'token: status is 200': (r) => r.status === 200,
+    'token: no refresh token for a client': (r) => !('refresh_token' in (r.json() as object)),
+  });
+  if (token.status !== 200) {
+    return;
+  }
+
+  const introspect = http.post(`${BASE_URL}/oauth/introspect`, form({ token: token.json('access_token') as string }), {
+    headers: SERVICE_AUTH,
+    tags: { name: 'introspect' },
+  });
+  check(introspect, {
+    'introspect: token is active': (r) => r.json('active') === true,
+    'introspect: subject is the client': (r) => r.json('sub') === SERVICE_ID,
+  });
+}
+
+export function web(): void {
+  // ログイン画面の代わりに POST /auth/login のトークンでユーザーを示す
+  const session = http.post(
+    `${BASE_URL}/v2/auth/login`,
+    JSON.stringify({ email: 'alice@example.com', password: 'password' }),
+    { headers: { 'Content-Type': 'application/json' }, tags: { name: 'login' } },
+  );
+  if (!check(session, { 'login: status is 200': (r) => r.status === 200 })) {
+    return;
+  }
+
+  const start = Date.now();
+  const verifier = randomString(32);
+  const state = randomString(16);
+  const nonce = randomString(16);
+  const challenge = crypto.sha256(verifier, 'base64rawurl');
+  const authorize = http.get(
+    `${BASE_URL}/oauth/authorize?` +
+      form({
+        response_type: 'code',
+        client_id: WEB_ID,
+        redirect_uri: REDIRECT_URI,
+        scope: 'openid profile email',
+        state,
+        nonce,
+        code_challenge: challenge,
+        code_challenge_method: 'S256',
+      }),
+    {
+      headers: { Authorization: `Bearer ${session.json('access_token')}` },
+      redirects: 0,
+      tags: { name: 'authorize' },
+    },
+  );
+  const location = authorize.headers['Location'] || '';
+  check(authorize, {
+    'authorize: redirects with a code': (r) => r.status === 302 && queryParam(location, 'code') !== '',
+    'authorize: state is returned': () => queryParam(location, 'state') === state,
+  });
+
+  const token = http.post(
+    `${BASE_URL}/oauth/token`,
+    form({
+      grant_type: 'authorization_code',
+      client_id: WEB_ID,
+      code: queryParam(location, 'code'),
+      redirect_uri: REDIRECT_URI,
+      code_verifier: verifier,
+    }),
+    { headers: FORM_HEADERS, tags: { name: 'token' } },
+  );
+  check(token, {
+    'token: status is 200': (r) => r.status === 200,
+    'token: has an ID token': (r) => typeof r.json('id_token') === 'string',
+  });
+  if (token.status !== 200) {
+    return;
+  }
+  loginDuration.add(Date.now() - start);
+
+  const userinfo = http.get(`${BASE_URL}/oauth/userinfo`, {
+    headers: { Authorization: `Bearer ${token.json('access_token')}` },
+    tags: { name: 'userinfo' },
+  });
+  check(userinfo, {
+    'userinfo: status is 200': (r) => r.status === 200,
+    'userinfo: email claim': (r) => r.json('email') === 'alice@example.com',
+  });
+
+  // リフレッシュトークンは使うたびに発行し直され、古いものは使えない
+  const refreshToken = token.json('refresh_token') as string;
+  const refreshed = http.post(
+    `${BASE_URL}/oauth/token`,
+    form({ grant_type: 'refresh_token', client_id: WEB_ID, refresh_token: refreshToken }),
+    { headers: FORM_HEADERS, tags: { name: 'token' } },
+  );
+  check(refreshed, { 'refresh: status is 200': (r) => r.status === 200 });
+  const reused = http.post(
+    `${BASE_URL}/oauth/token`,
+    form({ grant_type: 'refresh_token', client_id: WEB_ID, refresh_token: refreshToken }),
+    { headers: FORM_HEADERS, tags: { name: 'refreshReused' }, responseCallback: http.expectedStatuses(400) },
+  );
+  check(reused, { 'refresh: rotated token is rejected': (r) => r.json('error') === 'invalid_grant' });
+
+  // ログアウト: トークンを失効させる
+  const revoke = http.post(
+    `${BASE_URL}/oauth/revoke`,
+    form({ client_id: WEB_ID, token: refreshed.json('refresh_token') as string }),
+    { headers: FORM_HEADERS, tags: { name: 'revoke' } },
+  );
+  check(revoke, { 'revoke: status is 200': (r) => r.status === 200 });
+}
@@ -0,0 +1,44 @@
+import http from 'k6/http';
+import { check, sleep } from 'k6';
+import { Counter } from 'k6/metrics';
+import { Options } from 'k6/options';
+
+// プロトコル比較テスト: 同じAPIをHTTP/1.1・HTTP/2で計測して比較
+// TLS_SELF_SIGNED=true（HTTP/2）と HTTP2_ENABLED=false（HTTP/1.1）のサーバーに対して実行する
+// 例: API_URL=https://localhost:8080 k6 run dist/protocol-test.js
+// HTTP/3（HTTP3_ENABLED=true）はk6本体が未対応のため、xk6の拡張や curl --http3 で確認する
+export const options: Options = {
+  stages: [
+    { duration: '30s', target: 20 },
+    { duration: '1m', target: 20 },
+    { duration: '10s', target: 0 },
+  ],
+  insecureSkipTLSVerify: true, // 自己署名証明書を許可
+  thresholds: {
+    http_req_duration: ['p(95)<500'],
+    http_req_failed: ['rate<0.01'],
+  },
+};
+
+const BASE_URL = __ENV.API_URL || 'https://localhost:8080';
+
+// 応答したプロトコルごとのリクエスト数
+const protocols = new Counter('protocol_requests');
+
+export default function (): void {
+  const responses = http.batch([
+    ['GET', `${BASE_URL}/health`],
+    ['GET', `${BASE_URL}/v2/users`],
+    ['GET', `${BASE_URL}/v2/users/1`],
+    ['GET', `${BASE_URL}/delay/50`],
+  ]);
+
+  for (const res of responses) {
+    protocols.add(1, { proto: res.proto });
+    check(res, {
+      'status is 200': (r) => r.status === 200,
+    });
+  }
+
+  sleep(0.5);
+}
@@ -1,8 +1,12 @@
 import http from 'k6/http';
 import { check, sleep } from 'k6';
+import { Rate } from 'k6/metrics';
 import { Options } from 'k6/options';
 
 // ストレステスト: 段階的に負荷を増加させて限界を特定
+// 限界を超えるとサーバーは同時実行数の制限で匿名のリクエストから503（Retry-After付き）を返す
+// 応答時間が伸び続けて全体が落ちるのではなく、503の割合が増えて段階的に劣化することを確認する
+// 同じIPから大量に送るため、サーバーは RATE_LIMIT=100000 などで起動する
 export const options: Options = {
   stages: [
     { duration: '2m', target: 10 },   // ウォームアップ
@@ -14,10 +18,24 @@ export const options: Options = {
   ],
   thresholds: {
     http_req_duration: ['p(95)<1000'], // ストレス時は1秒まで許容
-    http_req_failed: ['rate<0.05'],    // エラー率5%未満
+    http_req_failed: ['rate<0.2'],     // 負荷制限の503を含む
+    load_shed: ['rate<0.2'],           // 負荷制限で断られた割合
   },
 };
 
+const loadShed = new Rate('load_shed');
+
+// 負荷制限の503は失敗として数えるが、他のエラーとは分けて記録する
+function shed(res: http.RefinedResponse<http.ResponseType | undefined>): boolean {
+  const isShed = res.status === 503 && res.headers['Retry-After'] !== undefined;
+  loadShed.add(isShed);
+  if (isShed) {
+    // 断るときは待たせずにすぐ返す
+    check(res, { 'shed: response time < 100ms': (r) => r.timings.duration < 100 });
+  }
+  return isShed;
+}
+
 const BASE_URL = __ENV.API_URL || 'http://localhost:8080';
 
 export default function (): void {
@@ -27,21 +45,24 @@ export default function (): void {
     JSON.stringify({ name: `user_${Date.now()}`, email: `test_${Date.now()}@example.com` }),
     { headers: { 'Content-Type': 'application/json' } }
   );
+  const createShed = shed(createRes);
   check(createRes, {
-    'create: status is 201': (r) => r.status === 201,
+    'create: status is 201 or shed': (r) => r.status === 201 || createShed,
     'create: response time < 1000ms': (r) => r.timings.duration < 1000,
   });
 
   // ユーザー一覧取得
   const listRes = http.get(`${BASE_URL}/users`);
+  const listShed = shed(listRes);
   check(listRes, {
-    'list: status is 200': (r) => r.status === 200,
+    'list: status is 200 or shed': (r) => r.status === 200 || listShed,
   });
 
   // 遅延エンドポイント（負荷テスト用）
   const delayRes = http.get(`${BASE_URL}/delay/50`);
+  const delayShed = shed(delayRes);
   check(delayRes, {
-    'delay: status is 200': (r) => r.status === 200,
+    'delay: status is 200 or shed': (r) => r.status === 200 || delayShed,
   });
 
   sleep(Math.random() * 2 + 1); // 1-3秒のランダムスリープ
@@ -0,0 +1,49 @@
+import http from 'k6/http';
+import { check, sleep } from 'k6';
+import { Options } from 'k6/options';
+
+// タイムアウトテスト: クライアントが待ちきれずに切断したリクエストをサーバーが打ち切れるかを確認
+// abandon はk6側のタイムアウト（CLIENT_TIMEOUT）より長い遅延を要求して切断する
+// deadline はサーバー側の上限（DELAY_TIMEOUT）より長い遅延を要求して504を受け取る
+// 終了後に /metrics の timeouts（abandoned・timed_out）とgoroutine数の推移を確認する
+// サーバーは DELAY_TIMEOUT=1s RATE_LIMIT=100000 などで起動する
+export const options: Options = {
+  scenarios: {
+    abandon: {
+      executor: 'ramping-vus',
+      stages: [
+        { duration: '10s', target: 100 },
+        { duration: '1m', target: 100 },
+        { duration: '10s', target: 0 },
+      ],
+      exec: 'abandon',
+    },
+    deadline: {
+      executor: 'constant-vus',
+      vus: 10,
+      duration: '1m',
+      exec: 'deadline',
+    },
+  },
+  thresholds: {
+    checks: ['rate>0.99'],
+  },
+};
+
+const BASE_URL = __ENV.API_URL || 'http://localhost:8080';
+const CLIENT_TIMEOUT = __ENV.CLIENT_TIMEOUT || '500ms';
+
+export function abandon(): void {
+  // 5秒の遅延を待たずに切断する（サーバーはここで待つのをやめる）
+  const res = http.get(`${BASE_URL}/delay/5000`, { timeout: CLIENT_TIMEOUT, tags: { name: 'delay' } });
+  check(res, { 'abandon: client timed out': (r) => r.status === 0 });
+}
+
+export function deadline(): void {
+  const res = http.get(`${BASE_URL}/delay/5000`, { tags: { name: 'delay' } });
+  check(res, {
+    'deadline: status is 504': (r) => r.status === 504,
+    'deadline: responded before the delay': (r) => r.timings.duration < 5000,
+  });
+  sleep(0.5);
+}
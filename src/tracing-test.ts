@@ -0,0 +1,41 @@
+import http from 'k6/http';
+import { check, sleep } from 'k6';
+import { instrumentHTTP } from 'k6/experimental/tracing';
+import { Options } from 'k6/options';
+
+// トレーステスト: k6のリクエストに W3C traceparent を付け、APIのスパンがk6のトレースに続くことを確認
+// サーバーはエクスポーターを指定して起動する（例）
+//   OTEL_TRACES_EXPORTER=otlp OTEL_EXPORTER_OTLP_ENDPOINT=http://localhost:4318 RATE_LIMIT=100000（Jaegerなどのコレクター）
+//   OTEL_TRACES_EXPORTER=stdout（標準出力にスパンを出す）
+// TRACING_MIDDLEWARE_SPANS=true でミドルウェアごとの子スパンも記録する
+// アクセスログの trace_id で、遅いリクエストのトレースを探せる
+instrumentHTTP({ propagator: 'w3c' });
+
+export const options: Options = {
+  stages: [
+    { duration: '10s', target: 20 },
+    { duration: '30s', target: 20 },
+    { duration: '10s', target: 0 },
+  ],
+  thresholds: {
+    http_req_failed: ['rate<0.01'],
+    checks: ['rate>0.99'],
+  },
+};
+
+const BASE_URL = __ENV.API_URL || 'http://localhost:8080';
+
+export default function (): void {
+  const id = Math.floor(Math.random() * 3) + 1;
+  const res = http.get(`${BASE_URL}/v2/users/${id}`, { tags: { name: 'getUser' } });
+  check(res, { 'getUser: status is 200': (r) => r.status === 200 });
+
+  const login = http.post(
+    `${BASE_URL}/v2/auth/login`,
+    JSON.stringify({ email: 'alice@example.com', password: 'password' }),
+    { headers: { 'Content-Type': 'application/json' }, tags: { name: 'login' } },
+  );
+  check(login, { 'login: status is 200': (r) => r.status === 200 });
+
+  sleep(0.5);
+}
@@ -0,0 +1,79 @@
+import http from 'k6/http';
+import { check, sleep } from 'k6';
+import { Counter, Trend } from 'k6/metrics';
+import { Options } from 'k6/options';
+
+// 上流障害テスト: ユーザー詳細が呼び出す上流が失敗・遅延したときに、障害が波及するかを確認
+// サーバーは自身の /v2/error-rate や /v2/delay を上流として起動する（例）
+//   UPSTREAM_URL=http://localhost:8080 UPSTREAM_PATH=/v2/error-rate/50 RATE_LIMIT=100000
+//   UPSTREAM_PATH=/v2/delay/2000 UPSTREAM_TIMEOUT=200ms（遅い上流）
+// UPSTREAM_REQUIRED=true で失敗を502/503/504として返し、false（既定）では上流なしで縮退して200を返す
+// UPSTREAM_BREAKER_THRESHOLD=0（ブレーカーなし）と比較し、ブレーカーが開くと応答時間が下がることを確認する
+// 実行中のブレーカーの状態は管理用APIの GET /admin/upstream、呼び出し・再試行の件数は /metrics の upstream で確認する
+// ブレーカーの状態を記録するには ADMIN_ENABLED=true ADMIN_TOKEN=secret で起動し、k6 に ADMIN_TOKEN=secret を渡す
+// （開始時に POST /admin/upstream/reset で前回のテストで開いたブレーカーを閉じる）
+export const options: Options = {
+  scenarios: {
+    users: {
+      executor: 'ramping-vus',
+      stages: [
+        { duration: '10s', target: 50 },
+        { duration: '1m', target: 50 },
+        { duration: '10s', target: 0 },
+      ],
+      exec: 'users',
+    },
+    breaker: {
+      executor: 'constant-arrival-rate',
+      rate: 1,
+      timeUnit: '1s',
+      duration: '1m20s',
+      preAllocatedVUs: 1,
+      exec: 'breaker',
+    },
+  },
+  thresholds: {
+    'http_req_duration{name:getUser}': ['p(95)<1000'],
+    checks: ['rate>0.99'],
+  },
+};
+
+const BASE_URL = __ENV.API_URL || 'http://localhost:8080';
+const ADMIN_URL = __ENV.ADMIN_URL || 'http://127.0.0.1:6060';
+const ADMIN_TOKEN = __ENV.ADMIN_TOKEN || '';
+const ADMIN_PARAMS = { headers: { Authorization: `Bearer ${ADMIN_TOKEN}` } };
+
+const fallbacks = new Counter('upstream_fallbacks');
+const breakerOpen = new Trend('upstream_breaker_open');
+
+export function setup(): void {
+  if (ADMIN_TOKEN) {
+    const res = http.post(`${ADMIN_URL}/admin/upstream/reset`, null, ADMIN_PARAMS);
+    check(res, { 'setup: breaker is reset': (r) => r.json('state') === 'closed' });
+  }
+}
+
+export function users(): void {
+  const id = Math.floor(Math.random() * 3) + 1;
+  const res = http.get(`${BASE_URL}/v2/users/${id}`, { tags: { name: 'getUser' } });
+  if (res.headers['X-Upstream-Status'] === 'fallback') {
+    fallbacks.add(1);
+  }
+  check(res, {
+    // 縮退時は200、UPSTREAM_REQUIRED=true では上流の失敗がそのまま返る
+    'getUser: status is 200 or upstream error': (r) => [200, 502, 503, 504].includes(r.status),
+    'getUser: open breaker has Retry-After': (r) => r.status !== 503 || r.headers['Retry-After'] !== undefined,
+  });
+  sleep(0.1);
+}
+
+export function breaker(): void {
+  if (!ADMIN_TOKEN) {
+    return;
+  }
+  const res = http.get(`${ADMIN_URL}/admin/upstream`, { ...ADMIN_PARAMS, tags: { name: 'upstream' } });
+  check(res, { 'upstream: status is 200': (r) => r.status === 200 });
+  if (res.status === 200) {
+    breakerOpen.add(res.json('state') === 'open' ? 1 : 0);
+  }
+}
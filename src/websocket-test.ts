@@ -0,0 +1,48 @@
+import ws from 'k6/ws';
+import { check } from 'k6';
+import { Trend } from 'k6/metrics';
+import { Options } from 'k6/options';
+
+// WebSocketテスト: 長時間接続をどれだけ同時に維持できるかを確認
+// 各VUが1本の接続を保持し、サーバー生成メッセージの遅延とエコーを計測する
+export const options: Options = {
+  stages: [
+    { duration: '1m', target: 200 },  // 1分で200接続まで増加
+    { duration: '3m', target: 200 },  // 3分間200接続を維持
+    { duration: '30s', target: 0 },   // 切断
+  ],
+  thresholds: {
+    ws_connecting: ['p(95)<1000'],        // 95%の接続確立が1秒以下
+    ws_message_latency: ['p(95)<200'],    // 生成メッセージの遅延
+    checks: ['rate>0.99'],
+  },
+};
+
+const WS_URL = (__ENV.API_URL || 'http://localhost:8080').replace(/^http/, 'ws');
+const RATE = __ENV.WS_RATE || '5';    // 生成メッセージ数（件/秒）
+const SIZE = __ENV.WS_SIZE || '256';  // 生成メッセージのペイロード（バイト）
+const HOLD_MS = 30000;                // 1接続を保持する時間
+
+const messageLatency = new Trend('ws_message_latency', true);
+
+export default function (): void {
+  const res = ws.connect(`${WS_URL}/ws/echo?rate=${RATE}&size=${SIZE}`, {}, (socket) => {
+    socket.on('open', () => {
+      // 接続中は定期的にエコーも確認する
+      socket.setInterval(() => socket.send('echo'), 1000);
+      socket.setTimeout(() => socket.close(), HOLD_MS);
+    });
+
+    socket.on('message', (data: string) => {
+      if (data === 'echo') {
+        return;
+      }
+      const msg = JSON.parse(data) as { sent_at: string };
+      messageLatency.add(Date.now() - Date.parse(msg.sent_at));
+    });
+  });
+
+  check(res, {
+    'ws: status is 101': (r) => r && r.status === 101,
+  });
+}